@@ -0,0 +1,9 @@
+// Command mqtt-benchmark-subscriber measures the latency and throughput of the messages sent through an
+// MQTT broker by mqtt-benchmark-publisher, see the README for its flags
+package main
+
+import "github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/pkg/subscriber"
+
+func main() {
+	subscriber.Main()
+}
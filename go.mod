@@ -1,9 +1,11 @@
 module github.com/TNO-SlaFleur/mqtt-benchmark-subscriber
 
-go 1.13
+go 1.22
 
 require (
 	github.com/GaryBoone/GoStats v0.0.0-20130122001700-1993eafbef57
 	github.com/eclipse/paho.mqtt.golang v1.2.0
-	golang.org/x/net v0.0.0-20191011234655-491137f69257 // indirect
+	github.com/klauspost/compress v1.18.0
+	github.com/lib/pq v1.10.9
+	golang.org/x/net v0.0.0-20191011234655-491137f69257
 )
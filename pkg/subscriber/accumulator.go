@@ -0,0 +1,197 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// accumulator collects the measurements of a single client. It is updated directly from the message
+// handler, which paho calls for one message at a time, and read by Run once done is closed. The handler
+// holds mu while it records a message, so the accumulator can be stopped and the samples received so
+// far can be read (see snapshot) while messages arrive. The latencies are summarized as they arrive, so
+// its memory does not grow with the count unless the raw latencies are kept.
+type accumulator struct {
+	mu           sync.Mutex
+	limit        int64 // messages to receive, 0 to receive until stopped
+	stats        *latencyStats
+	latencies    []float64 // only kept for the raw latencies
+	receivedAt   []int64   // only kept for the raw samples
+	perSecond    map[int64]int64
+	received     int64
+	bytes        int64 // payload bytes of the received messages
+	decompressed int64 // payload bytes of the received messages after decompression, see record
+	warmup       int64
+	started      time.Time
+	finished     time.Time
+	interrupted  time.Duration // between started and finished, while a resumed run was interrupted
+	err          error         // why the client failed, set before done is closed
+	done         chan struct{}
+	cooldown     bool // start cooling down once done
+	coolingDown  bool // until Run ends the cooldown, the messages received meanwhile are late arrivals
+}
+
+// newAccumulator creates an accumulator that is done once count messages were received, or when
+// stopped if count is 0. It keeps the raw latencies if keepLatencies is set and their receive times
+// as well if keepReceivedAt is set.
+func newAccumulator(count int64, keepLatencies, keepReceivedAt bool) *accumulator {
+	a := &accumulator{
+		limit:     count,
+		stats:     newLatencyStats(),
+		perSecond: make(map[int64]int64),
+		done:      make(chan struct{}),
+	}
+	if keepLatencies || keepReceivedAt {
+		a.latencies = make([]float64, 0, count)
+	}
+	if keepReceivedAt {
+		a.receivedAt = make([]int64, 0, count)
+	}
+
+	return a
+}
+
+// add records the latency of a message with a payload of size bytes received at receivedAt (unix
+// nanoseconds), it returns true once count messages were received. The caller must hold mu.
+func (a *accumulator) add(latency float64, receivedAt, size int64) bool {
+	if a.received == 0 {
+		a.started = time.Now()
+	}
+	a.stats.add(latency)
+	if a.latencies != nil {
+		a.latencies = append(a.latencies, latency)
+	}
+	if a.receivedAt != nil {
+		a.receivedAt = append(a.receivedAt, receivedAt)
+	}
+	a.perSecond[receivedAt/int64(time.Second)]++
+	a.received++
+	a.bytes += size
+	if a.limit == 0 || a.received < a.limit {
+		return false
+	}
+
+	a.finish(time.Now())
+
+	return true
+}
+
+// finish ends the measurement at at and starts the cooldown in the same locked section, so no message in
+// between looks like one too many
+func (a *accumulator) finish(at time.Time) {
+	a.finished = at
+	if a.received == 0 {
+		a.started = at
+	}
+	a.coolingDown = a.cooldown
+	close(a.done)
+}
+
+// stop ends the measurement before all messages were received, it returns false if it was already done
+func (a *accumulator) stop() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.completed() {
+		return false
+	}
+	a.finish(time.Now())
+
+	return true
+}
+
+// fail ends the measurement because the client failed with err, it returns false if it was already done
+func (a *accumulator) fail(err error) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.completed() {
+		return false
+	}
+	a.err = err
+	a.finish(time.Now())
+
+	return true
+}
+
+// snapshot returns copies of the receive times and latencies of the samples received so far, it may be
+// called while the accumulator is updated but only if the receive times are kept
+func (a *accumulator) snapshot() ([]int64, []float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]int64(nil), a.receivedAt...), append([]float64(nil), a.latencies...)
+}
+
+// restore loads the samples of an earlier run before any message is received, the run was interrupted for
+// interrupted after its last checkpoint
+func (a *accumulator) restore(receivedAt []int64, latencies []float64, interrupted time.Duration) {
+	n := int64(len(latencies))
+	if a.limit > 0 && n > a.limit {
+		n = a.limit
+	}
+	if n == 0 {
+		return
+	}
+	for _, latency := range latencies[:n] {
+		a.stats.add(latency)
+	}
+	if a.latencies != nil {
+		a.latencies = append(a.latencies, latencies[:n]...)
+	}
+	if a.receivedAt != nil {
+		a.receivedAt = append(a.receivedAt, receivedAt[:n]...)
+	}
+	for _, t := range receivedAt[:n] {
+		a.perSecond[t/int64(time.Second)]++
+	}
+	a.received = n
+	a.started = time.Unix(0, receivedAt[0])
+	if n == a.limit {
+		// done before it was interrupted
+		a.finish(time.Unix(0, receivedAt[n-1]))
+		return
+	}
+	a.interrupted = interrupted
+}
+
+// completed reports whether all messages were received, the accumulator must not be updated anymore
+func (a *accumulator) completed() bool {
+	select {
+	case <-a.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// measured returns the time from the start to the end of the measurement, without the interruption of a
+// resumed run
+func (a *accumulator) measured() time.Duration {
+	return a.finished.Sub(a.started) - a.interrupted
+}
+
+// summarize sets the latency and throughput results of res from the statistics of the latencies (in
+// nanoseconds) and per second counts of messages received over duration
+func summarize(res *results.RunResults, latencies *latencyStats, perSecond map[int64]int64, duration time.Duration) {
+	res.Successes = latencies.count
+	res.PerSecond = perSecond
+	res.Histogram = latencies.histogram
+	// a client stopped by -duration may not have received anything
+	if res.Successes == 0 {
+		return
+	}
+	res.MsgTimeMin = latencies.min
+	res.MsgTimeMax = latencies.max
+	res.MsgTimeMean = latencies.mean
+	res.MsgTimeStd = latencies.std()
+	res.RunTime = duration.Seconds()
+	res.RateCV = rateCV(perSecond)
+	// a single message, e.g. the last one of a resumed run, is received in no time: the rates are undefined
+	// (and +Inf can't be written as JSON)
+	if duration <= 0 {
+		return
+	}
+	res.MsgsPerSec = float64(res.Successes) / duration.Seconds()
+	// Little's Law: the average number of messages in flight is the arrival rate times the mean latency
+	res.QueueDepth = res.MsgsPerSec * res.MsgTimeMean / float64(time.Second)
+}
@@ -0,0 +1,52 @@
+package subscriber
+
+import (
+	"math"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// pooledLatency returns the mean and sample standard deviation of the latencies of all messages of all clients,
+// combined from the per-client means and standard deviations so every message weighs the same
+func pooledLatency(runs []*results.RunResults) (mean, std float64) {
+	var n int64
+	var sum float64
+	for _, res := range runs {
+		n += res.Successes
+		sum += res.MsgTimeMean * float64(res.Successes)
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	mean = sum / float64(n)
+	if n < 2 {
+		return mean, 0
+	}
+
+	// sum of squared deviations: within each client plus between the client means and the overall mean
+	var squares float64
+	for _, res := range runs {
+		deviation := res.MsgTimeMean - mean
+		squares += float64(res.Successes-1)*res.MsgTimeStd*res.MsgTimeStd + float64(res.Successes)*deviation*deviation
+	}
+
+	return mean, math.Sqrt(squares / float64(n-1))
+}
+
+// measurementWindow returns the time from the first measured message of any client up to the last measured
+// message of any client, in unix nanoseconds
+func measurementWindow(runs []*results.RunResults) (from, to int64) {
+	for _, res := range runs {
+		if res.MeasuredFrom == 0 {
+			continue
+		}
+		if from == 0 || res.MeasuredFrom < from {
+			from = res.MeasuredFrom
+		}
+		if res.MeasuredTo > to {
+			to = res.MeasuredTo
+		}
+	}
+
+	return from, to
+}
@@ -0,0 +1,108 @@
+package subscriber
+
+import (
+	"sort"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// maxAnomalies bounds the number of anomalies kept per client and in the totals, all are counted
+const maxAnomalies = 1000
+
+// anomalyDetector flags the messages of a client whose latency exceeds factor times the median latency of
+// the preceding window messages. It is only used by the message handler.
+type anomalyDetector struct {
+	factor float64
+	size   int
+
+	window []float64 // last latencies in arrival order (ring buffer)
+	sorted []float64 // the same latencies sorted
+	next   int
+
+	anomalies []*results.LatencyAnomaly
+	count     int64
+}
+
+func newAnomalyDetector(factor float64, size int) *anomalyDetector {
+	return &anomalyDetector{
+		factor: factor,
+		size:   size,
+	}
+}
+
+// observe checks the latency (in nanoseconds) of message m received by client against the rolling median
+func (d *anomalyDetector) observe(client int, m *Message, latency float64) {
+	// only flag once the window is full, so the median is meaningful
+	if len(d.window) == d.size {
+		median := d.sorted[len(d.sorted)/2]
+		if median > 0 && latency > d.factor*median {
+			d.count++
+			if len(d.anomalies) < maxAnomalies {
+				d.anomalies = append(d.anomalies, &results.LatencyAnomaly{
+					ReceivedAt: m.ReceivedAt,
+					Client:     client,
+					Publisher:  m.Payload.ClientId,
+					MessageID:  m.Payload.MessageId,
+					Latency:    latency,
+					Median:     median,
+				})
+			}
+		}
+	}
+	d.push(latency)
+}
+
+// push adds a latency to the window, replacing the oldest one once it is full
+func (d *anomalyDetector) push(latency float64) {
+	if len(d.window) < d.size {
+		d.window = append(d.window, latency)
+	} else {
+		oldest := d.window[d.next]
+		d.window[d.next] = latency
+		d.next = (d.next + 1) % d.size
+		i := sort.SearchFloat64s(d.sorted, oldest)
+		d.sorted = append(d.sorted[:i], d.sorted[i+1:]...)
+	}
+	i := sort.SearchFloat64s(d.sorted, latency)
+	d.sorted = append(d.sorted, 0)
+	copy(d.sorted[i+1:], d.sorted[i:])
+	d.sorted[i] = latency
+}
+
+// results returns the anomalies of the client, nil if there were none
+func (d *anomalyDetector) results() *results.AnomalyResults {
+	if d == nil || d.count == 0 {
+		return nil
+	}
+
+	return &results.AnomalyResults{
+		Count:     d.count,
+		Anomalies: d.anomalies,
+	}
+}
+
+// calculateAnomalyTotals lists the anomalies of all clients in the order they were received
+func calculateAnomalyTotals(runs []*results.RunResults) *results.AnomalyResults {
+	var totals *results.AnomalyResults
+	for _, res := range runs {
+		if res.Anomalies == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.AnomalyResults)
+		}
+		totals.Count += res.Anomalies.Count
+		totals.Anomalies = append(totals.Anomalies, res.Anomalies.Anomalies...)
+	}
+	if totals == nil {
+		return nil
+	}
+	sort.Slice(totals.Anomalies, func(i, j int) bool {
+		return totals.Anomalies[i].ReceivedAt < totals.Anomalies[j].ReceivedAt
+	})
+	if len(totals.Anomalies) > maxAnomalies {
+		totals.Anomalies = totals.Anomalies[:maxAnomalies]
+	}
+
+	return totals
+}
@@ -0,0 +1,74 @@
+package subscriber
+
+import (
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// calculateApdex classifies latencies (in nanoseconds) as satisfied (<= satisfied), tolerating (<= tolerating)
+// or frustrated and computes the Apdex score
+func calculateApdex(latencies []float64, satisfied, tolerating time.Duration) *results.ApdexResults {
+	res := new(results.ApdexResults)
+	for _, latency := range latencies {
+		switch {
+		case latency <= float64(satisfied):
+			res.Satisfied++
+		case latency <= float64(tolerating):
+			res.Tolerating++
+		default:
+			res.Frustrated++
+		}
+	}
+	apdexScore(res)
+
+	return res
+}
+
+// calculateHistogramApdex classifies the latencies counted in a latency histogram like calculateApdex, by the
+// highest latency of their bucket
+func calculateHistogramApdex(histogram map[int64]int64, satisfied, tolerating time.Duration) *results.ApdexResults {
+	res := new(results.ApdexResults)
+	for low, count := range histogram {
+		_, high := histogramBucket(low)
+		switch {
+		case high <= int64(satisfied):
+			res.Satisfied += count
+		case high <= int64(tolerating):
+			res.Tolerating += count
+		default:
+			res.Frustrated += count
+		}
+	}
+	apdexScore(res)
+
+	return res
+}
+
+// apdexScore sets the score of a from its counts
+func apdexScore(a *results.ApdexResults) {
+	total := a.Satisfied + a.Tolerating + a.Frustrated
+	if total > 0 {
+		a.Score = (float64(a.Satisfied) + float64(a.Tolerating)/2) / float64(total)
+	}
+}
+
+func calculateApdexTotals(runs []*results.RunResults) *results.ApdexResults {
+	var totals *results.ApdexResults
+	for _, res := range runs {
+		if res.Apdex == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.ApdexResults)
+		}
+		totals.Satisfied += res.Apdex.Satisfied
+		totals.Tolerating += res.Apdex.Tolerating
+		totals.Frustrated += res.Apdex.Frustrated
+	}
+	if totals != nil {
+		apdexScore(totals)
+	}
+
+	return totals
+}
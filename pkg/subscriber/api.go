@@ -0,0 +1,159 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// ClientProgress is the progress of a single client in a ProgressSnapshot
+type ClientProgress struct {
+	ID          int     `json:"id"`
+	Received    int64   `json:"received"`
+	Expected    int64   `json:"expected"`     // -count, 0 to receive until stopped
+	MsgsPerSec  float64 `json:"msgs_per_sec"` // in the last complete second
+	Disconnects int64   `json:"disconnects"`
+}
+
+// ProgressSnapshot is the progress of a run served on /progress, elapsed in seconds since the start
+type ProgressSnapshot struct {
+	State      string            `json:"state"` // running, stopping or done
+	Elapsed    float64           `json:"elapsed"`
+	Received   int64             `json:"received"`
+	MsgsPerSec float64           `json:"msgs_per_sec"`
+	Clients    []*ClientProgress `json:"clients"`
+}
+
+// controlAPI serves the progress of a run on GET /progress, stops it gracefully on POST /stop and serves
+// the results on GET /results once the run is done
+type controlAPI struct {
+	Clients []*Client
+
+	start    time.Time
+	stop     context.CancelFunc
+	stopping int32
+	mu       sync.Mutex
+	results  []byte // JSON results, once done
+	listener net.Listener
+	server   *http.Server
+}
+
+// newControlAPI listens on addr (e.g. :8080) for the given number of clients
+func newControlAPI(addr string, clients int) (*controlAPI, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	a := &controlAPI{
+		Clients:  make([]*Client, clients),
+		listener: listener,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/progress", a.serveProgress)
+	mux.HandleFunc("/stop", a.serveStop)
+	mux.HandleFunc("/results", a.serveResults)
+	a.server = &http.Server{Handler: mux}
+
+	return a, nil
+}
+
+// Start starts serving, stop stops the clients of the run started at start. The Clients must not be
+// changed anymore.
+func (a *controlAPI) Start(start time.Time, stop context.CancelFunc) {
+	a.start = start
+	a.stop = stop
+	go func() {
+		if err := a.server.Serve(a.listener); err != http.ErrServerClosed {
+			logf(levelError, "Error serving the control API: %v", err)
+		}
+	}()
+}
+
+// Close stops serving
+func (a *controlAPI) Close() error {
+	return a.server.Close()
+}
+
+// done sets the results served on /results
+func (a *controlAPI) done(jr *results.JSONResults) {
+	data, err := json.Marshal(jr)
+	if err != nil {
+		logf(levelError, "Error marshalling results: %v", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.results = data
+}
+
+func (a *controlAPI) finished() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.results
+}
+
+func (a *controlAPI) serveProgress(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	now := time.Now()
+	snapshot := &ProgressSnapshot{
+		State:   "running",
+		Elapsed: now.Sub(a.start).Seconds(),
+		Clients: make([]*ClientProgress, len(a.Clients)),
+	}
+	if a.finished() != nil {
+		snapshot.State = "done"
+	} else if atomic.LoadInt32(&a.stopping) == 1 {
+		snapshot.State = "stopping"
+	}
+	for i, c := range a.Clients {
+		metrics := c.metrics.snapshot(now)
+		snapshot.Clients[i] = &ClientProgress{
+			ID:          c.ID,
+			Received:    metrics.received,
+			Expected:    c.ReceiveCount,
+			MsgsPerSec:  metrics.rate,
+			Disconnects: atomic.LoadInt64(&c.disconnects),
+		}
+		snapshot.Received += metrics.received
+		snapshot.MsgsPerSec += metrics.rate
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(snapshot)
+}
+
+func (a *controlAPI) serveStop(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if atomic.CompareAndSwapInt32(&a.stopping, 0, 1) {
+		logf(levelInfo, "Stop requested by %v, stopping the clients", r.RemoteAddr)
+		a.stop()
+	}
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+func (a *controlAPI) serveResults(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data := a.finished()
+	if data == nil {
+		http.Error(rw, "the run is not done yet", http.StatusServiceUnavailable)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(data)
+}
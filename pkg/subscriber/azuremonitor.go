@@ -0,0 +1,124 @@
+package subscriber
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// AzureMonitorExporter publishes the key numbers of a run as Azure Monitor custom metrics of a resource,
+// authenticating with the service principal of the AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET
+// environment variables (which needs the Monitoring Metrics Publisher role on the resource)
+type AzureMonitorExporter struct {
+	ResourceID string
+	Region     string
+	Namespace  string
+
+	client http.Client
+}
+
+// azureMetric is the body of a custom metrics request
+type azureMetric struct {
+	Time string `json:"time"`
+	Data struct {
+		BaseData struct {
+			Metric    string              `json:"metric"`
+			Namespace string              `json:"namespace"`
+			DimNames  []string            `json:"dimNames,omitempty"`
+			Series    []azureMetricSeries `json:"series"`
+		} `json:"baseData"`
+	} `json:"data"`
+}
+
+type azureMetricSeries struct {
+	DimValues []string `json:"dimValues,omitempty"`
+	Min       float64  `json:"min"`
+	Max       float64  `json:"max"`
+	Sum       float64  `json:"sum"`
+	Count     int      `json:"count"`
+}
+
+// Export publishes every metric, dimensioned by the run id if set
+func (e *AzureMonitorExporter) Export(runID string, metrics []metric, timestamp time.Time) error {
+	e.client.Timeout = 30 * time.Second
+	token, err := e.token()
+	if err != nil {
+		return err
+	}
+
+	endpoint := "https://" + e.Region + ".monitoring.azure.com/" + strings.TrimPrefix(e.ResourceID, "/") + "/metrics"
+	for _, m := range metrics {
+		var body azureMetric
+		body.Time = timestamp.UTC().Format(time.RFC3339)
+		body.Data.BaseData.Metric = m.Name
+		body.Data.BaseData.Namespace = e.Namespace
+		series := azureMetricSeries{Min: m.Value, Max: m.Value, Sum: m.Value, Count: 1}
+		if runID != "" {
+			body.Data.BaseData.DimNames = []string{"RunId"}
+			series.DimValues = []string{runID}
+		}
+		body.Data.BaseData.Series = []azureMetricSeries{series}
+
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("publishing metric %v failed with %v: %s", m.Name, resp.Status, respBody)
+		}
+	}
+
+	return nil
+}
+
+// token requests an access token for Azure Monitor with the client credentials flow
+func (e *AzureMonitorExporter) token() (string, error) {
+	tenant := os.Getenv("AZURE_TENANT_ID")
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	secret := os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant == "" || clientID == "" || secret == "" {
+		return "", errors.New("AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET are required")
+	}
+
+	resp, err := e.client.PostForm("https://login.microsoftonline.com/"+url.PathEscape(tenant)+"/oauth2/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"resource":      {"https://monitoring.azure.com/"},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("requesting token failed with %v: %s", resp.Status, data)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
@@ -0,0 +1,117 @@
+package subscriber
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// comparedMetric is a metric of the totals compared with the baseline. Checked metrics regress when they got
+// worse by more than -max-regression-pct, the others are too noisy (max latency) or usually 0 in the baseline
+// (loss, duplicates), for which the absolute thresholds apply.
+type comparedMetric struct {
+	name           string
+	value          float64
+	higherIsBetter bool
+	checked        bool
+}
+
+// comparedMetrics returns the metrics of the totals that are compared with the baseline, latencies in
+// milliseconds
+func comparedMetrics(totals *results.TotalResults) []comparedMetric {
+	metrics := []comparedMetric{
+		{name: "msgs_per_sec", value: totals.TotalMsgsPerSec, higherIsBetter: true, checked: true},
+		{name: "latency_mean_ms", value: totals.MsgTimeMeanAvg / 1_000_000, checked: true},
+	}
+	for _, p := range totals.Percentiles {
+		metrics = append(metrics, comparedMetric{
+			name:    "latency_p" + strconv.FormatFloat(p.Percentile, 'f', -1, 64) + "_ms",
+			value:   p.Latency / 1_000_000,
+			checked: true,
+		})
+	}
+
+	return append(metrics,
+		comparedMetric{name: "latency_max_ms", value: totals.MsgTimeMax / 1_000_000},
+		comparedMetric{name: "loss_ratio", value: lossRatio(totals)},
+		comparedMetric{name: "lost", value: float64(totals.Lost)},
+		comparedMetric{name: "duplicate_deliveries", value: float64(totals.DuplicateDeliveries)},
+	)
+}
+
+// loadBaseline reads the JSON results of a previous run
+func loadBaseline(path string) (*results.JSONResults, error) {
+	var baseline results.JSONResults
+	if err := readJSONFile(path, &baseline); err != nil {
+		return nil, err
+	}
+	if baseline.Totals == nil {
+		return nil, fmt.Errorf("%v has no totals", path)
+	}
+
+	return &baseline, nil
+}
+
+// compareBaseline compares the totals of jr with those of the baseline read from file, metrics missing from
+// either (e.g. other -percentiles) are left out. maxRegression is in percent, 0 disables the check.
+func compareBaseline(baseline *results.JSONResults, file string, jr *results.JSONResults, maxRegression float64) *results.BaselineResults {
+	res := &results.BaselineResults{File: file, RunID: baseline.RunID}
+	previous := make(map[string]float64)
+	for _, m := range comparedMetrics(baseline.Totals) {
+		previous[m.name] = m.value
+	}
+	for _, m := range comparedMetrics(jr.Totals) {
+		before, ok := previous[m.name]
+		if !ok {
+			continue
+		}
+		metric := &results.BaselineMetric{
+			Metric:   m.name,
+			Baseline: before,
+			Current:  m.value,
+			Delta:    m.value - before,
+		}
+		res.Metrics = append(res.Metrics, metric)
+		if before == 0 {
+			continue
+		}
+		change := metric.Delta / math.Abs(before) * 100
+		metric.Change = &change
+
+		worse := change
+		if m.higherIsBetter {
+			worse = -change
+		}
+		if m.checked && maxRegression > 0 && worse > maxRegression {
+			res.Regressions = append(res.Regressions, &results.ThresholdFailure{
+				Threshold: "max_regression_pct",
+				Limit:     maxRegression,
+				Value:     worse,
+				Message: fmt.Sprintf("%s regressed by %.1f%% from %.3f to %.3f, more than %.1f%%",
+					m.name, worse, before, m.value, maxRegression),
+			})
+		}
+	}
+
+	return res
+}
+
+// checkRegressions adds the regressions of the baseline comparison to the verdict of the thresholds, with
+// -max-regression-pct a run is checked even if no other threshold is set
+func checkRegressions(thresholds *results.ThresholdResults, baseline *results.BaselineResults, maxRegression float64) *results.ThresholdResults {
+	if maxRegression <= 0 {
+		return thresholds
+	}
+	if thresholds == nil {
+		thresholds = &results.ThresholdResults{Passed: true}
+	}
+	thresholds.Checked = append(thresholds.Checked, "max_regression_pct")
+	if len(baseline.Regressions) > 0 {
+		thresholds.Passed = false
+		thresholds.Failures = append(thresholds.Failures, baseline.Regressions...)
+	}
+
+	return thresholds
+}
@@ -0,0 +1,58 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// splitBatch returns the records of a batched payload, a JSON array of records that each carry their own
+// GeneratedAt and MessageId (or the -timestamp-field and -message-id-field)
+func splitBatch(data []byte) ([][]byte, error) {
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty batch")
+	}
+	split := make([][]byte, len(records))
+	for i, record := range records {
+		split[i] = record
+	}
+
+	return split, nil
+}
+
+// batchCounter counts the batched messages of a client and the records in them
+type batchCounter struct {
+	batches int64
+	records int64
+}
+
+func (b *batchCounter) add(records int) {
+	atomic.AddInt64(&b.batches, 1)
+	atomic.AddInt64(&b.records, int64(records))
+}
+
+// results sets the batch counts of res
+func (b *batchCounter) results(res *results.RunResults) {
+	res.Batches = atomic.LoadInt64(&b.batches)
+	if res.Batches > 0 {
+		res.RecordsPerBatch = float64(atomic.LoadInt64(&b.records)) / float64(res.Batches)
+	}
+}
+
+// calculateBatchTotals sets the batch counts of the totals, weighing the clients by their batches
+func calculateBatchTotals(totals *results.TotalResults, runs []*results.RunResults) {
+	var records float64
+	for _, res := range runs {
+		totals.Batches += res.Batches
+		records += res.RecordsPerBatch * float64(res.Batches)
+	}
+	if totals.Batches > 0 {
+		totals.RecordsPerBatch = records / float64(totals.Batches)
+	}
+}
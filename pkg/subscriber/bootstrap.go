@@ -0,0 +1,43 @@
+package subscriber
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// bootstrapConfidence computes percentile bootstrap confidence intervals for the mean and p99 of latencies,
+// drawing the resamples from a source seeded with seed
+func bootstrapConfidence(latencies []float64, resamples int, level float64, seed int64) *results.ConfidenceResults {
+	if len(latencies) == 0 || resamples < 1 {
+		return nil
+	}
+	rnd := rand.New(rand.NewSource(seed))
+
+	means := make([]float64, resamples)
+	p99s := make([]float64, resamples)
+	sample := make([]float64, len(latencies))
+	for r := 0; r < resamples; r++ {
+		sum := 0.0
+		for i := range sample {
+			sample[i] = latencies[rnd.Intn(len(latencies))]
+			sum += sample[i]
+		}
+		sort.Float64s(sample)
+		means[r] = sum / float64(len(sample))
+		p99s[r] = quantile(sample, 0.99)
+	}
+	sort.Float64s(means)
+	sort.Float64s(p99s)
+
+	alpha := (1 - level) / 2
+	return &results.ConfidenceResults{
+		Level:     level,
+		Resamples: resamples,
+		MeanLow:   quantile(means, alpha),
+		MeanHigh:  quantile(means, 1-alpha),
+		P99Low:    quantile(p99s, alpha),
+		P99High:   quantile(p99s, 1-alpha),
+	}
+}
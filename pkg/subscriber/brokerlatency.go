@@ -0,0 +1,150 @@
+package subscriber
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// brokerTimestamp reads the time the broker or a bridge stamped a JSON payload with, by JSON pointer like
+// -timestamp-field: a number of -timestamp-unit since the Unix epoch or an RFC 3339 string
+type brokerTimestamp struct {
+	pointer []string
+	unit    time.Duration
+}
+
+func newBrokerTimestamp(field, unit string) (*brokerTimestamp, error) {
+	b := &brokerTimestamp{unit: timestampUnits[unit]}
+	if b.unit == 0 {
+		return nil, fmt.Errorf("invalid timestamp unit %v, expected ns, us, ms or s", unit)
+	}
+	var err error
+	if b.pointer, err = parseJSONPointer(field); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// decode returns the broker timestamp of a payload in unix nanoseconds, an error if it has none
+func (b *brokerTimestamp) decode(data []byte) (int64, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return 0, err
+	}
+	timestamp, err := resolveJSONPointer(doc, b.pointer)
+	if err != nil {
+		return 0, err
+	}
+
+	return jsonTimestamp(timestamp, b.unit)
+}
+
+// brokerLatencyTracker splits the latencies of the measured messages at their broker timestamp, as streaming
+// statistics like the latencies
+type brokerLatencyTracker struct {
+	inbound   *latencyStats // publisher to broker
+	outbound  *latencyStats // broker to subscriber
+	unstamped int64
+}
+
+func newBrokerLatencyTracker() *brokerLatencyTracker {
+	return &brokerLatencyTracker{inbound: newLatencyStats(), outbound: newLatencyStats()}
+}
+
+func (t *brokerLatencyTracker) received(m *Message) {
+	if m.BrokerAt == 0 {
+		t.unstamped++
+		return
+	}
+	t.inbound.add(float64(m.BrokerAt - m.Payload.GeneratedAt))
+	t.outbound.add(float64(m.ReceivedAt - m.BrokerAt))
+}
+
+// results returns nil if no message was measured
+func (t *brokerLatencyTracker) results() *results.BrokerLatencyResults {
+	if t.inbound.count == 0 && t.unstamped == 0 {
+		return nil
+	}
+	res := &results.BrokerLatencyResults{Samples: t.inbound.count, Unstamped: t.unstamped}
+	if t.inbound.count > 0 {
+		res.PublisherToBroker = latencyComponent(t.inbound)
+		res.BrokerToSubscriber = latencyComponent(t.outbound)
+	}
+
+	return res
+}
+
+func latencyComponent(s *latencyStats) *results.LatencyComponent {
+	return &results.LatencyComponent{
+		Min:       s.min,
+		Mean:      s.mean,
+		Std:       s.std(),
+		P50:       math.Min(histogramQuantile(s.histogram, 0.50), s.max),
+		P99:       math.Min(histogramQuantile(s.histogram, 0.99), s.max),
+		Max:       s.max,
+		Histogram: s.histogram,
+	}
+}
+
+// calculateBrokerLatencyTotals pools the latency components of all clients
+func calculateBrokerLatencyTotals(runs []*results.RunResults) *results.BrokerLatencyResults {
+	var totals *results.BrokerLatencyResults
+	var inbound, outbound *results.LatencyComponent
+	var inboundMoments, outboundMoments moments
+	for _, res := range runs {
+		b := res.BrokerLatency
+		if b == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.BrokerLatencyResults)
+		}
+		totals.Unstamped += b.Unstamped
+		if b.Samples == 0 {
+			continue
+		}
+		if inbound == nil {
+			inbound = &results.LatencyComponent{Min: b.PublisherToBroker.Min, Max: b.PublisherToBroker.Max, Histogram: make(map[int64]int64)}
+			outbound = &results.LatencyComponent{Min: b.BrokerToSubscriber.Min, Max: b.BrokerToSubscriber.Max, Histogram: make(map[int64]int64)}
+		}
+		totals.Samples += b.Samples
+		poolLatencyComponent(inbound, &inboundMoments, b.PublisherToBroker, b.Samples)
+		poolLatencyComponent(outbound, &outboundMoments, b.BrokerToSubscriber, b.Samples)
+	}
+	if inbound != nil {
+		totals.PublisherToBroker = pooledLatencyComponent(inbound, &inboundMoments)
+		totals.BrokerToSubscriber = pooledLatencyComponent(outbound, &outboundMoments)
+	}
+
+	return totals
+}
+
+// poolLatencyComponent adds the component of a client with count latencies to the pooled component
+func poolLatencyComponent(pooled *results.LatencyComponent, m *moments, c *results.LatencyComponent, count int64) {
+	pooled.Min = math.Min(pooled.Min, c.Min)
+	pooled.Max = math.Max(pooled.Max, c.Max)
+	m.merge(count, c.Mean, c.Std)
+	for low, n := range c.Histogram {
+		pooled.Histogram[low] += n
+	}
+}
+
+func pooledLatencyComponent(pooled *results.LatencyComponent, m *moments) *results.LatencyComponent {
+	pooled.Mean = m.mean
+	pooled.Std = m.std()
+	// the histograms are lost when the results are read back, e.g. by the coordinator. The quantiles are the
+	// highest latency of their bucket, which may exceed the largest latency.
+	if len(pooled.Histogram) > 0 {
+		pooled.P50 = math.Min(histogramQuantile(pooled.Histogram, 0.50), pooled.Max)
+		pooled.P99 = math.Min(histogramQuantile(pooled.Histogram, 0.99), pooled.Max)
+	}
+
+	return pooled
+}
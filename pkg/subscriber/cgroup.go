@@ -0,0 +1,175 @@
+package subscriber
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// cgroupRoot is where the cgroup hierarchies are mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupStats holds the resource limits and throttling counters of the cgroup(s) the process runs in
+// (Linux only). Limits are 0 if unlimited.
+type cgroupStats struct {
+	version     int
+	cpuLimit    float64 // cores
+	memoryLimit int64   // bytes
+	memoryPeak  int64   // bytes, 0 if not reported by the kernel
+	periods     int64
+	throttled   int64
+	throttledNs int64
+}
+
+// readCgroupStats reads the limits and counters of cgroup v2 or, if not mounted, cgroup v1,
+// it returns nil if the process does not run in a cgroup with limits (e.g. not in a container)
+func readCgroupStats() *cgroupStats {
+	paths := cgroupPaths()
+	var stats *cgroupStats
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		stats = readCgroupV2(cgroupDir("", paths[""]))
+	} else {
+		stats = readCgroupV1(cgroupDir("cpu", paths["cpu"]), cgroupDir("memory", paths["memory"]))
+	}
+	if stats.cpuLimit == 0 && stats.memoryLimit == 0 {
+		return nil
+	}
+
+	return stats
+}
+
+func readCgroupV2(dir string) *cgroupStats {
+	stats := &cgroupStats{version: 2}
+	// cpu.max: "<quota> <period>" or "max <period>"
+	if fields := strings.Fields(readCgroupFile(dir, "cpu.max")); len(fields) == 2 {
+		quota, errQuota := strconv.ParseFloat(fields[0], 64)
+		period, errPeriod := strconv.ParseFloat(fields[1], 64)
+		if errQuota == nil && errPeriod == nil && period > 0 {
+			stats.cpuLimit = quota / period
+		}
+	}
+	stats.memoryLimit = parseCgroupBytes(readCgroupFile(dir, "memory.max"))
+	stats.memoryPeak = parseCgroupBytes(readCgroupFile(dir, "memory.peak"))
+	cpu := readCgroupKeyValues(dir, "cpu.stat")
+	stats.periods = cpu["nr_periods"]
+	stats.throttled = cpu["nr_throttled"]
+	stats.throttledNs = cpu["throttled_usec"] * 1000
+
+	return stats
+}
+
+func readCgroupV1(cpuDir, memoryDir string) *cgroupStats {
+	stats := &cgroupStats{version: 1}
+	quota, errQuota := strconv.ParseFloat(readCgroupFile(cpuDir, "cpu.cfs_quota_us"), 64)
+	period, errPeriod := strconv.ParseFloat(readCgroupFile(cpuDir, "cpu.cfs_period_us"), 64)
+	// a quota of -1 is unlimited
+	if errQuota == nil && errPeriod == nil && quota > 0 && period > 0 {
+		stats.cpuLimit = quota / period
+	}
+	// without a limit the kernel reports a huge page aligned number
+	if limit := parseCgroupBytes(readCgroupFile(memoryDir, "memory.limit_in_bytes")); limit < 1<<62 {
+		stats.memoryLimit = limit
+	}
+	stats.memoryPeak = parseCgroupBytes(readCgroupFile(memoryDir, "memory.max_usage_in_bytes"))
+	cpu := readCgroupKeyValues(cpuDir, "cpu.stat")
+	stats.periods = cpu["nr_periods"]
+	stats.throttled = cpu["nr_throttled"]
+	stats.throttledNs = cpu["throttled_time"]
+
+	return stats
+}
+
+// cgroupPaths returns the cgroup of the process per controller from /proc/self/cgroup, the v2 cgroup
+// has the empty controller
+func cgroupPaths() map[string]string {
+	paths := make(map[string]string)
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return paths
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+
+	return paths
+}
+
+// cgroupDir returns the directory of the cgroup of a controller ("" for v2). Inside a container with its
+// own cgroup namespace the path is not visible and the controller's root is the container's cgroup.
+func cgroupDir(controller, path string) string {
+	root := filepath.Join(cgroupRoot, controller)
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(dir); err != nil {
+		return root
+	}
+
+	return dir
+}
+
+func readCgroupFile(dir, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// parseCgroupBytes parses a byte count, "max" and unreadable values are 0
+func parseCgroupBytes(value string) int64 {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
+
+// readCgroupKeyValues reads a flat keyed file like cpu.stat
+func readCgroupKeyValues(dir, name string) map[string]int64 {
+	values := make(map[string]int64)
+	for _, line := range strings.Split(readCgroupFile(dir, name), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+
+	return values
+}
+
+// calculateContainerResults computes the limits and the throttling over the run
+func calculateContainerResults(before, after *cgroupStats) *results.ContainerResults {
+	res := &results.ContainerResults{
+		CgroupVersion:    after.version,
+		CPULimit:         after.cpuLimit,
+		MemoryLimit:      after.memoryLimit,
+		MemoryPeak:       after.memoryPeak,
+		Periods:          after.periods - before.periods,
+		ThrottledPeriods: after.throttled - before.throttled,
+		ThrottledTime:    float64(after.throttledNs - before.throttledNs),
+	}
+	if res.Periods > 0 {
+		res.ThrottledRatio = float64(res.ThrottledPeriods) / float64(res.Periods)
+	}
+
+	return res
+}
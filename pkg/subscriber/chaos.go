@@ -0,0 +1,163 @@
+package subscriber
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// chaosDrop drops the connection of a client once during the run without a DISCONNECT, like a crashing device
+// or a network failure, and keeps the client down for a while: the Dialer holds back its reconnect until then,
+// after which paho reconnects to the same (persistent) session. It measures how long the client takes to
+// reconnect and to receive messages again, and counts the messages the broker redelivered.
+type chaosDrop struct {
+	after time.Duration
+	down  time.Duration
+
+	mu            sync.Mutex
+	droppedAt     time.Time
+	reconnectedAt time.Time
+	recoveredAt   time.Time // first measured message after the reconnect
+	redelivered   int64
+}
+
+func newChaosDrop(after, down time.Duration) *chaosDrop {
+	return &chaosDrop{after: after, down: down}
+}
+
+// chaosClient returns whether client id drops its connection, which the first fraction of the clients do (the
+// late joiners are the last)
+func chaosClient(id int, clients int, fraction float64) bool {
+	dropping := int(fraction*float64(clients) + 0.5)
+
+	return id < dropping
+}
+
+// drop closes the connection of client c, unless it is done already
+func (d *chaosDrop) drop(c *Client) {
+	if c.acc.completed() {
+		return
+	}
+	now := time.Now()
+	if err := c.Conn.drop(now.Add(d.down)); err != nil {
+		c.logf(levelWarn, "could not drop its connection: %v", err)
+		return
+	}
+	d.mu.Lock()
+	d.droppedAt = now
+	d.mu.Unlock()
+	if !c.Quiet {
+		c.logf(levelInfo, "dropped its connection, reconnecting after %v", d.down)
+	}
+}
+
+func (d *chaosDrop) connected(at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.droppedAt.IsZero() && d.reconnectedAt.IsZero() {
+		d.reconnectedAt = at
+	}
+}
+
+func (d *chaosDrop) received(m *Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.droppedAt.IsZero() || d.reconnectedAt.IsZero() {
+		return
+	}
+	if d.recoveredAt.IsZero() {
+		d.recoveredAt = time.Unix(0, m.ReceivedAt)
+	}
+	if m.Duplicate {
+		d.redelivered++
+	}
+}
+
+// results returns nil if the connection was not dropped, e.g. because the client was done before
+func (d *chaosDrop) results() *results.ChaosResults {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.droppedAt.IsZero() {
+		return nil
+	}
+
+	res := &results.ChaosResults{
+		Clients:     1,
+		DroppedAt:   d.droppedAt.UnixNano(),
+		Redelivered: d.redelivered,
+	}
+	if !d.reconnectedAt.IsZero() {
+		res.ReconnectTime = float64(d.reconnectedAt.Sub(d.droppedAt))
+		res.ReconnectTimeMax = res.ReconnectTime
+	}
+	if !d.recoveredAt.IsZero() {
+		res.Recovered = 1
+		res.RecoveryTime = float64(d.recoveredAt.Sub(d.droppedAt))
+		res.RecoveryTimeMax = res.RecoveryTime
+	}
+
+	return res
+}
+
+// drop closes the current connection of the client and holds back its reconnects until until
+func (cc *ClientConn) drop(until time.Time) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.tcp == nil {
+		return fmt.Errorf("no TCP connection")
+	}
+	cc.downUntil = until
+
+	return cc.tcp.Close()
+}
+
+// waitUntilUp delays a dial of the client until it may reconnect after a drop
+func (cc *ClientConn) waitUntilUp() {
+	cc.mu.Lock()
+	until := cc.downUntil
+	cc.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+func calculateChaosTotals(runs []*results.RunResults) *results.ChaosResults {
+	var totals *results.ChaosResults
+	var reconnected int
+	for _, res := range runs {
+		chaos := res.Chaos
+		if chaos == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.ChaosResults)
+		}
+		totals.Clients++
+		totals.Redelivered += chaos.Redelivered
+		if chaos.ReconnectTime > 0 {
+			reconnected++
+			totals.ReconnectTime += chaos.ReconnectTime
+			totals.ReconnectTimeMax = math.Max(totals.ReconnectTimeMax, chaos.ReconnectTime)
+		}
+		if chaos.Recovered > 0 {
+			totals.Recovered++
+			totals.RecoveryTime += chaos.RecoveryTime
+			totals.RecoveryTimeMax = math.Max(totals.RecoveryTimeMax, chaos.RecoveryTime)
+		}
+	}
+	if totals == nil {
+		return nil
+	}
+	if reconnected > 0 {
+		totals.ReconnectTime /= float64(reconnected)
+	}
+	if totals.Recovered > 0 {
+		totals.RecoveryTime /= float64(totals.Recovered)
+	}
+
+	return totals
+}
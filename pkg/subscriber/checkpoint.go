@@ -0,0 +1,132 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// checkpointer periodically writes the samples all clients received so far to a file, in the format of
+// -samples-file, so a run interrupted by a crash can be resumed (-resume) or finalized with the replay
+// subcommand instead of being lost
+type checkpointer struct {
+	path string
+	raw  results.RawSamples
+
+	mu      sync.Mutex
+	clients map[int]*checkpointClient
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// checkpointClient is the part of a client the checkpointer writes
+type checkpointClient struct {
+	samples *results.ClientSamples
+	acc     *accumulator
+}
+
+// startCheckpointer writes a checkpoint of the run described by raw to path every interval
+func startCheckpointer(path string, interval time.Duration, raw results.RawSamples) *checkpointer {
+	c := &checkpointer{
+		path:    path,
+		raw:     raw,
+		clients: make(map[int]*checkpointClient),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.write(); err != nil {
+					logf(levelError, "Error writing checkpoint: %v", err)
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+
+	return c
+}
+
+// register adds the accumulator of a client to the checkpoints, a nil checkpointer ignores it
+func (c *checkpointer) register(client *Client, acc *accumulator) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients[client.ID] = &checkpointClient{
+		samples: &results.ClientSamples{ID: client.ID, Broker: client.BrokerURL, QoS: client.MsgQoS},
+		acc:     acc,
+	}
+}
+
+// Stop stops the periodic checkpoints and writes a final one
+func (c *checkpointer) Stop() error {
+	close(c.stop)
+	<-c.done
+
+	return c.write()
+}
+
+// write replaces the checkpoint file, the new checkpoint is written next to it first so a crash while
+// writing leaves the previous checkpoint intact
+func (c *checkpointer) write() error {
+	raw := c.raw
+	raw.CheckpointedAt = time.Now().UnixNano()
+	c.mu.Lock()
+	for _, client := range c.clients {
+		samples := *client.samples
+		samples.ReceivedAt, samples.Latencies = client.acc.snapshot()
+		raw.Clients = append(raw.Clients, &samples)
+	}
+	c.mu.Unlock()
+	sort.Slice(raw.Clients, func(i, j int) bool {
+		return raw.Clients[i].ID < raw.Clients[j].ID
+	})
+
+	data, err := json.Marshal(&raw)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+// readCheckpoint reads the checkpoint of an interrupted run with at most clients clients
+func readCheckpoint(path string, clients int) (*results.RawSamples, error) {
+	var raw results.RawSamples
+	if err := readJSONFile(path, &raw); err != nil {
+		return nil, err
+	}
+	if raw.SchemaVersion != results.SchemaVersion {
+		return nil, fmt.Errorf("schema version %v is not supported", raw.SchemaVersion)
+	}
+	for _, samples := range raw.Clients {
+		if samples.ID < 0 || samples.ID >= clients {
+			return nil, fmt.Errorf("client %v is not part of this run of %v clients", samples.ID, clients)
+		}
+		if len(samples.ReceivedAt) != len(samples.Latencies) {
+			return nil, fmt.Errorf("client %v has %v receive times for %v latencies",
+				samples.ID, len(samples.ReceivedAt), len(samples.Latencies))
+		}
+	}
+
+	return &raw, nil
+}
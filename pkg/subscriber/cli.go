@@ -0,0 +1,2037 @@
+package subscriber
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// Main runs the command line tool with the arguments in os.Args, including the merge and replay subcommands
+func Main() {
+	if len(os.Args) > 1 && os.Args[1] == "merge" {
+		runMerge(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:])
+		return
+	}
+
+	o, err := parseOptions(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fatalf("Invalid arguments: %v", err)
+	}
+	if err := logs.configure(o.logLevel, o.logFormat); err != nil {
+		fatalf("Invalid arguments: %v", err)
+	}
+
+	var resumed *results.RawSamples
+	if o.resume {
+		resumed, err = readCheckpoint(o.checkpoint, o.clients)
+		if err != nil {
+			fatalf("Error reading checkpoint: %v", err)
+		}
+		// continue with the identity and random sources of the interrupted run
+		if o.runID == "" {
+			o.runID = resumed.RunID
+		}
+		if o.seed == 0 {
+			o.seed = resumed.Seed
+		}
+	}
+
+	if o.seed == 0 {
+		o.seed = time.Now().UnixNano()
+	}
+
+	var baseline *results.JSONResults
+	if o.baselineFile != "" {
+		if baseline, err = loadBaseline(o.baselineFile); err != nil {
+			fatalf("Error reading baseline: %v", err)
+		}
+	}
+
+	if o.mode == modeCoordinator {
+		jr, err := runCoordinator(o.coordAddress, o.workers, o.percentiles, o.registerTO, o.workerTO, o.quiet)
+		if err != nil {
+			fatalf("Error coordinating the workers: %v", err)
+		}
+		jr.RunID = o.runID
+		jr.Seed = o.seed
+		jr.Labels = o.labels
+		jr.Thresholds = Thresholds{
+			MaxP99Ms:      o.maxP99,
+			MinMsgsPerSec: o.minRate,
+			MaxLossRatio:  o.maxLoss,
+			MaxDuplicates: o.maxDups,
+			ExactlyOnce:   o.exactlyOnce != "",
+		}.results(jr.Totals, pooledQuantile(jr.Runs, 0.99))
+		if baseline != nil {
+			jr.Baseline = compareBaseline(baseline, o.baselineFile, jr, o.maxRegress)
+			jr.Thresholds = checkRegressions(jr.Thresholds, jr.Baseline, o.maxRegress)
+		}
+		printResults(os.Stdout, jr, o.format)
+		exitOnFailedClients(jr)
+		exitOnFailedThresholds(jr)
+		return
+	}
+
+	// workers register early, so they set up while the coordinator waits for the others
+	var worker *coordinatorWorker
+	idOffset := 0
+	if o.mode == modeWorker {
+		if worker, err = joinCoordinator(o.coordAddress, o.clients); err != nil {
+			fatalf("Error joining the coordinator: %v", err)
+		}
+		idOffset = worker.registered.IDOffset
+		// clients of different workers need distinct MQTT client ids
+		o.clientPrefix = fmt.Sprintf("%s-w%d", o.clientPrefix, worker.registered.Index)
+		if !o.quiet {
+			logf(levelInfo, "Registered with the coordinator as worker %v", worker.registered.Index)
+		}
+	}
+
+	if o.brokerAll {
+		// the certificates of the nodes are verified against the host name they were resolved from
+		if o.brokers, o.tlsServer, err = resolveBrokers(o.brokers, o.tlsServer); err != nil {
+			fatalf("Invalid arguments: %v", err)
+		}
+	}
+	endpoints := []*string{&o.standby}
+	for i := range o.brokers {
+		endpoints = append(endpoints, &o.brokers[i])
+	}
+	for i := range o.brokerRanges {
+		endpoints = append(endpoints, &o.brokerRanges[i].Broker)
+	}
+	for _, brokerURL := range endpoints {
+		if *brokerURL, err = webSocketURL(*brokerURL, o.wsPath); err != nil {
+			fatalf("Invalid arguments: %v", err)
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if o.clientCert != "" || o.caCert != "" || o.tlsServer != "" || o.insecure {
+		sharedCert := o.clientCert
+		if o.perClientCerts {
+			sharedCert = ""
+		}
+		tlsConfig = generateTLSConfig(sharedCert, o.clientKey, o.keyPassword, o.caCert, o.tlsServer, o.insecure)
+	}
+	if o.spiffeSocket != "" {
+		source, err := NewSPIFFESource(o.spiffeSocket, 30*time.Second, o.quiet)
+		if err != nil {
+			fatalf("Error fetching SVID: %v", err)
+		}
+		tlsConfig = &tls.Config{ServerName: o.tlsServer}
+		source.Configure(tlsConfig, o.spiffeServer)
+	}
+	if o.fips {
+		if tlsConfig == nil {
+			tlsConfig = new(tls.Config)
+		}
+		restrictToFIPS(tlsConfig)
+		if !boringCrypto && !o.quiet {
+			logf(levelWarn, "FIPS mode restricts the TLS algorithms, build with GOEXPERIMENT=boringcrypto to use a FIPS validated module")
+		}
+	}
+	var sessions *sessionCache
+	if o.tlsSessions {
+		if tlsConfig == nil {
+			tlsConfig = new(tls.Config)
+		}
+		sessions = newSessionCache()
+		tlsConfig.ClientSessionCache = sessions
+	}
+	clientTLS := make([]*tls.Config, o.clients)
+	for i := range clientTLS {
+		clientTLS[i] = tlsConfig
+	}
+	if o.perClientCerts {
+		certs, err := loadClientCertificates(o.clientCert, o.clientKey, o.keyPassword, o.certDir)
+		if err != nil {
+			fatalf("Error reading certificate files: %v", err)
+		}
+		for i := range clientTLS {
+			if clientTLS[i], err = certs.config(tlsConfig, idOffset+i); err != nil {
+				fatalf("Error reading certificate files: %v", err)
+			}
+		}
+	}
+
+	requiredFDs := uint64(o.clients) + fdHeadroom
+	fdLimit, err := ensureFDLimit(requiredFDs)
+	if err != nil {
+		logf(levelWarn, "Could not raise file descriptor limit: %v", err)
+	}
+	if fdLimit < requiredFDs {
+		fatalf("Invalid arguments: %v clients need about %v file descriptors but the limit is %v (raise it with 'ulimit -n')", o.clients, requiredFDs, fdLimit)
+	}
+	clientsPerBroker := make(map[string]int)
+	maxClientsPerBroker := 0
+	for i := 0; i < o.clients; i++ {
+		brokerURL := brokerFor(o.brokerRanges, i, o.brokers)
+		clientsPerBroker[brokerURL]++
+		if clientsPerBroker[brokerURL] > maxClientsPerBroker {
+			maxClientsPerBroker = clientsPerBroker[brokerURL]
+		}
+	}
+	if len(o.sources) > 0 {
+		// every source address has its own local ports
+		maxClientsPerBroker = (maxClientsPerBroker + len(o.sources) - 1) / len(o.sources)
+	}
+	checkLocalPorts(maxClientsPerBroker)
+
+	// resource limits of the container, if any, so a constrained subscriber is not mistaken for a slow broker
+	cgroupBefore := readCgroupStats()
+
+	var ifaceBefore *InterfaceCounters
+	if o.iface != "" {
+		ifaceBefore, err = readInterfaceCounters(o.iface)
+		if err != nil {
+			fatalf("Error reading interface counters: %v", err)
+		}
+	}
+
+	var dialer *Dialer
+	if o.tcpInfo || o.dnsCache || o.connTiming || o.qos2Timing || o.dialNet != "" || !o.noDelay || o.readBuffer > 0 || len(o.sources) > 0 || o.proxyURL != "" || o.chaosFrac > 0 || o.standby != "" {
+		dialer, err = newDialer(o.connTimeout, o.proxyURL)
+		if err != nil {
+			fatalf("Error setting up dialer: %v", err)
+		}
+		dialer.timing = o.connTiming
+		dialer.network = o.dialNet
+		dialer.delay = !o.noDelay
+		dialer.readBuffer = o.readBuffer
+		dialer.sources = o.sources
+		dialer.qos2 = o.qos2Timing
+	}
+	if o.dnsCache {
+		dialer.resolver = newDNSCache(o.dnsTTL)
+	}
+
+	clientConns := make([]*ClientConn, o.clients)
+	if dialer != nil {
+		for i := range clientConns {
+			brokerURLs := []string{brokerFor(o.brokerRanges, i, o.brokers)}
+			if o.standby != "" {
+				brokerURLs = append(brokerURLs, o.standby)
+			}
+			clientConns[i], err = dialer.Register(i, brokerURLs, clientTLS[i])
+			if err != nil {
+				fatalf("Invalid arguments: %v", err)
+			}
+		}
+	}
+
+	if dialer != nil && dialer.resolver != nil {
+		// resolve all brokers up front, so DNS failures and lookup times do not show up in the connection phase
+		for _, target := range dialer.targets {
+			if _, err := dialer.resolver.resolve(target.address); err != nil {
+				fatalf("Error resolving broker %v: %v", target.address, err)
+			}
+		}
+	}
+
+	if o.transport != "mqtt" && (dialer != nil || o.brokerMap != "" || len(o.brokers) > 1 || o.standby != "" || o.sharedName != "" ||
+		o.resubEvery > 0 || o.offlineAt > 0 || o.probeEvery > 0 || o.syncTopic != "" || tlsConfig != nil) {
+		fatalf("Invalid arguments: -transport %v does not support the MQTT connection, session and subscription flags", o.transport)
+	}
+
+	var connections *connectionCount
+	var probe *SubscribeProbe
+	if o.probeEvery > 0 {
+		connections = new(connectionCount)
+		if o.probeTopic == "" {
+			o.probeTopic = o.topics.Topic(0)
+		}
+		probe = &SubscribeProbe{
+			BrokerURLs:  []string{o.brokers[0]},
+			BrokerUser:  o.username,
+			BrokerPass:  o.password,
+			ClientID:    fmt.Sprintf("Subscriber-%s-probe", o.clientPrefix),
+			Topic:       o.probeTopic,
+			QoS:         byte(o.qos),
+			Interval:    o.probeEvery,
+			TLSConfig:   tlsConfig,
+			Quiet:       o.quiet,
+			connections: connections,
+		}
+		if dialer != nil {
+			cc, err := dialer.Register(o.clients, probe.BrokerURLs, tlsConfig)
+			if err != nil {
+				fatalf("Invalid arguments: %v", err)
+			}
+			probe.BrokerURLs = cc.URLs
+			probe.TLSConfig = nil
+		}
+	}
+
+	tcpInfoStop := make(chan struct{})
+	tcpInfoDone := make(chan struct{})
+	if o.tcpInfo {
+		go func() {
+			dialer.sampleTCPInfo(time.Second, tcpInfoStop)
+			close(tcpInfoDone)
+		}()
+	}
+
+	var kafka *KafkaProducer
+	if o.kafkaBrokers != "" {
+		kafka, err = newKafkaProducer(o.kafkaBrokers, o.kafkaTopic, fmt.Sprintf("Subscriber-%s", o.clientPrefix))
+		if err != nil {
+			fatalf("Error connecting to Kafka: %v", err)
+		}
+		defer kafka.Close()
+		if o.runID != "" {
+			kafka.Key = []byte(o.runID)
+		}
+	}
+
+	var reporter *IntervalReporter
+	if o.intervalFile != "" || o.latSeries || o.intervalLog || o.ui || kafka != nil {
+		reporter = &IntervalReporter{
+			Clients:  make([]*Client, o.clients),
+			Interval: o.interval,
+			Log:      o.intervalLog,
+		}
+	}
+	if o.intervalFile != "" {
+		f, err := os.OpenFile(o.intervalFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fatalf("Error opening interval stats file: %v", err)
+		}
+		defer f.Close()
+		reporter.Output = f
+	}
+	if kafka != nil {
+		if reporter.Output != nil {
+			reporter.Output = io.MultiWriter(reporter.Output, kafka)
+		} else {
+			reporter.Output = kafka
+		}
+	}
+
+	var exporter *PrometheusExporter
+	if o.pprofListen != "" {
+		if err := startPprof(o.pprofListen); err != nil {
+			fatalf("Error starting pprof endpoint: %v", err)
+		}
+	}
+
+	if o.promListen != "" {
+		exporter, err = newPrometheusExporter(o.promListen, o.clients)
+		if err != nil {
+			fatalf("Error starting Prometheus endpoint: %v", err)
+		}
+		defer exporter.Close()
+	}
+
+	var api *controlAPI
+	if o.apiListen != "" {
+		api, err = newControlAPI(o.apiListen, o.clients)
+		if err != nil {
+			fatalf("Error starting control API: %v", err)
+		}
+		defer api.Close()
+	}
+
+	var events *eventLog
+	if o.eventLogFile != "" {
+		events, err = openEventLog(o.eventLogFile)
+		if err != nil {
+			fatalf("Error opening event log: %v", err)
+		}
+	}
+
+	var dump *latencyDump
+	if o.latencyFile != "" {
+		dump, err = openLatencyDump(o.latencyFile)
+		if err != nil {
+			fatalf("Error opening latency file: %v", err)
+		}
+	}
+
+	fdMonitor := startFDMonitor(100 * time.Millisecond)
+	selfMonitor := startSelfMonitor(time.Second)
+
+	var drift *clockDrift
+	if o.ntpServer != "" || o.clock.monotonic || o.clock.offset != 0 {
+		drift = startClockDrift(o.clock, o.ntpServer)
+	}
+	if o.ntpCorrect {
+		if drift.ntpErr != nil {
+			fatalf("Error querying NTP server for the clock offset: %v", drift.ntpErr)
+		}
+		o.clock.offset += drift.offset
+		if !o.quiet {
+			logf(levelInfo, "Compensating a clock offset of %v", o.clock.offset)
+		}
+	}
+
+	if worker != nil {
+		if err := worker.waitForStart(); err != nil {
+			fatalf("Error waiting for the coordinator to start: %v", err)
+		}
+	}
+
+	resCh := make(chan *results.RunResults)
+	ctx, cancel := runContext(o.timeout)
+	defer cancel()
+	start := time.Now()
+	// samples are relative to the start of the interrupted run when resuming
+	samplesStart := start
+	resumedClients := make(map[int]*results.ClientSamples)
+	var interrupted time.Duration
+	if resumed != nil {
+		samplesStart = time.Unix(0, resumed.Start)
+		// from the last checkpoint on, the samples were lost or never received
+		interrupted = time.Duration(resumed.Interrupted)
+		if resumed.CheckpointedAt > 0 {
+			interrupted += start.Sub(time.Unix(0, resumed.CheckpointedAt))
+		}
+		for _, samples := range resumed.Clients {
+			resumedClients[samples.ID] = samples
+		}
+	}
+	var checkpoints *checkpointer
+	if o.checkpoint != "" {
+		checkpoints = startCheckpointer(o.checkpoint, o.checkpointEv, results.RawSamples{
+			SchemaVersion: results.SchemaVersion,
+			RunID:         o.runID,
+			Seed:          o.seed,
+			Labels:        o.labels,
+			Start:         samplesStart.UnixNano(),
+			Interrupted:   int64(interrupted),
+		})
+	}
+	if probe != nil {
+		probe.Start(start)
+	}
+	var clientTopics []string
+	if perClientTopics(o.subscriptions) || len(o.groups) > 0 {
+		clientTopics = make([]string, o.clients)
+	}
+	connects := newConnectLimiter(o.connConc)
+	var shared *sharedGroup
+	if o.sharedName != "" {
+		shared = newSharedGroup(o.sharedName, o.count)
+	}
+	var ramp *rampUp
+	if o.connRate > 0 || o.rampUpFor > 0 {
+		ramp = newRampUp(start, o.clients, o.connRate, o.rampUpFor)
+	}
+	var gate *publisherGate
+	if o.expectPubs > 0 {
+		gate = newPublisherGate(o.expectPubs, start, o.quiet)
+	}
+	var starter *startSync
+	if o.syncTopic != "" {
+		starter = newStartSync(o.syncTopic, start, o.quiet)
+	}
+	clientIDSuffix := randomSuffix(o.seed)
+	var progress *aggregateProgress
+	var progressStop chan struct{}
+	if o.progressAgg && !o.quiet {
+		progress = newAggregateProgress(o.progressEvery, o.clients, o.count)
+		if o.progressPeriod > 0 {
+			progressStop = make(chan struct{})
+			go progress.run(o.progressPeriod, progressStop)
+		}
+	}
+	for i := 0; i < o.clients; i++ {
+		if !o.quiet {
+			logf(levelDebug, "Starting client %v", i)
+		}
+		c := &Client{
+			ID:          i,
+			ClientID:    o.clientPrefix,
+			BrokerURL:   brokerFor(o.brokerRanges, i, o.brokers),
+			BrokerUser:  o.username,
+			BrokerPass:  o.password,
+			MsgTopic:    o.topics.Topic(idOffset + i),
+			ReceiveCount:    o.count,
+			Duration:        o.duration,
+			Cooldown:        o.cooldown,
+			MsgQoS:      byte(o.qos),
+			Quiet:       o.quiet,
+			TLSConfig:   clientTLS[i],
+			Conn:        clientConns[i],
+			StandbyURL:  o.standby,
+			OfflineAt:   o.offlineAt,
+			CleanSession: o.cleanSession,
+			SessionExpiry: o.sessionExpiry,
+			MeasureRetained: o.retained,
+			MeasureJitter:   o.jitter,
+			OfflineFor:  o.offlineFor,
+			Bootstrap:   o.bootstrap,
+			Percentiles: o.percentiles,
+			HistogramBuckets: o.histogramBounds,
+			Confidence:  o.confidence,
+			ApdexT:      o.apdexT,
+			ApdexF:      o.apdexF,
+			ProcessDelay: o.processDelay,
+			ConsumeRate:  o.consumeRate,
+			ResubscribeEvery: o.resubEvery,
+			ResubscribeGap:   o.resubGap,
+			RunID:            o.runID,
+			Seed:             o.seed,
+			CheckRunID:       o.checkRunID,
+			PublisherCount:   o.perPublisher,
+			ExactlyOnce:      o.exactlyOnce != "",
+			ExactlyOnceIDs:   o.exactlyOnceIDs,
+			TopicStats:       o.topicStats,
+			KeepSamples:      o.samplesFile != "" || o.checkpoint != "" || o.interArrival,
+			KeepLatencies:    o.storeRaw,
+			PipelineBuffer:   o.pipelineBuf,
+			DecodeWorkers:    o.decoders,
+			MaxPacketSize:    o.maxPacket,
+			ConnectTimeout:   o.connTimeout,
+			ConnectRetries:   o.connRetries,
+			ConnectBackoff:   o.connBackoff,
+			ProtocolVersion:  o.protocolLevel,
+			NativeClient:     o.nativeClient,
+			SubscriptionOptions: o.subOptions,
+			KeepPayloads:     o.keepPayloads,
+			AnomalyFactor:    o.anomalyF,
+			AnomalyWindow:    o.anomalyW,
+			VerifySize:       o.verifySize,
+			PayloadCompression: o.payloadComp,
+			MaxDecompressedSize: o.maxDecomp,
+			BatchMode:        o.batchMode,
+			StallThreshold:   o.stallAfter,
+			progress:         progress,
+			Tuning:           o.tuning,
+			gate:             gate,
+			startSync:        starter,
+			connects:         connects,
+			connections:      connections,
+			clock:            o.clock,
+			checkpoints:      checkpoints,
+			events:           events,
+			latencyDump:      dump,
+			decoder:          o.decoder,
+			decompressor:     o.decompressor,
+			brokerStamp:      o.brokerStamp,
+			resumed:          resumedClients[i],
+			interrupted:      interrupted,
+		}
+		if ramp != nil {
+			c.ConnectDelay = ramp.delay(i)
+			c.rampUp = ramp
+		}
+		if lateJoiner(i, o.clients, o.lateFraction) {
+			c.JoinDelay = o.lateDelay
+		}
+		if o.clientIDTmpl != "" {
+			c.MQTTClientID = expandClientID(o.clientIDTmpl, i, clientIDSuffix)
+		}
+		if o.clientIDRand {
+			c.MQTTClientID = c.mqttClientID() + "-" + clientIDSuffix
+		}
+		if o.transport != "mqtt" {
+			// the other backends deliver at most once, like QoS 0
+			c.MsgQoS = 0
+			c.Source, err = newMessageSource(o.transport, c.BrokerURL, c.mqttClientID(), o.connTimeout)
+			if err != nil {
+				fatalf("Invalid arguments: %v", err)
+			}
+		}
+		if chaosClient(i, o.clients, o.chaosFrac) {
+			c.ChaosAfter = o.chaosAfter
+			c.ChaosDown = o.chaosDown
+		}
+		if o.warmup > 0 {
+			c.WarmupUntil = start.Add(o.warmup).UnixNano()
+		}
+		c.WarmupCount = o.warmupCount
+		if o.qosLevels != nil {
+			c.MsgQoS = o.qosLevels[i]
+		}
+		if g := groupFor(o.groups, i); g != nil {
+			if g.Topic != nil {
+				c.MsgTopic = g.Topic.Topic(idOffset + i)
+			}
+			if g.QoS >= 0 {
+				c.MsgQoS = byte(g.QoS)
+			}
+			if g.Count > 0 {
+				c.ReceiveCount = g.Count
+			}
+			if g.CleanSession != nil {
+				c.CleanSession = *g.CleanSession
+			}
+		}
+		// the topic of a group replaces all topics, -qos, -qos-mix and the groups' QoS are the default
+		if g := groupFor(o.groups, i); g == nil || g.Topic == nil {
+			for _, s := range o.subscriptions[1:] {
+				more := Subscription{Topic: s.topic.Topic(idOffset + i), QoS: c.MsgQoS}
+				if s.qos >= 0 {
+					more.QoS = byte(s.qos)
+				}
+				c.MoreTopics = append(c.MoreTopics, more)
+			}
+			if o.subscriptions[0].qos >= 0 {
+				c.MsgQoS = byte(o.subscriptions[0].qos)
+			}
+		}
+		if t := tenantFor(o.tenants, i); t != nil {
+			c.MsgTopic = t.Topic(c.MsgTopic)
+			for j := range c.MoreTopics {
+				c.MoreTopics[j].Topic = t.Topic(c.MoreTopics[j].Topic)
+			}
+			if t.Username != "" {
+				c.BrokerUser = t.Username
+				c.BrokerPass = t.Password
+			}
+		}
+		if shared != nil {
+			c.MsgTopic = sharedTopic(shared.name, c.MsgTopic)
+			for j := range c.MoreTopics {
+				c.MoreTopics[j].Topic = sharedTopic(shared.name, c.MoreTopics[j].Topic)
+			}
+			c.ReceiveCount = 0
+			c.shared = shared
+		}
+		if reporter != nil {
+			c.window = newIntervalWindow()
+			reporter.Clients[i] = c
+		}
+		if exporter != nil || api != nil {
+			c.metrics = newClientMetrics()
+		}
+		if exporter != nil {
+			exporter.Clients[i] = c
+		}
+		if api != nil {
+			api.Clients[i] = c
+		}
+		if clientTopics != nil {
+			clientTopics[i] = c.MsgTopic
+		}
+		if progress == nil {
+			c.ProgressEvery, c.ProgressPeriod = o.progressEvery, o.progressPeriod
+		}
+		go c.Run(ctx, resCh)
+	}
+	if o.ui {
+		// on stderr, so the results on stdout can still be redirected
+		dash := newDashboard(os.Stderr, reporter.Clients)
+		reporter.OnReport = dash.render
+		log.SetOutput(dash.logs)
+	}
+	if reporter != nil {
+		reporter.Start(start)
+	}
+	if exporter != nil {
+		exporter.Start()
+	}
+	if api != nil {
+		api.Start(start, cancel)
+	}
+
+	// collect the results
+	runs := make([]*results.RunResults, o.clients)
+	var end time.Time
+	for i := 0; i < o.clients; i++ {
+		runs[i] = <-resCh
+		if until := measuredUntil(runs[i], time.Now()); until.After(end) {
+			end = until
+		}
+	}
+	totalTime := end.Sub(start)
+	if progressStop != nil {
+		close(progressStop)
+	}
+	if events != nil {
+		if err := events.Close(); err != nil {
+			logf(levelError, "Error writing event log: %v", err)
+		}
+	}
+	if dump != nil {
+		if err := dump.Close(); err != nil {
+			logf(levelError, "Error writing latency file: %v", err)
+		}
+	}
+	if checkpoints != nil {
+		if err := checkpoints.Stop(); err != nil {
+			logf(levelError, "Error writing checkpoint: %v", err)
+		}
+	}
+	var latencySeries []*results.LatencySample
+	if reporter != nil {
+		latencySeries = reporter.Stop()
+	}
+	if o.ui {
+		log.SetOutput(os.Stderr)
+	}
+
+	if o.tcpInfo {
+		close(tcpInfoStop)
+		<-tcpInfoDone
+		for _, res := range runs {
+			res.TCPInfo = clientConns[res.ID].TCPInfoResults()
+		}
+	}
+	if o.connTiming {
+		for _, res := range runs {
+			res.Connect = clientConns[res.ID].ConnectResults()
+		}
+	}
+	if o.qos2Timing {
+		for _, res := range runs {
+			res.QoS2 = clientConns[res.ID].QoS2Results()
+		}
+	}
+	if dialer != nil {
+		for _, res := range runs {
+			res.AddressFamily = clientConns[res.ID].AddressFamily()
+			if len(o.sources) > 0 {
+				res.SourceAddress = clientConns[res.ID].SourceAddress()
+			}
+		}
+	}
+
+	totals := calculateTotalResults(runs, totalTime, o.clients)
+	if probe != nil {
+		totals.Probe = probe.Stop()
+	}
+	if gate != nil {
+		totals.PublishersReady = gate.openedAfter()
+	}
+	if starter != nil {
+		totals.StartedAfter = starter.startedAfter()
+	}
+	if o.latSeries {
+		totals.LatencySeries = latencySeries
+		for _, res := range runs {
+			res.LatencySeries = reporter.ClientSeries(res.ID)
+		}
+	}
+	totals.Percentiles = pooledPercentiles(runs, o.percentiles)
+	totals.LatencyHistogram = pooledHistogramBuckets(runs)
+	if o.bootstrap > 0 {
+		totals.Confidence = bootstrapConfidence(pooledLatencies(runs), o.bootstrap, o.confidence, o.seed)
+	}
+	if o.interArrival {
+		totals.InterArrival = fitInterArrivals(runs)
+	}
+	if shared != nil {
+		shared.results(runs, totals)
+	}
+	if ramp != nil {
+		ramp.results(totals, totalTime)
+	}
+	if clientTopics != nil {
+		for _, res := range runs {
+			res.Topic = clientTopics[res.ID]
+		}
+	}
+	var nodes []*results.NodeResults
+	if len(o.brokerRanges) > 0 || len(o.brokers) > 1 {
+		for _, res := range runs {
+			res.Broker = brokerFor(o.brokerRanges, res.ID, o.brokers)
+		}
+		nodes = calculateNodeResults(runs, totalTime)
+	}
+
+	var tenantResults []*results.TenantResults
+	if len(o.tenants) > 0 {
+		for _, res := range runs {
+			if t := tenantFor(o.tenants, res.ID); t != nil {
+				res.Tenant = t.Name
+			}
+		}
+		tenantResults = calculateTenantResults(runs, totalTime)
+	}
+
+	var groupResults []*results.GroupResults
+	if len(o.groups) > 0 {
+		for _, res := range runs {
+			res.Group = groupFor(o.groups, res.ID).Name
+		}
+		groupResults = calculateGroupResults(o.groups, runs, totalTime)
+	}
+
+	var qosResults []*results.QoSResults
+	if o.qosLevels != nil {
+		qosResults = calculateQoSResults(runs, totalTime)
+	}
+
+	if sessions != nil {
+		totals.TLSSessions = sessions.results()
+	}
+
+	if drift != nil {
+		totals.Clock, err = drift.results()
+		if err != nil {
+			logf(levelWarn, "Error measuring clock drift against NTP: %v", err)
+		}
+	}
+
+	if fdMonitor != nil {
+		totals.FDs = &results.FDResults{
+			Limit: fdLimit,
+			Peak:  fdMonitor.Stop(),
+		}
+	}
+	totals.Self = selfMonitor.Stop()
+
+	if cgroupBefore != nil {
+		if cgroupAfter := readCgroupStats(); cgroupAfter != nil {
+			totals.Container = calculateContainerResults(cgroupBefore, cgroupAfter)
+		}
+	}
+
+	if ifaceBefore != nil {
+		ifaceAfter, err := readInterfaceCounters(o.iface)
+		if err != nil {
+			fatalf("Error reading interface counters: %v", err)
+		}
+		totals.Interface = calculateInterfaceResults(o.iface, ifaceBefore, ifaceAfter, totals.TotalRunTime)
+	}
+
+	thresholds := Thresholds{
+		MaxP99Ms:      o.maxP99,
+		MinMsgsPerSec: o.minRate,
+		MaxLossRatio:  o.maxLoss,
+		MaxDuplicates: o.maxDups,
+		ExactlyOnce:   o.exactlyOnce != "",
+	}
+	p99 := pooledQuantile(runs, 0.99)
+
+	// print stats
+	jr := &results.JSONResults{
+		SchemaVersion: results.SchemaVersion,
+		RunID:         o.runID,
+		Seed:          o.seed,
+		Labels:        o.labels,
+		Runs:          runs,
+		Totals:        totals,
+		Nodes:         nodes,
+		Tenants:       tenantResults,
+		Groups:        groupResults,
+		QoS:           qosResults,
+		Config:        effectiveConfig(flag.CommandLine, start, start.Add(totalTime)),
+		Thresholds:    thresholds.results(totals, p99),
+	}
+	jr.Config.MQTT = o.tuning.settings()
+	jr.Config.MQTT.Subscription = o.subOptions.results()
+	jr.Config.MQTT.NativeClient = o.nativeClient || o.protocolLevel == 5
+	if baseline != nil {
+		jr.Baseline = compareBaseline(baseline, o.baselineFile, jr, o.maxRegress)
+		jr.Thresholds = checkRegressions(jr.Thresholds, jr.Baseline, o.maxRegress)
+	}
+	printResults(os.Stdout, jr, o.format)
+	if o.outputFile != "" {
+		if err := writeResultsFile(o.outputFile, jr); err != nil {
+			fatalf("Error writing results file: %v", err)
+		}
+	}
+	if api != nil {
+		api.done(jr)
+	}
+
+	if worker != nil {
+		if err := worker.sendResults(jr, start.Add(totalTime)); err != nil {
+			fatalf("Error sending results to the coordinator: %v", err)
+		}
+	}
+
+	if o.samplesFile != "" {
+		if err := writeRawSamples(o.samplesFile, jr, samplesStart); err != nil {
+			fatalf("Error writing raw samples: %v", err)
+		}
+	}
+
+	if o.esURL != "" {
+		exporter := &ElasticsearchExporter{
+			URL:         o.esURL,
+			Index:       o.esIndex,
+			MappingFile: o.esMapping,
+			Samples:     o.esSamples,
+		}
+		if err := exporter.Export(jr, start); err != nil {
+			fatalf("Error exporting results to Elasticsearch: %v", err)
+		}
+	}
+
+	for _, output := range o.outputs {
+		exporter, err := newOutput(output, o.outSeries)
+		if err != nil {
+			fatalf("Invalid arguments: %v", err)
+		}
+		if err := exporter.Export(jr, start); err != nil {
+			fatalf("Error exporting results to %v: %v", outputEndpoint(output), err)
+		}
+	}
+
+	if o.pgDSN != "" {
+		sink := &PostgresSink{
+			DSN:       o.pgDSN,
+			Timescale: o.pgTimescale,
+		}
+		if err := sink.Write(jr, start); err != nil {
+			fatalf("Error writing results to PostgreSQL: %v", err)
+		}
+	}
+
+	if kafka != nil {
+		data, err := json.Marshal(jr)
+		if err != nil {
+			fatalf("Error marshalling results: %v", err)
+		}
+		if err := kafka.Produce(data); err != nil {
+			fatalf("Error producing results to Kafka: %v", err)
+		}
+	}
+
+	if o.cwNamespace != "" {
+		exporter := &CloudWatchExporter{
+			Namespace: o.cwNamespace,
+			Region:    o.cwRegion,
+		}
+		if err := exporter.Export(o.runID, keyMetrics(totals), start); err != nil {
+			fatalf("Error exporting metrics to CloudWatch: %v", err)
+		}
+	}
+
+	if o.azResource != "" {
+		exporter := &AzureMonitorExporter{
+			ResourceID: o.azResource,
+			Region:     o.azRegion,
+			Namespace:  o.azNamespace,
+		}
+		if err := exporter.Export(o.runID, keyMetrics(totals), start); err != nil {
+			fatalf("Error exporting metrics to Azure Monitor: %v", err)
+		}
+	}
+
+	if o.otelEndpoint != "" {
+		exporter := &OTLPExporter{
+			Endpoint:    o.otelEndpoint,
+			ServiceName: o.otelService,
+		}
+		if err := exporter.Export(jr, start, start.Add(totalTime)); err != nil {
+			fatalf("Error exporting to OpenTelemetry: %v", err)
+		}
+	}
+
+	if o.notifyURL != "" {
+		if err := notify(o.notifyURL, runSummary(jr, p99, thresholds)); err != nil {
+			fatalf("Error posting run summary: %v", err)
+		}
+	}
+
+	if o.smtpAddr != "" {
+		reporter := &EmailReporter{
+			Addr:     o.smtpAddr,
+			From:     o.emailFrom,
+			Username: o.smtpUser,
+			Password: o.smtpPass,
+			HTML:     o.emailHTML,
+		}
+		for _, to := range strings.Split(o.emailTo, ",") {
+			reporter.To = append(reporter.To, strings.TrimSpace(to))
+		}
+		subject := "MQTT benchmark report"
+		if o.runID != "" {
+			subject += " " + o.runID
+		}
+		var report bytes.Buffer
+		printResults(&report, jr, "text")
+		if err := reporter.Send(subject, report.String()); err != nil {
+			fatalf("Error sending report email: %v", err)
+		}
+	}
+
+	if api != nil && o.apiLinger > 0 {
+		logf(levelInfo, "Serving the results on %v/results for %v", o.apiListen, o.apiLinger)
+		time.Sleep(o.apiLinger)
+	}
+
+	exitOnFailedClients(jr)
+	exitOnFailedThresholds(jr)
+}
+
+// measuredUntil returns when the client of res stopped measuring, given when its results were received: the
+// -cooldown after it is not part of the run
+func measuredUntil(res *results.RunResults, received time.Time) time.Time {
+	return received.Add(-time.Duration(res.CooldownTime * float64(time.Second)))
+}
+
+func calculateTotalResults(runs []*results.RunResults, totalTime time.Duration, sampleSize int) *results.TotalResults {
+	totals := new(results.TotalResults)
+	totals.TotalRunTime = totalTime.Seconds()
+
+	msgTimeMeans := make([]float64, len(runs))
+	var connectTimes, subscribeTimes []float64
+	msgsPerSecs := make([]float64, len(runs))
+	runTimes := make([]float64, len(runs))
+	bws := make([]float64, len(runs))
+
+	perSecond := make(map[int64]int64)
+	for i, res := range runs {
+		for second, count := range res.PerSecond {
+			perSecond[second] += count
+		}
+		totals.Successes += res.Successes
+		totals.TotalMsgsPerSec += res.MsgsPerSec
+		totals.BytesReceived += res.BytesReceived
+		totals.TotalMBPerSec += res.MBPerSec
+		totals.Duplicates += res.Duplicates
+		totals.DuplicateDeliveries += res.DuplicateDeliveries
+		totals.Lost += res.Lost
+		totals.OutOfOrder += res.OutOfOrder
+		if res.MaxDisplacement > totals.MaxDisplacement {
+			totals.MaxDisplacement = res.MaxDisplacement
+		}
+		for qos, count := range res.OutOfOrderQoS {
+			if totals.OutOfOrderQoS == nil {
+				totals.OutOfOrderQoS = make(map[int]int64)
+			}
+			totals.OutOfOrderQoS[qos] += count
+		}
+		totals.Gaps += res.Gaps
+		totals.Takeovers += res.Takeovers
+		totals.Disconnects += res.Disconnects
+		totals.Truncated = totals.Truncated || res.Truncated
+		totals.RunIDMismatches += res.RunIDMismatches
+		totals.Oversize += res.Oversize
+		totals.Malformed += res.Malformed
+		totals.Corrupted += res.Corrupted
+		totals.DroppedInternal += res.DroppedInternal
+		if res.LargestPacket > totals.LargestPacket {
+			totals.LargestPacket = res.LargestPacket
+		}
+		totals.WarmupMessages += res.WarmupMessages
+		if res.LateArrivals != nil {
+			if totals.LateArrivals == nil {
+				totals.LateArrivals = new(int64)
+			}
+			*totals.LateArrivals += *res.LateArrivals
+		}
+		totals.QueueDepth += res.QueueDepth
+		if res.ConnectTime > 0 {
+			connectTimes = append(connectTimes, res.ConnectTime)
+		}
+		if res.SubscribeTime > 0 {
+			subscribeTimes = append(subscribeTimes, res.SubscribeTime)
+		}
+
+		// clients stopped by -duration without messages have no latencies
+		if res.Successes > 0 && (totals.MsgTimeMin == 0 || res.MsgTimeMin < totals.MsgTimeMin) {
+			totals.MsgTimeMin = res.MsgTimeMin
+		}
+
+		if res.MsgTimeMax > totals.MsgTimeMax {
+			totals.MsgTimeMax = res.MsgTimeMax
+		}
+
+		msgTimeMeans[i] = res.MsgTimeMean
+		msgsPerSecs[i] = res.MsgsPerSec
+		runTimes[i] = res.RunTime
+		bws[i] = res.MsgsPerSec
+	}
+	totals.AvgMsgsPerSec = stats.StatsMean(msgsPerSecs)
+	totals.FailedClients = failedClients(runs)
+	totals.RateCV = rateCV(perSecond)
+	totals.AvgRunTime = stats.StatsMean(runTimes)
+	totals.MsgTimeMeanAvg = stats.StatsMean(msgTimeMeans)
+	totals.ConnectTimeMin, totals.ConnectTimeMean, totals.ConnectTimeMax = minMeanMax(connectTimes)
+	totals.SubscribeTimeMin, totals.SubscribeTimeMean, totals.SubscribeTimeMax = minMeanMax(subscribeTimes)
+	// the per-client averages above weigh clients equally, regardless of their messages and measurement windows
+	totals.MsgTimeMean, totals.MsgTimeStd = pooledLatency(runs)
+	if from, to := measurementWindow(runs); to > from {
+		totals.WindowTime = time.Duration(to - from).Seconds()
+		totals.MsgsPerSec = float64(totals.Successes) / totals.WindowTime
+		totals.MBPerSec = float64(totals.BytesReceived) / 1e6 / totals.WindowTime
+	}
+	if totals.Successes > 0 {
+		totals.AvgPayloadSize = float64(totals.BytesReceived) / float64(totals.Successes)
+	}
+	// calculate std if sample is > 1, otherwise leave as 0 (convention)
+	if sampleSize > 1 {
+		totals.MsgTimeMeanStd = stats.StatsSampleStandardDeviation(msgTimeMeans)
+	}
+	totals.TCPInfo = calculateTCPInfoTotals(runs)
+	totals.Connect = calculateConnectTotals(runs)
+	totals.QoS2 = calculateQoS2Totals(runs)
+	totals.AddressFamilies = calculateAddressFamilies(runs)
+	totals.Anomalies = calculateAnomalyTotals(runs)
+	totals.Failover = calculateFailoverTotals(runs)
+	totals.Reconnect = calculateReconnectTotals(runs)
+	totals.Apdex = calculateApdexTotals(runs)
+	totals.OfflineQueue = calculateOfflineQueueTotals(runs)
+	totals.Chaos = calculateChaosTotals(runs)
+	totals.Compression = calculateCompressionTotals(runs, totals)
+	calculateBatchTotals(totals, runs)
+	totals.LateJoin = calculateLateJoinTotals(runs)
+	totals.Retained = calculateRetainedTotals(runs)
+	totals.Resubscribe = calculateResubscribeTotals(runs)
+	totals.Expiry = calculateExpiryTotals(runs)
+	totals.Jitter = calculateJitterTotals(runs)
+	totals.BrokerLatency = calculateBrokerLatencyTotals(runs)
+	totals.FlowControl = calculateFlowControlTotals(runs)
+	totals.DecodeWorkers = calculateDecodeWorkerTotals(runs)
+	totals.Stalls = calculateStallTotals(runs)
+	totals.Publishers = calculatePublisherTotals(runs)
+	totals.ExactlyOnce = calculateExactlyOnceTotals(runs)
+	totals.Topics = calculateTopicTotals(runs)
+	totals.Subscriptions = calculateSubscriptionTotals(runs)
+	calculateQoSTotals(totals, runs)
+
+	return totals
+}
+
+func printResults(w io.Writer, jr *results.JSONResults, format string) {
+	switch format {
+	case "json":
+		data, err := json.Marshal(jr)
+		if err != nil {
+			fatalf("Error marshalling results: %v", err)
+		}
+		var out bytes.Buffer
+		_ = json.Indent(&out, data, "", "\t")
+
+		fmt.Fprintln(w, out.String())
+	case "csv":
+		if err := printCSV(w, jr); err != nil {
+			fatalf("Error writing results: %v", err)
+		}
+	case "junit":
+		if err := printJUnit(w, jr); err != nil {
+			fatalf("Error writing results: %v", err)
+		}
+	case "tap":
+		if err := printTAP(w, jr); err != nil {
+			fatalf("Error writing results: %v", err)
+		}
+	default:
+		runs, totals := jr.Runs, jr.Totals
+		if jr.RunID != "" {
+			fmt.Fprintf(w, "Run ID:                      %s\n", jr.RunID)
+		}
+		fmt.Fprintf(w, "Seed:                        %d\n", jr.Seed)
+		for _, key := range labelFlags(jr.Labels).keys() {
+			fmt.Fprintf(w, "Label %-22s %s\n", key+":", jr.Labels[key])
+		}
+		fmt.Fprintln(w)
+		for _, res := range runs {
+			fmt.Fprintf(w, "======= CLIENT %d =======\n", res.ID)
+			if res.Broker != "" {
+				fmt.Fprintf(w, "Broker:                      %s\n", res.Broker)
+			}
+			if res.Tenant != "" {
+				fmt.Fprintf(w, "Tenant:                      %s\n", res.Tenant)
+			}
+			if res.Group != "" {
+				fmt.Fprintf(w, "Group:                       %s\n", res.Group)
+			}
+			if res.Topic != "" {
+				fmt.Fprintf(w, "Topic:                       %s\n", res.Topic)
+			}
+			if res.PersistentSession {
+				fmt.Fprintf(w, "Clean session:               false\n")
+			}
+			switch {
+			case res.SessionExpiry == sessionNeverExpires:
+				fmt.Fprintf(w, "Session expiry (s):          never\n")
+			case res.SessionExpiry > 0:
+				fmt.Fprintf(w, "Session expiry (s):          %d\n", res.SessionExpiry)
+			}
+			if res.AddressFamily != "" {
+				fmt.Fprintf(w, "Address family:              %s\n", res.AddressFamily)
+			}
+			if res.SourceAddress != "" {
+				fmt.Fprintf(w, "Source address:              %s\n", res.SourceAddress)
+			}
+			fmt.Fprintf(w, "QoS:                         %d\n", res.QoS)
+			printQoS(w, res.GrantedQoS, res.DeliveredQoS, res.QoSMismatches)
+			fmt.Fprintf(w, "Number of messages received: %d\n", res.Successes)
+			fmt.Fprintf(w, "Runtime (s):                 %.3f\n", res.RunTime)
+			fmt.Fprintf(w, "Msg latency min (ms):        %.3f\n", res.MsgTimeMin / 1_000_000)
+			fmt.Fprintf(w, "Msg latency max (ms):        %.3f\n", res.MsgTimeMax / 1_000_000)
+			fmt.Fprintf(w, "Msg latency mean (ms):       %.3f\n", res.MsgTimeMean / 1_000_000)
+			fmt.Fprintf(w, "Msg latency std (ms):        %.3f\n", res.MsgTimeStd / 1_000_000)
+			printPercentiles(w, res.Percentiles)
+			fmt.Fprintf(w, "Bandwidth (msg/sec):         %.3f\n", res.MsgsPerSec)
+			fmt.Fprintf(w, "Bytes received:              %d\n", res.BytesReceived)
+			fmt.Fprintf(w, "Avg payload size (bytes):    %.1f\n", res.AvgPayloadSize)
+			fmt.Fprintf(w, "Bandwidth (MB/sec):          %.3f\n", res.MBPerSec)
+			printBatches(w, res.Batches, res.RecordsPerBatch)
+			if res.Compression != nil {
+				printCompression(w, res.Compression)
+			}
+			fmt.Fprintf(w, "Rate stability (CV):         %.3f\n", res.RateCV)
+			fmt.Fprintf(w, "Messages beyond count:       %d\n", res.Duplicates)
+			fmt.Fprintf(w, "Duplicate deliveries:        %d\n", res.DuplicateDeliveries)
+			fmt.Fprintf(w, "Lost / out of order:         %d / %d (%d gaps)\n", res.Lost, res.OutOfOrder, res.Gaps)
+			printReordering(w, res.OutOfOrder, res.MaxDisplacement, res.OutOfOrderQoS)
+			if res.ExactlyOnce != nil {
+				printExactlyOnce(w, res.ExactlyOnce)
+			}
+			fmt.Fprintf(w, "Queue depth estimate:        %.3f\n", res.QueueDepth)
+			fmt.Fprintf(w, "Session takeovers:           %d\n", res.Takeovers)
+			fmt.Fprintf(w, "Disconnects:                 %d\n", res.Disconnects)
+			fmt.Fprintf(w, "Connect time (ms):           %.3f\n", res.ConnectTime/1_000_000)
+			fmt.Fprintf(w, "Subscribe time (ms):         %.3f\n", res.SubscribeTime/1_000_000)
+			if res.Truncated {
+				fmt.Fprintf(w, "Truncated:                   stopped before all messages were received\n")
+			}
+			if res.Error != "" {
+				fmt.Fprintf(w, "Error:                       %s\n", res.Error)
+			}
+			if res.RunIDMismatches > 0 {
+				fmt.Fprintf(w, "Run ID mismatches:           %d\n", res.RunIDMismatches)
+			}
+			printPacketSizes(w, res.LargestPacket, res.Oversize, res.Malformed)
+			if res.Corrupted > 0 {
+				fmt.Fprintf(w, "Corrupted messages:          %d\n", res.Corrupted)
+			}
+			if res.DroppedInternal > 0 {
+				fmt.Fprintf(w, "Dropped by the pipeline:     %d\n", res.DroppedInternal)
+			}
+			if res.DecodeWorkers != nil {
+				printDecodeWorkers(w, res.DecodeWorkers)
+			}
+			if res.LateArrivals != nil {
+				fmt.Fprintf(w, "Late arrivals (cooldown):    %d\n", *res.LateArrivals)
+			}
+			if res.WarmupMessages > 0 {
+				fmt.Fprintf(w, "Warm-up messages:            %d\n", res.WarmupMessages)
+			}
+			for _, count := range res.Publishers {
+				if count.Missing > 0 {
+					fmt.Fprintf(w, "Missing from publisher %-5d %d of %d\n", count.ClientID, count.Missing, count.Expected)
+				}
+			}
+			fmt.Fprintln(w)
+			if res.Apdex != nil {
+				printApdex(w, res.Apdex)
+			}
+			if res.Confidence != nil {
+				printConfidence(w, res.Confidence)
+			}
+			if res.TCPInfo != nil {
+				printTCPInfo(w, res.TCPInfo)
+			}
+			if res.Connect != nil {
+				printConnect(w, res.Connect)
+			}
+			if res.QoS2 != nil {
+				printQoS2(w, res.QoS2)
+			}
+			if res.Payloads != nil {
+				printPayloads(w, res.Payloads)
+			}
+			if res.Reconnect != nil {
+				printReconnect(w, res.Reconnect)
+			}
+			if res.Failover != nil {
+				printFailover(w, res.Failover)
+			}
+			if res.OfflineQueue != nil {
+				printOfflineQueue(w, res.OfflineQueue)
+			}
+			if res.Chaos != nil {
+				printChaos(w, res.Chaos)
+			}
+			if res.LateJoin != nil {
+				printLateJoin(w, res.LateJoin)
+			}
+			if res.Retained != nil {
+				printRetained(w, res.Retained)
+			}
+			if res.Resubscribe != nil {
+				printResubscribe(w, res.Resubscribe)
+			}
+			if res.Expiry != nil {
+				printExpiry(w, res.Expiry)
+			}
+			if res.Jitter != nil {
+				printJitter(w, res.Jitter)
+			}
+			if res.BrokerLatency != nil {
+				printBrokerLatency(w, res.BrokerLatency)
+			}
+			if res.FlowControl != nil {
+				printFlowControl(w, res.FlowControl)
+			}
+			if res.Stalls != nil {
+				printStalls(w, res.Stalls)
+			}
+			if res.Subscriptions != nil {
+				printSubscriptions(w, res.Subscriptions)
+			}
+		}
+		fmt.Fprintf(w, "========= TOTAL (%d) =========\n", len(runs))
+		fmt.Fprintf(w, "Number of messages received: %d\n", totals.Successes)
+		fmt.Fprintf(w, "Total Runtime (sec):         %.3f\n", totals.TotalRunTime)
+		fmt.Fprintf(w, "Average Runtime (sec):       %.3f\n", totals.AvgRunTime)
+		fmt.Fprintf(w, "Msg latency min (ms):        %.3f\n", totals.MsgTimeMin / 1_000_000)
+		fmt.Fprintf(w, "Msg latency max (ms):        %.3f\n", totals.MsgTimeMax / 1_000_000)
+		fmt.Fprintf(w, "Msg latency mean mean (ms):  %.3f\n", totals.MsgTimeMeanAvg / 1_000_000)
+		fmt.Fprintf(w, "Msg latency mean std (ms):   %.3f\n", totals.MsgTimeMeanStd / 1_000_000)
+		fmt.Fprintf(w, "Msg latency mean (ms):       %.3f\n", totals.MsgTimeMean/1_000_000)
+		fmt.Fprintf(w, "Msg latency std (ms):        %.3f\n", totals.MsgTimeStd/1_000_000)
+		printPercentiles(w, totals.Percentiles)
+		fmt.Fprintf(w, "Average Bandwidth (msg/sec): %.3f\n", totals.AvgMsgsPerSec)
+		fmt.Fprintf(w, "Total Bandwidth (msg/sec):   %.3f\n", totals.TotalMsgsPerSec)
+		fmt.Fprintf(w, "Throughput (msg/sec):        %.3f over %.3f s\n", totals.MsgsPerSec, totals.WindowTime)
+		fmt.Fprintf(w, "Bytes received:              %d\n", totals.BytesReceived)
+		fmt.Fprintf(w, "Avg payload size (bytes):    %.1f\n", totals.AvgPayloadSize)
+		fmt.Fprintf(w, "Total Bandwidth (MB/sec):    %.3f\n", totals.TotalMBPerSec)
+		fmt.Fprintf(w, "Throughput (MB/sec):         %.3f\n", totals.MBPerSec)
+		printBatches(w, totals.Batches, totals.RecordsPerBatch)
+		if totals.Compression != nil {
+			printCompression(w, totals.Compression)
+		}
+		fmt.Fprintf(w, "Rate stability (CV):         %.3f\n", totals.RateCV)
+		fmt.Fprintf(w, "Messages beyond count:       %d\n", totals.Duplicates)
+		fmt.Fprintf(w, "Duplicate deliveries:        %d\n", totals.DuplicateDeliveries)
+		fmt.Fprintf(w, "Lost / out of order:         %d / %d (%d gaps)\n", totals.Lost, totals.OutOfOrder, totals.Gaps)
+		printReordering(w, totals.OutOfOrder, totals.MaxDisplacement, totals.OutOfOrderQoS)
+		if totals.ExactlyOnce != nil {
+			printExactlyOnce(w, totals.ExactlyOnce)
+		}
+		if totals.QoSDowngrades > 0 {
+			fmt.Fprintf(w, "QoS downgrades (clients):    %d\n", totals.QoSDowngrades)
+		}
+		printQoS(w, nil, totals.DeliveredQoS, totals.QoSMismatches)
+		fmt.Fprintf(w, "Queue depth estimate:        %.3f\n", totals.QueueDepth)
+		fmt.Fprintf(w, "Session takeovers:           %d\n", totals.Takeovers)
+		fmt.Fprintf(w, "Disconnects:                 %d\n", totals.Disconnects)
+		fmt.Fprintf(w, "Connect (ms) min/mean/max:   %.3f / %.3f / %.3f\n",
+			totals.ConnectTimeMin/1_000_000, totals.ConnectTimeMean/1_000_000, totals.ConnectTimeMax/1_000_000)
+		fmt.Fprintf(w, "Subscribe (ms) min/mean/max: %.3f / %.3f / %.3f\n",
+			totals.SubscribeTimeMin/1_000_000, totals.SubscribeTimeMean/1_000_000, totals.SubscribeTimeMax/1_000_000)
+		if totals.Truncated {
+			fmt.Fprintf(w, "Truncated:                   stopped before all messages were received\n")
+		}
+		if len(totals.FailedClients) > 0 {
+			fmt.Fprintf(w, "Failed clients:              %s\n", strings.Trim(fmt.Sprint(totals.FailedClients), "[]"))
+		}
+		if totals.AddressFamilies != nil {
+			fmt.Fprintf(w, "Clients over IPv4 / IPv6:    %d / %d\n", totals.AddressFamilies["ipv4"], totals.AddressFamilies["ipv6"])
+		}
+		if totals.RunIDMismatches > 0 {
+			fmt.Fprintf(w, "Run ID mismatches:           %d\n", totals.RunIDMismatches)
+		}
+		printPacketSizes(w, totals.LargestPacket, totals.Oversize, totals.Malformed)
+		if totals.Corrupted > 0 {
+			fmt.Fprintf(w, "Corrupted messages:          %d\n", totals.Corrupted)
+		}
+		if totals.DroppedInternal > 0 {
+			fmt.Fprintf(w, "Dropped by the pipeline:     %d\n", totals.DroppedInternal)
+		}
+		if totals.DecodeWorkers != nil {
+			printDecodeWorkers(w, totals.DecodeWorkers)
+		}
+		if totals.LateArrivals != nil {
+			fmt.Fprintf(w, "Late arrivals (cooldown):    %d\n", *totals.LateArrivals)
+		}
+		if totals.WarmupMessages > 0 || totals.PublishersReady > 0 || totals.StartedAfter > 0 {
+			fmt.Fprintf(w, "Warm-up messages:            %d\n", totals.WarmupMessages)
+		}
+		if totals.PublishersReady > 0 {
+			fmt.Fprintf(w, "Publishers ready after (ms): %.3f\n", totals.PublishersReady/1_000_000)
+		}
+		if totals.StartedAfter > 0 {
+			fmt.Fprintf(w, "Start message after (ms):    %.3f\n", totals.StartedAfter/1_000_000)
+		}
+		fmt.Fprintln(w)
+		if totals.Apdex != nil {
+			printApdex(w, totals.Apdex)
+		}
+		if totals.Confidence != nil {
+			printConfidence(w, totals.Confidence)
+		}
+		if totals.TCPInfo != nil {
+			printTCPInfo(w, totals.TCPInfo)
+		}
+		if totals.Connect != nil {
+			printConnectPhases(w, totals.Connect)
+		}
+		if totals.QoS2 != nil {
+			printQoS2(w, totals.QoS2)
+		}
+		if totals.InterArrival != nil {
+			printInterArrival(w, totals.InterArrival)
+		}
+		if totals.Anomalies != nil {
+			printAnomalies(w, totals.Anomalies)
+		}
+		if totals.Reconnect != nil {
+			printReconnect(w, totals.Reconnect)
+		}
+		if totals.Failover != nil {
+			printFailover(w, totals.Failover)
+		}
+		if totals.OfflineQueue != nil {
+			printOfflineQueue(w, totals.OfflineQueue)
+		}
+		if totals.Chaos != nil {
+			printChaos(w, totals.Chaos)
+		}
+		if totals.LateJoin != nil {
+			printLateJoin(w, totals.LateJoin)
+		}
+		if totals.Retained != nil {
+			printRetained(w, totals.Retained)
+		}
+		if totals.Resubscribe != nil {
+			printResubscribe(w, totals.Resubscribe)
+		}
+		if totals.Expiry != nil {
+			printExpiry(w, totals.Expiry)
+		}
+		if totals.Jitter != nil {
+			printJitter(w, totals.Jitter)
+		}
+		if totals.BrokerLatency != nil {
+			printBrokerLatency(w, totals.BrokerLatency)
+		}
+		if totals.FlowControl != nil {
+			printFlowControl(w, totals.FlowControl)
+		}
+		if totals.Stalls != nil {
+			printStalls(w, totals.Stalls)
+		}
+		if totals.Subscriptions != nil {
+			printSubscriptions(w, totals.Subscriptions)
+		}
+		if totals.SharedGroup != nil {
+			printSharedGroup(w, totals.SharedGroup)
+		}
+		if totals.RampUp != nil {
+			printRampUp(w, totals.RampUp)
+		}
+		if len(totals.Publishers) > 0 {
+			fmt.Fprintf(w, "======= PUBLISHERS (%d) =======\n", len(totals.Publishers))
+			fmt.Fprintf(w, "Publisher  Received  Expected   Missing\n")
+			for _, count := range totals.Publishers {
+				fmt.Fprintf(w, "%9d  %8d  %8d  %8d\n", count.ClientID, count.Received, count.Expected, count.Missing)
+			}
+			fmt.Fprintln(w)
+		}
+		if len(totals.Topics) > 0 {
+			printTopics(w, totals.Topics)
+		}
+		if totals.Probe != nil {
+			fmt.Fprintf(w, "======= SUBSCRIBE PROBE (%d) =======\n", len(totals.Probe.Samples))
+			fmt.Fprintf(w, "SUBACK latency min (ms):     %.3f\n", totals.Probe.SubackMin/1_000_000)
+			fmt.Fprintf(w, "SUBACK latency max (ms):     %.3f\n", totals.Probe.SubackMax/1_000_000)
+			fmt.Fprintf(w, "SUBACK latency mean (ms):    %.3f\n", totals.Probe.SubackMean/1_000_000)
+			fmt.Fprintf(w, "SUBACK latency std (ms):     %.3f\n", totals.Probe.SubackStd/1_000_000)
+			fmt.Fprintf(w, "SUBACK trend (ms/min):       %.3f\n", totals.Probe.SubackTrend*60/1_000_000)
+			fmt.Fprintf(w, "UNSUBACK latency mean (ms):  %.3f\n", totals.Probe.UnsubackMean/1_000_000)
+			fmt.Fprintf(w, "Probe errors:                %d\n\n", totals.Probe.Errors)
+			fmt.Fprintf(w, "Elapsed (s)  Connections  SUBACK (ms)\n")
+			for _, sample := range totals.Probe.Samples {
+				fmt.Fprintf(w, "%11.3f  %11d  %11.3f\n", sample.Time, sample.Connections, sample.SubackLatency/1_000_000)
+			}
+			fmt.Fprintln(w)
+		}
+		for _, node := range jr.Nodes {
+			fmt.Fprintf(w, "======= NODE %s (%d) =======\n", node.Broker, node.Clients)
+			fmt.Fprintf(w, "Number of messages received: %d\n", node.Successes)
+			fmt.Fprintf(w, "Msg latency min (ms):        %.3f\n", node.MsgTimeMin/1_000_000)
+			fmt.Fprintf(w, "Msg latency max (ms):        %.3f\n", node.MsgTimeMax/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean mean (ms):  %.3f\n", node.MsgTimeMeanAvg/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean std (ms):   %.3f\n", node.MsgTimeMeanStd/1_000_000)
+			fmt.Fprintf(w, "Total Bandwidth (msg/sec):   %.3f\n", node.TotalMsgsPerSec)
+			fmt.Fprintf(w, "Messages beyond count:       %d\n\n", node.Duplicates)
+		}
+		for _, worker := range jr.Workers {
+			fmt.Fprintf(w, "======= WORKER %d %s (%d) =======\n", worker.Index, worker.Worker, worker.Clients)
+			fmt.Fprintf(w, "Number of messages received: %d\n", worker.Successes)
+			fmt.Fprintf(w, "Msg latency min (ms):        %.3f\n", worker.MsgTimeMin/1_000_000)
+			fmt.Fprintf(w, "Msg latency max (ms):        %.3f\n", worker.MsgTimeMax/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean mean (ms):  %.3f\n", worker.MsgTimeMeanAvg/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean std (ms):   %.3f\n", worker.MsgTimeMeanStd/1_000_000)
+			fmt.Fprintf(w, "Total Bandwidth (msg/sec):   %.3f\n", worker.TotalMsgsPerSec)
+			fmt.Fprintf(w, "Messages beyond count:       %d\n\n", worker.Duplicates)
+		}
+		for _, group := range jr.Groups {
+			fmt.Fprintf(w, "======= GROUP %s (%d) =======\n", group.Group, group.Clients)
+			fmt.Fprintf(w, "Number of messages received: %d\n", group.Successes)
+			fmt.Fprintf(w, "Msg latency min (ms):        %.3f\n", group.MsgTimeMin/1_000_000)
+			fmt.Fprintf(w, "Msg latency max (ms):        %.3f\n", group.MsgTimeMax/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean mean (ms):  %.3f\n", group.MsgTimeMeanAvg/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean std (ms):   %.3f\n", group.MsgTimeMeanStd/1_000_000)
+			fmt.Fprintf(w, "Total Bandwidth (msg/sec):   %.3f\n", group.TotalMsgsPerSec)
+			fmt.Fprintf(w, "Messages beyond count:       %d\n\n", group.Duplicates)
+		}
+		for _, tenant := range jr.Tenants {
+			fmt.Fprintf(w, "======= TENANT %s (%d) =======\n", tenant.Tenant, tenant.Clients)
+			fmt.Fprintf(w, "Number of messages received: %d\n", tenant.Successes)
+			fmt.Fprintf(w, "Msg latency min (ms):        %.3f\n", tenant.MsgTimeMin/1_000_000)
+			fmt.Fprintf(w, "Msg latency max (ms):        %.3f\n", tenant.MsgTimeMax/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean mean (ms):  %.3f\n", tenant.MsgTimeMeanAvg/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean std (ms):   %.3f\n", tenant.MsgTimeMeanStd/1_000_000)
+			fmt.Fprintf(w, "Total Bandwidth (msg/sec):   %.3f\n", tenant.TotalMsgsPerSec)
+			fmt.Fprintf(w, "Messages beyond count:       %d\n\n", tenant.Duplicates)
+		}
+		for _, level := range jr.QoS {
+			fmt.Fprintf(w, "======= QOS %d (%d) =======\n", level.QoS, level.Clients)
+			fmt.Fprintf(w, "Number of messages received: %d\n", level.Successes)
+			fmt.Fprintf(w, "Msg latency min (ms):        %.3f\n", level.MsgTimeMin/1_000_000)
+			fmt.Fprintf(w, "Msg latency max (ms):        %.3f\n", level.MsgTimeMax/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean mean (ms):  %.3f\n", level.MsgTimeMeanAvg/1_000_000)
+			fmt.Fprintf(w, "Msg latency mean std (ms):   %.3f\n", level.MsgTimeMeanStd/1_000_000)
+			fmt.Fprintf(w, "Total Bandwidth (msg/sec):   %.3f\n", level.TotalMsgsPerSec)
+			fmt.Fprintf(w, "Messages beyond count:       %d\n\n", level.Duplicates)
+		}
+		if len(totals.LatencySeries) > 0 {
+			fmt.Fprintf(w, "======= LATENCY OVER TIME =======\n")
+			fmt.Fprintf(w, "Elapsed (s)  Received   msg/sec  p50 (ms)  p95 (ms)  p99 (ms)\n")
+			for _, sample := range totals.LatencySeries {
+				fmt.Fprintf(w, "%11.3f  %8d  %8.1f  %8.3f  %8.3f  %8.3f\n", sample.Elapsed, sample.Received, sample.MsgsPerSec,
+					sample.P50/1_000_000, sample.P95/1_000_000, sample.P99/1_000_000)
+			}
+			fmt.Fprintln(w)
+		}
+		if totals.FDs != nil {
+			fmt.Fprintf(w, "File descriptor limit:       %d\n", totals.FDs.Limit)
+			fmt.Fprintf(w, "Peak file descriptors:       %d\n\n", totals.FDs.Peak)
+		}
+		if totals.Self != nil {
+			printSelf(w, totals.Self)
+		}
+		if totals.Container != nil {
+			printContainer(w, totals.Container)
+		}
+		if totals.Clock != nil {
+			fmt.Fprintf(w, "Clock source:                %s\n", totals.Clock.Source)
+			fmt.Fprintf(w, "Wall clock divergence (ms):  %.3f\n", totals.Clock.Divergence/1_000_000)
+			if totals.Clock.Offset != 0 {
+				fmt.Fprintf(w, "Clock offset applied (ms):   %.3f\n", totals.Clock.Offset/1_000_000)
+			}
+			if totals.Clock.NTPServer != "" {
+				fmt.Fprintf(w, "NTP offset start (ms):       %.3f\n", totals.Clock.NTPOffsetStart/1_000_000)
+				fmt.Fprintf(w, "NTP offset end (ms):         %.3f\n", totals.Clock.NTPOffsetEnd/1_000_000)
+				fmt.Fprintf(w, "Clock drift (ms):            %.3f\n", totals.Clock.Drift/1_000_000)
+				fmt.Fprintf(w, "Clock drift (ppm):           %.3f\n", totals.Clock.DriftPPM)
+			}
+			fmt.Fprintln(w)
+		}
+		if totals.TLSSessions != nil {
+			fmt.Fprintf(w, "TLS handshakes:              %d\n", totals.TLSSessions.Handshakes)
+			fmt.Fprintf(w, "TLS sessions resumed:        %d\n", totals.TLSSessions.Resumed)
+			fmt.Fprintf(w, "TLS resumption rate:         %.3f\n\n", totals.TLSSessions.ResumptionRate)
+		}
+		if totals.Interface != nil {
+			fmt.Fprintf(w, "======= INTERFACE %s =======\n", totals.Interface.Name)
+			fmt.Fprintf(w, "Received bytes:              %d\n", totals.Interface.RxBytes)
+			fmt.Fprintf(w, "Received packets:            %d\n", totals.Interface.RxPackets)
+			fmt.Fprintf(w, "Bandwidth (bytes/sec):       %.3f\n", totals.Interface.RxBytesPerSec)
+			fmt.Fprintf(w, "Bandwidth (packets/sec):     %.3f\n\n", totals.Interface.RxPacketsPerSec)
+		}
+		if jr.Baseline != nil {
+			printBaseline(w, jr.Baseline)
+		}
+		if jr.Thresholds != nil {
+			printThresholds(w, jr.Thresholds)
+		}
+	}
+}
+
+func printApdex(w io.Writer, apdex *results.ApdexResults) {
+	fmt.Fprintf(w, "Apdex score:                 %.3f\n", apdex.Score)
+	fmt.Fprintf(w, "Apdex satisfied:             %d\n", apdex.Satisfied)
+	fmt.Fprintf(w, "Apdex tolerating:            %d\n", apdex.Tolerating)
+	fmt.Fprintf(w, "Apdex frustrated:            %d\n\n", apdex.Frustrated)
+}
+
+func printConfidence(w io.Writer, ci *results.ConfidenceResults) {
+	fmt.Fprintf(w, "Latency mean %2.0f%% CI (ms):    %.3f - %.3f\n", ci.Level*100, ci.MeanLow/1_000_000, ci.MeanHigh/1_000_000)
+	fmt.Fprintf(w, "Latency p99 %2.0f%% CI (ms):     %.3f - %.3f\n\n", ci.Level*100, ci.P99Low/1_000_000, ci.P99High/1_000_000)
+}
+
+func printTCPInfo(w io.Writer, info *results.TCPInfoResults) {
+	fmt.Fprintf(w, "TCP RTT min (ms):            %.3f\n", info.RTTMin/1_000_000)
+	fmt.Fprintf(w, "TCP RTT max (ms):            %.3f\n", info.RTTMax/1_000_000)
+	fmt.Fprintf(w, "TCP RTT mean (ms):           %.3f\n", info.RTTMean/1_000_000)
+	fmt.Fprintf(w, "TCP RTT var max (ms):        %.3f\n", info.RTTVarMax/1_000_000)
+	fmt.Fprintf(w, "TCP retransmits:             %d\n\n", info.Retransmits)
+}
+
+func printSelf(w io.Writer, self *results.SelfResults) {
+	fmt.Fprintf(w, "CPU user / sys (ms):         %.3f / %.3f\n", self.CPUUser/1_000_000, self.CPUSystem/1_000_000)
+	fmt.Fprintf(w, "CPU busy (cores):            %.3f\n", self.CPUCores)
+	fmt.Fprintf(w, "Heap peak (MB):              %.1f\n", float64(self.HeapPeak)/(1<<20))
+	fmt.Fprintf(w, "Memory from the OS (MB):     %.1f\n", float64(self.SysMemory)/(1<<20))
+	fmt.Fprintf(w, "Allocated (MB):              %.1f\n", float64(self.Allocated)/(1<<20))
+	fmt.Fprintf(w, "Peak goroutines:             %d\n", self.GoroutinesPeak)
+	fmt.Fprintf(w, "GC cycles:                   %d\n", self.GCCycles)
+	fmt.Fprintf(w, "GC pause total / max (ms):   %.3f / %.3f\n\n", self.GCPauseTotal/1_000_000, self.GCPauseMax/1_000_000)
+}
+
+func printContainer(w io.Writer, container *results.ContainerResults) {
+	fmt.Fprintf(w, "Cgroup version:              %d\n", container.CgroupVersion)
+	if container.CPULimit > 0 {
+		fmt.Fprintf(w, "Container CPU limit (cores): %.2f\n", container.CPULimit)
+	}
+	if container.MemoryLimit > 0 {
+		fmt.Fprintf(w, "Container memory limit (MB): %.1f\n", float64(container.MemoryLimit)/(1<<20))
+	}
+	if container.MemoryPeak > 0 {
+		fmt.Fprintf(w, "Container memory peak (MB):  %.1f\n", float64(container.MemoryPeak)/(1<<20))
+	}
+	fmt.Fprintf(w, "CPU throttled periods:       %d of %d (%.1f%%)\n",
+		container.ThrottledPeriods, container.Periods, container.ThrottledRatio*100)
+	fmt.Fprintf(w, "CPU throttled time (ms):     %.3f\n\n", container.ThrottledTime/1_000_000)
+}
+
+// printPacketSizes prints the packet size counters, only if messages were dropped or could not be decoded
+func printPacketSizes(w io.Writer, largest, oversize, malformed int64) {
+	if oversize == 0 && malformed == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Largest packet (bytes):      %d\n", largest)
+	fmt.Fprintf(w, "Oversize messages:           %d\n", oversize)
+	fmt.Fprintf(w, "Malformed messages:          %d\n", malformed)
+}
+
+func printPayloads(w io.Writer, payloads *results.PayloadResults) {
+	fmt.Fprintf(w, "Payloads received:           %d\n", payloads.Received)
+	for _, list := range []struct {
+		name    string
+		samples []*results.PayloadSample
+	}{{"First", payloads.First}, {"Last", payloads.Last}} {
+		for _, sample := range list.samples {
+			fmt.Fprintf(w, "%-5s %s %s (%d bytes, %s): %s\n", list.name,
+				time.Unix(0, sample.ReceivedAt).Format("15:04:05.000"), sample.Topic, sample.Size, sample.Encoding, sample.Payload)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func printPercentiles(w io.Writer, percentiles []*results.Percentile) {
+	for _, p := range percentiles {
+		label := fmt.Sprintf("Msg latency p%v (ms):", p.Percentile)
+		fmt.Fprintf(w, "%-29s%.3f\n", label, p.Latency/1_000_000)
+	}
+}
+
+func printConnect(w io.Writer, connect *results.ConnectResults) {
+	fmt.Fprintf(w, "Connect DNS (ms):            %.3f\n", connect.DNS/1_000_000)
+	fmt.Fprintf(w, "Connect TCP (ms):            %.3f\n", connect.TCP/1_000_000)
+	fmt.Fprintf(w, "Connect TLS (ms):            %.3f\n", connect.TLS/1_000_000)
+	fmt.Fprintf(w, "Connect MQTT (ms):           %.3f\n", connect.MQTT/1_000_000)
+	fmt.Fprintf(w, "Connect total (ms):          %.3f\n\n", connect.Total/1_000_000)
+}
+
+// maxPrintedAnomalies bounds the anomalies listed in the text output, the JSON results list more
+const maxPrintedAnomalies = 50
+
+func printAnomalies(w io.Writer, anomalies *results.AnomalyResults) {
+	fmt.Fprintf(w, "======= LATENCY ANOMALIES (%d) =======\n", anomalies.Count)
+	fmt.Fprintf(w, "Received at   client  publisher  message  latency (ms)  median (ms)\n")
+	for i, a := range anomalies.Anomalies {
+		if i == maxPrintedAnomalies {
+			fmt.Fprintf(w, "... %d more\n", anomalies.Count-int64(i))
+			break
+		}
+		fmt.Fprintf(w, "%s  %6d  %9d  %7d  %12.3f  %11.3f\n", time.Unix(0, a.ReceivedAt).Format("15:04:05.000"),
+			a.Client, a.Publisher, a.MessageID, a.Latency/1_000_000, a.Median/1_000_000)
+	}
+	fmt.Fprintln(w)
+}
+
+func printInterArrival(w io.Writer, ia *results.InterArrivalResults) {
+	fmt.Fprintf(w, "======= INTER-ARRIVAL TIMES (%d) =======\n", ia.Samples)
+	fmt.Fprintf(w, "Mean (ms):                   %.3f\n", ia.Mean/1_000_000)
+	fmt.Fprintf(w, "Std (ms):                    %.3f\n", ia.Std/1_000_000)
+	fmt.Fprintf(w, "CV:                          %.3f\n", ia.CV)
+	if ia.Exponential != nil {
+		fmt.Fprintf(w, "Exponential rate (msg/sec):  %.3f (KS %.4f)\n", ia.Exponential.Rate, ia.Exponential.KS)
+	}
+	if ia.Lognormal != nil {
+		fmt.Fprintf(w, "Lognormal mu, sigma:         %.3f, %.3f (KS %.4f)\n", ia.Lognormal.Mu, ia.Lognormal.Sigma, ia.Lognormal.KS)
+	}
+	if ia.BestFit != "" {
+		fmt.Fprintf(w, "Best fit:                    %s\n", ia.BestFit)
+	}
+	fmt.Fprintln(w)
+}
+
+func printConnectPhases(w io.Writer, connect *results.ConnectTotalResults) {
+	fmt.Fprintf(w, "======= CONNECT PHASES (%d) =======\n", connect.Clients)
+	fmt.Fprintf(w, "Phase  min (ms)  mean (ms)  p50 (ms)  p95 (ms)  p99 (ms)  max (ms)\n")
+	for _, phase := range []struct {
+		name string
+		dist *results.PhaseDistribution
+	}{
+		{"DNS", connect.DNS}, {"TCP", connect.TCP}, {"TLS", connect.TLS}, {"MQTT", connect.MQTT}, {"Total", connect.Total},
+	} {
+		d := phase.dist
+		fmt.Fprintf(w, "%-5s  %8.3f  %9.3f  %8.3f  %8.3f  %8.3f  %8.3f\n", phase.name, d.Min/1_000_000, d.Mean/1_000_000,
+			d.P50/1_000_000, d.P95/1_000_000, d.P99/1_000_000, d.Max/1_000_000)
+	}
+	fmt.Fprintln(w)
+}
+
+func printQoS2(w io.Writer, qos2 *results.QoS2Results) {
+	fmt.Fprintf(w, "======= QOS 2 EXCHANGE (%d, %d incomplete) =======\n", qos2.Exchanges, qos2.Incomplete)
+	fmt.Fprintf(w, "Phase    min (ms)  mean (ms)  p50 (ms)  p95 (ms)  p99 (ms)  max (ms)\n")
+	for _, phase := range []struct {
+		name string
+		dist *results.PhaseDistribution
+	}{
+		{"PUBREC", qos2.PubRec}, {"PUBREL", qos2.PubRel}, {"PUBCOMP", qos2.PubComp}, {"Total", qos2.Total},
+	} {
+		d := phase.dist
+		fmt.Fprintf(w, "%-7s  %8.3f  %9.3f  %8.3f  %8.3f  %8.3f  %8.3f\n", phase.name, d.Min/1_000_000, d.Mean/1_000_000,
+			d.P50/1_000_000, d.P95/1_000_000, d.P99/1_000_000, d.Max/1_000_000)
+	}
+	fmt.Fprintln(w)
+}
+
+func printReconnect(w io.Writer, reconnect *results.ReconnectResults) {
+	fmt.Fprintf(w, "Connection losses:           %d\n", reconnect.ConnectionLosses)
+	fmt.Fprintf(w, "Reconnects:                  %d\n", reconnect.Reconnects)
+	if reconnect.Attempts > 0 {
+		fmt.Fprintf(w, "Reconnect attempts:          %d\n", reconnect.Attempts)
+	}
+	fmt.Fprintf(w, "Reconnect time mean (ms):    %.3f\n", reconnect.ReconnectTime/1_000_000)
+	fmt.Fprintf(w, "Reconnect time max (ms):     %.3f\n", reconnect.ReconnectTimeMax/1_000_000)
+	fmt.Fprintf(w, "Downtime (ms):               %.3f\n", reconnect.Downtime/1_000_000)
+	fmt.Fprintf(w, "Missed while disconnected:   %d\n\n", reconnect.MissedMessages)
+}
+
+func printFailover(w io.Writer, failover *results.FailoverResults) {
+	fmt.Fprintf(w, "Failovers:                   %d\n", failover.Failovers)
+	fmt.Fprintf(w, "Reconnect time mean (ms):    %.3f\n", failover.ReconnectTime/1_000_000)
+	fmt.Fprintf(w, "Reconnect time max (ms):     %.3f\n", failover.ReconnectTimeMax/1_000_000)
+	fmt.Fprintf(w, "Resume time mean (ms):       %.3f\n", failover.ResumeTime/1_000_000)
+	fmt.Fprintf(w, "Resume time max (ms):        %.3f\n", failover.ResumeTimeMax/1_000_000)
+	fmt.Fprintf(w, "Missed messages:             %d\n\n", failover.MissedMessages)
+}
+
+func printOfflineQueue(w io.Writer, queue *results.OfflineQueueResults) {
+	fmt.Fprintf(w, "Offline time (ms):           %.3f\n", queue.OfflineTime/1_000_000)
+	fmt.Fprintf(w, "Queued messages:             %d\n", queue.QueuedMessages)
+	fmt.Fprintf(w, "Queue drain time (ms):       %.3f\n", queue.DrainTime/1_000_000)
+	fmt.Fprintf(w, "Queue drain rate (msg/sec):  %.3f\n", queue.DrainRate)
+	fmt.Fprintf(w, "Queued latency min (ms):     %.3f\n", queue.QueuedLatencyMin/1_000_000)
+	fmt.Fprintf(w, "Queued latency max (ms):     %.3f\n", queue.QueuedLatencyMax/1_000_000)
+	fmt.Fprintf(w, "Queued latency mean (ms):    %.3f\n", queue.QueuedLatencyMean/1_000_000)
+	fmt.Fprintf(w, "Queued latency std (ms):     %.3f\n\n", queue.QueuedLatencyStd/1_000_000)
+}
+
+func printChaos(w io.Writer, chaos *results.ChaosResults) {
+	fmt.Fprintf(w, "Dropped / recovered:         %d / %d\n", chaos.Clients, chaos.Recovered)
+	fmt.Fprintf(w, "Reconnect after drop (ms):   %.3f\n", chaos.ReconnectTime/1_000_000)
+	fmt.Fprintf(w, "Reconnect max (ms):          %.3f\n", chaos.ReconnectTimeMax/1_000_000)
+	fmt.Fprintf(w, "Recovery after drop (ms):    %.3f\n", chaos.RecoveryTime/1_000_000)
+	fmt.Fprintf(w, "Recovery max (ms):           %.3f\n", chaos.RecoveryTimeMax/1_000_000)
+	fmt.Fprintf(w, "Redelivered messages:        %d\n\n", chaos.Redelivered)
+}
+
+func printBatches(w io.Writer, batches int64, recordsPerBatch float64) {
+	if batches == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Batches received:            %d\n", batches)
+	fmt.Fprintf(w, "Records per batch:           %.1f\n", recordsPerBatch)
+}
+
+func printExactlyOnce(w io.Writer, eo *results.ExactlyOnceResults) {
+	verdict := "PASS"
+	if !eo.Passed {
+		verdict = "FAIL"
+	}
+	fmt.Fprintf(w, "Exactly-once:                %s (MessageIds %d-%d of %d publishers)\n", verdict, eo.FirstID, eo.LastID, eo.Publishers)
+	fmt.Fprintf(w, "Missing / duplicated ids:    %d / %d of %d\n", eo.Missing, eo.Duplicated, eo.Expected)
+	if eo.Unexpected > 0 {
+		fmt.Fprintf(w, "Ids outside the range:       %d\n", eo.Unexpected)
+	}
+	if eo.FailedClients > 0 {
+		fmt.Fprintf(w, "Failed exactly-once clients: %d\n", eo.FailedClients)
+	}
+}
+
+func printCompression(w io.Writer, compression *results.CompressionResults) {
+	fmt.Fprintf(w, "Payload compression:         %v\n", compression.Codec)
+	fmt.Fprintf(w, "Decompressed bytes:          %d\n", compression.BytesDecompressed)
+	fmt.Fprintf(w, "Compression ratio:           %.3f\n", compression.Ratio)
+	fmt.Fprintf(w, "Decompressed (MB/sec):       %.3f\n", compression.MBPerSec)
+	if compression.Failed > 0 {
+		fmt.Fprintf(w, "Decompression failures:      %d\n", compression.Failed)
+	}
+}
+
+func printLateJoin(w io.Writer, late *results.LateJoinResults) {
+	fmt.Fprintf(w, "Join delay (ms):             %.3f\n", late.JoinDelay/1_000_000)
+	fmt.Fprintf(w, "First message mean (ms):     %.3f\n", late.TimeToFirstMessage/1_000_000)
+	fmt.Fprintf(w, "First message max (ms):      %.3f\n", late.TimeToFirstMessageMax/1_000_000)
+	fmt.Fprintf(w, "Retained messages:           %d\n", late.RetainedMessages)
+	fmt.Fprintf(w, "Backlog messages:            %d\n", late.BacklogMessages)
+	fmt.Fprintf(w, "Catch-up time (ms):          %.3f\n\n", late.CatchUpTime/1_000_000)
+}
+
+func printTopics(w io.Writer, topics []*results.TopicResults) {
+	width := len("Topic")
+	for _, topic := range topics {
+		if len(topic.Topic) > width {
+			width = len(topic.Topic)
+		}
+	}
+	fmt.Fprintf(w, "======= TOPICS (%d) =======\n", len(topics))
+	fmt.Fprintf(w, "%-*s  Messages   Msg/sec  Mean (ms)   Max (ms)\n", width, "Topic")
+	for _, topic := range topics {
+		fmt.Fprintf(w, "%-*s  %8d  %8.3f  %9.3f  %9.3f\n", width, topic.Topic, topic.Messages, topic.MsgsPerSec,
+			topic.MsgTimeMean/1_000_000, topic.MsgTimeMax/1_000_000)
+	}
+	fmt.Fprintln(w)
+}
+
+func printSubscriptions(w io.Writer, subscriptions []*results.SubscriptionResults) {
+	width := len("Subscription")
+	for _, s := range subscriptions {
+		if len(s.Topic) > width {
+			width = len(s.Topic)
+		}
+	}
+	fmt.Fprintf(w, "%-*s  QoS  Granted  Messages\n", width, "Subscription")
+	for _, s := range subscriptions {
+		granted := "-"
+		if s.GrantedQoS != nil {
+			granted = formatGrantedQoS(*s.GrantedQoS)
+		}
+		fmt.Fprintf(w, "%-*s  %3d  %7s  %8d\n", width, s.Topic, s.QoS, granted, s.Messages)
+	}
+	fmt.Fprintln(w)
+}
+
+// printReordering prints the largest displacement and the out-of-order messages per QoS, only if messages
+// were reordered
+func printReordering(w io.Writer, outOfOrder, maxDisplacement int64, byQoS map[int]int64) {
+	if outOfOrder == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Max displacement:            %d\n", maxDisplacement)
+	fmt.Fprintf(w, "Out of order QoS 0 / 1 / 2:  %d / %d / %d\n", byQoS[0], byQoS[1], byQoS[2])
+}
+
+// printQoS prints the granted QoS if known and the messages delivered per QoS
+func printQoS(w io.Writer, granted *int, delivered map[int]int64, mismatches int64) {
+	if granted != nil {
+		fmt.Fprintf(w, "Granted QoS:                 %s\n", formatGrantedQoS(*granted))
+	}
+	fmt.Fprintf(w, "Delivered QoS 0 / 1 / 2:     %d / %d / %d\n", delivered[0], delivered[1], delivered[2])
+	if mismatches > 0 {
+		fmt.Fprintf(w, "QoS mismatches:              %d\n", mismatches)
+	}
+}
+
+func printBrokerLatency(w io.Writer, b *results.BrokerLatencyResults) {
+	fmt.Fprintf(w, "Broker-stamped messages:     %d (%d unstamped)\n", b.Samples, b.Unstamped)
+	if b.PublisherToBroker != nil {
+		fmt.Fprintf(w, "Pub to broker (ms) mean/p99: %.3f / %.3f (max %.3f)\n",
+			b.PublisherToBroker.Mean/1_000_000, b.PublisherToBroker.P99/1_000_000, b.PublisherToBroker.Max/1_000_000)
+		fmt.Fprintf(w, "Broker to sub (ms) mean/p99: %.3f / %.3f (max %.3f)\n",
+			b.BrokerToSubscriber.Mean/1_000_000, b.BrokerToSubscriber.P99/1_000_000, b.BrokerToSubscriber.Max/1_000_000)
+	}
+	fmt.Fprintln(w)
+}
+
+func printDecodeWorkers(w io.Writer, decoders *results.DecodeWorkerResults) {
+	fmt.Fprintf(w, "Decode workers:              %d (%d messages, queue full %d times)\n", decoders.Workers, decoders.Messages, decoders.QueueFull)
+}
+
+func printFlowControl(w io.Writer, flow *results.FlowControlResults) {
+	fmt.Fprintf(w, "Receive window (messages):   %d\n", flow.Window)
+	fmt.Fprintf(w, "Throttled deliveries:        %d of %d (%.2f%%)\n", flow.Throttled, flow.Messages, 100*flow.ThrottledRatio)
+	fmt.Fprintf(w, "Throttle wait mean/max (ms): %.3f / %.3f\n", flow.WaitMean/1_000_000, flow.WaitMax/1_000_000)
+	fmt.Fprintf(w, "Latency window full (ms):    %.3f (%d messages)\n", flow.LatencyFullMean/1_000_000, flow.MeasuredFull)
+	fmt.Fprintf(w, "Latency otherwise (ms):      %.3f (%d messages)\n\n", flow.LatencyOtherMean/1_000_000, flow.MeasuredOther)
+}
+
+func printJitter(w io.Writer, jitter *results.JitterResults) {
+	fmt.Fprintf(w, "Inter-arrival min (ms):      %.3f\n", jitter.InterArrivalMin/1_000_000)
+	fmt.Fprintf(w, "Inter-arrival max (ms):      %.3f\n", jitter.InterArrivalMax/1_000_000)
+	fmt.Fprintf(w, "Inter-arrival mean (ms):     %.3f\n", jitter.InterArrivalMean/1_000_000)
+	fmt.Fprintf(w, "Inter-arrival std (ms):      %.3f\n", jitter.InterArrivalStd/1_000_000)
+	if jitter.InterArrivalP99 > 0 {
+		fmt.Fprintf(w, "Inter-arrival p99 (ms):      %.3f\n", jitter.InterArrivalP99/1_000_000)
+	}
+	fmt.Fprintf(w, "Latency jitter (ms):         %.3f\n\n", jitter.Jitter/1_000_000)
+}
+
+// maxPrintedStalls bounds the stalls listed in the text output, the JSON results list more
+const maxPrintedStalls = 20
+
+func printStalls(w io.Writer, stalls *results.StallResults) {
+	fmt.Fprintf(w, "Stalls:                      %d\n", stalls.Count)
+	if stalls.Clients > 0 {
+		fmt.Fprintf(w, "Clients stalled:             %d\n", stalls.Clients)
+	}
+	fmt.Fprintf(w, "Stalled (ms):                %.3f\n", stalls.Stalled/1_000_000)
+	fmt.Fprintf(w, "Longest stall (ms):          %.3f\n", stalls.Longest/1_000_000)
+	for i, s := range stalls.Stalls {
+		if i == maxPrintedStalls {
+			fmt.Fprintf(w, "  ... %d more\n", stalls.Count-int64(i))
+			break
+		}
+		ongoing := ""
+		if s.Ongoing {
+			ongoing = " (until the client stopped)"
+		}
+		fmt.Fprintf(w, "  client %d at %s for %.3f ms%s\n", s.Client, time.Unix(0, s.Start).Format("15:04:05.000"),
+			s.Duration/1_000_000, ongoing)
+	}
+	fmt.Fprintln(w)
+}
+
+func printRetained(w io.Writer, retained *results.RetainedResults) {
+	fmt.Fprintf(w, "Retained / live messages:    %d / %d\n", retained.RetainedMessages, retained.LiveMessages)
+	fmt.Fprintf(w, "First retained mean (ms):    %.3f\n", retained.TimeToFirstRetained/1_000_000)
+	fmt.Fprintf(w, "First retained max (ms):     %.3f\n", retained.TimeToFirstRetainedMax/1_000_000)
+	fmt.Fprintf(w, "Retained delivery mean (ms): %.3f\n", retained.RetainedDeliveryTime/1_000_000)
+	fmt.Fprintf(w, "Retained delivery max (ms):  %.3f\n\n", retained.RetainedDeliveryTimeMax/1_000_000)
+}
+
+func printResubscribe(w io.Writer, resub *results.ResubscribeResults) {
+	fmt.Fprintf(w, "Resubscribe cycles:          %d\n", resub.Cycles)
+	fmt.Fprintf(w, "Unsubscribe time mean (ms):  %.3f\n", resub.UnsubscribeTime/1_000_000)
+	fmt.Fprintf(w, "Resubscribe time mean (ms):  %.3f\n", resub.ResubscribeTime/1_000_000)
+	fmt.Fprintf(w, "Resubscribe time max (ms):   %.3f\n", resub.ResubscribeTimeMax/1_000_000)
+	if resub.Suback != nil {
+		fmt.Fprintf(w, "SUBACK p50/p95/p99 (ms):     %.3f / %.3f / %.3f\n", resub.Suback.P50/1_000_000,
+			resub.Suback.P95/1_000_000, resub.Suback.P99/1_000_000)
+		fmt.Fprintf(w, "UNSUBACK p50/p95/p99 (ms):   %.3f / %.3f / %.3f\n", resub.Unsuback.P50/1_000_000,
+			resub.Unsuback.P95/1_000_000, resub.Unsuback.P99/1_000_000)
+	}
+	fmt.Fprintf(w, "Missed messages:             %d\n\n", resub.MissedMessages)
+}
+
+func printExpiry(w io.Writer, expiry *results.ExpiryResults) {
+	fmt.Fprintf(w, "Messages with expiry:        %d\n", expiry.Messages)
+	fmt.Fprintf(w, "Delivered after expiry:      %d\n", expiry.Expired)
+	fmt.Fprintf(w, "Lost to expiry (estimated):  %d\n", expiry.Dropped)
+	fmt.Fprintf(w, "Remaining expiry min (ms):   %.3f\n", expiry.RemainingMin/1_000_000)
+	fmt.Fprintf(w, "Remaining expiry max (ms):   %.3f\n", expiry.RemainingMax/1_000_000)
+	fmt.Fprintf(w, "Remaining expiry mean (ms):  %.3f\n\n", expiry.RemainingMean/1_000_000)
+}
+
+func printSharedGroup(w io.Writer, shared *results.SharedGroupResults) {
+	fmt.Fprintf(w, "======= SHARED GROUP %s (%d) =======\n", shared.Group, shared.Clients)
+	fmt.Fprintf(w, "Messages per client min:     %d\n", shared.MinPerClient)
+	fmt.Fprintf(w, "Messages per client max:     %d\n", shared.MaxPerClient)
+	fmt.Fprintf(w, "Messages per client mean:    %.3f\n", shared.MeanPerClient)
+	fmt.Fprintf(w, "Messages per client std:     %.3f\n", shared.StdPerClient)
+	fmt.Fprintf(w, "Fairness (Jain's index):     %.3f\n\n", shared.Fairness)
+}
+
+// generateTLSConfig creates the TLS configuration of the broker connections. Unless insecure, the broker's
+// certificate is verified against the CA certificates in caFile (the system roots if empty) and serverName
+// (the broker's host name if empty). The client certificate in certFile is presented if set.
+func generateTLSConfig(certFile, keyFile, keyPassword, caFile, serverName string, insecure bool) *tls.Config {
+	cfg := tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecure,
+	}
+	if certFile != "" {
+		cert, err := loadKeyPair(certFile, keyFile, keyPassword)
+		if err != nil {
+			fatalf("Error reading certificate files: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		caPEM, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			fatalf("Error reading CA certificates: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(caPEM) {
+			fatalf("Error reading CA certificates: no PEM certificates found in %v", caFile)
+		}
+	}
+
+	return &cfg
+}
+
+// loadKeyPair reads a certificate and its PEM private key, which is decrypted with password if encrypted
+func loadKeyPair(certFile, keyFile, password string) (tls.Certificate, error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	switch {
+	case block == nil:
+		return tls.Certificate{}, fmt.Errorf("no PEM private key found in %v", keyFile)
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		return tls.Certificate{}, fmt.Errorf("encrypted PKCS #8 key %v is not supported, convert it to a traditional PEM key first", keyFile)
+	case x509.IsEncryptedPEMBlock(block):
+		if password == "" {
+			return tls.Certificate{}, fmt.Errorf("private key %v is encrypted, set -key-password", keyFile)
+		}
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("decrypting private key %v: %v", keyFile, err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+	}
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func printRampUp(w io.Writer, ramp *results.RampUpResults) {
+	fmt.Fprintf(w, "======= RAMP-UP =======\n")
+	fmt.Fprintf(w, "Clients subscribed:          %d / %d\n", ramp.Subscribed, ramp.Clients)
+	fmt.Fprintf(w, "Planned ramp-up (ms):        %.3f\n", ramp.Planned/1_000_000)
+	fmt.Fprintf(w, "First subscribed (ms):       %.3f\n", ramp.FirstSubscribed/1_000_000)
+	fmt.Fprintf(w, "Connect phase (ms):          %.3f\n", ramp.LastSubscribed/1_000_000)
+	fmt.Fprintf(w, "Receive phase (ms):          %.3f\n\n", ramp.ReceivePhase/1_000_000)
+}
+
+func printBaseline(w io.Writer, baseline *results.BaselineResults) {
+	fmt.Fprintf(w, "======= BASELINE %s =======\n", baseline.File)
+	if baseline.RunID != "" {
+		fmt.Fprintf(w, "Baseline run ID:             %s\n", baseline.RunID)
+	}
+	fmt.Fprintf(w, "%-22s %12s %12s %12s %9s\n", "Metric", "Baseline", "Current", "Delta", "Change")
+	for _, m := range baseline.Metrics {
+		change := "-"
+		if m.Change != nil {
+			change = fmt.Sprintf("%+.1f%%", *m.Change)
+		}
+		fmt.Fprintf(w, "%-22s %12.3f %12.3f %+12.3f %9s\n", m.Metric, m.Baseline, m.Current, m.Delta, change)
+	}
+	fmt.Fprintln(w)
+}
+
+func printThresholds(w io.Writer, thresholds *results.ThresholdResults) {
+	if thresholds.Passed {
+		fmt.Fprintf(w, "======= THRESHOLDS PASSED =======\n\n")
+		return
+	}
+	fmt.Fprintf(w, "======= THRESHOLDS FAILED =======\n")
+	for _, failure := range thresholds.Failures {
+		fmt.Fprintf(w, "- %s\n", failure.Message)
+	}
+	fmt.Fprintln(w)
+}
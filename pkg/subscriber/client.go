@@ -0,0 +1,982 @@
+package subscriber
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+	"encoding/json"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+type Message struct {
+    Payload Payload
+    ReceivedAt int64
+    Retained bool
+    Topic string
+    Size int64 // payload bytes
+    DecompressedSize int64 // payload bytes after decompression, 0 if the payloads are not compressed
+    QoS byte
+    Duplicate bool // DUP flag, the broker delivered the message before
+    BrokerAt int64 // unix nanoseconds the broker or a bridge stamped the message with, 0 if unstamped
+    UserProperties []UserProperty // MQTT 5.0 user properties of the PUBLISH, in the order sent
+    MessageExpiry int64 // seconds of the MQTT 5.0 message expiry interval left when delivered, 0 if it has none
+    SubscriptionIDs []int // MQTT 5.0 Subscription Identifiers of the subscriptions the message matched
+}
+
+type Payload struct {
+    GeneratedAt int64
+    ClientId    int
+    MessageId   int
+    // ExpiryInterval mirrors the MQTT 5 message expiry interval set by the publisher, in seconds (optional)
+    ExpiryInterval int64 `json:",omitempty"`
+    // RunId identifies the experiment the publisher took part in (optional)
+    RunId string `json:",omitempty"`
+    // Size is the length of the payload in bytes as published, Checksum its CRC-32, see verifyPayload (optional)
+    Size     int64  `json:",omitempty"`
+    Checksum string `json:",omitempty"`
+}
+
+// Client implements an MQTT client running benchmark test
+type Client struct {
+	ID              int
+	ClientID        string
+	MQTTClientID    string // overrides the client id derived from ClientID and ID, see -client-id
+	BrokerURL       string
+	BrokerUser      string
+	BrokerPass      string
+	MsgTopic        string
+	ReceiveCount    int64
+	Duration        time.Duration
+	Cooldown        time.Duration // how long the subscription stays open after the client completed
+	MsgQoS          byte
+	MoreTopics      []Subscription // subscribed to besides MsgTopic
+	Quiet           bool
+	WaitTimeout time.Duration
+	TLSConfig   *tls.Config
+	Conn        *ClientConn
+	StandbyURL  string
+	OfflineAt   int64
+	CleanSession bool // ignored with OfflineAt and ChaosAfter, the session has to survive the offline period
+	SessionExpiry time.Duration // MQTT 5.0 Session Expiry Interval of a persistent session, 0 never expires
+	OfflineFor  time.Duration
+	Bootstrap   int
+	Percentiles []float64
+	HistogramBuckets []float64 // upper bounds in nanoseconds of the latency histogram of the results, see -hist-buckets
+	Confidence  float64
+	ApdexT      time.Duration
+	ApdexF      time.Duration
+	JoinDelay   time.Duration
+	WarmupUntil int64 // unix nanoseconds before which messages are not measured
+	WarmupCount int64 // number of first messages that are not measured
+	MeasureRetained bool
+	MeasureJitter   bool
+	ConnectDelay time.Duration
+	ProcessDelay *DelayDistribution
+	ConsumeRate  float64
+	ResubscribeEvery time.Duration
+	ResubscribeGap   time.Duration
+	RunID            string
+	Seed             int64
+	CheckRunID       bool
+	PublisherCount   int64
+	ExactlyOnce      bool
+	ExactlyOnceIDs   [2]int // first and last MessageId every publisher sends with ExactlyOnce
+	PipelineBuffer   int
+	DecodeWorkers    int // goroutines decoding the messages in parallel, 0 decodes in the message handler
+	TopicStats       bool
+	KeepSamples      bool
+	KeepLatencies    bool
+	MaxPacketSize    int64
+	ConnectTimeout   time.Duration
+	ConnectRetries   int           // connect attempts after the first failed one
+	ConnectBackoff   time.Duration // before the first retry, doubled for every further retry
+	ProtocolVersion  uint // CONNECT protocol level, 5 (MQTT 5.0) connects with the native client
+	NativeClient     bool // connect with the native client at the other protocol levels as well
+	SubscriptionOptions SubscriptionOptions // MQTT 5.0 only
+	KeepPayloads     int
+	AnomalyFactor    float64
+	AnomalyWindow    int
+	VerifySize       int // expected payload length in bytes, 0 if any
+	StallThreshold   time.Duration // without measured messages, after which a client counts as stalled
+	ChaosAfter       time.Duration // since the start, after which the connection is dropped without DISCONNECT, needs Conn
+	ChaosDown        time.Duration // how long the client stays down after the drop
+	Tuning           MQTTTuning
+	Source           MessageSource // receives the messages instead of an MQTT broker if set, see -transport
+	PayloadCompression string      // codec the payloads are compressed with, see -payload-compression
+	MaxDecompressedSize int64      // bytes a payload may decompress to, larger ones are malformed (0 is unlimited)
+	BatchMode        bool          // payloads are JSON arrays of records, each measured as a message
+	ProgressEvery    int64         // messages after which the client logs its progress, unless Quiet
+	ProgressPeriod   time.Duration // or the period, if ProgressEvery is 0
+
+	// Hooks for embedders, called from the client's goroutines: OnConnect after every (re)subscribe,
+	// OnMessage for every measured message and OnComplete with the results before they are reported
+	OnConnect  func(c *Client)
+	OnMessage  func(c *Client, m *Message)
+	OnComplete func(c *Client, res *results.RunResults)
+
+	gate       *publisherGate
+	startSync  *startSync
+	connects   connectLimiter
+	connections *connectionCount
+	clock       *clockSource
+	checkpoints *checkpointer
+	resumed     *results.ClientSamples
+	interrupted time.Duration // of the resumed run
+	mqttMu     sync.Mutex // guards mqttClient, mqttOpts and stopped, goOffline replaces the client
+	mqttClient mqtt.Client
+	mqttOpts   *mqtt.ClientOptions
+	stopped    bool // Run disconnected the client, it must not connect again
+	failover   *failoverTracker
+	takeover   takeoverTracker
+	reconnects reconnectTracker
+	disconnects int64
+	runIDMismatches int64
+	corrupted       int64
+	undecompressed  int64 // payloads that could not be decompressed
+	batches         batchCounter
+	progress        *aggregateProgress // logs the progress over all clients instead
+	progressLogged  time.Time
+	connectTime   int64 // nanoseconds until the CONNACK of the first connection
+	subscribeTime int64 // nanoseconds until the first SUBACK
+	sizes      packetSizes
+	payloads   *payloadKeeper
+	anomalies  *anomalyDetector
+	events     *eventLog
+	latencyDump *latencyDump
+	decoder    payloadDecoder
+	decompressor *payloadDecompressor
+	brokerStamp *brokerTimestamp
+	everConnected int32
+	sessionExpiry int64 // seconds, of the MQTT 5.0 session the broker granted
+	offline    *offlineTracker
+	late       *lateJoinTracker
+	retained   *retainedTracker
+	jitter     *jitterTracker
+	brokerLatency *brokerLatencyTracker
+	stalls     *stallWatchdog
+	chaos      *chaosDrop
+	inflight   inflightWindow
+	receive    *receiveWindow
+	flow       *flowControlTracker
+	lateArrivals int64 // guarded by the lock of the accumulator
+	resub      *resubscribeTracker
+	expiry     expiryTracker
+	qos        qosTracker
+	publishers publisherCounter
+	exactlyOnce *exactlyOnceTracker
+	topics     topicStats
+	subscriptionCounts *subscriptionCounter
+	sequences  sequenceTracker
+	window     *intervalWindow
+	metrics    *clientMetrics
+	shared     *sharedGroup
+	rampUp     *rampUp
+	pipeline   *messagePipeline
+	decoders   *decodePool
+	acc        *accumulator
+}
+
+// Run runs benchmark tests and writes results in the provided channel, when ctx is cancelled it reports
+// the messages received so far
+func (c *Client) Run(ctx context.Context, res chan *results.RunResults) {
+	runResults := new(results.RunResults)
+
+	if c.StandbyURL != "" {
+		c.failover = newFailoverTracker()
+	}
+	if c.OfflineAt > 0 {
+		c.offline = new(offlineTracker)
+	}
+	if c.JoinDelay > 0 {
+		c.late = new(lateJoinTracker)
+	}
+	if c.MeasureRetained {
+		c.retained = new(retainedTracker)
+	}
+	if c.MeasureJitter {
+		c.jitter = newJitterTracker()
+	}
+	if c.brokerStamp != nil {
+		c.brokerLatency = newBrokerLatencyTracker()
+	}
+	if c.Tuning.MaxInflight > 0 {
+		c.flow = newFlowControlTracker(c.Tuning.MaxInflight)
+	}
+	if c.Tuning.ReceiveMaximum > 0 {
+		c.flow = newFlowControlTracker(c.Tuning.ReceiveMaximum)
+		c.receive = newReceiveWindow(c.Tuning.ReceiveMaximum, c.flow)
+	}
+	if c.StallThreshold > 0 {
+		c.stalls = newStallWatchdog(c.StallThreshold)
+	}
+	if c.ChaosAfter > 0 {
+		c.chaos = newChaosDrop(c.ChaosAfter, c.ChaosDown)
+	}
+	if c.ResubscribeEvery > 0 {
+		c.resub = newResubscribeTracker()
+	}
+	if c.PublisherCount > 0 {
+		c.publishers = make(publisherCounter)
+	}
+	if c.ExactlyOnce {
+		c.exactlyOnce = newExactlyOnceTracker(c.ExactlyOnceIDs[0], c.ExactlyOnceIDs[1])
+	}
+	if c.TopicStats {
+		c.topics = make(topicStats)
+	}
+	if len(c.MoreTopics) > 0 {
+		c.subscriptionCounts = newSubscriptionCounter(c.subscriptions())
+	}
+	// without MessageIds every message would look like a duplicate of the first
+	if c.decoder == nil || c.decoder.messageIDs() {
+		c.sequences = make(sequenceTracker)
+	}
+	c.sizes.limit = c.MaxPacketSize
+	if c.KeepPayloads > 0 {
+		c.payloads = newPayloadKeeper(c.KeepPayloads)
+	}
+	if c.AnomalyFactor > 0 {
+		c.anomalies = newAnomalyDetector(c.AnomalyFactor, c.AnomalyWindow)
+	}
+	// the messages are measured by the message handler
+	c.acc = newAccumulator(c.ReceiveCount, c.KeepLatencies || c.Bootstrap > 0, c.KeepSamples)
+	c.acc.cooldown = c.Cooldown > 0
+	if c.resumed != nil {
+		c.acc.restore(c.resumed.ReceivedAt, c.resumed.Latencies, c.interrupted)
+	}
+	c.checkpoints.register(c, c.acc)
+	if c.compressed() && c.decompressor == nil {
+		// the CLI shares one between its clients
+		decompressor, err := newPayloadDecompressor(c.PayloadCompression, c.MaxDecompressedSize)
+		if err != nil {
+			c.fail(err)
+		}
+		c.decompressor = decompressor
+	}
+	if c.PipelineBuffer > 0 {
+		c.pipeline = newMessagePipeline(c.PipelineBuffer)
+	}
+	if c.DecodeWorkers > 0 {
+		c.decoders = newDecodePool(c.DecodeWorkers)
+	}
+	// start subscriber, unless the client received all messages before the run was interrupted
+	if !c.acc.completed() {
+		go c.receiveMessages(ctx)
+		if c.stalls != nil {
+			go c.stalls.watch(c, c.acc.done)
+		}
+	}
+
+	runResults.ID = c.ID
+	runResults.QoS = c.MsgQoS
+	runResults.PersistentSession = c.persistentSession()
+
+	// with a duration, report whatever was received when it elapses
+	if c.Duration > 0 {
+		timer := time.AfterFunc(c.Duration, func() {
+			// the messages received before it elapsed are measured, including those still being decoded
+			c.decoders.stop()
+			if c.acc.stop() {
+				c.events.log(c.ID, eventCompleted, nil)
+				if !c.Quiet {
+					c.logf(levelInfo, "stopped after %v", c.Duration)
+				}
+			}
+		})
+		defer timer.Stop()
+	}
+	if c.chaos != nil {
+		timer := time.AfterFunc(c.ChaosAfter, func() {
+			c.chaos.drop(c)
+		})
+		defer timer.Stop()
+	}
+
+	// wait until we are done or stopped
+	select {
+	case <-c.acc.done:
+	case <-c.shared.completed():
+		// another client of the shared group received the last message
+		c.decoders.stop()
+		if c.acc.stop() {
+			c.events.log(c.ID, eventCompleted, nil)
+		}
+	case <-ctx.Done():
+		c.decoders.stop()
+		if c.acc.stop() {
+			runResults.Truncated = true
+			c.events.log(c.ID, eventCompleted, ctx.Err())
+		}
+	}
+	c.decoders.stop()
+	if c.Cooldown > 0 && !runResults.Truncated {
+		// keep the subscription open, so the messages still in flight (e.g. unacknowledged QoS 1/2 messages)
+		// arrive as late arrivals instead of looking lost. The accumulator started cooling down when it was done.
+		cooldownStart := time.Now()
+		select {
+		case <-time.After(c.Cooldown):
+		case <-ctx.Done():
+		}
+		c.acc.mu.Lock()
+		c.acc.coolingDown = false
+		late := c.lateArrivals
+		runResults.LateArrivals = &late
+		c.acc.mu.Unlock()
+		runResults.CooldownTime = time.Since(cooldownStart).Seconds()
+	}
+	// no connection, paho goroutine or message handler outlives the results, also for embedders of Run; a
+	// cancelled run skips the cooldown, so the client disconnects as soon as ctx is done
+	c.disconnect()
+	if c.Source != nil {
+		c.Source.Close()
+	}
+	latencies := c.acc.latencies
+	// calculate results
+	summarize(runResults, c.acc.stats, c.acc.perSecond, c.acc.measured())
+	if runResults.Successes > 0 {
+		runResults.MeasuredFrom = c.acc.started.UnixNano()
+		runResults.MeasuredTo = c.acc.finished.UnixNano()
+	}
+	runResults.ReceivedAt = c.acc.receivedAt
+	runResults.BytesReceived = c.acc.bytes
+	if runResults.Successes > 0 {
+		runResults.AvgPayloadSize = float64(c.acc.bytes) / float64(runResults.Successes)
+	}
+	if runResults.RunTime > 0 {
+		runResults.MBPerSec = float64(c.acc.bytes) / 1e6 / runResults.RunTime
+	}
+	if c.ReceiveCount > 0 && c.acc.received > c.ReceiveCount {
+		runResults.Duplicates = c.acc.received - c.ReceiveCount
+	}
+	runResults.WarmupMessages = c.acc.warmup
+	if c.acc.err != nil {
+		runResults.Failed = true
+		runResults.Error = c.acc.err.Error()
+	}
+	runResults.DroppedInternal = c.pipeline.droppedCount()
+	runResults.DecodeWorkers = c.decoders.results()
+	runResults.Takeovers = c.takeover.count()
+	runResults.Disconnects = atomic.LoadInt64(&c.disconnects)
+	runResults.RunIDMismatches = atomic.LoadInt64(&c.runIDMismatches)
+	runResults.ConnectTime = float64(atomic.LoadInt64(&c.connectTime))
+	runResults.SubscribeTime = float64(atomic.LoadInt64(&c.subscribeTime))
+	runResults.Oversize = atomic.LoadInt64(&c.sizes.oversize)
+	runResults.Malformed = atomic.LoadInt64(&c.sizes.malformed)
+	runResults.Corrupted = atomic.LoadInt64(&c.corrupted)
+	c.batches.results(runResults)
+	runResults.LargestPacket = atomic.LoadInt64(&c.sizes.largest)
+	runResults.Payloads = c.payloads.results()
+	runResults.Anomalies = c.anomalies.results()
+	runResults.Latencies = latencies
+	if latencies != nil {
+		if c.ApdexT > 0 && len(latencies) > 0 {
+			runResults.Apdex = calculateApdex(latencies, c.ApdexT, c.ApdexF)
+		}
+		runResults.Percentiles = latencyPercentiles(latencies, c.Percentiles)
+	} else {
+		if c.ApdexT > 0 && runResults.Successes > 0 {
+			runResults.Apdex = calculateHistogramApdex(runResults.Histogram, c.ApdexT, c.ApdexF)
+		}
+		runResults.Percentiles = histogramPercentiles(runResults.Histogram, c.Percentiles)
+	}
+	runResults.LatencyHistogram = histogramBuckets(runResults.Histogram, c.HistogramBuckets)
+	if c.Bootstrap > 0 {
+		runResults.Confidence = bootstrapConfidence(latencies, c.Bootstrap, c.Confidence, c.seed())
+	}
+
+	runResults.Reconnect = c.reconnects.results(time.Now(), c.Conn != nil)
+	if c.failover != nil {
+		runResults.Failover = c.failover.results()
+	}
+	if c.offline != nil {
+		runResults.OfflineQueue = c.offline.results()
+	}
+	if c.late != nil {
+		runResults.LateJoin = c.late.results(c.JoinDelay)
+	}
+	if c.retained != nil {
+		runResults.Retained = c.retained.results()
+	}
+	if c.resub != nil {
+		runResults.Resubscribe = c.resub.results()
+	}
+	runResults.Expiry = c.expiry.results(c.sequences)
+	runResults.SessionExpiry = atomic.LoadInt64(&c.sessionExpiry)
+	if c.jitter != nil {
+		runResults.Jitter = c.jitter.results()
+	}
+	if c.brokerLatency != nil {
+		runResults.BrokerLatency = c.brokerLatency.results()
+	}
+	if c.flow != nil {
+		c.acc.mu.Lock()
+		runResults.FlowControl = c.flow.results()
+		c.acc.mu.Unlock()
+	}
+	runResults.Stalls = c.stalls.results(c.ID, c.acc.finished)
+	runResults.Chaos = c.chaos.results()
+	if c.compressed() {
+		runResults.Compression = compressionResults(c.PayloadCompression, c.acc.bytes, c.acc.decompressed,
+			atomic.LoadInt64(&c.undecompressed), runResults.RunTime)
+	}
+	if c.publishers != nil {
+		runResults.Publishers = c.publishers.results(c.PublisherCount)
+	}
+	if c.exactlyOnce != nil {
+		// messages arriving after the client completed are still counted
+		c.acc.mu.Lock()
+		runResults.ExactlyOnce = c.exactlyOnce.results()
+		c.acc.mu.Unlock()
+	}
+	if c.topics != nil {
+		runResults.Topics = c.topics.results()
+	}
+	if c.subscriptionCounts != nil {
+		runResults.Subscriptions = c.subscriptionCounts.results()
+	}
+	c.qos.results(c, runResults)
+	c.sequences.results(runResults)
+
+	if c.OnComplete != nil {
+		c.OnComplete(c, runResults)
+	}
+
+	// report results
+	res <- runResults
+}
+
+// record measures a received message, it holds the lock of the accumulator so the messages are recorded one at
+// a time, also when paho calls the message handler concurrently (-order=false)
+func (c *Client) record(m *Message) {
+	c.acc.mu.Lock()
+	defer c.acc.mu.Unlock()
+	// every delivery counts for exactly-once, including the warm-up and the messages beyond the count
+	if c.exactlyOnce != nil {
+		c.exactlyOnce.received(m)
+	}
+	if c.acc.completed() {
+		if c.acc.coolingDown {
+			// not measured, but they fill the gaps of the MessageId sequences
+			c.lateArrivals++
+			if c.shared == nil && c.sequences != nil {
+				c.sequences.received(m)
+			}
+			return
+		}
+		// messages arriving after -duration elapsed are not measured either
+		if c.ReceiveCount > 0 && c.acc.received == c.ReceiveCount {
+			c.logf(levelWarn, "received too many messages (probably duplicates): %v", m)
+		}
+		return
+	}
+	// Don't measure until all publishers are up and the warm-up is over
+	if c.gate != nil && !c.gate.observe(m) {
+		c.acc.warmup++
+		return
+	}
+	if c.startSync != nil && !c.startSync.started() {
+		c.acc.warmup++
+		return
+	}
+	if m.ReceivedAt < c.WarmupUntil || c.acc.warmup < c.WarmupCount {
+		c.acc.warmup++
+		return
+	}
+	if c.shared != nil && !c.shared.claim() {
+		// the group received all messages, the other clients are being stopped
+		return
+	}
+	c.reconnects.received(m)
+	if c.failover != nil {
+		c.failover.received(m)
+	}
+	if c.offline != nil {
+		c.offline.received(m)
+	}
+	if c.late != nil {
+		c.late.received(m)
+	}
+	if c.retained != nil {
+		c.retained.received(m)
+	}
+	if c.resub != nil {
+		c.resub.received(m)
+	}
+	c.expiry.received(m)
+	c.qos.received(m, c.requestedQoS(m))
+	if c.OnMessage != nil {
+		c.OnMessage(c, m)
+	}
+	if c.publishers != nil {
+		c.publishers.received(m)
+	}
+	if c.shared != nil {
+		c.shared.received(m)
+	} else if c.sequences != nil {
+		c.sequences.received(m)
+	}
+	latency := float64(m.ReceivedAt - m.Payload.GeneratedAt) // in nanoseconds
+	if c.window != nil {
+		c.window.add(latency)
+	}
+	c.metrics.observe(latency, m.ReceivedAt)
+	if c.topics != nil {
+		c.topics.received(m, latency)
+	}
+	if c.subscriptionCounts != nil {
+		c.subscriptionCounts.received(m)
+	}
+	if c.jitter != nil {
+		c.jitter.received(m, latency)
+	}
+	if c.brokerLatency != nil {
+		c.brokerLatency.received(m)
+	}
+	if c.flow != nil {
+		// the message holds a slot itself, a full window holds back the acknowledgements of the others
+		c.flow.measured(latency, c.inflight.full() || c.receive.full())
+	}
+	if c.stalls != nil {
+		c.stalls.received(c, m.ReceivedAt)
+	}
+	if c.chaos != nil {
+		c.chaos.received(m)
+	}
+	if c.anomalies != nil {
+		c.anomalies.observe(c.ID, m, latency)
+	}
+	c.latencyDump.write(c.ID, m, latency)
+
+	// Check if we are done, Run calculates the results from here on
+	c.acc.decompressed += m.DecompressedSize
+	c.progress.add()
+	if c.acc.add(latency, m.ReceivedAt, m.Size) {
+		c.events.log(c.ID, eventCompleted, nil)
+		return
+	}
+	receivedSoFar := c.acc.received
+
+	if c.offline != nil && receivedSoFar == c.OfflineAt {
+		go c.offline.goOffline(c, c.OfflineFor)
+	}
+
+	// Print progress every so often
+	if !c.Quiet && c.progressDue(receivedSoFar, time.Now()) {
+		if c.ReceiveCount > 0 {
+			c.logf(levelInfo, "Received %d of messages out of %d", receivedSoFar, c.ReceiveCount)
+		} else {
+			c.logf(levelInfo, "Received %d messages", receivedSoFar)
+		}
+	}
+}
+
+// fail stops the client after a failure it can't recover from, instead of waiting for messages that will
+// never arrive, and reports err in its results
+func (c *Client) fail(err error) {
+	if c.acc.fail(err) {
+		c.logf(levelError, "failed: %v", err)
+		c.events.log(c.ID, eventCompleted, err)
+	}
+}
+
+// compressed returns whether the payloads are compressed and have to be decompressed before decoding them
+func (c *Client) compressed() bool {
+	return c.PayloadCompression != "" && c.PayloadCompression != "none"
+}
+
+// seed returns the seed of the client's random sources, derived from the run's Seed so every client
+// draws a different but reproducible sequence
+func (c *Client) seed() int64 {
+	return c.Seed + int64(c.ID)
+}
+
+// currentMQTTClient returns the paho client of the broker connection, goOffline replaces it
+func (c *Client) currentMQTTClient() mqtt.Client {
+	c.mqttMu.Lock()
+	defer c.mqttMu.Unlock()
+
+	return c.mqttClient
+}
+
+// disconnect disconnects the broker connection once Run is done, a connect still in progress is disconnected
+// by connectedAfterStop when it completes
+func (c *Client) disconnect() {
+	c.mqttMu.Lock()
+	defer c.mqttMu.Unlock()
+	c.stopped = true
+	if c.mqttClient != nil {
+		c.mqttClient.Disconnect(250)
+	}
+}
+
+// connectedAfterStop disconnects client if Run disconnected while it was connecting, it returns whether it did
+func (c *Client) connectedAfterStop(client mqtt.Client) bool {
+	c.mqttMu.Lock()
+	defer c.mqttMu.Unlock()
+	if !c.stopped {
+		return false
+	}
+	client.Disconnect(250)
+
+	return true
+}
+
+// mqttClientID returns the client id used to connect to the broker
+func (c *Client) mqttClientID() string {
+	if c.MQTTClientID != "" {
+		return c.MQTTClientID
+	}
+	return fmt.Sprintf("Subscriber-%s-%v", c.ClientID, c.ID)
+}
+
+// newMQTTClient returns the client of a broker connection with opts: the native client for MQTT 5.0, which
+// paho does not speak, or with NativeClient, and a paho client otherwise. The native client keeps a single
+// goroutine per connection where paho keeps about six.
+func (c *Client) newMQTTClient(opts *mqtt.ClientOptions) mqtt.Client {
+	if c.ProtocolVersion == 5 || c.NativeClient {
+		native := newNativeClient(opts, c.connectProperties(), c.SubscriptionOptions)
+		native.window = c.receive
+		return native
+	}
+	return mqtt.NewClient(opts)
+}
+
+// persistentSession reports whether the client connects with clean session false, the offline period of
+// OfflineAt and ChaosAfter needs the session to survive it
+func (c *Client) persistentSession() bool {
+	return !c.CleanSession || c.OfflineAt > 0 || c.ChaosAfter > 0
+}
+
+// connectProperties returns the MQTT 5.0 properties of the CONNECT
+func (c *Client) connectProperties() mqttProperties {
+	var p mqttProperties
+	if c.persistentSession() {
+		// without the property an MQTT 5.0 session ends with the connection
+		p.sessionExpiry, p.hasSessionExpiry = sessionNeverExpires, true
+		if c.SessionExpiry > 0 {
+			p.sessionExpiry = uint32(c.SessionExpiry / time.Second)
+		}
+	}
+	p.receiveMaximum = uint16(c.Tuning.ReceiveMaximum)
+	p.maximumPacketSize = uint32(c.MaxPacketSize)
+	return p
+}
+
+// sessionGranted records the session expiry interval of a persistent MQTT 5.0 session, the broker may grant a
+// shorter one than requested in its CONNACK
+func (c *Client) sessionGranted(connAck *mqttProperties) {
+	if !c.persistentSession() {
+		return
+	}
+	requested := c.connectProperties().sessionExpiry
+	granted := requested
+	if connAck.hasSessionExpiry {
+		granted = connAck.sessionExpiry
+	}
+	// logged once, not on every reconnect
+	if previous := atomic.SwapInt64(&c.sessionExpiry, int64(granted)); granted != requested && previous != int64(granted) {
+		c.logf(levelWarn, "the broker limited the session expiry interval to %ds instead of %ds", granted, requested)
+	}
+}
+
+func (c *Client) receiveMessages(ctx context.Context) {
+	onConnected := func(client mqtt.Client) {
+		if atomic.SwapInt32(&c.everConnected, 1) == 0 {
+			c.events.log(c.ID, eventConnected, nil)
+		} else {
+			c.events.log(c.ID, eventReconnected, nil)
+		}
+		if !c.Quiet {
+			c.logf(levelInfo, "is connected to the broker %v", c.BrokerURL)
+		}
+		c.connections.up()
+		if native, ok := client.(*nativeClient); ok && c.ProtocolVersion == 5 {
+			c.sessionGranted(native.connAckProperties())
+		}
+		if c.takeover.connected(time.Now()) {
+			c.logf(levelWarn, "was probably disconnected by another client using client id %v", c.mqttClientID())
+		}
+		c.reconnects.connected(time.Now(), c.Conn.dialCount())
+		if c.chaos != nil {
+			c.chaos.connected(time.Now())
+		}
+		if c.failover != nil {
+			c.failover.connected(time.Now(), c.Conn.brokerIndex())
+		}
+
+		// (re)subscribe on every connect, a clean session does not keep the subscription
+		if c.late != nil {
+			c.late.subscribing(time.Now())
+		}
+		if c.retained != nil {
+			c.retained.subscribing(time.Now())
+		}
+		c.events.log(c.ID, eventSubscribe, nil)
+		subscribeStarted := time.Now()
+		subscribetoken := c.subscribe(client)
+		subscribetoken.Wait()
+		if subscribetoken.Error() != nil {
+			c.events.log(c.ID, eventSubscribeError, subscribetoken.Error())
+			c.logf(levelError, "had error subscribing to the broker: %v", subscribetoken.Error())
+			// after a reconnect the client may still get the messages of its session
+			if atomic.LoadInt64(&c.subscribeTime) == 0 {
+				c.fail(fmt.Errorf("subscribing: %v", subscribetoken.Error()))
+			}
+		} else {
+			c.events.log(c.ID, eventSuback, nil)
+			if c.qos.suback(c, subscribetoken) {
+				c.fail(fmt.Errorf("the broker refused all subscriptions"))
+			}
+			atomic.CompareAndSwapInt64(&c.subscribeTime, 0, int64(time.Since(subscribeStarted)))
+			c.rampUp.suback(c.ID, time.Now())
+			if c.startSync != nil {
+				c.startSync.ready(c, client)
+			}
+		}
+		if c.OnConnect != nil {
+			c.OnConnect(c)
+		}
+	}
+
+	// the delays are drawn from the client's own source, under a lock as with -order=false paho calls the
+	// handler concurrently
+	rnd := rand.New(rand.NewSource(c.seed()))
+	var rndMu sync.Mutex
+	var limiter *rateLimiter
+	if c.ConsumeRate > 0 {
+		limiter = newRateLimiter(c.ConsumeRate)
+	}
+	// keeps and sizes a message in the order received, it returns false if the message is dropped
+	admit := func(msg mqtt.Message, receivedAt int64) bool {
+	    c.payloads.keep(msg.Topic(), msg.Payload(), receivedAt)
+	    // dropped like an MQTT 5 client drops packets exceeding its Maximum Packet Size
+	    return c.sizes.accept(publishPacketSize(msg))
+	}
+	// decodes the measured messages of a message, in the handler or, with decode workers, in parallel
+	decode := func(msg mqtt.Message, receivedAt int64) []*Message {
+	    data := msg.Payload()
+	    var decompressedSize int64
+	    if c.compressed() {
+	        var err error
+	        if data, err = c.decompressor.decompress(data); err != nil {
+	            atomic.AddInt64(&c.undecompressed, 1)
+	            atomic.AddInt64(&c.sizes.malformed, 1)
+	            c.logf(levelWarn, "received message which could not be decompressed with %v: %v", c.PayloadCompression, err)
+	            return nil
+	        }
+	        decompressedSize = int64(len(data))
+	    }
+	    records := [][]byte{data}
+	    if c.BatchMode {
+	        var err error
+	        if records, err = splitBatch(data); err != nil {
+	            atomic.AddInt64(&c.sizes.malformed, 1)
+	            c.logf(levelWarn, "received message which is no batch of records: %v", err)
+	            return nil
+	        }
+	        c.batches.add(len(records))
+	    }
+	    var messages []*Message
+	    counted := false
+	    for _, record := range records {
+	        var payload Payload
+	        var err error
+	        if c.decoder != nil {
+	            payload, err = c.decoder.decode(record)
+	        } else {
+	            err = json.Unmarshal(record, &payload)
+	        }
+
+	        if err != nil {
+	            atomic.AddInt64(&c.sizes.malformed, 1)
+	            c.logf(levelWarn, "received message which could not be unmarshalled from JSON: %v", err)
+	        } else if c.CheckRunID && payload.RunId != c.RunID {
+	            // message of another experiment
+	            atomic.AddInt64(&c.runIDMismatches, 1)
+	        } else {
+	            if err := verifyPayload(record, &payload, c.VerifySize); err != nil {
+	                // still measured, the message did arrive
+	                atomic.AddInt64(&c.corrupted, 1)
+	                c.logf(levelWarn, "received a corrupted message on %v: %v", msg.Topic(), err)
+	            }
+	            m := &Message {
+	                Payload: payload,
+	                ReceivedAt: receivedAt,
+	                Retained: msg.Retained(),
+	                Topic: msg.Topic(),
+	                QoS: msg.Qos(),
+	                Duplicate: msg.Duplicate(),
+	            }
+	            if p, ok := msg.(*publishPacket); ok {
+	                m.UserProperties = p.properties.userProperties
+	                m.SubscriptionIDs = p.properties.subscriptionIDs
+	                if p.properties.hasMessageExpiry {
+	                    m.MessageExpiry = int64(p.properties.messageExpiry)
+	                }
+	            }
+	            if c.brokerStamp != nil {
+	                // unstamped messages are still measured end-to-end
+	                if brokerAt, err := c.brokerStamp.decode(record); err == nil {
+	                    m.BrokerAt = brokerAt
+	                }
+	            }
+	            // the bytes of a batch are counted once, with its first record
+	            if !counted {
+	                m.Size = int64(len(msg.Payload()))
+	                m.DecompressedSize = decompressedSize
+	                counted = true
+	            }
+	            messages = append(messages, m)
+	        }
+	    }
+	    return messages
+	}
+	// measures a message, in the handler or, with a pipeline, in its own goroutine
+	handle := func(msg mqtt.Message, receivedAt int64) {
+	    if !admit(msg, receivedAt) {
+	        return
+	    }
+	    for _, m := range decode(msg, receivedAt) {
+	        c.record(m)
+	    }
+	}
+	if c.pipeline != nil {
+		go c.pipeline.run(handle, c.acc.done)
+	}
+	if c.decoders != nil {
+		c.decoders.run(decode, c.record)
+	}
+	c.inflight = newInflightWindow(c.Tuning.MaxInflight)
+	onMessage := func(client mqtt.Client, msg mqtt.Message) {
+	    receivedAt := c.clock.now()
+	    // with -receive-maximum the native client counts the messages of its receive window instead
+	    if c.inflight != nil {
+	        waitStart := time.Now()
+	        c.flow.acquired(c.inflight.acquire(), time.Since(waitStart))
+	    }
+	    defer c.inflight.release()
+	    if c.decoders != nil {
+	        // the workers decode the message and record it in the order received; once Run stopped them,
+	        // the messages after the last one are decoded here to report them as duplicates
+	        if admit(msg, receivedAt) && !c.decoders.push(msg, receivedAt) {
+	            for _, m := range decode(msg, receivedAt) {
+	                c.record(m)
+	            }
+	        }
+	    } else if c.pipeline == nil || c.acc.completed() {
+	        // messages after the last one are still handled directly, to report them as duplicates
+	        handle(msg, receivedAt)
+	    } else if !c.pipeline.push(msg, receivedAt) && !c.Quiet {
+	        c.logf(levelWarn, "dropped a message, the pipeline buffer is full")
+	    }
+	    // simulate a slow consumer, paho acknowledges the message once the handler returns
+	    if c.ProcessDelay != nil {
+	        rndMu.Lock()
+	        delay := c.ProcessDelay.Next(rnd)
+	        rndMu.Unlock()
+	        time.Sleep(delay)
+	    }
+	    if limiter != nil {
+	        limiter.wait()
+	    }
+	}
+
+	brokerURLs := []string{c.BrokerURL}
+	if c.StandbyURL != "" {
+		brokerURLs = append(brokerURLs, c.StandbyURL)
+	}
+	tlsConfig := c.TLSConfig
+	if c.Conn != nil {
+		// the connection is established by the Dialer, including TLS
+		brokerURLs = c.Conn.URLs
+		tlsConfig = nil
+	}
+
+	opts := mqtt.NewClientOptions()
+	for _, brokerURL := range brokerURLs {
+		opts.AddBroker(brokerURL)
+	}
+	opts.SetClientID(c.mqttClientID()).
+		SetCleanSession(!c.persistentSession()).
+		// with limited connects the client reconnects itself, see reconnect
+		SetAutoReconnect(c.connects == nil).
+		SetOnConnectHandler(onConnected).
+		SetConnectionLostHandler(func(client mqtt.Client, reason error) {
+			c.logf(levelWarn, "lost connection to the broker: %v. Will reconnect...", reason.Error())
+			c.events.log(c.ID, eventConnectionLost, reason)
+			atomic.AddInt64(&c.disconnects, 1)
+			c.connections.down()
+			c.takeover.connectionLost(reason, time.Now())
+			c.reconnects.connectionLost(time.Now(), c.Conn.dialCount())
+			if c.failover != nil {
+				c.failover.connectionLost(time.Now())
+			}
+			if c.connects != nil {
+				c.reconnect(ctx, client)
+			}
+		}).
+		SetDefaultPublishHandler(onMessage)
+	if c.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(c.ConnectTimeout)
+	}
+	if c.ProtocolVersion > 0 {
+		opts.SetProtocolVersion(c.ProtocolVersion)
+		// SetProtocolVersion ignores MQTT 5.0, which only the native client speaks
+		opts.ProtocolVersion = c.ProtocolVersion
+	}
+	c.Tuning.apply(opts)
+	if c.BrokerUser != "" && c.BrokerPass != "" {
+		opts.SetUsername(c.BrokerUser)
+		opts.SetPassword(c.BrokerPass)
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	// the run may be cancelled before the client connects
+	if c.ConnectDelay > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.ConnectDelay):
+		}
+	}
+	if c.JoinDelay > 0 {
+		if !c.Quiet {
+			c.logf(levelInfo, "joining late, waiting %v before subscribing", c.JoinDelay)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.JoinDelay):
+		}
+	}
+
+	if c.Source != nil {
+		c.receiveFrom(onMessage)
+		return
+	}
+
+	client := c.newMQTTClient(opts)
+	c.mqttMu.Lock()
+	c.mqttClient = client
+	c.mqttOpts = opts
+	c.mqttMu.Unlock()
+	if err := c.connect(client); err != nil {
+		c.fail(fmt.Errorf("connecting to the broker (%d attempts): %v", c.ConnectRetries+1, err))
+		return
+	}
+	if c.connectedAfterStop(client) {
+		return
+	}
+	if c.resub != nil {
+		go c.resub.cycle(c, c.ResubscribeEvery, c.ResubscribeGap)
+	}
+}
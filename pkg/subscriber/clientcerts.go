@@ -0,0 +1,95 @@
+package subscriber
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// clientCertificates gives every client its own certificate for brokers that accept one connection per
+// device certificate: either from the -client-cert and -client-key templates, with %d replaced by the client
+// number, or from the pool of key pairs in -client-cert-dir, assigned round-robin if there are fewer than
+// clients
+type clientCertificates struct {
+	certTemplate string
+	keyTemplate  string
+	password     string
+	pool         []tls.Certificate
+}
+
+// isCertTemplate reports whether a -client-cert or -client-key path is a template for a file per client
+func isCertTemplate(path string) bool {
+	return strings.Contains(path, "%d")
+}
+
+// loadClientCertificates reads the key pairs of dir, or prepares the templates if dir is empty. The key pairs
+// of dir are the certificates <name>.crt or <name>.pem with the key <name>.key, in the order of their names.
+func loadClientCertificates(certTemplate, keyTemplate, password, dir string) (*clientCertificates, error) {
+	certs := &clientCertificates{certTemplate: certTemplate, keyTemplate: keyTemplate, password: password}
+	if dir == "" {
+		return certs, nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || ext != ".crt" && ext != ".pem" {
+			continue
+		}
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		keyFile := filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name))+".key")
+		if _, err := os.Stat(keyFile); err != nil {
+			// e.g. the CA certificate
+			continue
+		}
+		cert, err := loadKeyPair(filepath.Join(dir, name), keyFile, password)
+		if err != nil {
+			return nil, err
+		}
+		certs.pool = append(certs.pool, cert)
+	}
+	if len(certs.pool) == 0 {
+		return nil, fmt.Errorf("no certificates with a key found in %v", dir)
+	}
+
+	return certs, nil
+}
+
+// config returns a copy of base with the certificate of client number n
+func (c *clientCertificates) config(base *tls.Config, n int) (*tls.Config, error) {
+	cfg := new(tls.Config)
+	if base != nil {
+		cfg = base.Clone()
+	}
+	if len(c.pool) > 0 {
+		cfg.Certificates = []tls.Certificate{c.pool[n%len(c.pool)]}
+		return cfg, nil
+	}
+
+	certFile, keyFile := c.certTemplate, c.keyTemplate
+	if isCertTemplate(certFile) {
+		certFile = fmt.Sprintf(certFile, n)
+	}
+	// a single key may be shared by the certificates
+	if isCertTemplate(keyFile) {
+		keyFile = fmt.Sprintf(keyFile, n)
+	}
+	cert, err := loadKeyPair(certFile, keyFile, c.password)
+	if err != nil {
+		return nil, fmt.Errorf("client %d: %v", n, err)
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+
+	return cfg, nil
+}
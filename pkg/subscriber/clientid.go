@@ -0,0 +1,32 @@
+package subscriber
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// expandClientID returns the client id of client n from a -client-id template, replacing {hostname}, {pid},
+// {n} (the client index) and {random} (drawn once per run). Without {n} the index is appended, so every
+// client still has its own id.
+func expandClientID(template string, n int, random string) string {
+	hostname, _ := os.Hostname()
+	if !strings.Contains(template, "{n}") {
+		template += "-{n}"
+	}
+
+	return strings.NewReplacer(
+		"{hostname}", hostname,
+		"{pid}", strconv.Itoa(os.Getpid()),
+		"{n}", strconv.Itoa(n),
+		"{random}", random,
+	).Replace(template)
+}
+
+// randomSuffix returns 8 random hex digits that tell the client ids of subscriber instances apart, drawn from
+// the seed of the run so a replayed (or resumed) run connects with the same client ids
+func randomSuffix(seed int64) string {
+	return fmt.Sprintf("%08x", rand.New(rand.NewSource(seed)).Uint32())
+}
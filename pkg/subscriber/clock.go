@@ -0,0 +1,147 @@
+package subscriber
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and the Unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// clockSource provides the receive timestamps of the clients. The wall clock follows any adjustment of
+// the system clock during the run, the monotonic clock advances steadily from the wall clock time at
+// the start of the run, so steps of the system clock do not show up as latency jumps. The offset
+// compensates the skew between the clocks of the publisher and subscriber hosts.
+type clockSource struct {
+	monotonic bool
+	start     time.Time
+	offset    time.Duration // added to every timestamp, the offset of the publishers' clock to the local clock
+}
+
+// newClockSource creates a clockSource for the given kind (wall or monotonic)
+func newClockSource(kind string) (*clockSource, error) {
+	switch kind {
+	case "wall":
+		return &clockSource{start: time.Now()}, nil
+	case "monotonic":
+		return &clockSource{monotonic: true, start: time.Now()}, nil
+	default:
+		return nil, fmt.Errorf("invalid clock %v, expected wall or monotonic", kind)
+	}
+}
+
+// now returns the current time in unix nanoseconds, a nil clockSource uses the wall clock without offset
+func (c *clockSource) now() int64 {
+	if c == nil {
+		return time.Now().UnixNano()
+	}
+	if !c.monotonic {
+		return time.Now().UnixNano() + int64(c.offset)
+	}
+
+	return c.start.UnixNano() + int64(time.Since(c.start)) + int64(c.offset)
+}
+
+// clockDrift measures how the local clock behaves over the run: the divergence of the wall clock from the
+// monotonic clock (steps and slewing of the system clock) and, if an NTP server is set, the change of the
+// offset to the NTP server
+type clockDrift struct {
+	source    *clockSource
+	ntpServer string
+	offset    time.Duration
+	ntpErr    error
+}
+
+// startClockDrift starts measuring the drift of the local clock, querying ntpServer (if set) once now
+// and once at the end of the run
+func startClockDrift(source *clockSource, ntpServer string) *clockDrift {
+	d := &clockDrift{source: source, ntpServer: ntpServer}
+	if ntpServer != "" {
+		d.offset, d.ntpErr = ntpOffset(ntpServer, 5*time.Second)
+	}
+
+	return d
+}
+
+// results finishes the measurement, durations in nanoseconds
+func (d *clockDrift) results() (*results.ClockResults, error) {
+	end := time.Now()
+	elapsed := end.Sub(d.source.start)
+	res := &results.ClockResults{
+		Source:     "wall",
+		Divergence: float64(end.Round(0).Sub(d.source.start.Round(0)) - elapsed),
+		Offset:     float64(d.source.offset),
+	}
+	if d.source.monotonic {
+		res.Source = "monotonic"
+	}
+	if d.ntpServer == "" {
+		return res, nil
+	}
+	if d.ntpErr != nil {
+		return res, d.ntpErr
+	}
+
+	offset, err := ntpOffset(d.ntpServer, 5*time.Second)
+	if err != nil {
+		return res, err
+	}
+	res.NTPServer = d.ntpServer
+	res.NTPOffsetStart = float64(d.offset)
+	res.NTPOffsetEnd = float64(offset)
+	res.Drift = float64(offset - d.offset)
+	if elapsed > 0 {
+		res.DriftPPM = res.Drift / float64(elapsed) * 1e6
+	}
+
+	return res, nil
+}
+
+// ntpOffset queries an (S)NTP server and returns the offset of the server's clock to the local clock
+func ntpOffset(server string, timeout time.Duration) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+
+	// client request: leap indicator 0, version 4, mode 3
+	request := make([]byte, 48)
+	request[0] = 0x23
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	if err != nil {
+		return 0, err
+	}
+	received := sent.Add(time.Since(sent))
+	if n < 48 || response[0]&0x7 != 4 {
+		return 0, fmt.Errorf("invalid NTP response from %v", server)
+	}
+
+	serverReceived := ntpTime(response[32:40])
+	serverSent := ntpTime(response[40:48])
+
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime converts a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:]))
+
+	return time.Unix(seconds, fraction*int64(time.Second)>>32)
+}
@@ -0,0 +1,134 @@
+package subscriber
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CloudWatchExporter publishes the key numbers of a run as AWS CloudWatch custom metrics, using the
+// credentials and region of the standard AWS environment variables
+type CloudWatchExporter struct {
+	Namespace string
+	Region    string
+}
+
+// Export publishes the metrics with a PutMetricData request, dimensioned by the run id if set
+func (e *CloudWatchExporter) Export(runID string, metrics []metric, timestamp time.Time) error {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+	region := e.Region
+	if region == "" {
+		region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return errors.New("no AWS region configured")
+	}
+
+	form := url.Values{}
+	form.Set("Action", "PutMetricData")
+	form.Set("Version", "2010-08-01")
+	form.Set("Namespace", e.Namespace)
+	for i, m := range metrics {
+		prefix := "MetricData.member." + strconv.Itoa(i+1) + "."
+		form.Set(prefix+"MetricName", m.Name)
+		form.Set(prefix+"Unit", m.Unit)
+		form.Set(prefix+"Value", strconv.FormatFloat(m.Value, 'g', -1, 64))
+		form.Set(prefix+"Timestamp", timestamp.UTC().Format(time.RFC3339))
+		if runID != "" {
+			form.Set(prefix+"Dimensions.member.1.Name", "RunId")
+			form.Set(prefix+"Dimensions.member.1.Value", runID)
+		}
+	}
+	body := form.Encode()
+
+	host := "monitoring." + region + ".amazonaws.com"
+	req, err := http.NewRequest(http.MethodPost, "https://"+host+"/", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signV4(req, body, host, region, "monitoring", accessKey, secretKey, time.Now())
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("PutMetricData failed with %v: %s", resp.Status, data)
+	}
+
+	return nil
+}
+
+// signV4 signs req with AWS Signature Version 4, all headers set on req so far are signed
+func signV4(req *http.Request, body, host, region, service, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("Host", host)
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	var names []string
+	headers := make(map[string]string)
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		names = append(names, name)
+		headers[name] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,116 @@
+package subscriber
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// payloadDecompressor decompresses the payloads of the messages, refusing payloads that decompress to more
+// than limit bytes (0 is unlimited) so a small compressed payload cannot exhaust the memory. It is safe for
+// concurrent use, the clients of a run share one.
+type payloadDecompressor struct {
+	codec string
+	limit int64
+	zstd  *zstd.Decoder
+}
+
+func newPayloadDecompressor(codec string, limit int64) (*payloadDecompressor, error) {
+	d := &payloadDecompressor{codec: codec, limit: limit}
+	switch codec {
+	case "", "none", "gzip":
+	case "zstd":
+		// the checksums of the frames are verified, the window is bounded by the limit as well
+		options := []zstd.DOption{zstd.WithDecoderConcurrency(0)}
+		if limit > 0 {
+			window := uint64(limit)
+			if window < zstd.MinWindowSize {
+				window = zstd.MinWindowSize
+			}
+			options = append(options, zstd.WithDecoderMaxMemory(uint64(limit)), zstd.WithDecoderMaxWindow(window))
+		}
+		var err error
+		if d.zstd, err = zstd.NewReader(nil, options...); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("payload-compression should be none, gzip or zstd, given: %v", codec)
+	}
+
+	return d, nil
+}
+
+// decompress returns the payload of a message
+func (d *payloadDecompressor) decompress(data []byte) ([]byte, error) {
+	switch d.codec {
+	case "gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if d.limit == 0 {
+			return ioutil.ReadAll(reader)
+		}
+		out, err := ioutil.ReadAll(io.LimitReader(reader, d.limit+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(out)) > d.limit {
+			return nil, fmt.Errorf("payload decompresses to more than %d bytes", d.limit)
+		}
+		return out, nil
+	case "zstd":
+		out, err := d.zstd.DecodeAll(data, nil)
+		if err == zstd.ErrDecoderSizeExceeded {
+			return nil, fmt.Errorf("payload decompresses to more than %d bytes", d.limit)
+		}
+		return out, err
+	}
+
+	return data, nil
+}
+
+// compressionResults compares the compressed bytes of the measured messages with their decompressed bytes,
+// failed is the number of payloads that could not be decompressed
+func compressionResults(codec string, compressed, decompressed, failed int64, runTime float64) *results.CompressionResults {
+	res := &results.CompressionResults{
+		Codec:             codec,
+		BytesDecompressed: decompressed,
+		Failed:            failed,
+	}
+	if compressed > 0 {
+		res.Ratio = float64(decompressed) / float64(compressed)
+	}
+	if runTime > 0 {
+		res.MBPerSec = float64(decompressed) / 1e6 / runTime
+	}
+
+	return res
+}
+
+// calculateCompressionTotals sums the decompressed bytes of all clients, the throughput is over the
+// measurement window of the totals
+func calculateCompressionTotals(runs []*results.RunResults, totals *results.TotalResults) *results.CompressionResults {
+	var codec string
+	var decompressed, failed int64
+	for _, res := range runs {
+		if res.Compression == nil {
+			continue
+		}
+		codec = res.Compression.Codec
+		decompressed += res.Compression.BytesDecompressed
+		failed += res.Compression.Failed
+	}
+	if codec == "" {
+		return nil
+	}
+
+	return compressionResults(codec, totals.BytesReceived, decompressed, failed, totals.WindowTime)
+}
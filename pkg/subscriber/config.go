@@ -0,0 +1,137 @@
+package subscriber
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// version is the version of the tool, set at build time with -ldflags "-X github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/pkg/subscriber.version=v1.2.3"
+var version = ""
+
+// secretFlags are the flags whose values may hold credentials, they are redacted from the results
+var secretFlags = map[string]bool{
+	"password":      true,
+	"smtp-password": true,
+	"key-password":  true,
+	"pg-dsn":        true,
+	"es-url":        true,
+	"notify-url":    true,
+	"output":        true,
+}
+
+// toolVersion returns the version set at build time, or the module version if built with go install
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+
+	return "unknown"
+}
+
+// effectiveConfig records the configuration of the run from started to finished, it must be called
+// after the flags were validated so defaults derived from other flags are included
+func effectiveConfig(fs *flag.FlagSet, started, finished time.Time) *results.ConfigResults {
+	hostname, _ := os.Hostname()
+	cfg := &results.ConfigResults{
+		Version:    toolVersion(),
+		GoVersion:  runtime.Version(),
+		Hostname:   hostname,
+		Host:       hostResults(),
+		Args:       os.Args[1:],
+		Flags:      make(map[string]string),
+		StartedAt:  started,
+		FinishedAt: finished,
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "REDACTED"
+		}
+		if f.Name == "broker" {
+			value = redactURL(value)
+			cfg.Broker = value
+		}
+		cfg.Flags[f.Name] = value
+	})
+	cfg.Args = redactArgs(cfg.Args)
+
+	return cfg
+}
+
+// hostResults describes the host the subscriber runs on
+func hostResults() *results.HostResults {
+	host := &results.HostResults{
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+	}
+	if release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		host.Kernel = strings.TrimSpace(string(release))
+	}
+
+	return host
+}
+
+// redactURL returns rawURL with its password, if any, redacted, or those of a comma separated list of URLs
+func redactURL(rawURL string) string {
+	if strings.Contains(rawURL, ",") {
+		urls := strings.Split(rawURL, ",")
+		for i := range urls {
+			urls[i] = redactURL(urls[i])
+		}
+		return strings.Join(urls, ",")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); !ok {
+		return rawURL
+	}
+	u.User = url.UserPassword(u.User.Username(), "REDACTED")
+
+	return u.String()
+}
+
+// redactArgs returns a copy of the command line args with the values of secret flags redacted,
+// given as -flag=value or -flag value, and the passwords of URLs
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	secretValue := false
+	for i, arg := range args {
+		// passwords in URLs, e.g. of -broker
+		redacted[i] = redactURL(arg)
+		if secretValue {
+			redacted[i] = "REDACTED"
+			secretValue = false
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if eq := strings.Index(name, "="); eq >= 0 {
+			if secretFlags[name[:eq]] {
+				redacted[i] = arg[:len(arg)-len(name)+eq+1] + "REDACTED"
+			} else {
+				redacted[i] = arg[:len(arg)-len(name)+eq+1] + redactURL(name[eq+1:])
+			}
+			continue
+		}
+		secretValue = secretFlags[name]
+	}
+
+	return redacted
+}
@@ -0,0 +1,377 @@
+package subscriber
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configSetting is a flag value of a config file, by the name of the flag
+type configSetting struct {
+	line  int
+	name  string
+	value string
+}
+
+// configFile is a benchmark configuration read with -config. Its settings are flag values by flag name
+// (repeatable flags take a list), its groups the client groups of the run with their settings by name.
+type configFile struct {
+	path     string
+	settings []configSetting
+	groups   []map[string]string
+}
+
+// readConfigFile reads a YAML (.yaml, .yml) or TOML (.toml) config file. Only the subset needed for flag values
+// is supported: scalars, lists of scalars and, for groups, a list of maps (YAML) or [[groups]] tables (TOML).
+// Constructs outside it, such as anchors, block scalars, inline maps and multi-line strings, are rejected
+// rather than misread.
+func readConfigFile(path string) (*configFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cfg := &configFile{path: path}
+	scanner := bufio.NewScanner(file)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = cfg.parseYAML(scanner)
+	case ".toml":
+		err = cfg.parseTOML(scanner)
+	default:
+		return nil, fmt.Errorf("unsupported config file %v, expected .yaml, .yml or .toml", path)
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// configArg returns the value of the -config flag in args before fs parses them, the file has to be read
+// first so the flags on the command line override its settings
+func configArg(fs *flag.FlagSet, args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+		// skip the value of a flag given as -flag value, boolean flags have none
+		if f := fs.Lookup(name); f != nil {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				i++
+			}
+		}
+	}
+
+	return ""
+}
+
+// apply sets the flags of fs to the settings of the config file, the groups are returned by parseGroups
+func (cfg *configFile) apply(fs *flag.FlagSet) error {
+	for _, setting := range cfg.settings {
+		if setting.name == "config" {
+			return fmt.Errorf("%v:%d: config files cannot include another config file", cfg.path, setting.line)
+		}
+		if fs.Lookup(setting.name) == nil {
+			return fmt.Errorf("%v:%d: unknown setting %v", cfg.path, setting.line, setting.name)
+		}
+		if err := fs.Set(setting.name, setting.value); err != nil {
+			return fmt.Errorf("%v:%d: invalid value %q for %v: %v", cfg.path, setting.line, setting.value, setting.name, err)
+		}
+	}
+
+	return nil
+}
+
+// configIndent returns the indentation of a line and the line without it and without a trailing comment
+func configIndent(line string) (int, string) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	inQuote, escaped := rune(0), false
+	for i, r := range trimmed {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote == '"' && r == '\\':
+			escaped = true
+		case inQuote != 0:
+			if r == inQuote {
+				inQuote = 0
+			}
+		case r == '"' || r == '\'':
+			inQuote = r
+		case r == '#' && (i == 0 || trimmed[i-1] == ' ' || trimmed[i-1] == '\t'):
+			return indent, strings.TrimSpace(trimmed[:i])
+		}
+	}
+
+	return indent, strings.TrimSpace(trimmed)
+}
+
+// configScalar unquotes a quoted scalar, other scalars are taken as is. Values that start a construct outside
+// the supported subset are rejected, quoting them takes them literally.
+func configScalar(value string) (string, error) {
+	switch {
+	case value == "":
+		return "", nil
+	case strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''"):
+		return "", errors.New("multi-line strings are not supported")
+	case value[0] == '"' || value[0] == '\'':
+		unquoted, rest, err := configQuoted(value)
+		if err != nil {
+			return "", err
+		}
+		if rest != "" {
+			return "", fmt.Errorf("unexpected %q after quoted value", rest)
+		}
+		return unquoted, nil
+	case value[0] == '[' || value[0] == '{' || value == "-" || strings.HasPrefix(value, "- "):
+		return "", fmt.Errorf("unsupported value %v, nested lists and inline maps are not supported", value)
+	case strings.ContainsRune("&*!|>?%@`", rune(value[0])):
+		return "", fmt.Errorf("unsupported value %v, anchors, aliases, tags and block scalars are not supported, quote it to take it literally", value)
+	}
+
+	return value, nil
+}
+
+// configQuoted unquotes the quoted scalar at the start of value and returns the text after it. Double quotes
+// take the escapes \" \\ \/ \n \r \t, single quotes take the text as is except for a doubled quote (YAML).
+func configQuoted(value string) (string, string, error) {
+	quote := value[0]
+	var unquoted strings.Builder
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(value) && value[i+1] == '\'':
+			unquoted.WriteByte('\'')
+			i++
+		case c == quote:
+			return unquoted.String(), strings.TrimSpace(value[i+1:]), nil
+		case c == '\\' && quote == '"':
+			if i+1 == len(value) {
+				return "", "", errors.New("unterminated quoted value")
+			}
+			i++
+			switch value[i] {
+			case '"', '\\', '/':
+				unquoted.WriteByte(value[i])
+			case 'n':
+				unquoted.WriteByte('\n')
+			case 'r':
+				unquoted.WriteByte('\r')
+			case 't':
+				unquoted.WriteByte('\t')
+			default:
+				return "", "", fmt.Errorf("unsupported escape \\%c in quoted value", value[i])
+			}
+		default:
+			unquoted.WriteByte(c)
+		}
+	}
+
+	return "", "", errors.New("unterminated quoted value")
+}
+
+// configList splits an inline list [a, "b", c] into its unquoted scalars. Commas in quoted items are part of the
+// item, a trailing comma is allowed but empty items, nested lists and text after the list are rejected.
+func configList(value string) ([]string, error) {
+	items := []string{}
+	rest := strings.TrimSpace(value[1:])
+	for {
+		if rest == "" {
+			return nil, errors.New("unterminated list, lists have to be on one line")
+		}
+		if rest[0] == ']' {
+			break
+		}
+		var item string
+		var err error
+		if rest[0] == '"' || rest[0] == '\'' {
+			item, rest, err = configQuoted(rest)
+		} else {
+			end := strings.IndexAny(rest, ",]")
+			if end < 0 {
+				end = len(rest)
+			}
+			plain := strings.TrimSpace(rest[:end])
+			if plain == "" {
+				return nil, errors.New("empty list item")
+			}
+			item, err = configScalar(plain)
+			rest = rest[end:]
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		switch {
+		case strings.HasPrefix(rest, ","):
+			rest = strings.TrimSpace(rest[1:])
+		case strings.HasPrefix(rest, "]"):
+		case rest == "":
+			return nil, errors.New("unterminated list, lists have to be on one line")
+		default:
+			return nil, fmt.Errorf("expected ',' or ']' in list, found %q", rest)
+		}
+	}
+	if rest = strings.TrimSpace(rest[1:]); rest != "" {
+		return nil, fmt.Errorf("unexpected %q after list", rest)
+	}
+
+	return items, nil
+}
+
+// parseYAML parses top-level 'name: value' settings, lists as '[a, b]' or '- item' lines below 'name:', and the
+// groups as a list of maps below 'groups:'
+func (cfg *configFile) parseYAML(scanner *bufio.Scanner) error {
+	var list string // the setting whose '- item' lines follow
+	var group map[string]string
+	var err error
+	groupIndent := 0
+	for number := 1; scanner.Scan(); number++ {
+		if strings.HasPrefix(strings.TrimLeft(scanner.Text(), " "), "\t") {
+			return fmt.Errorf("line %d: tabs are not allowed for indentation", number)
+		}
+		indent, line := configIndent(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "---" {
+			if len(cfg.settings) > 0 || len(cfg.groups) > 0 || list != "" {
+				return fmt.Errorf("line %d: only one document is supported", number)
+			}
+			continue
+		}
+		if indent == 0 {
+			list, group = "", nil
+		}
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			item := strings.TrimSpace(strings.TrimPrefix(line, "-"))
+			switch {
+			case list == "groups":
+				group = make(map[string]string)
+				groupIndent = indent + 2
+				cfg.groups = append(cfg.groups, group)
+				if item == "" {
+					continue
+				}
+				line, indent = item, groupIndent
+			case list != "":
+				value, err := configScalar(item)
+				if err != nil {
+					return fmt.Errorf("line %d: %v", number, err)
+				}
+				cfg.settings = append(cfg.settings, configSetting{line: number, name: list, value: value})
+				continue
+			default:
+				return fmt.Errorf("line %d: list item without a setting", number)
+			}
+		}
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return fmt.Errorf("line %d: expected 'name: value'", number)
+		}
+		name, value := strings.TrimSpace(line[:colon]), strings.TrimSpace(line[colon+1:])
+		if name, err = configScalar(name); err != nil {
+			return fmt.Errorf("line %d: %v", number, err)
+		}
+		if group != nil && indent == groupIndent {
+			if group[name], err = configScalar(value); err != nil {
+				return fmt.Errorf("line %d: %v", number, err)
+			}
+			continue
+		}
+		if indent != 0 {
+			return fmt.Errorf("line %d: unexpected indentation, settings are not nested", number)
+		}
+		switch {
+		case value == "":
+			list = name
+		case name == "groups":
+			return fmt.Errorf("line %d: groups should be a list of maps", number)
+		case strings.HasPrefix(value, "["):
+			items, err := configList(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", number, err)
+			}
+			for _, item := range items {
+				cfg.settings = append(cfg.settings, configSetting{line: number, name: name, value: item})
+			}
+		default:
+			if value, err = configScalar(value); err != nil {
+				return fmt.Errorf("line %d: %v", number, err)
+			}
+			cfg.settings = append(cfg.settings, configSetting{line: number, name: name, value: value})
+		}
+	}
+
+	return nil
+}
+
+// parseTOML parses top-level 'name = value' settings, lists as '[a, b]', and the groups as [[groups]] tables
+func (cfg *configFile) parseTOML(scanner *bufio.Scanner) error {
+	var group map[string]string
+	var err error
+	for number := 1; scanner.Scan(); number++ {
+		_, line := configIndent(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case line == "[[groups]]":
+			group = make(map[string]string)
+			cfg.groups = append(cfg.groups, group)
+			continue
+		case strings.HasPrefix(line, "["):
+			return fmt.Errorf("line %d: unsupported table %v, only [[groups]] is supported", number, line)
+		}
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			return fmt.Errorf("line %d: expected 'name = value'", number)
+		}
+		name, value := strings.TrimSpace(line[:eq]), strings.TrimSpace(line[eq+1:])
+		if name, err = configScalar(name); err != nil {
+			return fmt.Errorf("line %d: %v", number, err)
+		}
+		if group != nil {
+			if group[name], err = configScalar(value); err != nil {
+				return fmt.Errorf("line %d: %v", number, err)
+			}
+			continue
+		}
+		if strings.HasPrefix(value, "[") {
+			items, err := configList(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", number, err)
+			}
+			for _, item := range items {
+				cfg.settings = append(cfg.settings, configSetting{line: number, name: name, value: item})
+			}
+			continue
+		}
+		if value, err = configScalar(value); err != nil {
+			return fmt.Errorf("line %d: %v", number, err)
+		}
+		cfg.settings = append(cfg.settings, configSetting{line: number, name: name, value: value})
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package subscriber
+
+import (
+	"bufio"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigScalar(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{value: "", want: ""},
+		{value: "tcp://broker:1883", want: "tcp://broker:1883"},
+		{value: "-1", want: "-1"},
+		{value: "sensors/#", want: "sensors/#"},
+		{value: `"a, b"`, want: "a, b"},
+		{value: `"say \"hi\" \\ \/ \t"`, want: "say \"hi\" \\ / \t"},
+		{value: `'it''s'`, want: "it's"},
+		{value: `'c:\path'`, want: `c:\path`},
+		{value: `"*"`, want: "*"},
+		{value: `"unterminated`, err: "unterminated quoted value"},
+		{value: `"a" b`, err: `unexpected "b" after quoted value`},
+		{value: `"\x"`, err: `unsupported escape \x`},
+		{value: `"""multi"""`, err: "multi-line strings are not supported"},
+		{value: "'''multi'''", err: "multi-line strings are not supported"},
+		{value: "{a: 1}", err: "inline maps are not supported"},
+		{value: "[a]", err: "nested lists"},
+		{value: "- a", err: "nested lists"},
+		{value: "&anchor value", err: "anchors"},
+		{value: "*alias", err: "aliases"},
+		{value: "!!str 1", err: "tags"},
+		{value: "|", err: "block scalars"},
+		{value: ">-", err: "block scalars"},
+	}
+	for _, test := range tests {
+		got, err := configScalar(test.value)
+		checkConfigError(t, test.value, err, test.err)
+		if err == nil && got != test.want {
+			t.Errorf("configScalar(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+		err   string
+	}{
+		{value: "[]", want: []string{}},
+		{value: "[ ]", want: []string{}},
+		{value: "[a, b, c]", want: []string{"a", "b", "c"}},
+		{value: "[a,b,]", want: []string{"a", "b"}},
+		{value: `["a, b", 'c]d', e]`, want: []string{"a, b", "c]d", "e"}},
+		{value: `["x\"y", "" ]`, want: []string{`x"y`, ""}},
+		{value: "[env=ci, team=qa]", want: []string{"env=ci", "team=qa"}},
+		{value: "[a, b", err: "unterminated list"},
+		{value: `["a", "b`, err: "unterminated quoted value"},
+		{value: "[a,, b]", err: "empty list item"},
+		{value: "[, a]", err: "empty list item"},
+		{value: "[[a], b]", err: "nested lists"},
+		{value: "[{a: 1}]", err: "inline maps"},
+		{value: `["a" "b"]`, err: "expected ',' or ']'"},
+		{value: "[a] b", err: `unexpected "b" after list`},
+	}
+	for _, test := range tests {
+		got, err := configList(test.value)
+		checkConfigError(t, test.value, err, test.err)
+		if err == nil && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("configList(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestConfigIndent(t *testing.T) {
+	tests := []struct {
+		line   string
+		indent int
+		want   string
+	}{
+		{line: "count: 10", indent: 0, want: "count: 10"},
+		{line: "    qos: 2  # at least once", indent: 4, want: "qos: 2"},
+		{line: "# comment", indent: 0, want: ""},
+		{line: "topic: sensors/#", indent: 0, want: "topic: sensors/#"},
+		{line: `label: "a # b" # c`, indent: 0, want: `label: "a # b"`},
+		{line: `label: "a \" # b" # c`, indent: 0, want: `label: "a \" # b"`},
+		{line: `label: 'a # b'`, indent: 0, want: `label: 'a # b'`},
+	}
+	for _, test := range tests {
+		indent, got := configIndent(test.line)
+		if indent != test.indent || got != test.want {
+			t.Errorf("configIndent(%q) = %d, %q, want %d, %q", test.line, indent, got, test.indent, test.want)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		settings []configSetting
+		groups   []map[string]string
+		err      string
+	}{
+		{
+			name: "settings and lists",
+			input: "---\nbroker: tcp://broker:1883 # comment\ncount: 1000\nlabel: [env=ci, \"team=a, b\"]\n" +
+				"topic:\n  - a/#\n  - 'b'\n",
+			settings: []configSetting{
+				{line: 2, name: "broker", value: "tcp://broker:1883"},
+				{line: 3, name: "count", value: "1000"},
+				{line: 4, name: "label", value: "env=ci"},
+				{line: 4, name: "label", value: "team=a, b"},
+				{line: 6, name: "topic", value: "a/#"},
+				{line: 7, name: "topic", value: "b"},
+			},
+		},
+		{
+			name:  "groups",
+			input: "groups:\n  - name: sensors\n    clients: 50\n  -\n    name: \"alarms\"\n    qos: 2\n",
+			groups: []map[string]string{
+				{"name": "sensors", "clients": "50"},
+				{"name": "alarms", "qos": "2"},
+			},
+		},
+		{name: "tab in value", input: "label:\ta\tb\n", settings: []configSetting{{line: 1, name: "label", value: "a\tb"}}},
+		{name: "tabs", input: "count: 1\n\tqos: 1\n", err: "line 2: tabs are not allowed"},
+		{name: "nested", input: "broker:\n  host: x\n", err: "line 2: unexpected indentation"},
+		{name: "item without setting", input: "- a\n", err: "line 1: list item without a setting"},
+		{name: "no colon", input: "count 1\n", err: "line 1: expected 'name: value'"},
+		{name: "inline groups", input: "groups: [a]\n", err: "line 1: groups should be a list of maps"},
+		{name: "inline map group", input: "groups:\n  - {name: a}\n", err: "line 2: unsupported value {name"},
+		{name: "block scalar", input: "topic: |\n  a\n", err: "line 1: unsupported value |"},
+		{name: "anchor", input: "count: &n 1\n", err: "line 1: unsupported value &n 1"},
+		{name: "alias", input: "qos: *n\n", err: "line 1: unsupported value *n"},
+		{name: "multi-line list", input: "label: [a,\n  b]\n", err: "line 1: unterminated list"},
+		{name: "nested list item", input: "label:\n  - - a\n", err: "line 2: unsupported value - a"},
+		{name: "bad group value", input: "groups:\n  - name: 'a\n", err: "line 2: unterminated quoted value"},
+		{name: "documents", input: "count: 1\n---\ncount: 2\n", err: "line 2: only one document"},
+	}
+	for _, test := range tests {
+		cfg := &configFile{}
+		err := cfg.parseYAML(bufio.NewScanner(strings.NewReader(test.input)))
+		checkConfigError(t, test.name, err, test.err)
+		if err == nil {
+			checkConfig(t, test.name, cfg, test.settings, test.groups)
+		}
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		settings []configSetting
+		groups   []map[string]string
+		err      string
+	}{
+		{
+			name: "settings and groups",
+			input: "broker = \"tcp://broker:1883\" # comment\n\"count\" = 1000\nlabel = ['env=ci', \"a,b\",]\n\n" +
+				"[[groups]]\nname = \"sensors\"\nclients = 50\n[[groups]]\nname = 'alarms'\n",
+			settings: []configSetting{
+				{line: 1, name: "broker", value: "tcp://broker:1883"},
+				{line: 2, name: "count", value: "1000"},
+				{line: 3, name: "label", value: "env=ci"},
+				{line: 3, name: "label", value: "a,b"},
+			},
+			groups: []map[string]string{
+				{"name": "sensors", "clients": "50"},
+				{"name": "alarms"},
+			},
+		},
+		{name: "table", input: "[broker]\nhost = 1\n", err: "line 1: unsupported table [broker]"},
+		{name: "no equals", input: "count 1\n", err: "line 1: expected 'name = value'"},
+		{name: "multi-line string", input: "topic = \"\"\"\na\n\"\"\"\n", err: "line 1: multi-line strings"},
+		{name: "multi-line array", input: "label = [\n  \"a\",\n]\n", err: "line 1: unterminated list"},
+		{name: "inline table", input: "tls = { ca = \"x\" }\n", err: "line 1: unsupported value {"},
+		{name: "group list", input: "[[groups]]\ntopic = [\"a\"]\n", err: "line 2: unsupported value [\"a\"]"},
+		{name: "trailing text", input: "broker = \"a\" \"b\"\n", err: `line 1: unexpected "\"b\"" after quoted value`},
+	}
+	for _, test := range tests {
+		cfg := &configFile{}
+		err := cfg.parseTOML(bufio.NewScanner(strings.NewReader(test.input)))
+		checkConfigError(t, test.name, err, test.err)
+		if err == nil {
+			checkConfig(t, test.name, cfg, test.settings, test.groups)
+		}
+	}
+}
+
+func TestConfigArg(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	fs.Int("count", 0, "")
+	fs.Bool("quiet", false, "")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"-config", "a.yaml"}, want: "a.yaml"},
+		{args: []string{"--config=b.toml", "-count", "1"}, want: "b.toml"},
+		{args: []string{"-count", "-config", "-config", "c.yaml"}, want: "c.yaml"},
+		{args: []string{"-quiet", "-config", "d.yaml"}, want: "d.yaml"},
+		{args: []string{"-count=1", "-config", "e.yaml"}, want: "e.yaml"},
+		{args: []string{"extra", "-config", "f.yaml"}, want: ""},
+		{args: []string{"--", "-config", "g.yaml"}, want: ""},
+	}
+	for _, test := range tests {
+		if got := configArg(fs, test.args); got != test.want {
+			t.Errorf("configArg(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	count := fs.Int("count", 0, "")
+	tests := []struct {
+		settings []configSetting
+		err      string
+	}{
+		{settings: []configSetting{{line: 1, name: "count", value: "5"}}},
+		{settings: []configSetting{{line: 2, name: "config", value: "x.yaml"}}, err: "c.yaml:2: config files cannot include"},
+		{settings: []configSetting{{line: 3, name: "nope", value: "1"}}, err: "c.yaml:3: unknown setting nope"},
+		{settings: []configSetting{{line: 4, name: "count", value: "x"}}, err: `c.yaml:4: invalid value "x" for count`},
+	}
+	for _, test := range tests {
+		cfg := &configFile{path: "c.yaml", settings: test.settings}
+		checkConfigError(t, test.settings[0].name, cfg.apply(fs), test.err)
+		if test.err == "" && *count != 5 {
+			t.Errorf("count = %d, want 5", *count)
+		}
+	}
+}
+
+// checkConfigError reports an error that is not expected or does not contain the expected text
+func checkConfigError(t *testing.T, name string, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("%v: unexpected error %v", name, err)
+	case want != "" && err == nil:
+		t.Errorf("%v: expected error containing %q", name, want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("%v: error %q does not contain %q", name, err, want)
+	}
+}
+
+// checkConfig reports settings and groups of cfg that differ from the expected ones
+func checkConfig(t *testing.T, name string, cfg *configFile, settings []configSetting, groups []map[string]string) {
+	t.Helper()
+	if !reflect.DeepEqual(cfg.settings, settings) {
+		t.Errorf("%v: settings = %+v, want %+v", name, cfg.settings, settings)
+	}
+	if !reflect.DeepEqual(cfg.groups, groups) {
+		t.Errorf("%v: groups = %+v, want %+v", name, cfg.groups, groups)
+	}
+}
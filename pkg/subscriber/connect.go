@@ -0,0 +1,136 @@
+package subscriber
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// maxConnectBackoff caps the exponential backoff between connect attempts
+const maxConnectBackoff = time.Minute
+
+// connectLimiter bounds the number of clients establishing their connection at the same time,
+// so thousands of clients do not flood the broker (and the local network stack) with handshakes at once
+type connectLimiter chan struct{}
+
+// portRangeFile holds the range of local ports used for outgoing connections on Linux
+const portRangeFile = "/proc/sys/net/ipv4/ip_local_port_range"
+
+// newConnectLimiter returns a connectLimiter allowing concurrency connection attempts, nil if unlimited
+func newConnectLimiter(concurrency int) connectLimiter {
+	if concurrency <= 0 {
+		return nil
+	}
+
+	return make(connectLimiter, concurrency)
+}
+
+// acquire blocks until the client may connect, a nil connectLimiter never blocks
+func (l connectLimiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+// release frees the slot taken by acquire
+func (l connectLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// checkLocalPorts warns if more clients connect to a single broker address than there are local ports
+// for outgoing connections, each connection to the same address needs its own local port
+func checkLocalPorts(clientsPerAddress int) {
+	data, err := ioutil.ReadFile(portRangeFile)
+	if err != nil {
+		return
+	}
+	var low, high int
+	if _, err := fmt.Sscan(strings.TrimSpace(string(data)), &low, &high); err != nil {
+		return
+	}
+	if ports := high - low + 1; clientsPerAddress > ports {
+		logf(levelWarn, "%v clients connect to the same broker address but only %v local ports are available (%v), "+
+			"spread the clients over more broker addresses or widen the port range", clientsPerAddress, ports, portRangeFile)
+	}
+}
+
+// connect connects client to the broker, retrying a failed attempt up to ConnectRetries times with an
+// exponential backoff starting at ConnectBackoff. It returns the error of the last attempt, or of the
+// attempt during which the measurement ended.
+func (c *Client) connect(client mqtt.Client) error {
+	backoff := c.ConnectBackoff
+	for attempt := 0; ; attempt++ {
+		c.connects.acquire()
+		connectStarted := time.Now()
+		c.events.log(c.ID, eventConnect, nil)
+		token := client.Connect()
+		token.Wait()
+		c.connects.release()
+		err := token.Error()
+		if err == nil {
+			// of the first connection, goOffline connects again
+			atomic.CompareAndSwapInt64(&c.connectTime, 0, int64(time.Since(connectStarted)))
+			if c.Conn != nil {
+				c.Conn.connacked(connectStarted, time.Now())
+			}
+			return nil
+		}
+		c.events.log(c.ID, eventConnectFailed, err)
+		c.logf(levelWarn, "had error connecting to the broker: %v", err)
+		if attempt >= c.ConnectRetries {
+			return err
+		}
+
+		if !c.Quiet {
+			c.logf(levelInfo, "retrying to connect in %v", backoff)
+		}
+		select {
+		case <-c.acc.done:
+			return err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+// reconnect reconnects client after it lost its connection. paho reconnects by itself unless the connects are
+// limited, then the client reconnects here so it waits for a slot like the clients connecting for the first
+// time. It retries with the exponential backoff of connect until reconnected, the measurement ended or ctx
+// is done.
+func (c *Client) reconnect(ctx context.Context, client mqtt.Client) {
+	backoff := c.ConnectBackoff
+	for {
+		c.connects.acquire()
+		c.events.log(c.ID, eventConnect, nil)
+		token := client.Connect()
+		token.Wait()
+		c.connects.release()
+		err := token.Error()
+		if err == nil {
+			c.connectedAfterStop(client)
+			return
+		}
+		c.events.log(c.ID, eventConnectFailed, err)
+		c.logf(levelWarn, "had error reconnecting to the broker: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.acc.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
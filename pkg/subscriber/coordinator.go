@@ -0,0 +1,426 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// Modes of the command line tool: a single instance, or workers on several machines started and merged by a coordinator
+const (
+	modeStandalone  = "standalone"
+	modeWorker      = "worker"
+	modeCoordinator = "coordinator"
+)
+
+// coordinatorStartDelay is how far ahead of the last registration the coordinator schedules the start,
+// so every worker receives the start message in time
+const coordinatorStartDelay = 2 * time.Second
+
+// coordinatorHeartbeat is the interval at which a running worker tells the coordinator it is alive, so the
+// coordinator can give up on a worker that hangs or lost its connection without bounding the run time
+const coordinatorHeartbeat = 5 * time.Second
+
+// Types of the coordinator messages. A worker sends register and receives registered right away, and start
+// once all workers registered; while running it sends heartbeats, after its run a run message per client
+// followed by done.
+const (
+	messageRegister   = "register"
+	messageRegistered = "registered"
+	messageStart      = "start"
+	messageHeartbeat  = "heartbeat"
+	messageRun        = "run"
+	messageDone       = "done"
+)
+
+// coordinatorMessage is a message between the coordinator and a worker, sent as a JSON document per line over TCP
+type coordinatorMessage struct {
+	Type     string `json:"type"`
+	Worker   string `json:"worker,omitempty"`    // register: hostname of the worker
+	Clients  int    `json:"clients,omitempty"`   // register: number of clients of the worker
+	Index    int    `json:"index,omitempty"`     // registered: index of the worker
+	IDOffset int    `json:"id_offset,omitempty"` // registered: offset of the worker's client indices in the merged results
+	StartAt  int64  `json:"start_at,omitempty"`  // start: unix nanoseconds at which all workers start
+
+	// run: the results of a client with the samples that are not part of its JSON results
+	Run       *results.RunResults `json:"run,omitempty"`
+	Latencies []float64           `json:"latencies,omitempty"`
+	PerSecond map[int64]int64     `json:"per_second,omitempty"`
+	Histogram map[int64]int64     `json:"histogram,omitempty"`
+	Sections  *sectionSamples     `json:"sections,omitempty"`
+
+	// done: the totals of the worker and the seconds from the start until its last client stopped measuring
+	Totals  *results.TotalResults `json:"totals,omitempty"`
+	RunTime float64               `json:"run_time,omitempty"`
+}
+
+// sectionSamples are the samples of the sections of a client's results that are not part of its JSON results,
+// the coordinator pools them in the totals like a worker does
+type sectionSamples struct {
+	UnsubscribeTimes            []float64       `json:"unsubscribe_times,omitempty"`
+	ResubscribeTimes            []float64       `json:"resubscribe_times,omitempty"`
+	PubRecTimes                 []float64       `json:"pubrec_times,omitempty"`
+	PubRelTimes                 []float64       `json:"pubrel_times,omitempty"`
+	PubCompTimes                []float64       `json:"pubcomp_times,omitempty"`
+	QoS2Times                   []float64       `json:"qos2_times,omitempty"`
+	InterArrivalHistogram       map[int64]int64 `json:"inter_arrival_histogram,omitempty"`
+	PublisherToBrokerHistogram  map[int64]int64 `json:"publisher_to_broker_histogram,omitempty"`
+	BrokerToSubscriberHistogram map[int64]int64 `json:"broker_to_subscriber_histogram,omitempty"`
+}
+
+// newSectionSamples returns the section samples of res
+func newSectionSamples(res *results.RunResults) *sectionSamples {
+	s := new(sectionSamples)
+	if r := res.Resubscribe; r != nil {
+		s.UnsubscribeTimes, s.ResubscribeTimes = r.UnsubscribeTimes, r.ResubscribeTimes
+	}
+	if q := res.QoS2; q != nil {
+		s.PubRecTimes, s.PubRelTimes, s.PubCompTimes, s.QoS2Times = q.PubRecTimes, q.PubRelTimes, q.PubCompTimes, q.TotalTimes
+	}
+	if j := res.Jitter; j != nil {
+		s.InterArrivalHistogram = j.InterArrivalHistogram
+	}
+	if b := res.BrokerLatency; b != nil {
+		if b.PublisherToBroker != nil {
+			s.PublisherToBrokerHistogram = b.PublisherToBroker.Histogram
+		}
+		if b.BrokerToSubscriber != nil {
+			s.BrokerToSubscriberHistogram = b.BrokerToSubscriber.Histogram
+		}
+	}
+
+	return s
+}
+
+// restore sets the section samples of res, received without them
+func (s *sectionSamples) restore(res *results.RunResults) {
+	if s == nil {
+		return
+	}
+	if r := res.Resubscribe; r != nil {
+		r.UnsubscribeTimes, r.ResubscribeTimes = s.UnsubscribeTimes, s.ResubscribeTimes
+	}
+	if q := res.QoS2; q != nil {
+		q.PubRecTimes, q.PubRelTimes, q.PubCompTimes, q.TotalTimes = s.PubRecTimes, s.PubRelTimes, s.PubCompTimes, s.QoS2Times
+	}
+	if j := res.Jitter; j != nil {
+		j.InterArrivalHistogram = s.InterArrivalHistogram
+	}
+	if b := res.BrokerLatency; b != nil {
+		if b.PublisherToBroker != nil {
+			b.PublisherToBroker.Histogram = s.PublisherToBrokerHistogram
+		}
+		if b.BrokerToSubscriber != nil {
+			b.BrokerToSubscriber.Histogram = s.BrokerToSubscriberHistogram
+		}
+	}
+}
+
+// coordinatorAddress returns the host:port of a coordinator given as tcp://host:port
+func coordinatorAddress(coordinatorURL string) (string, error) {
+	u, err := url.Parse(coordinatorURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid coordinator %v: %v", coordinatorURL, err)
+	}
+	if u.Scheme != "tcp" || u.Port() == "" {
+		return "", fmt.Errorf("invalid coordinator %v, expected tcp://host:port", coordinatorURL)
+	}
+
+	return u.Host, nil
+}
+
+// coordinatorWorker is the connection of a worker to the coordinator
+type coordinatorWorker struct {
+	conn       net.Conn
+	dec        *json.Decoder
+	registered coordinatorMessage
+	startAt    time.Time
+
+	mu        sync.Mutex // the heartbeats are sent concurrently with the results
+	enc       *json.Encoder
+	heartbeat chan struct{}
+}
+
+// joinCoordinator registers a worker running clients clients with the coordinator at address
+func joinCoordinator(address string, clients int) (*coordinatorWorker, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	w := &coordinatorWorker{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+		dec:  json.NewDecoder(conn),
+	}
+	hostname, _ := os.Hostname()
+	if err := w.enc.Encode(&coordinatorMessage{Type: messageRegister, Worker: hostname, Clients: clients}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := w.receive(messageRegistered, &w.registered); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// receive reads the next message from the coordinator, which should be of type kind
+func (w *coordinatorWorker) receive(kind string, msg *coordinatorMessage) error {
+	if err := w.dec.Decode(msg); err != nil {
+		return err
+	}
+	if msg.Type != kind {
+		return fmt.Errorf("expected a %v message from the coordinator, got %v", kind, msg.Type)
+	}
+
+	return nil
+}
+
+// waitForStart waits until the start the coordinator schedules once all workers registered
+func (w *coordinatorWorker) waitForStart() error {
+	var start coordinatorMessage
+	if err := w.receive(messageStart, &start); err != nil {
+		return err
+	}
+	w.startAt = time.Unix(0, start.StartAt)
+	w.heartbeat = make(chan struct{})
+	go w.sendHeartbeats(w.heartbeat)
+	wait := time.Until(w.startAt)
+	if wait < 0 {
+		logf(levelWarn, "starting %v after the other workers, this worker took too long to set up", -wait)
+	}
+	time.Sleep(wait)
+
+	return nil
+}
+
+// sendHeartbeats tells the coordinator the worker is alive every coordinatorHeartbeat until stop is closed
+func (w *coordinatorWorker) sendHeartbeats(stop chan struct{}) {
+	ticker := time.NewTicker(coordinatorHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		err := w.enc.Encode(&coordinatorMessage{Type: messageHeartbeat})
+		w.mu.Unlock()
+		if err != nil {
+			logf(levelWarn, "Error sending a heartbeat to the coordinator: %v", err)
+			return
+		}
+	}
+}
+
+// sendResults streams the results of the worker's clients to the coordinator followed by its totals and
+// the time until measuredUntil, when its last client stopped measuring, and closes the connection
+func (w *coordinatorWorker) sendResults(jr *results.JSONResults, measuredUntil time.Time) error {
+	defer w.conn.Close()
+	close(w.heartbeat)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, res := range jr.Runs {
+		err := w.enc.Encode(&coordinatorMessage{
+			Type:      messageRun,
+			Run:       res,
+			Latencies: res.Latencies,
+			PerSecond: res.PerSecond,
+			Histogram: res.Histogram,
+			Sections:  newSectionSamples(res),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.enc.Encode(&coordinatorMessage{
+		Type:    messageDone,
+		Totals:  jr.Totals,
+		RunTime: measuredUntil.Sub(w.startAt).Seconds(),
+	})
+}
+
+// runCoordinator waits for workers workers to register at address, starts them at the same time and
+// merges the results they send back. The percentiles are those of the pooled latencies of all clients.
+// It gives up if not all workers registered within registerTimeout, or if a running worker sent nothing,
+// not even a heartbeat, for workerTimeout.
+func runCoordinator(address string, workers int, percentiles []float64, registerTimeout, workerTimeout time.Duration,
+	quiet bool) (*results.JSONResults, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	if !quiet {
+		logf(levelInfo, "Coordinator waiting for %v workers on %v", workers, l.Addr())
+	}
+	registerBy := time.Now().Add(registerTimeout)
+	if err := l.(*net.TCPListener).SetDeadline(registerBy); err != nil {
+		return nil, err
+	}
+
+	conns := make([]net.Conn, workers)
+	encs := make([]*json.Encoder, workers)
+	decs := make([]*json.Decoder, workers)
+	registrations := make([]coordinatorMessage, workers)
+	offsets := make([]int, workers)
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	offset := 0
+	for i := range conns {
+		if conns[i], err = l.Accept(); err != nil {
+			if isTimeout(err) {
+				return nil, fmt.Errorf("only %v of %v workers registered within %v", i, workers, registerTimeout)
+			}
+			return nil, err
+		}
+		encs[i] = json.NewEncoder(conns[i])
+		decs[i] = json.NewDecoder(conns[i])
+		conns[i].SetReadDeadline(registerBy)
+		if err := decs[i].Decode(&registrations[i]); err != nil {
+			return nil, fmt.Errorf("worker %v: %v", conns[i].RemoteAddr(), err)
+		}
+		if registrations[i].Type != messageRegister {
+			return nil, fmt.Errorf("worker %v: expected a %v message, got %v", conns[i].RemoteAddr(), messageRegister, registrations[i].Type)
+		}
+		offsets[i] = offset
+		if err := encs[i].Encode(&coordinatorMessage{Type: messageRegistered, Index: i, IDOffset: offset}); err != nil {
+			return nil, fmt.Errorf("worker %v: %v", conns[i].RemoteAddr(), err)
+		}
+		if !quiet {
+			logf(levelInfo, "Worker %v (%v) registered with %v clients", i, registrations[i].Worker, registrations[i].Clients)
+		}
+		offset += registrations[i].Clients
+	}
+
+	startAt := time.Now().Add(coordinatorStartDelay)
+	for i, enc := range encs {
+		if err := enc.Encode(&coordinatorMessage{Type: messageStart, StartAt: startAt.UnixNano()}); err != nil {
+			return nil, fmt.Errorf("worker %v: %v", i, err)
+		}
+	}
+	if !quiet {
+		logf(levelInfo, "Starting %v workers with %v clients at %v", workers, offset, startAt.Format(time.RFC3339Nano))
+	}
+
+	type workerDone struct {
+		index  int
+		runs   []*results.RunResults
+		totals *results.TotalResults
+		// seconds from the start until the worker's last client stopped measuring
+		runTime float64
+		err     error
+	}
+	done := make(chan workerDone)
+	for i := range decs {
+		go func(i int) {
+			res := workerDone{index: i}
+			for {
+				var msg coordinatorMessage
+				conns[i].SetReadDeadline(time.Now().Add(workerTimeout))
+				if res.err = decs[i].Decode(&msg); res.err != nil {
+					if isTimeout(res.err) {
+						res.err = fmt.Errorf("no message for %v, the worker hangs or lost its connection", workerTimeout)
+					}
+					break
+				}
+				if msg.Type == messageHeartbeat {
+					continue
+				}
+				if msg.Type == messageDone {
+					res.totals = msg.Totals
+					res.runTime = msg.RunTime
+					break
+				}
+				if msg.Type != messageRun || msg.Run == nil {
+					res.err = fmt.Errorf("unexpected %v message", msg.Type)
+					break
+				}
+				msg.Run.Latencies = msg.Latencies
+				msg.Run.PerSecond = msg.PerSecond
+				msg.Run.Histogram = msg.Histogram
+				msg.Sections.restore(msg.Run)
+				res.runs = append(res.runs, msg.Run)
+			}
+			done <- res
+		}(i)
+	}
+
+	var runs []*results.RunResults
+	workerResults := make([]*results.WorkerResults, workers)
+	var errs []error
+	// the run ends when the last client of any worker stopped measuring, as reported by the workers: the time
+	// the results arrive here includes their reporting and the network
+	var runTime float64
+	for range decs {
+		res := <-done
+		registration := registrations[res.index]
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("worker %v (%v): %v", res.index, registration.Worker, res.err))
+			continue
+		}
+		for _, run := range res.runs {
+			run.ID += offsets[res.index]
+		}
+		runTime = math.Max(runTime, res.runTime)
+		runs = append(runs, res.runs...)
+		workerResults[res.index] = &results.WorkerResults{
+			Worker:       registration.Worker,
+			Index:        res.index,
+			Clients:      len(res.runs),
+			IDOffset:     offsets[res.index],
+			TotalResults: res.totals,
+		}
+		if !quiet {
+			logf(levelInfo, "Worker %v (%v) finished", res.index, registration.Worker)
+		}
+	}
+	totalTime := time.Duration(runTime * float64(time.Second))
+	if len(errs) > 0 {
+		for _, err := range errs[1:] {
+			logf(levelError, "Error collecting results: %v", err)
+		}
+		return nil, errs[0]
+	}
+	if len(runs) == 0 {
+		return nil, errors.New("the workers did not report any client")
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ID < runs[j].ID
+	})
+
+	totals := calculateTotalResults(runs, totalTime, len(runs))
+	totals.Percentiles = pooledPercentiles(runs, percentiles)
+	totals.LatencyHistogram = pooledHistogramBuckets(runs)
+
+	return &results.JSONResults{
+		SchemaVersion: results.SchemaVersion,
+		Runs:          runs,
+		Totals:        totals,
+		Workers:       workerResults,
+	}, nil
+}
+
+// isTimeout reports whether err is the timeout of a network deadline
+func isTimeout(err error) bool {
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
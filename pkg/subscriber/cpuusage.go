@@ -0,0 +1,19 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package subscriber
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user and system CPU time used by the process so far
+func processCPUTime() (time.Duration, time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, 0, false
+	}
+
+	return time.Duration(usage.Utime.Nano()), time.Duration(usage.Stime.Nano()), true
+}
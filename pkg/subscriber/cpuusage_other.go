@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package subscriber
+
+import "time"
+
+// processCPUTime does not report the CPU time on other platforms
+func processCPUTime() (time.Duration, time.Duration, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,121 @@
+package subscriber
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// printCSV writes the results as CSV: a header, a row per client and a totals row with client "total".
+// Latencies are in nanoseconds, the percentile columns are those of the totals.
+func printCSV(w io.Writer, jr *results.JSONResults) error {
+	totals := jr.Totals
+	header := []string{"run_id", "client", "broker", "tenant", "qos", "successes", "run_time",
+		"msg_time_min_ns", "msg_time_max_ns", "msg_time_mean_ns", "msg_time_std_ns", "msgs_per_sec", "rate_cv",
+		"duplicates", "duplicate_deliveries", "lost", "out_of_order", "gaps", "disconnects", "truncated"}
+	for _, p := range totals.Percentiles {
+		header = append(header, "p"+formatFloat(p.Percentile)+"_ns")
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, res := range jr.Runs {
+		row := []string{jr.RunID, strconv.Itoa(res.ID), res.Broker, res.Tenant, strconv.Itoa(int(res.QoS)),
+			formatInt(res.Successes), formatFloat(res.RunTime), formatFloat(res.MsgTimeMin), formatFloat(res.MsgTimeMax),
+			formatFloat(res.MsgTimeMean), formatFloat(res.MsgTimeStd), formatFloat(res.MsgsPerSec), formatFloat(res.RateCV),
+			formatInt(res.Duplicates), formatInt(res.DuplicateDeliveries), formatInt(res.Lost), formatInt(res.OutOfOrder), formatInt(res.Gaps),
+			formatInt(res.Disconnects), strconv.FormatBool(res.Truncated)}
+		cw.Write(append(row, percentileColumns(res.Percentiles, totals.Percentiles)...))
+	}
+	// over all clients the latency is weighted by message and the rate measured over the common window
+	row := []string{jr.RunID, "total", "", "", "", formatInt(totals.Successes), formatFloat(totals.TotalRunTime),
+		formatFloat(totals.MsgTimeMin), formatFloat(totals.MsgTimeMax), formatFloat(totals.MsgTimeMean),
+		formatFloat(totals.MsgTimeStd), formatFloat(totals.MsgsPerSec), formatFloat(totals.RateCV),
+		formatInt(totals.Duplicates), formatInt(totals.DuplicateDeliveries), formatInt(totals.Lost), formatInt(totals.OutOfOrder), formatInt(totals.Gaps),
+		formatInt(totals.Disconnects), strconv.FormatBool(totals.Truncated)}
+	cw.Write(append(row, percentileColumns(totals.Percentiles, totals.Percentiles)...))
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// percentileColumns returns the latencies of percentiles in the order of columns, empty if missing
+func percentileColumns(percentiles, columns []*results.Percentile) []string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		for _, p := range percentiles {
+			if p.Percentile == column.Percentile {
+				values[i] = formatFloat(p.Latency)
+			}
+		}
+	}
+
+	return values
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// latencyDump writes the latency of every measured message of all clients as CSV rows, in the order
+// they are measured
+type latencyDump struct {
+	mu     sync.Mutex
+	f      *os.File
+	buf    *bufio.Writer
+	w      *csv.Writer
+	closed bool
+}
+
+// openLatencyDump creates (or truncates) the latency file at path and writes the header
+func openLatencyDump(path string) (*latencyDump, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	d := &latencyDump{f: f, buf: buf, w: csv.NewWriter(buf)}
+	d.w.Write([]string{"received_at", "client", "publisher", "message_id", "latency_ns"})
+
+	return d, nil
+}
+
+// write writes a message measured by client with latency in nanoseconds, a nil latencyDump ignores it
+func (d *latencyDump) write(client int, m *Message, latency float64) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.w.Write([]string{formatInt(m.ReceivedAt), strconv.Itoa(client), strconv.Itoa(m.Payload.ClientId),
+		strconv.Itoa(m.Payload.MessageId), formatFloat(latency)})
+}
+
+// Close flushes and closes the latency file, it returns the first error writing it
+func (d *latencyDump) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	d.w.Flush()
+	err := d.w.Error()
+	if err == nil {
+		err = d.buf.Flush()
+	}
+	if closeErr := d.f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,144 @@
+package subscriber
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// dashboardClients is the maximum number of clients the dashboard shows a progress bar for
+const dashboardClients = 20
+
+// dashboardLogLines is the number of log lines the dashboard shows below the clients
+const dashboardLogLines = 5
+
+// dashboard renders a refreshing view of the progress of the clients to a terminal on every interval
+// report, using ANSI escape sequences. The log is shown below it rather than scrolling it away.
+type dashboard struct {
+	out     io.Writer
+	clients []*Client
+	logs    *logTail
+}
+
+func newDashboard(out io.Writer, clients []*Client) *dashboard {
+	return &dashboard{out: out, clients: clients, logs: newLogTail(dashboardLogLines)}
+}
+
+// render draws the dashboard for an interval report
+func (d *dashboard) render(report *IntervalReport) {
+	width := terminalColumns()
+	var b bytes.Buffer
+	// move the cursor home and clear the screen
+	b.WriteString("\033[H\033[2J")
+
+	var disconnects, completed int64
+	for i, c := range d.clients {
+		disconnects += atomic.LoadInt64(&c.disconnects)
+		if c.ReceiveCount > 0 && report.Clients[i].Received >= c.ReceiveCount {
+			completed++
+		}
+	}
+	totals := report.Totals
+	fmt.Fprintf(&b, "mqtt-benchmark-subscriber   elapsed %.1fs   clients %d (%d done)\n\n",
+		report.Elapsed, len(d.clients), completed)
+	fmt.Fprintf(&b, "Messages received:  %d\n", totals.Received)
+	fmt.Fprintf(&b, "Rate (msg/sec):     %.1f\n", totals.MsgsPerSec)
+	fmt.Fprintf(&b, "Latency (ms):       p50 %.3f   p95 %.3f   p99 %.3f\n",
+		totals.LatencyP50/1_000_000, totals.LatencyP95/1_000_000, totals.LatencyP99/1_000_000)
+	fmt.Fprintf(&b, "Reconnects:         %d\n\n", disconnects)
+
+	bar := width - 66
+	if bar < 10 {
+		bar = 10
+	}
+	for i, stats := range report.Clients {
+		if i == dashboardClients {
+			fmt.Fprintf(&b, "... and %d more clients\n", len(report.Clients)-dashboardClients)
+			break
+		}
+		c := d.clients[i]
+		fmt.Fprintf(&b, "%5d %s %10s  %9.1f msg/s  p99 %8.3f ms  reconnects %d\n", stats.ID,
+			progressBar(stats.Received, c.ReceiveCount, bar), progressCount(stats.Received, c.ReceiveCount),
+			stats.MsgsPerSec, stats.LatencyP99/1_000_000, atomic.LoadInt64(&c.disconnects))
+	}
+
+	if lines := d.logs.lines(); len(lines) > 0 {
+		b.WriteString("\n")
+		for _, line := range lines {
+			if len(line) > width {
+				line = line[:width]
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	d.out.Write(b.Bytes())
+}
+
+// progressBar returns a bar of width characters filled to received out of count, empty if count is 0
+func progressBar(received, count int64, width int) string {
+	filled := 0
+	if count > 0 {
+		filled = int(int64(width) * received / count)
+		if filled > width {
+			filled = width
+		}
+	}
+
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+// progressCount returns received out of count, or only received without a count
+func progressCount(received, count int64) string {
+	if count == 0 {
+		return strconv.FormatInt(received, 10)
+	}
+
+	return fmt.Sprintf("%d/%d", received, count)
+}
+
+// terminalColumns returns the width of the terminal from $COLUMNS, 80 if unknown
+func terminalColumns() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+
+	return 80
+}
+
+// logTail keeps the last lines written to it, to be used as the output of the log while the dashboard
+// owns the terminal
+type logTail struct {
+	mu   sync.Mutex
+	max  int
+	tail []string
+}
+
+func newLogTail(max int) *logTail {
+	return &logTail{max: max}
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.tail = append(t.tail, line)
+	}
+	if len(t.tail) > t.max {
+		t.tail = t.tail[len(t.tail)-t.max:]
+	}
+
+	return len(p), nil
+}
+
+// lines returns a copy of the last lines
+func (t *logTail) lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.tail...)
+}
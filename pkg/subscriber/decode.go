@@ -0,0 +1,191 @@
+package subscriber
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// payloadDecoder extracts the Payload fields from the messages of publishers that do not send the
+// Payload JSON document
+type payloadDecoder interface {
+	decode(data []byte) (Payload, error)
+	// messageIDs reports whether the decoded payloads identify the messages by publisher and MessageId
+	messageIDs() bool
+}
+
+// binaryDecoder reads the timestamp of binary payloads as 8 bytes big-endian nanoseconds since the Unix
+// epoch at a fixed offset
+type binaryDecoder struct {
+	offset int
+}
+
+func (d *binaryDecoder) decode(data []byte) (Payload, error) {
+	if len(data) < d.offset+8 {
+		return Payload{}, fmt.Errorf("payload of %d bytes has no timestamp at offset %d", len(data), d.offset)
+	}
+
+	return Payload{GeneratedAt: int64(binary.BigEndian.Uint64(data[d.offset:]))}, nil
+}
+
+func (d *binaryDecoder) messageIDs() bool {
+	return false
+}
+
+// timestampUnits are the units of numeric timestamps accepted by -timestamp-unit
+var timestampUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// jsonPointerDecoder takes the fields of the Payload from arbitrary JSON documents by JSON pointer (RFC 6901).
+// The timestamp is a number of units since the Unix epoch or an RFC 3339 string; the publisher and
+// message id are optional.
+type jsonPointerDecoder struct {
+	timestamp []string
+	unit      time.Duration
+	clientID  []string
+	messageID []string
+}
+
+// newJSONPointerDecoder creates a decoder for the given pointers, clientIDField and messageIDField may be empty
+func newJSONPointerDecoder(timestampField, unit, clientIDField, messageIDField string) (*jsonPointerDecoder, error) {
+	d := &jsonPointerDecoder{unit: timestampUnits[unit]}
+	if d.unit == 0 {
+		return nil, fmt.Errorf("invalid timestamp unit %v, expected ns, us, ms or s", unit)
+	}
+	var err error
+	if d.timestamp, err = parseJSONPointer(timestampField); err != nil {
+		return nil, err
+	}
+	if clientIDField != "" {
+		if d.clientID, err = parseJSONPointer(clientIDField); err != nil {
+			return nil, err
+		}
+	}
+	if messageIDField != "" {
+		if d.messageID, err = parseJSONPointer(messageIDField); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// parseJSONPointer splits a JSON pointer into its unescaped reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q, it should start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func (d *jsonPointerDecoder) decode(data []byte) (Payload, error) {
+	var payload Payload
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return payload, err
+	}
+
+	timestamp, err := resolveJSONPointer(doc, d.timestamp)
+	if err != nil {
+		return payload, err
+	}
+	if payload.GeneratedAt, err = jsonTimestamp(timestamp, d.unit); err != nil {
+		return payload, err
+	}
+
+	if d.clientID != nil {
+		if payload.ClientId, err = resolveJSONInt(doc, d.clientID); err != nil {
+			return payload, err
+		}
+	}
+	if d.messageID != nil {
+		if payload.MessageId, err = resolveJSONInt(doc, d.messageID); err != nil {
+			return payload, err
+		}
+	}
+
+	return payload, nil
+}
+
+// jsonTimestamp returns the unix nanoseconds of a timestamp in a JSON document, a number of units since the Unix
+// epoch or an RFC 3339 string
+func jsonTimestamp(timestamp interface{}, unit time.Duration) (int64, error) {
+	switch value := timestamp.(type) {
+	case json.Number:
+		units, err := value.Float64()
+		if err != nil {
+			return 0, err
+		}
+		// integral nanoseconds are taken as is, a float64 cannot represent them exactly
+		if n, err := value.Int64(); err == nil && unit == time.Nanosecond {
+			return n, nil
+		}
+		return int64(units * float64(unit)), nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return 0, err
+		}
+		return t.UnixNano(), nil
+	default:
+		return 0, fmt.Errorf("timestamp is not a number or RFC 3339 string: %v", timestamp)
+	}
+}
+
+func (d *jsonPointerDecoder) messageIDs() bool {
+	return d.messageID != nil
+}
+
+// resolveJSONPointer returns the value the reference tokens of a JSON pointer point to in doc
+func resolveJSONPointer(doc interface{}, tokens []string) (interface{}, error) {
+	value := doc
+	for i, token := range tokens {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[token]; !ok {
+				return nil, fmt.Errorf("field /%s not found", strings.Join(tokens[:i+1], "/"))
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("element /%s not found", strings.Join(tokens[:i+1], "/"))
+			}
+			value = v[index]
+		default:
+			return nil, fmt.Errorf("/%s is not an object or array", strings.Join(tokens[:i], "/"))
+		}
+	}
+
+	return value, nil
+}
+
+// resolveJSONInt returns the integer a JSON pointer points to in doc
+func resolveJSONInt(doc interface{}, tokens []string) (int, error) {
+	value, err := resolveJSONPointer(doc, tokens)
+	if err != nil {
+		return 0, err
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("/%s is not a number: %v", strings.Join(tokens, "/"), value)
+	}
+	n, err := number.Int64()
+
+	return int(n), err
+}
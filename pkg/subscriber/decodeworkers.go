@@ -0,0 +1,154 @@
+package subscriber
+
+import (
+	"sync"
+	"sync/atomic"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// decodeQueuePerWorker is the number of messages queued per decode worker before the handler waits
+const decodeQueuePerWorker = 256
+
+// decodeJob is a message queued for the decode workers, decoded receives the messages measured from it
+type decodeJob struct {
+	msg        mqtt.Message
+	receivedAt int64
+	decoded    chan []*Message
+}
+
+// decodeShard is the message count of a single worker, padded to a cache line so the workers do not share one
+type decodeShard struct {
+	messages int64
+	_        [56]byte
+}
+
+// decodePool decodes the messages of a client in parallel (decompression, batches, JSON unmarshalling) and
+// records them in the order they were received, so the sequences per publisher are checked as without it.
+// Only recording holds the lock of the accumulator, in a single goroutine. The handler waits while the queue
+// is full and counts how often it had to.
+type decodePool struct {
+	jobs      chan *decodeJob
+	ordered   chan *decodeJob // the jobs in the order received, for the recorder
+	shards    []decodeShard
+	queueFull int64
+
+	mu       sync.RWMutex // held by push while queueing, so stop does not close the queues under it
+	running  bool
+	stopping bool
+	stopOnce sync.Once
+	drained  chan struct{}
+}
+
+func newDecodePool(workers int) *decodePool {
+	return &decodePool{
+		jobs:    make(chan *decodeJob, workers*decodeQueuePerWorker),
+		ordered: make(chan *decodeJob, workers*decodeQueuePerWorker),
+		shards:  make([]decodeShard, workers),
+		drained: make(chan struct{}),
+	}
+}
+
+// run starts the workers, which decode the queued messages, and the recorder, which records them in order
+// until the pool is stopped and its queue drained. A pool stopped before it ran never runs.
+func (p *decodePool) run(decode func(msg mqtt.Message, receivedAt int64) []*Message, record func(m *Message)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopping {
+		return
+	}
+	p.running = true
+	for i := range p.shards {
+		go func(shard *decodeShard) {
+			for job := range p.jobs {
+				job.decoded <- decode(job.msg, job.receivedAt)
+				atomic.AddInt64(&shard.messages, 1)
+			}
+		}(&p.shards[i])
+	}
+	go func() {
+		for job := range p.ordered {
+			for _, m := range <-job.decoded {
+				record(m)
+			}
+		}
+		close(p.jobs)
+		close(p.drained)
+	}()
+}
+
+// push queues a message, waiting while the queue is full. It returns false once the pool is stopped, the
+// caller handles the message itself then.
+func (p *decodePool) push(msg mqtt.Message, receivedAt int64) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopping {
+		return false
+	}
+	job := &decodeJob{msg: msg, receivedAt: receivedAt, decoded: make(chan []*Message, 1)}
+	select {
+	case p.ordered <- job:
+	default:
+		atomic.AddInt64(&p.queueFull, 1)
+		p.ordered <- job
+	}
+	p.jobs <- job
+
+	return true
+}
+
+// stop stops queueing messages and returns once the messages queued so far are recorded
+func (p *decodePool) stop() {
+	if p == nil {
+		return
+	}
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopping = true
+		if p.running {
+			close(p.ordered)
+		} else {
+			close(p.drained)
+		}
+		p.mu.Unlock()
+	})
+	<-p.drained
+}
+
+// results merges the counts of the workers, nil without a pool
+func (p *decodePool) results() *results.DecodeWorkerResults {
+	if p == nil {
+		return nil
+	}
+	res := &results.DecodeWorkerResults{
+		Workers:   len(p.shards),
+		QueueFull: atomic.LoadInt64(&p.queueFull),
+		PerWorker: make([]int64, len(p.shards)),
+	}
+	for i := range p.shards {
+		res.PerWorker[i] = atomic.LoadInt64(&p.shards[i].messages)
+		res.Messages += res.PerWorker[i]
+	}
+
+	return res
+}
+
+// calculateDecodeWorkerTotals sums the messages decoded by the workers of all clients
+func calculateDecodeWorkerTotals(runs []*results.RunResults) *results.DecodeWorkerResults {
+	var totals *results.DecodeWorkerResults
+	for _, res := range runs {
+		d := res.DecodeWorkers
+		if d == nil {
+			continue
+		}
+		if totals == nil {
+			totals = &results.DecodeWorkerResults{Workers: d.Workers}
+		}
+		totals.Messages += d.Messages
+		totals.QueueFull += d.QueueFull
+	}
+
+	return totals
+}
@@ -0,0 +1,67 @@
+package subscriber
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// DelayDistribution describes an artificial per-message processing delay, either fixed or drawn from a distribution
+type DelayDistribution struct {
+	Kind string
+	A    time.Duration
+	B    time.Duration
+}
+
+// parseDelay parses a processing delay, one of '<duration>' (fixed), 'uniform:<min>:<max>',
+// 'exp:<mean>' or 'normal:<mean>:<std>'
+func parseDelay(s string) (*DelayDistribution, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) == 1 {
+		parts = []string{"fixed", parts[0]}
+	}
+	d := &DelayDistribution{Kind: parts[0]}
+	durations := make([]time.Duration, len(parts)-1)
+	for i, part := range parts[1:] {
+		v, err := time.ParseDuration(part)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid duration %q in delay %q", part, s)
+		}
+		durations[i] = v
+	}
+
+	switch {
+	case (d.Kind == "fixed" || d.Kind == "exp") && len(durations) == 1:
+		d.A = durations[0]
+	case (d.Kind == "uniform" || d.Kind == "normal") && len(durations) == 2:
+		d.A, d.B = durations[0], durations[1]
+		if d.Kind == "uniform" && d.B < d.A {
+			return nil, fmt.Errorf("maximum should not be less than minimum in delay %q", s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid delay %q, expected <duration>, uniform:<min>:<max>, exp:<mean> or normal:<mean>:<std>", s)
+	}
+
+	return d, nil
+}
+
+// Next draws the next delay, negative draws of the normal distribution are clamped to 0
+func (d *DelayDistribution) Next(rnd *rand.Rand) time.Duration {
+	var v float64
+	switch d.Kind {
+	case "uniform":
+		v = float64(d.A) + rnd.Float64()*float64(d.B-d.A)
+	case "exp":
+		v = rnd.ExpFloat64() * float64(d.A)
+	case "normal":
+		v = float64(d.A) + rnd.NormFloat64()*float64(d.B)
+	default:
+		v = float64(d.A)
+	}
+	if v < 0 {
+		return 0
+	}
+
+	return time.Duration(v)
+}
@@ -0,0 +1,343 @@
+package subscriber
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// dialerScheme is the proxy scheme under which the Dialer is registered with golang.org/x/net/proxy.
+// paho has no hook for custom dialers, but it routes tcp:// and ssl:// connections through the
+// proxy configured in the all_proxy environment variable, which lets us establish them ourselves.
+const dialerScheme = "mqtt-benchmark"
+
+// clientHostPrefix prefixes the placeholder host a client connects to when dialed by the Dialer
+const clientHostPrefix = "client-"
+
+// Dialer establishes the broker connections of all clients, so socket level statistics can be collected
+type Dialer struct {
+	forward proxy.Dialer
+	// resolver resolves the broker hosts if set, it must not be changed once clients connect
+	resolver *dnsCache
+	// timing resolves the broker hosts without caching if there is no resolver, so DNS can be timed separately
+	timing bool
+	// network is dialed instead of the network requested by paho if set (tcp4 or tcp6)
+	network string
+	// delay enables Nagle's algorithm (TCP_NODELAY off), readBuffer sets SO_RCVBUF if > 0
+	delay      bool
+	readBuffer int
+	// sources are the local addresses clients bind to round-robin by their id if set, the connections
+	// are dialed directly (not through a proxy) within timeout
+	sources []*net.TCPAddr
+	timeout time.Duration
+	// qos2 times the QoS 2 exchanges of every connection
+	qos2 bool
+
+	mu      sync.Mutex
+	targets map[string]*dialTarget
+	conns   []*ClientConn
+}
+
+// dialTarget is a broker a client connects to through the Dialer
+type dialTarget struct {
+	conn      *ClientConn
+	index     int // of the broker in the URLs of the client
+	address   string
+	tlsConfig *tls.Config
+}
+
+// ClientConn tracks the broker connections dialed on behalf of a single client
+type ClientConn struct {
+	ID   int
+	URLs []string
+
+	mu       sync.Mutex
+	tcp      *net.TCPConn
+	tcpStats tcpInfoStats
+	phases   *connectPhases
+	qos2     *qos2Timing
+	dials    int64
+	broker   int // index in URLs of the broker dialed last
+	// downUntil holds back the reconnects after a chaos drop
+	downUntil time.Time
+}
+
+// newDialer creates a Dialer and installs it as paho's proxy. The connections go through proxyURL (socks5://,
+// http:// or https://) if set, or else through any proxy configured in the environment. Connecting to the broker
+// times out after timeout.
+func newDialer(timeout time.Duration, proxyURL string) (*Dialer, error) {
+	d := &Dialer{
+		forward: &net.Dialer{Timeout: timeout},
+		timeout: timeout,
+		targets: make(map[string]*dialTarget),
+	}
+
+	for _, scheme := range []string{"http", "https"} {
+		proxy.RegisterDialerType(scheme, func(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+			return newHTTPProxy(u, forward, timeout)
+		})
+	}
+	allProxy := proxyURL
+	if allProxy == "" {
+		allProxy = firstEnv("ALL_PROXY", "all_proxy")
+	}
+	if allProxy != "" {
+		u, err := url.Parse(allProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %v: %v", allProxy, err)
+		}
+		upstream, err := proxy.FromURL(u, d.forward)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %v: %v", allProxy, err)
+		}
+		if noProxy := firstEnv("NO_PROXY", "no_proxy"); noProxy != "" && proxyURL == "" {
+			perHost := proxy.NewPerHost(upstream, d.forward)
+			perHost.AddFromString(noProxy)
+			upstream = perHost
+		}
+		d.forward = upstream
+	}
+
+	proxy.RegisterDialerType(dialerScheme, func(*url.URL, proxy.Dialer) (proxy.Dialer, error) {
+		return d, nil
+	})
+	for _, name := range []string{"ALL_PROXY", "all_proxy"} {
+		os.Setenv(name, dialerScheme+"://")
+	}
+	for _, name := range []string{"NO_PROXY", "no_proxy"} {
+		os.Unsetenv(name)
+	}
+
+	return d, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// Register registers a client with the Dialer, the client should connect to the returned ClientConn's URLs,
+// which correspond to the given broker URLs
+func (d *Dialer) Register(id int, brokerURLs []string, tlsConfig *tls.Config) (*ClientConn, error) {
+	cc := &ClientConn{ID: id}
+	if d.qos2 {
+		cc.qos2 = newQoS2Timing()
+	}
+	targets := make(map[string]*dialTarget)
+	for i, brokerURL := range brokerURLs {
+		u, err := url.Parse(brokerURL)
+		if err != nil {
+			return nil, err
+		}
+		target := &dialTarget{
+			conn:    cc,
+			index:   i,
+			address: u.Host,
+		}
+		switch u.Scheme {
+		case "tcp":
+		case "ssl", "tls", "tcps":
+			if tlsConfig == nil {
+				target.tlsConfig = new(tls.Config)
+			} else {
+				target.tlsConfig = tlsConfig.Clone()
+			}
+			if target.tlsConfig.ServerName == "" {
+				target.tlsConfig.ServerName = u.Hostname()
+			}
+		default:
+			return nil, fmt.Errorf("unsupported broker scheme %v, only tcp and ssl connections can be dialed directly", u.Scheme)
+		}
+
+		host := clientHostPrefix + strconv.Itoa(id)
+		if i > 0 {
+			host += "-" + strconv.Itoa(i)
+		}
+		targets[host] = target
+		cc.URLs = append(cc.URLs, "tcp://"+host)
+	}
+
+	d.mu.Lock()
+	for host, target := range targets {
+		d.targets[host] = target
+	}
+	d.conns = append(d.conns, cc)
+	d.mu.Unlock()
+
+	return cc, nil
+}
+
+// Dial implements proxy.Dialer, addr is the placeholder host of a registered client
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	target, ok := d.targets[addr]
+	d.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no client registered for %v", addr)
+	}
+	target.conn.waitUntilUp()
+	atomic.AddInt64(&target.conn.dials, 1)
+
+	phases := &connectPhases{dialed: time.Now()}
+	addresses := []string{target.address}
+	var err error
+	if d.resolver != nil {
+		addresses, err = d.resolver.resolve(target.address)
+	} else if d.timing || len(d.sources) > 0 {
+		// source addresses are chosen by the address family of the broker address
+		addresses, err = lookupAddresses(target.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	phases.resolved = time.Now()
+	if d.network != "" {
+		network = d.network
+		addresses = filterAddresses(network, addresses)
+		if len(addresses) == 0 {
+			return nil, fmt.Errorf("broker %v has no %v address", target.address, network)
+		}
+	}
+
+	forward := func(address string) proxy.Dialer {
+		return d.forwardFor(target.conn.ID, address)
+	}
+	conn, err := target.dial(forward, network, addresses, phases, d.tuneConn)
+	if err != nil {
+		return nil, err
+	}
+	target.conn.dialedConn(phases)
+	target.conn.dialedBroker(target.index)
+	if target.conn.qos2 != nil {
+		conn = target.conn.qos2.wrap(conn)
+	}
+
+	return conn, nil
+}
+
+// dial connects to the first of the addresses of the target that accepts the connection, tune is applied
+// to the TCP connection before the TLS handshake
+func (t *dialTarget) dial(forward func(address string) proxy.Dialer, network string, addresses []string, phases *connectPhases,
+	tune func(*net.TCPConn) error) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	for _, address := range addresses {
+		if conn, err = forward(address).Dial(network, address); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	phases.connected = time.Now()
+	phases.handshaken = phases.connected
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if err := tune(tcp); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		t.conn.setTCPConn(tcp)
+	}
+	if t.tlsConfig == nil {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, t.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	phases.handshaken = time.Now()
+
+	return tlsConn, nil
+}
+
+// forwardFor returns the dialer connecting client id to address (ip:port or host:port): with source addresses
+// the client binds to one of the sources of the address family of the broker address, round-robin by id
+func (d *Dialer) forwardFor(id int, address string) proxy.Dialer {
+	if len(d.sources) == 0 {
+		return d.forward
+	}
+	sources := d.sources
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			var matching []*net.TCPAddr
+			for _, source := range d.sources {
+				if (source.IP.To4() != nil) == (ip.To4() != nil) {
+					matching = append(matching, source)
+				}
+			}
+			if len(matching) > 0 {
+				sources = matching
+			}
+		}
+	}
+
+	return &net.Dialer{Timeout: d.timeout, LocalAddr: sources[id%len(sources)]}
+}
+
+// tuneConn applies the socket options of the Dialer to a client connection
+func (d *Dialer) tuneConn(tcp *net.TCPConn) error {
+	if err := tcp.SetNoDelay(!d.delay); err != nil {
+		return err
+	}
+	if d.readBuffer > 0 {
+		return tcp.SetReadBuffer(d.readBuffer)
+	}
+
+	return nil
+}
+
+func (cc *ClientConn) setTCPConn(tcp *net.TCPConn) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.tcpStats.newConn()
+	cc.tcp = tcp
+}
+
+func (cc *ClientConn) dialedBroker(index int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.broker = index
+}
+
+// brokerIndex returns the index in URLs of the broker the client dialed last, 0 for a nil ClientConn
+func (cc *ClientConn) brokerIndex() int {
+	if cc == nil {
+		return 0
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.broker
+}
+
+// ClientConns returns all registered clients
+func (d *Dialer) ClientConns() []*ClientConn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]*ClientConn(nil), d.conns...)
+}
+
+// dialCount returns the number of connection attempts of the client, 0 for a nil ClientConn
+func (cc *ClientConn) dialCount() int64 {
+	if cc == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&cc.dials)
+}
@@ -0,0 +1,103 @@
+package subscriber
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache resolves broker hosts once and hands out the cached addresses to all client dials,
+// so thousands of clients connecting at the same time do not each query DNS
+type dnsCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// dnsEntry holds the addresses of a single host, resolving is done once for all waiting dials
+type dnsEntry struct {
+	ready     chan struct{}
+	addresses []string
+	err       error
+	expires   time.Time
+}
+
+// newDNSCache creates a dnsCache, entries are resolved again after ttl (never if ttl is 0)
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		entries: make(map[string]*dnsEntry),
+	}
+}
+
+// resolve returns the addresses (ip:port) of the given host:port, IP addresses are returned as is
+func (d *dnsCache) resolve(address string) ([]string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return []string{address}, nil
+	}
+
+	d.mu.Lock()
+	entry, ok := d.entries[host]
+	// failed lookups are retried, successful ones are kept for ttl
+	if ok && entry.resolved() && (entry.err != nil || d.ttl > 0 && time.Now().After(entry.expires)) {
+		ok = false
+	}
+	if !ok {
+		entry = &dnsEntry{ready: make(chan struct{})}
+		d.entries[host] = entry
+		go entry.lookup(host, d.ttl)
+	}
+	d.mu.Unlock()
+
+	<-entry.ready
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	addresses := make([]string, len(entry.addresses))
+	for i, ip := range entry.addresses {
+		addresses[i] = net.JoinHostPort(ip, port)
+	}
+
+	return addresses, nil
+}
+
+// lookupAddresses resolves the host of address (host:port) without caching, IP addresses are returned as is
+func lookupAddresses(address string) ([]string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return []string{address}, nil
+	}
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(ips))
+	for i, ip := range ips {
+		addresses[i] = net.JoinHostPort(ip, port)
+	}
+
+	return addresses, nil
+}
+
+func (e *dnsEntry) lookup(host string, ttl time.Duration) {
+	defer close(e.ready)
+	e.addresses, e.err = net.LookupHost(host)
+	e.expires = time.Now().Add(ttl)
+}
+
+func (e *dnsEntry) resolved() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
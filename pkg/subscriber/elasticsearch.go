@@ -0,0 +1,152 @@
+package subscriber
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// ElasticsearchExporter bulk-indexes the results into an Elasticsearch / OpenSearch index
+type ElasticsearchExporter struct {
+	URL         string
+	Index       string
+	MappingFile string
+	Samples     bool
+
+	client http.Client
+}
+
+// Export indexes the totals, the per-client results and optionally the latency samples of the run as separate
+// documents, distinguished by their 'type' field
+func (e *ElasticsearchExporter) Export(jr *results.JSONResults, start time.Time) error {
+	e.client.Timeout = 30 * time.Second
+	if e.MappingFile != "" {
+		if err := e.createIndex(); err != nil {
+			return err
+		}
+	}
+
+	var body bytes.Buffer
+	add := func(docType string, timestamp time.Time, v interface{}, omit ...string) error {
+		doc, err := toDocument(v)
+		if err != nil {
+			return err
+		}
+		for _, field := range omit {
+			delete(doc, field)
+		}
+		doc["type"] = docType
+		doc["@timestamp"] = timestamp.UTC().Format(time.RFC3339Nano)
+		if jr.RunID != "" {
+			doc["run_id"] = jr.RunID
+		}
+		if len(jr.Labels) > 0 {
+			doc["labels"] = jr.Labels
+		}
+		action := map[string]interface{}{"index": map[string]string{"_index": e.Index}}
+		for _, line := range []interface{}{action, doc} {
+			data, err := json.Marshal(line)
+			if err != nil {
+				return err
+			}
+			body.Write(data)
+			body.WriteByte('\n')
+		}
+		return nil
+	}
+
+	// the latency samples are indexed as separate documents
+	if err := add("totals", start, jr.Totals, "latency_series"); err != nil {
+		return err
+	}
+	for _, res := range jr.Runs {
+		if err := add("run", start, res); err != nil {
+			return err
+		}
+	}
+	if e.Samples {
+		for _, sample := range jr.Totals.LatencySeries {
+			timestamp := start.Add(time.Duration(sample.Elapsed * float64(time.Second)))
+			if err := add("latency_sample", timestamp, sample); err != nil {
+				return err
+			}
+		}
+	}
+
+	resp, err := e.client.Post(e.endpoint("_bulk"), "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("bulk request failed with %v: %s", resp.Status, data)
+	}
+	var bulk struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &bulk); err != nil {
+		return err
+	}
+	if bulk.Errors {
+		return fmt.Errorf("bulk request had errors: %s", data)
+	}
+
+	return nil
+}
+
+// createIndex creates the index with the provided mapping, unless it exists already
+func (e *ElasticsearchExporter) createIndex() error {
+	mapping, err := ioutil.ReadFile(e.MappingFile)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Head(e.endpoint(e.Index))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPut, e.endpoint(e.Index), bytes.NewReader(mapping))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("creating index %v failed with %v: %s", e.Index, resp.Status, data)
+	}
+
+	return nil
+}
+
+func (e *ElasticsearchExporter) endpoint(path string) string {
+	return strings.TrimSuffix(e.URL, "/") + "/" + path
+}
+
+// toDocument converts v to a generic JSON object using its JSON encoding
+func toDocument(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]interface{})
+	err = json.Unmarshal(data, &doc)
+
+	return doc, err
+}
@@ -0,0 +1,50 @@
+package subscriber
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// EmailReporter sends the text report of a run via SMTP
+type EmailReporter struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+	HTML     bool
+}
+
+// Send mails report to all recipients, as plain text or as preformatted HTML
+func (e *EmailReporter) Send(subject string, report string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	body := report
+	if e.HTML {
+		fmt.Fprintf(&msg, "Content-Type: text/html; charset=utf-8\r\n\r\n")
+		body = "<html><body><h3>" + html.EscapeString(subject) + "</h3><pre>" + html.EscapeString(report) + "</pre></body></html>"
+	} else {
+		fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	}
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, err := net.SplitHostPort(e.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+
+	return smtp.SendMail(e.Addr, auth, e.From, e.To, msg.Bytes())
+}
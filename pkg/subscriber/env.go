@@ -0,0 +1,92 @@
+package subscriber
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables that set flags, e.g. MQTT_BENCH_BROKER sets -broker
+const envPrefix = "MQTT_BENCH_"
+
+// envName returns the environment variable of a flag: the flag name in upper case with dashes replaced by
+// underscores after envPrefix
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// envConfigArg returns the config file of MQTT_BENCH_CONFIG, used when -config is not on the command line
+func envConfigArg() string {
+	return os.Getenv(envName("config"))
+}
+
+// applyEnv sets the flags of fs that have an environment variable. It is applied after the config file and
+// before parsing the command line, so the command line overrides the environment and the environment the
+// config file. A repeatable flag takes a value per line, which replace the values of the config file.
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		values := []string{value}
+		if strings.Contains(value, "\n") {
+			values = nil
+			for _, line := range strings.Split(value, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					values = append(values, line)
+				}
+			}
+		}
+		for _, v := range values {
+			if setErr := fs.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %v: %v", v, name, setErr)
+				return
+			}
+		}
+	})
+
+	return err
+}
+
+// replacedFlag is a repeatable flag whose values are replaced, rather than added to, by a source of higher
+// precedence: the config file, the environment and the command line, in that order
+type replacedFlag struct {
+	value flag.Value
+	reset func()
+	set   bool // set by the current source
+}
+
+func (r *replacedFlag) String() string {
+	if r.value == nil {
+		return ""
+	}
+
+	return r.value.String()
+}
+
+// Set implements flag.Value, the first value of a source drops the values of the sources before it
+func (r *replacedFlag) Set(value string) error {
+	if !r.set {
+		r.reset()
+		r.set = true
+	}
+
+	return r.value.Set(value)
+}
+
+// nextFlagSource starts a source of higher precedence, whose values replace those set so far of the
+// replacedFlags of fs
+func nextFlagSource(fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if r, ok := f.Value.(*replacedFlag); ok {
+			r.set = false
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Lifecycle events of a client's connection written to the event log
+const (
+	eventConnect          = "connect"         // connecting to the broker
+	eventConnectFailed    = "connect_failed"  // the connection attempt failed
+	eventConnected        = "connected"       // CONNACK received for the first connection
+	eventReconnected      = "reconnected"     // CONNACK received after the connection was lost or taken offline
+	eventConnectionLost   = "connection_lost" // the connection broke, paho reconnects
+	eventSubscribe        = "subscribe"       // SUBSCRIBE sent
+	eventSuback           = "suback"          // SUBACK received
+	eventSubscribeError   = "subscribe_failed"
+	eventUnsubscribe      = "unsubscribe" // UNSUBSCRIBE sent
+	eventUnsuback         = "unsuback"    // UNSUBACK received
+	eventUnsubscribeError = "unsubscribe_failed"
+	eventDisconnect       = "disconnect"  // DISCONNECT sent, e.g. to go offline
+	eventCompleted        = "completed"   // all messages received, -duration elapsed or stopped early (error says why)
+	eventStalled          = "stalled"     // no messages for longer than -stall-threshold
+	eventStallEnded       = "stall_ended" // messages received again after a stall
+)
+
+// LifecycleEvent is a single line of the event log
+type LifecycleEvent struct {
+	Time   time.Time `json:"time"`
+	Client int       `json:"client"`
+	Event  string    `json:"event"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// eventLog writes the lifecycle events of all clients as JSON lines, in the order they happen. Events are
+// written unbuffered, they are rare and must survive a crash of the process.
+type eventLog struct {
+	mu     sync.Mutex
+	f      *os.File
+	enc    *json.Encoder
+	err    error
+	closed bool
+}
+
+// openEventLog creates (or truncates) the event log file at path
+func openEventLog(path string) (*eventLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// log writes an event of client with the error that caused it (if any), a nil eventLog ignores it
+func (l *eventLog) log(client int, event string, cause error) {
+	if l == nil {
+		return
+	}
+	e := LifecycleEvent{Time: time.Now(), Client: client, Event: event}
+	if cause != nil {
+		e.Error = cause.Error()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the first error is reported by Close, events after Close (e.g. while shutting down) are dropped
+	if l.err == nil && !l.closed {
+		l.err = l.enc.Encode(&e)
+	}
+}
+
+// Close closes the event log, it returns the first error writing it
+func (l *eventLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if err := l.f.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+
+	return l.err
+}
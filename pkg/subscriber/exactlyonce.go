@@ -0,0 +1,150 @@
+package subscriber
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// parseIDRange parses the <first>-<last> MessageIds of -exactly-once
+func parseIDRange(s string) (int, int, error) {
+	bounds := strings.SplitN(s, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("exactly-once should be a range of MessageIds <first>-<last>, given: %v", s)
+	}
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("exactly-once should be a range of MessageIds <first>-<last>, given: %v", s)
+	}
+	last, err := strconv.Atoi(bounds[1])
+	if err != nil || first < 0 || last < first {
+		return 0, 0, fmt.Errorf("exactly-once should be a range of MessageIds <first>-<last>, given: %v", s)
+	}
+
+	return first, last, nil
+}
+
+// exactlyOnceTracker counts how often every MessageId in [first, last] of each publisher ClientId was received,
+// to verify that QoS 2 delivered each of them exactly once. The counts saturate at 255, its memory is a byte per
+// MessageId in the range per publisher.
+type exactlyOnceTracker struct {
+	first      int
+	last       int
+	counts     map[int][]uint8
+	unexpected int64
+}
+
+func newExactlyOnceTracker(first, last int) *exactlyOnceTracker {
+	return &exactlyOnceTracker{first: first, last: last, counts: make(map[int][]uint8)}
+}
+
+func (t *exactlyOnceTracker) received(m *Message) {
+	id := m.Payload.MessageId
+	if id < t.first || id > t.last {
+		t.unexpected++
+		return
+	}
+	counts, ok := t.counts[m.Payload.ClientId]
+	if !ok {
+		counts = make([]uint8, t.last-t.first+1)
+		t.counts[m.Payload.ClientId] = counts
+	}
+	if counts[id-t.first] < 255 {
+		counts[id-t.first]++
+	}
+}
+
+// idRanges returns the ranges [first, last] of the MessageIds whose count matches
+func (t *exactlyOnceTracker) idRanges(counts []uint8, match func(count uint8) bool) [][2]int {
+	var ranges [][2]int
+	for i, count := range counts {
+		if !match(count) {
+			continue
+		}
+		id := t.first + i
+		if n := len(ranges); n > 0 && ranges[n-1][1] == id-1 {
+			ranges[n-1][1] = id
+		} else {
+			ranges = append(ranges, [2]int{id, id})
+		}
+	}
+
+	return ranges
+}
+
+// results returns the verdict with the missing and duplicated MessageIds per publisher, listing at most
+// maxMissingRanges ranges of each. A client that received nothing from any publisher did not pass.
+func (t *exactlyOnceTracker) results() *results.ExactlyOnceResults {
+	res := &results.ExactlyOnceResults{
+		FirstID:    t.first,
+		LastID:     t.last,
+		Publishers: len(t.counts),
+		Expected:   int64(len(t.counts)) * int64(t.last-t.first+1),
+		Unexpected: t.unexpected,
+	}
+	publishers := make([]int, 0, len(t.counts))
+	for clientID := range t.counts {
+		publishers = append(publishers, clientID)
+	}
+	sort.Ints(publishers)
+
+	missingRanges, duplicateRanges := 0, 0
+	for _, clientID := range publishers {
+		counts := t.counts[clientID]
+		for _, count := range counts {
+			switch {
+			case count == 0:
+				res.Missing++
+			case count > 1:
+				res.Duplicated++
+			}
+		}
+		if missing := t.idRanges(counts, func(count uint8) bool { return count == 0 }); len(missing) > 0 && missingRanges < maxMissingRanges {
+			if len(missing) > maxMissingRanges-missingRanges {
+				missing = missing[:maxMissingRanges-missingRanges]
+			}
+			missingRanges += len(missing)
+			res.MissingIDs = append(res.MissingIDs, &results.MissingIDs{ClientID: clientID, Ranges: missing})
+		}
+		if duplicates := t.idRanges(counts, func(count uint8) bool { return count > 1 }); len(duplicates) > 0 && duplicateRanges < maxMissingRanges {
+			if len(duplicates) > maxMissingRanges-duplicateRanges {
+				duplicates = duplicates[:maxMissingRanges-duplicateRanges]
+			}
+			duplicateRanges += len(duplicates)
+			res.DuplicateIDs = append(res.DuplicateIDs, &results.DuplicateIDs{ClientID: clientID, Ranges: duplicates})
+		}
+	}
+	res.Passed = res.Publishers > 0 && res.Missing == 0 && res.Duplicated == 0
+
+	return res
+}
+
+// calculateExactlyOnceTotals sums the verdicts of the clients, the run passes if all clients passed
+func calculateExactlyOnceTotals(runs []*results.RunResults) *results.ExactlyOnceResults {
+	var totals *results.ExactlyOnceResults
+	for _, res := range runs {
+		eo := res.ExactlyOnce
+		if eo == nil {
+			continue
+		}
+		if totals == nil {
+			totals = &results.ExactlyOnceResults{Passed: true, FirstID: eo.FirstID, LastID: eo.LastID}
+		}
+		if eo.Publishers > totals.Publishers {
+			totals.Publishers = eo.Publishers
+		}
+		totals.Expected += eo.Expected
+		totals.Missing += eo.Missing
+		totals.Duplicated += eo.Duplicated
+		totals.Unexpected += eo.Unexpected
+		if !eo.Passed {
+			totals.Passed = false
+			totals.FailedClients++
+		}
+	}
+
+	return totals
+}
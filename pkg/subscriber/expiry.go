@@ -0,0 +1,148 @@
+package subscriber
+
+import (
+	"math"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// expiryTracker checks the remaining expiry of delivered messages, expired messages should not be delivered.
+// The broker drops the messages that expire while queued, it estimates which of the missing messages those
+// were: the ones of a gap that were published too early to be delivered before the message after the gap.
+type expiryTracker struct {
+	expired   int64
+	remaining []float64
+	longest   int64 // seconds, the largest message expiry interval property delivered
+
+	last    map[int][2]int64 // by publisher ClientId, the highest MessageId received and when it was generated
+	dropped map[int][][2]int // by publisher ClientId, ranges [first, last] of MessageIds estimated expired
+}
+
+func (t *expiryTracker) received(m *Message) {
+	var expiresAt, interval int64
+	switch {
+	case m.Payload.ExpiryInterval > 0:
+		interval = m.Payload.ExpiryInterval * int64(time.Second)
+		expiresAt = m.Payload.GeneratedAt + interval
+	case m.MessageExpiry > 0:
+		// the broker rounds the interval left to seconds, the longest one delivered is taken as the interval
+		// the publisher set
+		t.longest = max(t.longest, m.MessageExpiry)
+		interval = t.longest * int64(time.Second)
+		expiresAt = m.ReceivedAt + m.MessageExpiry*int64(time.Second)
+	default:
+		return
+	}
+	remaining := expiresAt - m.ReceivedAt
+	if remaining < 0 {
+		t.expired++
+	}
+	t.remaining = append(t.remaining, float64(remaining))
+	t.gap(m, m.ReceivedAt-interval)
+}
+
+// gap estimates the messages of the publisher of m that expired before m was delivered, those generated before
+// deadline. The missing messages are assumed to be generated evenly between the last message received and m.
+func (t *expiryTracker) gap(m *Message, deadline int64) {
+	if t.last == nil {
+		t.last = make(map[int][2]int64)
+	}
+	id, generatedAt := int64(m.Payload.MessageId), m.Payload.GeneratedAt
+	last, ok := t.last[m.Payload.ClientId]
+	if ok && id <= last[0] {
+		// out of order or a duplicate
+		return
+	}
+	t.last[m.Payload.ClientId] = [2]int64{id, generatedAt}
+	missing := id - last[0] - 1
+	if !ok || missing <= 0 {
+		return
+	}
+	var fraction float64
+	switch {
+	case generatedAt > last[1]:
+		fraction = float64(deadline-last[1]) / float64(generatedAt-last[1])
+	case deadline > generatedAt:
+		fraction = 1
+	}
+	expired := int64(math.Ceil(fraction*float64(id-last[0]))) - 1
+	if expired > missing {
+		expired = missing
+	}
+	if expired <= 0 {
+		return
+	}
+	if t.dropped == nil {
+		t.dropped = make(map[int][][2]int)
+	}
+	t.dropped[m.Payload.ClientId] = append(t.dropped[m.Payload.ClientId], [2]int{int(last[0]) + 1, int(last[0] + expired)})
+}
+
+// droppedMessages counts the messages estimated expired that are still missing in seq at the end of the run
+func (t *expiryTracker) droppedMessages(seq sequenceTracker) int64 {
+	var dropped int64
+	for clientID, ranges := range t.dropped {
+		publisher, ok := seq[clientID]
+		if !ok {
+			continue
+		}
+		for _, r := range ranges {
+			for _, missing := range publisher.missing {
+				if first, last := max(r[0], missing[0]), min(r[1], missing[1]); first <= last {
+					dropped += int64(last - first + 1)
+				}
+			}
+		}
+	}
+
+	return dropped
+}
+
+// results returns the expiry results, or nil if none of the messages had an expiry interval. The messages
+// dropped on expiry are estimated from the gaps in the sequences of the publishers in seq.
+func (t *expiryTracker) results(seq sequenceTracker) *results.ExpiryResults {
+	if len(t.remaining) == 0 {
+		return nil
+	}
+
+	return &results.ExpiryResults{
+		Messages:      int64(len(t.remaining)),
+		Expired:       t.expired,
+		Dropped:       t.droppedMessages(seq),
+		RemainingMin:  stats.StatsMin(t.remaining),
+		RemainingMax:  stats.StatsMax(t.remaining),
+		RemainingMean: stats.StatsMean(t.remaining),
+	}
+}
+
+func calculateExpiryTotals(runs []*results.RunResults) *results.ExpiryResults {
+	var totals *results.ExpiryResults
+	var weightedMean float64
+	for _, res := range runs {
+		e := res.Expiry
+		if e == nil {
+			continue
+		}
+		if totals == nil {
+			totals = &results.ExpiryResults{RemainingMin: e.RemainingMin, RemainingMax: e.RemainingMax}
+		}
+		totals.Messages += e.Messages
+		totals.Expired += e.Expired
+		totals.Dropped += e.Dropped
+		weightedMean += e.RemainingMean * float64(e.Messages)
+		if e.RemainingMin < totals.RemainingMin {
+			totals.RemainingMin = e.RemainingMin
+		}
+		if e.RemainingMax > totals.RemainingMax {
+			totals.RemainingMax = e.RemainingMax
+		}
+	}
+	if totals != nil {
+		totals.RemainingMean = weightedMean / float64(totals.Messages)
+	}
+
+	return totals
+}
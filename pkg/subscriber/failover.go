@@ -0,0 +1,118 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// failoverTracker measures the time between losing the connection and reconnecting to the other broker /
+// receiving messages again, and the messages missed in between based on the publishers' MessageIds.
+// Reconnecting to the same broker is not a failover, the reconnectTracker accounts for it.
+type failoverTracker struct {
+	mu             sync.Mutex
+	broker         int // index of the broker connected to, -1 before the first connect
+	lostAt         int64
+	reconnecting   bool
+	resuming       bool
+	reconnectTimes []float64
+	resumeTimes    []float64
+	missed         missedCounter
+}
+
+func newFailoverTracker() *failoverTracker {
+	return &failoverTracker{broker: -1}
+}
+
+func (t *failoverTracker) connectionLost(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lostAt = at.UnixNano()
+	t.reconnecting = true
+	t.missed.lost()
+}
+
+// connected counts a failover if the client reconnected to another broker than the one it lost
+func (t *failoverTracker) connected(at time.Time, broker int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	previous := t.broker
+	t.broker = broker
+	if !t.reconnecting {
+		return
+	}
+	t.reconnecting = false
+	if broker == previous {
+		t.missed.idsAtLoss = nil
+		return
+	}
+	t.resuming = true
+	t.reconnectTimes = append(t.reconnectTimes, float64(at.UnixNano()-t.lostAt))
+}
+
+func (t *failoverTracker) received(m *Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.resuming {
+		t.resuming = false
+		t.resumeTimes = append(t.resumeTimes, float64(m.ReceivedAt-t.lostAt))
+	}
+	t.missed.received(m)
+}
+
+func (t *failoverTracker) results() *results.FailoverResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := &results.FailoverResults{
+		Failovers:      len(t.reconnectTimes),
+		MissedMessages: t.missed.missed,
+	}
+	if len(t.reconnectTimes) > 0 {
+		res.ReconnectTime = stats.StatsMean(t.reconnectTimes)
+		res.ReconnectTimeMax = stats.StatsMax(t.reconnectTimes)
+	}
+	if len(t.resumeTimes) > 0 {
+		res.ResumeTime = stats.StatsMean(t.resumeTimes)
+		res.ResumeTimeMax = stats.StatsMax(t.resumeTimes)
+	}
+
+	return res
+}
+
+func calculateFailoverTotals(runs []*results.RunResults) *results.FailoverResults {
+	var totals *results.FailoverResults
+	var reconnectTimes, resumeTimes []float64
+	for _, res := range runs {
+		if res.Failover == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.FailoverResults)
+		}
+		totals.Failovers += res.Failover.Failovers
+		totals.MissedMessages += res.Failover.MissedMessages
+		if res.Failover.ReconnectTimeMax > totals.ReconnectTimeMax {
+			totals.ReconnectTimeMax = res.Failover.ReconnectTimeMax
+		}
+		if res.Failover.ResumeTimeMax > totals.ResumeTimeMax {
+			totals.ResumeTimeMax = res.Failover.ResumeTimeMax
+		}
+		if res.Failover.Failovers > 0 {
+			reconnectTimes = append(reconnectTimes, res.Failover.ReconnectTime)
+		}
+		if res.Failover.ResumeTime > 0 {
+			resumeTimes = append(resumeTimes, res.Failover.ResumeTime)
+		}
+	}
+	if len(reconnectTimes) > 0 {
+		totals.ReconnectTime = stats.StatsMean(reconnectTimes)
+	}
+	if len(resumeTimes) > 0 {
+		totals.ResumeTime = stats.StatsMean(resumeTimes)
+	}
+
+	return totals
+}
@@ -0,0 +1,40 @@
+package subscriber
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// exitClientsFailed is the exit code of a run in which clients failed to connect or subscribe
+const exitClientsFailed = 4
+
+// failedClients returns the ids of the clients that failed, in order
+func failedClients(runs []*results.RunResults) []int {
+	var ids []int
+	for _, res := range runs {
+		if res.Failed {
+			ids = append(ids, res.ID)
+		}
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// exitOnFailedClients exits with exitClientsFailed if any client failed, after listing the failed clients
+// and their errors on stderr (stdout holds the results)
+func exitOnFailedClients(jr *results.JSONResults) {
+	if len(jr.Totals.FailedClients) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d clients failed:\n", len(jr.Totals.FailedClients), len(jr.Runs))
+	for _, res := range jr.Runs {
+		if res.Failed {
+			fmt.Fprintf(os.Stderr, "  client %d: %s\n", res.ID, res.Error)
+		}
+	}
+	os.Exit(exitClientsFailed)
+}
@@ -0,0 +1,79 @@
+package subscriber
+
+import (
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// fdHeadroom is the number of file descriptors reserved on top of one per client (stdio, log files, DNS, ...)
+const fdHeadroom = 64
+
+// FDMonitor samples the number of open file descriptors and keeps the peak
+type FDMonitor struct {
+	mu   sync.Mutex
+	peak int
+	stop chan struct{}
+	done chan struct{}
+}
+
+// countOpenFDs returns the number of file descriptors currently open by this process (Linux only)
+func countOpenFDs() (int, error) {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+
+	return len(fds), nil
+}
+
+// startFDMonitor starts sampling open file descriptors, returns nil if they can't be counted on this platform
+func startFDMonitor(interval time.Duration) *FDMonitor {
+	n, err := countOpenFDs()
+	if err != nil {
+		return nil
+	}
+	m := &FDMonitor{
+		peak: n,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.sample()
+			}
+		}
+	}()
+
+	return m
+}
+
+func (m *FDMonitor) sample() {
+	n, err := countOpenFDs()
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	if n > m.peak {
+		m.peak = n
+	}
+	m.mu.Unlock()
+}
+
+// Stop stops sampling and returns the peak number of open file descriptors
+func (m *FDMonitor) Stop() int {
+	close(m.stop)
+	<-m.done
+	m.sample()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.peak
+}
@@ -0,0 +1,24 @@
+package subscriber
+
+import "crypto/tls"
+
+// fipsCipherSuites are the FIPS 140 approved TLS 1.2 cipher suites
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsCurves are the FIPS 140 approved key exchange curves
+var fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// restrictToFIPS limits cfg to FIPS-approved protocol versions, cipher suites and curves.
+// TLS 1.3 is disabled because its cipher suites cannot be configured and include ChaCha20-Poly1305.
+// This only restricts the negotiation, the algorithms are FIPS validated in boringcrypto builds only.
+func restrictToFIPS(cfg *tls.Config) {
+	cfg.MinVersion = tls.VersionTLS12
+	cfg.MaxVersion = tls.VersionTLS12
+	cfg.CipherSuites = fipsCipherSuites
+	cfg.CurvePreferences = fipsCurves
+}
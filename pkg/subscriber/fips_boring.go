@@ -0,0 +1,10 @@
+//go:build boringcrypto
+// +build boringcrypto
+
+package subscriber
+
+// restricts all TLS configuration to FIPS-approved settings, using the BoringCrypto module
+import _ "crypto/tls/fipsonly"
+
+// boringCrypto reports whether the binary is built with GOEXPERIMENT=boringcrypto
+const boringCrypto = true
@@ -0,0 +1,7 @@
+//go:build !boringcrypto
+// +build !boringcrypto
+
+package subscriber
+
+// boringCrypto reports whether the binary is built with GOEXPERIMENT=boringcrypto
+const boringCrypto = false
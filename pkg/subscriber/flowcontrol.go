@@ -0,0 +1,201 @@
+package subscriber
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// flowControlTracker measures how the inflight window of a client throttles the delivery: the messages that
+// waited for a slot and how long, and the latencies of the messages measured while the window was full
+type flowControlTracker struct {
+	window int
+
+	mu        sync.Mutex // the messages are acquired concurrently, outside the lock of the accumulator
+	messages  int64
+	throttled int64
+	waitTotal time.Duration
+	waitMax   time.Duration
+
+	// measured under the lock of the accumulator
+	measuredFull  int64
+	latencyFull   float64
+	measuredOther int64
+	latencyOther  float64
+}
+
+func newFlowControlTracker(window int) *flowControlTracker {
+	return &flowControlTracker{window: window}
+}
+
+// acquired counts a message that took a slot of the window, after waiting for it if throttled
+func (t *flowControlTracker) acquired(throttled bool, wait time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages++
+	if !throttled {
+		return
+	}
+	t.throttled++
+	t.waitTotal += wait
+	if wait > t.waitMax {
+		t.waitMax = wait
+	}
+}
+
+// measured adds the latency of a measured message, full is whether the window was full when it was measured
+func (t *flowControlTracker) measured(latency float64, full bool) {
+	if full {
+		t.measuredFull++
+		t.latencyFull += latency
+	} else {
+		t.measuredOther++
+		t.latencyOther += latency
+	}
+}
+
+func (t *flowControlTracker) results() *results.FlowControlResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := &results.FlowControlResults{
+		Window:        t.window,
+		Messages:      t.messages,
+		Throttled:     t.throttled,
+		WaitMax:       float64(t.waitMax),
+		MeasuredFull:  t.measuredFull,
+		MeasuredOther: t.measuredOther,
+	}
+	if t.messages > 0 {
+		res.ThrottledRatio = float64(t.throttled) / float64(t.messages)
+	}
+	if t.throttled > 0 {
+		res.WaitMean = float64(t.waitTotal) / float64(t.throttled)
+	}
+	if t.measuredFull > 0 {
+		res.LatencyFullMean = t.latencyFull / float64(t.measuredFull)
+	}
+	if t.measuredOther > 0 {
+		res.LatencyOtherMean = t.latencyOther / float64(t.measuredOther)
+	}
+
+	return res
+}
+
+// calculateFlowControlTotals sums the throttling of all clients, weighing the means by their messages
+func calculateFlowControlTotals(runs []*results.RunResults) *results.FlowControlResults {
+	var totals *results.FlowControlResults
+	var waitTotal, latencyFull, latencyOther float64
+	for _, res := range runs {
+		f := res.FlowControl
+		if f == nil {
+			continue
+		}
+		if totals == nil {
+			totals = &results.FlowControlResults{Window: f.Window}
+		}
+		totals.Messages += f.Messages
+		totals.Throttled += f.Throttled
+		totals.WaitMax = math.Max(totals.WaitMax, f.WaitMax)
+		totals.MeasuredFull += f.MeasuredFull
+		totals.MeasuredOther += f.MeasuredOther
+		waitTotal += f.WaitMean * float64(f.Throttled)
+		latencyFull += f.LatencyFullMean * float64(f.MeasuredFull)
+		latencyOther += f.LatencyOtherMean * float64(f.MeasuredOther)
+	}
+	if totals == nil {
+		return nil
+	}
+	if totals.Messages > 0 {
+		totals.ThrottledRatio = float64(totals.Throttled) / float64(totals.Messages)
+	}
+	if totals.Throttled > 0 {
+		totals.WaitMean = waitTotal / float64(totals.Throttled)
+	}
+	if totals.MeasuredFull > 0 {
+		totals.LatencyFullMean = latencyFull / float64(totals.MeasuredFull)
+	}
+	if totals.MeasuredOther > 0 {
+		totals.LatencyOtherMean = latencyOther / float64(totals.MeasuredOther)
+	}
+
+	return totals
+}
+
+// receiveWindow follows the MQTT 5.0 Receive Maximum the client announced: the broker holds back its QoS 1
+// and 2 deliveries while the client has that many unacknowledged. The client cannot see the held back
+// messages, the first message arriving after a full window freed a slot is counted as throttled, with the
+// time since the window filled up as its wait. A nil window tracks nothing.
+type receiveWindow struct {
+	size int
+	flow *flowControlTracker
+
+	mu        sync.Mutex
+	unacked   int
+	fullSince time.Time
+	freed     bool // a slot of the full window was freed, the next message was held back
+}
+
+func newReceiveWindow(size int, flow *flowControlTracker) *receiveWindow {
+	return &receiveWindow{size: size, flow: flow}
+}
+
+// received counts a QoS 1 or 2 message the client has to acknowledge
+func (w *receiveWindow) received() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	throttled := w.freed
+	wait := time.Since(w.fullSince)
+	w.freed = false
+	w.unacked++
+	if w.unacked == w.size {
+		w.fullSince = time.Now()
+	}
+	w.mu.Unlock()
+	if throttled {
+		w.flow.acquired(true, wait)
+	} else {
+		w.flow.acquired(false, 0)
+	}
+}
+
+// acknowledged frees the slot of a message, once the client sent its PUBACK or PUBCOMP
+func (w *receiveWindow) acknowledged() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.unacked == 0 {
+		return
+	}
+	if w.unacked >= w.size {
+		w.freed = true
+	}
+	w.unacked--
+}
+
+// full returns whether the broker has to hold back its deliveries
+func (w *receiveWindow) full() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.unacked >= w.size
+}
+
+// reset empties the window when the connection is lost, the broker sends the unacknowledged messages again
+func (w *receiveWindow) reset() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.unacked = 0
+	w.freed = false
+}
@@ -0,0 +1,57 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+)
+
+// publisherGate is shared by all clients and opens once messages of the expected number of distinct
+// publishers have been observed, messages received before are not measured
+type publisherGate struct {
+	expected int
+	start    time.Time
+	quiet    bool
+
+	mu       sync.Mutex
+	seen     map[int]bool
+	openedAt time.Time
+}
+
+func newPublisherGate(expected int, start time.Time, quiet bool) *publisherGate {
+	return &publisherGate{
+		expected: expected,
+		start:    start,
+		quiet:    quiet,
+		seen:     make(map[int]bool),
+	}
+}
+
+// observe records the publisher of m and returns whether the gate is open
+func (g *publisherGate) observe(m *Message) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.openedAt.IsZero() {
+		return true
+	}
+	g.seen[m.Payload.ClientId] = true
+	if len(g.seen) < g.expected {
+		return false
+	}
+	g.openedAt = time.Now()
+	if !g.quiet {
+		logf(levelInfo, "Observed %d publishers after %v, starting measurements", len(g.seen), g.openedAt.Sub(g.start))
+	}
+
+	return true
+}
+
+// openedAfter returns how long it took until all publishers were observed, in nanoseconds
+func (g *publisherGate) openedAfter() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.openedAt.IsZero() {
+		return 0
+	}
+
+	return float64(g.openedAt.Sub(g.start))
+}
@@ -0,0 +1,144 @@
+package subscriber
+
+import (
+	"strconv"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// subscriptionRefused is the SUBACK return code of a subscription the broker refused, with MQTT 5.0 every reason
+// code from it up is a refusal
+const subscriptionRefused = 0x80
+
+// qosTracker verifies the QoS the broker grants in the SUBACK and delivers the messages with, a broker may
+// grant a lower QoS than subscribed with (e.g. 1 instead of 2) and delivers the messages with at most the
+// granted QoS
+type qosTracker struct {
+	mu      sync.Mutex
+	granted map[string]byte // by topic filter, of the last SUBACK
+
+	delivered  map[int]int64 // updated by the message handler only
+	mismatches int64
+}
+
+// suback records the QoS granted in the SUBACK of token and logs downgrades, it returns whether the broker
+// refused all subscriptions
+func (t *qosTracker) suback(c *Client, token mqtt.Token) bool {
+	// a paho SubscribeToken or the token of the native client
+	subscribeToken, ok := token.(interface{ Result() map[string]byte })
+	if !ok {
+		return false
+	}
+	refused := 0
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.granted == nil {
+		t.granted = make(map[string]byte)
+	}
+	for _, s := range c.subscriptions() {
+		granted, ok := subscribeToken.Result()[s.Topic]
+		if !ok {
+			continue
+		}
+		code := granted
+		if granted >= subscriptionRefused {
+			granted = subscriptionRefused
+			refused++
+		}
+		// logged once, not on every reconnect
+		if previous, seen := t.granted[s.Topic]; !seen || previous != granted {
+			switch {
+			case granted == subscriptionRefused:
+				c.logf(levelWarn, "subscription to %v was refused by the broker: %v", s.Topic, reasonCodeText(code))
+			case granted < s.QoS:
+				c.logf(levelWarn, "was granted QoS %d instead of %d for %v", granted, s.QoS, s.Topic)
+			}
+		}
+		t.granted[s.Topic] = granted
+	}
+
+	return refused > 0 && refused == len(subscribeToken.Result())
+}
+
+// received counts the QoS m was delivered with, requested is the QoS of the subscription it matched
+func (t *qosTracker) received(m *Message, requested byte) {
+	if t.delivered == nil {
+		t.delivered = make(map[int]int64)
+	}
+	t.delivered[int(m.QoS)]++
+	if m.QoS != requested {
+		t.mismatches++
+	}
+}
+
+// results sets the granted and delivered QoS of res and its subscriptions
+func (t *qosTracker) results(c *Client, res *results.RunResults) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if granted, ok := t.granted[c.MsgTopic]; ok {
+		res.GrantedQoS = grantedQoS(granted)
+	}
+	for _, s := range res.Subscriptions {
+		if granted, ok := t.granted[s.Topic]; ok {
+			s.GrantedQoS = grantedQoS(granted)
+		}
+	}
+	res.DeliveredQoS = t.delivered
+	res.QoSMismatches = t.mismatches
+}
+
+func grantedQoS(granted byte) *int {
+	qos := int(granted)
+
+	return &qos
+}
+
+// formatGrantedQoS returns the granted QoS for the text report
+func formatGrantedQoS(granted int) string {
+	if granted == subscriptionRefused {
+		return "refused"
+	}
+
+	return strconv.Itoa(granted)
+}
+
+// requestedQoS returns the QoS of the subscription of the client m was received through, the first matching
+// one like subscriptionCounter
+func (c *Client) requestedQoS(m *Message) byte {
+	for _, s := range c.MoreTopics {
+		if !topicMatches(c.MsgTopic, m.Topic) && topicMatches(s.Topic, m.Topic) {
+			return s.QoS
+		}
+	}
+
+	return c.MsgQoS
+}
+
+// downgraded reports whether the broker granted a lower QoS than requested or refused the subscription
+func downgraded(granted *int, requested byte) bool {
+	return granted != nil && (*granted < int(requested) || *granted == subscriptionRefused)
+}
+
+// calculateQoSTotals sums the deliveries per QoS and counts the clients granted a lower QoS than requested
+// for any of their subscriptions
+func calculateQoSTotals(totals *results.TotalResults, runs []*results.RunResults) {
+	for _, res := range runs {
+		for qos, count := range res.DeliveredQoS {
+			if totals.DeliveredQoS == nil {
+				totals.DeliveredQoS = make(map[int]int64)
+			}
+			totals.DeliveredQoS[qos] += count
+		}
+		totals.QoSMismatches += res.QoSMismatches
+		isDowngraded := downgraded(res.GrantedQoS, res.QoS)
+		for _, s := range res.Subscriptions {
+			isDowngraded = isDowngraded || downgraded(s.GrantedQoS, s.QoS)
+		}
+		if isDowngraded {
+			totals.QoSDowngrades++
+		}
+	}
+}
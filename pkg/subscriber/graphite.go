@@ -0,0 +1,83 @@
+package subscriber
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// defaultGraphitePrefix is the root of the metric paths without a prefix in the -output URL
+const defaultGraphitePrefix = "mqtt_benchmark"
+
+// graphiteUnsafe matches the characters that are not allowed in a node of a Graphite metric path
+var graphiteUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// GraphiteExporter sends the totals and the per-client results, and optionally the latency series, to
+// Graphite (carbon) in the plaintext protocol. The metric paths are <prefix>[.<run id>].totals.<field> and
+// <prefix>[.<run id>].clients.<id>.<field>, the series under series.<field> of either.
+type GraphiteExporter struct {
+	Address string
+	Prefix  string
+	Series  bool
+}
+
+// Export sends the results of the run started at start, the series points at their time in the run
+func (e *GraphiteExporter) Export(jr *results.JSONResults, start time.Time) error {
+	conn, err := net.DialTimeout("tcp", e.Address, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		return err
+	}
+
+	root := e.Prefix
+	if jr.RunID != "" {
+		root += "." + graphiteUnsafe.ReplaceAllString(jr.RunID, "_")
+	}
+	w := bufio.NewWriter(conn)
+	send := func(path string, timestamp time.Time, v interface{}, omit ...string) error {
+		fields, err := numericFields(v, omit...)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedNames(fields) {
+			value := strconv.FormatFloat(fields[name], 'f', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s.%s %s %d\n", path, name, value, timestamp.Unix()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := send(root+".totals", start, jr.Totals); err != nil {
+		return err
+	}
+	for _, res := range jr.Runs {
+		if err := send(fmt.Sprintf("%s.clients.%d", root, res.ID), start, res, "id"); err != nil {
+			return err
+		}
+	}
+	if e.Series {
+		for _, sample := range jr.Totals.LatencySeries {
+			if err := send(root+".totals.series", sampleTime(start, sample), sample, "elapsed"); err != nil {
+				return err
+			}
+		}
+		for _, res := range jr.Runs {
+			for _, sample := range res.LatencySeries {
+				if err := send(fmt.Sprintf("%s.clients.%d.series", root, res.ID), sampleTime(start, sample), sample, "elapsed"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,144 @@
+package subscriber
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// clientGroup is a named group of consecutive clients, with IDs in [From, To], that subscribe with their own
+// topic, QoS, message count and session instead of -topic, -qos, -count and a clean session
+type clientGroup struct {
+	Name         string
+	From         int
+	To           int
+	Topic        *topicTemplate // nil for -topic
+	QoS          int            // -1 for -qos
+	Count        int64          // -1 for -count
+	CleanSession *bool          // nil for the default
+}
+
+// groupFlags collects repeated -group flags, each the settings of a group as comma separated key=value pairs
+type groupFlags []map[string]string
+
+func (g *groupFlags) String() string {
+	groups := make([]string, len(*g))
+	for i, setting := range *g {
+		groups[i] = setting["name"]
+	}
+
+	return strings.Join(groups, ",")
+}
+
+// Set implements flag.Value, the settings are validated by parseClientGroups
+func (g *groupFlags) Set(value string) error {
+	setting := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("invalid group %q, expected name=<name>,clients=<n>[,topic=..][,qos=..][,count=..][,clean-session=..]", value)
+		}
+		setting[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	*g = append(*g, setting)
+
+	return nil
+}
+
+// parseClientGroups parses the settings of the groups by name: name and clients are required, topic, qos,
+// count and clean-session are optional. The clients are numbered over the groups in order.
+func parseClientGroups(settings []map[string]string) ([]clientGroup, error) {
+	var groups []clientGroup
+	from := 0
+	for i, setting := range settings {
+		g := clientGroup{Name: setting["name"], QoS: -1, Count: -1}
+		if g.Name == "" {
+			return nil, fmt.Errorf("group %d has no name", i+1)
+		}
+		for _, other := range groups {
+			if other.Name == g.Name {
+				return nil, fmt.Errorf("group %v is defined twice", g.Name)
+			}
+		}
+		clients, err := strconv.Atoi(setting["clients"])
+		if err != nil || clients < 1 {
+			return nil, fmt.Errorf("group %v should have clients > 0, given: %q", g.Name, setting["clients"])
+		}
+		g.From, g.To = from, from+clients-1
+		from += clients
+		for name, value := range setting {
+			switch name {
+			case "name", "clients":
+			case "topic":
+				if g.Topic, err = parseTopicTemplate(value); err != nil {
+					return nil, fmt.Errorf("group %v: %v", g.Name, err)
+				}
+			case "qos":
+				if g.QoS, err = strconv.Atoi(value); err != nil || g.QoS < 0 || g.QoS > 2 {
+					return nil, fmt.Errorf("group %v should have qos 0, 1 or 2, given: %q", g.Name, value)
+				}
+			case "count":
+				if g.Count, err = strconv.ParseInt(value, 10, 64); err != nil || g.Count < 1 {
+					return nil, fmt.Errorf("group %v should have count > 0, given: %q", g.Name, value)
+				}
+			case "clean-session":
+				clean, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("group %v should have clean-session true or false, given: %q", g.Name, value)
+				}
+				g.CleanSession = &clean
+			default:
+				return nil, fmt.Errorf("group %v has unknown setting %v, expected name, clients, topic, qos, count or clean-session", g.Name, name)
+			}
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
+
+// groupFor returns the group client id belongs to, or nil if there are no groups
+func groupFor(groups []clientGroup, id int) *clientGroup {
+	for i := range groups {
+		if id >= groups[i].From && id <= groups[i].To {
+			return &groups[i]
+		}
+	}
+
+	return nil
+}
+
+// groupClients returns the number of clients of all groups
+func groupClients(groups []clientGroup) int {
+	if len(groups) == 0 {
+		return 0
+	}
+
+	return groups[len(groups)-1].To + 1
+}
+
+// calculateGroupResults aggregates the results per group, in the order of the groups
+func calculateGroupResults(groups []clientGroup, runs []*results.RunResults, totalTime time.Duration) []*results.GroupResults {
+	perGroup := make(map[string][]*results.RunResults)
+	for _, res := range runs {
+		perGroup[res.Group] = append(perGroup[res.Group], res)
+	}
+
+	groupResults := make([]*results.GroupResults, 0, len(groups))
+	for _, g := range groups {
+		runs := perGroup[g.Name]
+		if len(runs) == 0 {
+			continue
+		}
+		groupResults = append(groupResults, &results.GroupResults{
+			Group:        g.Name,
+			Clients:      len(runs),
+			TotalResults: calculateTotalResults(runs, totalTime, len(runs)),
+		})
+	}
+
+	return groupResults
+}
@@ -0,0 +1,234 @@
+package subscriber
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// histogramBits is the number of significant bits of the latencies the histogram distinguishes, the
+// buckets are at most 1/512 (0.2%) of their latencies wide
+const histogramBits = 10
+
+// histogramBucket returns the lowest and highest latency in nanoseconds of the bucket of latency v. Below
+// 2^histogramBits nanoseconds every nanosecond has its own bucket, above it the buckets double in width
+// with every power of two (like an HDR histogram), negative latencies of unsynchronized clocks mirror them.
+func histogramBucket(v int64) (int64, int64) {
+	if v < 0 {
+		low, high := histogramBucket(-v)
+		return -high, -low
+	}
+	if v < 1<<histogramBits {
+		return v, v
+	}
+	shift := uint(bits.Len64(uint64(v)) - histogramBits)
+	low := v >> shift << shift
+
+	return low, low + 1<<shift - 1
+}
+
+// latencyStats are the streaming statistics of latencies in nanoseconds: the mean and variance (Welford's
+// online algorithm), the extremes and a histogram for the percentiles, in memory independent of the count
+type latencyStats struct {
+	count     int64
+	mean      float64
+	m2        float64
+	min       float64
+	max       float64
+	histogram map[int64]int64 // counts by the lowest latency of the bucket
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{histogram: make(map[int64]int64)}
+}
+
+// add adds a latency in nanoseconds
+func (s *latencyStats) add(latency float64) {
+	s.count++
+	if s.count == 1 || latency < s.min {
+		s.min = latency
+	}
+	if s.count == 1 || latency > s.max {
+		s.max = latency
+	}
+	delta := latency - s.mean
+	s.mean += delta / float64(s.count)
+	s.m2 += delta * (latency - s.mean)
+	low, _ := histogramBucket(int64(math.Round(latency)))
+	s.histogram[low]++
+}
+
+// std returns the sample standard deviation, 0 for fewer than two latencies (convention)
+func (s *latencyStats) std() float64 {
+	if s.count < 2 {
+		return 0
+	}
+
+	return math.Sqrt(s.m2 / float64(s.count-1))
+}
+
+// histogramQuantile returns the q-th quantile (0 <= q <= 1) of the latencies counted in histogram using the
+// nearest-rank method, as the highest latency of the bucket it falls in
+func histogramQuantile(histogram map[int64]int64, q float64) float64 {
+	lows, total := histogramLows(histogram)
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for _, low := range lows {
+		seen += histogram[low]
+		if seen >= rank {
+			_, high := histogramBucket(low)
+			return float64(high)
+		}
+	}
+	_, high := histogramBucket(lows[len(lows)-1])
+
+	return float64(high)
+}
+
+// histogramLows returns the buckets of histogram in order and the number of latencies counted
+func histogramLows(histogram map[int64]int64) ([]int64, int64) {
+	lows := make([]int64, 0, len(histogram))
+	var total int64
+	for low, count := range histogram {
+		lows = append(lows, low)
+		total += count
+	}
+	sort.Slice(lows, func(i, j int) bool {
+		return lows[i] < lows[j]
+	})
+
+	return lows, total
+}
+
+// histogramPercentiles returns the given percentiles of the latencies counted in histogram
+func histogramPercentiles(histogram map[int64]int64, percentiles []float64) []*results.Percentile {
+	if len(histogram) == 0 || len(percentiles) == 0 {
+		return nil
+	}
+	res := make([]*results.Percentile, len(percentiles))
+	for i, p := range percentiles {
+		res[i] = &results.Percentile{Percentile: p, Latency: histogramQuantile(histogram, p/100)}
+	}
+
+	return res
+}
+
+// pooledHistogram returns the merged latency histograms of all clients
+func pooledHistogram(runs []*results.RunResults) map[int64]int64 {
+	histogram := make(map[int64]int64)
+	for _, res := range runs {
+		for low, count := range res.Histogram {
+			histogram[low] += count
+		}
+	}
+
+	return histogram
+}
+
+// rawLatencies reports whether all latencies of every client were kept, the percentiles are then exact
+func rawLatencies(runs []*results.RunResults) bool {
+	for _, res := range runs {
+		if int64(len(res.Latencies)) != res.Successes {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pooledPercentiles returns the percentiles of the latencies of all clients, exact if the latencies were
+// kept and from the histograms otherwise
+func pooledPercentiles(runs []*results.RunResults, percentiles []float64) []*results.Percentile {
+	if rawLatencies(runs) {
+		return latencyPercentiles(pooledLatencies(runs), percentiles)
+	}
+
+	return histogramPercentiles(pooledHistogram(runs), percentiles)
+}
+
+// pooledQuantile returns the q-th quantile of the latencies of all clients like pooledPercentiles
+func pooledQuantile(runs []*results.RunResults, q float64) float64 {
+	if rawLatencies(runs) {
+		return quantile(sortedCopy(pooledLatencies(runs)), q)
+	}
+
+	return histogramQuantile(pooledHistogram(runs), q)
+}
+
+// parseHistogramBuckets parses the comma separated, increasing upper bounds of -hist-buckets, e.g.
+// "1ms,5ms,10ms", into nanoseconds
+func parseHistogramBuckets(s string) ([]float64, error) {
+	var bounds []float64
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		bound, err := time.ParseDuration(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid histogram bucket %q, expected a duration such as 5ms", entry)
+		}
+		if len(bounds) > 0 && float64(bound) <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("histogram buckets should be increasing, given %v after %v", bound, time.Duration(bounds[len(bounds)-1]))
+		}
+		bounds = append(bounds, float64(bound))
+	}
+
+	return bounds, nil
+}
+
+// histogramBuckets counts the latencies of histogram in the buckets with the upper bounds in nanoseconds,
+// by the highest latency of their histogram bucket like the percentiles. It returns nil without bounds.
+func histogramBuckets(histogram map[int64]int64, bounds []float64) *results.LatencyHistogram {
+	if len(bounds) == 0 {
+		return nil
+	}
+	res := &results.LatencyHistogram{Buckets: make([]*results.HistogramBucket, len(bounds))}
+	for i, bound := range bounds {
+		res.Buckets[i] = &results.HistogramBucket{Le: bound}
+	}
+	for low, count := range histogram {
+		_, high := histogramBucket(low)
+		i := sort.SearchFloat64s(bounds, float64(high))
+		if i == len(bounds) {
+			res.Overflow += count
+		} else {
+			res.Buckets[i].Count += count
+		}
+	}
+
+	return res
+}
+
+// pooledHistogramBuckets sums the latency histograms of all clients, which have the same buckets
+func pooledHistogramBuckets(runs []*results.RunResults) *results.LatencyHistogram {
+	var pooled *results.LatencyHistogram
+	for _, res := range runs {
+		if res.LatencyHistogram == nil {
+			continue
+		}
+		if pooled == nil {
+			pooled = &results.LatencyHistogram{Buckets: make([]*results.HistogramBucket, len(res.LatencyHistogram.Buckets))}
+			for i, bucket := range res.LatencyHistogram.Buckets {
+				pooled.Buckets[i] = &results.HistogramBucket{Le: bucket.Le}
+			}
+		}
+		for i, bucket := range res.LatencyHistogram.Buckets {
+			pooled.Buckets[i].Count += bucket.Count
+		}
+		pooled.Overflow += res.LatencyHistogram.Overflow
+	}
+
+	return pooled
+}
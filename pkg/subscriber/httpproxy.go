@@ -0,0 +1,112 @@
+package subscriber
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// httpProxy tunnels connections through an HTTP proxy with the CONNECT method, golang.org/x/net/proxy only
+// implements SOCKS5
+type httpProxy struct {
+	address string // host:port of the proxy
+	tls     bool   // https proxy
+	auth    string // Proxy-Authorization header, empty without credentials
+	forward proxy.Dialer
+	timeout time.Duration
+}
+
+// newHTTPProxy creates the dialer of an http:// or https:// proxy URL, it implements proxy.DialerType
+func newHTTPProxy(u *url.URL, forward proxy.Dialer, timeout time.Duration) (proxy.Dialer, error) {
+	p := &httpProxy{address: u.Host, tls: u.Scheme == "https", forward: forward, timeout: timeout}
+	if u.Port() == "" {
+		port := "80"
+		if p.tls {
+			port = "443"
+		}
+		p.address = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := u.User.Username() + ":" + password
+		p.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	return p, nil
+}
+
+// Dial connects to the proxy and asks it to open a tunnel to addr
+func (p *httpProxy) Dial(network, addr string) (net.Conn, error) {
+	conn, err := p.forward.Dial(network, p.address)
+	if err != nil {
+		return nil, err
+	}
+	tunnel, err := p.connect(conn, addr)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %v: %v", p.address, err)
+	}
+
+	return tunnel, nil
+}
+
+func (p *httpProxy) connect(conn net.Conn, addr string) (net.Conn, error) {
+	if p.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(p.timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	proxyConn := conn
+	if p.tls {
+		host, _, _ := net.SplitHostPort(p.address)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		proxyConn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if p.auth != "" {
+		req.Header.Set("Proxy-Authorization", p.auth)
+	}
+	if err := req.Write(proxyConn); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(proxyConn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT %v failed with %v", addr, resp.Status)
+	}
+	// the broker doesn't send before the client, but anything read ahead must not be lost
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: proxyConn, reader: reader}, nil
+	}
+
+	return proxyConn, nil
+}
+
+// bufferedConn is a connection of which the first bytes were already read into reader
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,134 @@
+package subscriber
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// InfluxDB measurements the results are written to
+const (
+	influxTotals  = "mqtt_subscriber_totals"
+	influxClients = "mqtt_subscriber_client"
+	influxSeries  = "mqtt_subscriber_series"
+)
+
+// influxEscaper escapes tag keys and values of the InfluxDB line protocol
+var influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+// InfluxDBExporter writes the totals and the per-client results, and optionally the latency series, to an
+// InfluxDB 1.x database in the line protocol. The run id and the labels are tags of every point.
+type InfluxDBExporter struct {
+	URL      string
+	Database string
+	Username string
+	Password string
+	Series   bool
+
+	client http.Client
+}
+
+// Export writes the results of the run started at start, the series points at their time in the run
+func (e *InfluxDBExporter) Export(jr *results.JSONResults, start time.Time) error {
+	e.client.Timeout = 30 * time.Second
+	tags := make(map[string]string, len(jr.Labels)+1)
+	for key, value := range jr.Labels {
+		tags[key] = value
+	}
+	if jr.RunID != "" {
+		tags["run_id"] = jr.RunID
+	}
+
+	var body bytes.Buffer
+	add := func(measurement string, extra map[string]string, timestamp time.Time, v interface{}, omit ...string) error {
+		fields, err := numericFields(v, omit...)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		body.WriteString(measurement)
+		pointTags := make(labelFlags, len(tags)+len(extra))
+		for key, value := range tags {
+			pointTags[key] = value
+		}
+		for key, value := range extra {
+			pointTags[key] = value
+		}
+		// tags sorted by key, as recommended for performance
+		for _, key := range pointTags.keys() {
+			if pointTags[key] != "" {
+				fmt.Fprintf(&body, ",%s=%s", influxEscaper.Replace(key), influxEscaper.Replace(pointTags[key]))
+			}
+		}
+		for i, name := range sortedNames(fields) {
+			separator := ","
+			if i == 0 {
+				separator = " "
+			}
+			fmt.Fprintf(&body, "%s%s=%s", separator, influxEscaper.Replace(name), strconv.FormatFloat(fields[name], 'g', -1, 64))
+		}
+		fmt.Fprintf(&body, " %d\n", timestamp.UnixNano())
+		return nil
+	}
+
+	if err := add(influxTotals, nil, start, jr.Totals); err != nil {
+		return err
+	}
+	for _, res := range jr.Runs {
+		clientTags := map[string]string{"client": strconv.Itoa(res.ID), "broker": res.Broker, "tenant": res.Tenant}
+		if err := add(influxClients, clientTags, start, res, "id"); err != nil {
+			return err
+		}
+	}
+	if e.Series {
+		for _, sample := range jr.Totals.LatencySeries {
+			if err := add(influxSeries, nil, sampleTime(start, sample), sample, "elapsed"); err != nil {
+				return err
+			}
+		}
+		for _, res := range jr.Runs {
+			for _, sample := range res.LatencySeries {
+				err := add(influxSeries, map[string]string{"client": strconv.Itoa(res.ID)}, sampleTime(start, sample), sample, "elapsed")
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return e.write(body.Bytes())
+}
+
+// sampleTime returns the time of a sample of the latency series of the run started at start
+func sampleTime(start time.Time, sample *results.LatencySample) time.Time {
+	return start.Add(time.Duration(sample.Elapsed * float64(time.Second)))
+}
+
+// write posts the lines to the database
+func (e *InfluxDBExporter) write(lines []byte) error {
+	query := url.Values{"db": {e.Database}, "precision": {"ns"}}
+	if e.Username != "" {
+		query.Set("u", e.Username)
+		query.Set("p", e.Password)
+	}
+	resp, err := e.client.Post(strings.TrimRight(e.URL, "/")+"/write?"+query.Encode(), "text/plain; charset=utf-8", bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("InfluxDB returned %v: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
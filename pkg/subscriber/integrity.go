@@ -0,0 +1,44 @@
+package subscriber
+
+import (
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strconv"
+)
+
+// checksumField finds the value of the Checksum field of a JSON payload
+var checksumField = regexp.MustCompile(`"Checksum"\s*:\s*"([0-9A-Fa-f]*)"`)
+
+// verifyPayload checks the integrity of a received payload, to catch payloads truncated or altered on the way
+// (e.g. by bridges): its length against expectedSize if > 0 and against the Size the publisher declared, and
+// its Checksum. The Checksum is the CRC-32 (IEEE) in hex of the JSON payload as published with an empty
+// Checksum, so the publisher fills it in after marshalling. It returns nil if the payload is intact.
+func verifyPayload(data []byte, payload *Payload, expectedSize int) error {
+	if expectedSize > 0 && len(data) != expectedSize {
+		return fmt.Errorf("payload of %d bytes, expected %d", len(data), expectedSize)
+	}
+	if payload.Size > 0 && int64(len(data)) != payload.Size {
+		return fmt.Errorf("payload of %d bytes, the publisher sent %d", len(data), payload.Size)
+	}
+	if payload.Checksum == "" {
+		return nil
+	}
+
+	want, err := strconv.ParseUint(payload.Checksum, 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid checksum %q", payload.Checksum)
+	}
+	match := checksumField.FindSubmatchIndex(data)
+	if match == nil {
+		return fmt.Errorf("checksum %v not found in the payload", payload.Checksum)
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(data[:match[2]])
+	crc.Write(data[match[3]:])
+	if got := crc.Sum32(); got != uint32(want) {
+		return fmt.Errorf("checksum %08x, the publisher sent %v", got, payload.Checksum)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package subscriber
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// interArrivals returns the times between consecutive messages of every client, in nanoseconds
+func interArrivals(runs []*results.RunResults) []float64 {
+	var gaps []float64
+	for _, res := range runs {
+		for i := 1; i < len(res.ReceivedAt); i++ {
+			// the wall clock may step back, such gaps are left out
+			if gap := res.ReceivedAt[i] - res.ReceivedAt[i-1]; gap >= 0 {
+				gaps = append(gaps, float64(gap))
+			}
+		}
+	}
+
+	return gaps
+}
+
+// fitInterArrivals fits the inter-arrival times of all clients to an exponential distribution (Poisson
+// arrivals) and a lognormal distribution (bursty arrivals) by maximum likelihood, the goodness of fit is
+// the Kolmogorov-Smirnov statistic. It returns nil with less than two inter-arrival times.
+func fitInterArrivals(runs []*results.RunResults) *results.InterArrivalResults {
+	gaps := sortedCopy(interArrivals(runs))
+	if len(gaps) < 2 {
+		return nil
+	}
+
+	mean := stats.StatsMean(gaps)
+	res := &results.InterArrivalResults{
+		Samples: len(gaps),
+		Mean:    mean,
+		Std:     stats.StatsSampleStandardDeviation(gaps),
+	}
+	if mean > 0 {
+		res.CV = res.Std / mean
+		rate := 1 / mean
+		res.Exponential = &results.ExponentialFit{
+			Rate: rate * float64(time.Second),
+			KS: ksStatistic(gaps, func(x float64) float64 {
+				return 1 - math.Exp(-rate*x)
+			}),
+		}
+	}
+
+	// the lognormal distribution is only defined for positive times
+	positive := gaps[sort.SearchFloat64s(gaps, math.SmallestNonzeroFloat64):]
+	if len(positive) > 1 {
+		logs := make([]float64, len(positive))
+		for i, gap := range positive {
+			logs[i] = math.Log(gap)
+		}
+		mu, sigma := stats.StatsMean(logs), stats.StatsSampleStandardDeviation(logs)
+		if sigma > 0 {
+			res.Lognormal = &results.LognormalFit{
+				Mu:    mu,
+				Sigma: sigma,
+				KS: ksStatistic(positive, func(x float64) float64 {
+					return 0.5 * math.Erfc(-(math.Log(x)-mu)/(sigma*math.Sqrt2))
+				}),
+			}
+		}
+	}
+
+	switch {
+	case res.Exponential != nil && (res.Lognormal == nil || res.Exponential.KS <= res.Lognormal.KS):
+		res.BestFit = "exponential"
+	case res.Lognormal != nil:
+		res.BestFit = "lognormal"
+	}
+
+	return res
+}
+
+// ksStatistic returns the largest distance between the empirical distribution of sorted and the cdf
+func ksStatistic(sorted []float64, cdf func(float64) float64) float64 {
+	n := float64(len(sorted))
+	d := 0.0
+	for i, x := range sorted {
+		f := cdf(x)
+		d = math.Max(d, math.Max(float64(i+1)/n-f, f-float64(i)/n))
+	}
+
+	return d
+}
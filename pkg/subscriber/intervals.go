@@ -0,0 +1,200 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// intervalWindow collects the latencies a client received during the current reporting interval
+type intervalWindow struct {
+	mu        sync.Mutex
+	received  int64
+	latencies []float64
+}
+
+// IntervalStats describes the messages received up to and during a single reporting interval,
+// latencies in nanoseconds
+type IntervalStats struct {
+	Received       int64   `json:"received"`
+	WindowReceived int64   `json:"window_received"`
+	MsgsPerSec     float64 `json:"msgs_per_sec"`
+	LatencyP50     float64 `json:"latency_p50"`
+	LatencyP95     float64 `json:"latency_p95"`
+	LatencyP99     float64 `json:"latency_p99"`
+}
+
+// ClientIntervalStats are the IntervalStats of a single client
+type ClientIntervalStats struct {
+	ID int `json:"id"`
+	IntervalStats
+}
+
+// IntervalReport is written for every reporting interval, elapsed in seconds since the start of the run
+type IntervalReport struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Elapsed   float64                `json:"elapsed"`
+	Clients   []*ClientIntervalStats `json:"clients"`
+	Totals    *IntervalStats         `json:"totals"`
+}
+
+// IntervalReporter reports the IntervalStats of all clients at a fixed interval to Output and Stream (if set),
+// logs the aggregate stats of every interval if Log is set, calls OnReport (if set) with every report, and
+// keeps the stats of every interval as a time series per client and over all clients
+type IntervalReporter struct {
+	Clients  []*Client
+	Interval time.Duration
+	Output   io.Writer
+	Stream   *ResultStream
+	Log      bool
+	OnReport func(report *IntervalReport)
+
+	last         time.Time
+	series       []*results.LatencySample
+	clientSeries [][]*results.LatencySample
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+func newIntervalWindow() *intervalWindow {
+	return new(intervalWindow)
+}
+
+func (w *intervalWindow) add(latency float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.received++
+	w.latencies = append(w.latencies, latency)
+}
+
+// flush returns the total number of received messages and the latencies of the current window, and starts a new window
+func (w *intervalWindow) flush() (int64, []float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	latencies := w.latencies
+	w.latencies = nil
+
+	return w.received, latencies
+}
+
+func calculateIntervalStats(received int64, latencies []float64, window time.Duration) IntervalStats {
+	sorted := sortedCopy(latencies)
+	res := IntervalStats{
+		Received:       received,
+		WindowReceived: int64(len(latencies)),
+		LatencyP50:     quantile(sorted, 0.50),
+		LatencyP95:     quantile(sorted, 0.95),
+		LatencyP99:     quantile(sorted, 0.99),
+	}
+	if window > 0 {
+		res.MsgsPerSec = float64(len(latencies)) / window.Seconds()
+	}
+
+	return res
+}
+
+// Start starts reporting, elapsed times are relative to start. Clients that are not collecting
+// interval statistics yet start doing so, which requires them not to be running.
+func (r *IntervalReporter) Start(start time.Time) {
+	for _, c := range r.Clients {
+		if c.window == nil {
+			c.window = newIntervalWindow()
+		}
+	}
+	r.last = start
+	r.clientSeries = make([][]*results.LatencySample, len(r.Clients))
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				r.report(start)
+				return
+			case <-ticker.C:
+				r.report(start)
+			}
+		}
+	}()
+}
+
+// Stop reports the last (partial) interval, stops reporting and returns the time series over all clients
+func (r *IntervalReporter) Stop() []*results.LatencySample {
+	close(r.stop)
+	<-r.done
+
+	return r.series
+}
+
+// ClientSeries returns the time series of the i-th client of Clients, once stopped
+func (r *IntervalReporter) ClientSeries(i int) []*results.LatencySample {
+	return r.clientSeries[i]
+}
+
+// latencySample returns the sample in a time series of the stats of an interval
+func latencySample(elapsed float64, stats IntervalStats) *results.LatencySample {
+	return &results.LatencySample{
+		Elapsed:    elapsed,
+		Received:   stats.WindowReceived,
+		MsgsPerSec: stats.MsgsPerSec,
+		P50:        stats.LatencyP50,
+		P95:        stats.LatencyP95,
+		P99:        stats.LatencyP99,
+	}
+}
+
+func (r *IntervalReporter) report(start time.Time) {
+	now := time.Now()
+	window := now.Sub(r.last)
+	r.last = now
+
+	report := &IntervalReport{
+		Timestamp: now,
+		Elapsed:   now.Sub(start).Seconds(),
+		Clients:   make([]*ClientIntervalStats, len(r.Clients)),
+	}
+	var total int64
+	var allLatencies []float64
+	for i, c := range r.Clients {
+		received, latencies := c.window.flush()
+		report.Clients[i] = &ClientIntervalStats{
+			ID:            c.ID,
+			IntervalStats: calculateIntervalStats(received, latencies, window),
+		}
+		r.clientSeries[i] = append(r.clientSeries[i], latencySample(report.Elapsed, report.Clients[i].IntervalStats))
+		total += received
+		allLatencies = append(allLatencies, latencies...)
+	}
+	totals := calculateIntervalStats(total, allLatencies, window)
+	report.Totals = &totals
+	r.series = append(r.series, latencySample(report.Elapsed, totals))
+	if r.Log {
+		logf(levelInfo, "INTERVAL %.3fs: %d messages (%.3f msg/sec), latency p50 %.3f ms, p95 %.3f ms, p99 %.3f ms",
+			report.Elapsed, totals.WindowReceived, totals.MsgsPerSec,
+			totals.LatencyP50/1_000_000, totals.LatencyP95/1_000_000, totals.LatencyP99/1_000_000)
+	}
+	if r.Stream != nil {
+		r.Stream.publish(&StreamEvent{Interval: report})
+	}
+	if r.OnReport != nil {
+		r.OnReport(report)
+	}
+	if r.Output == nil {
+		return
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		logf(levelError, "Error marshalling interval stats: %v", err)
+		return
+	}
+	if _, err := r.Output.Write(append(data, '\n')); err != nil {
+		logf(levelError, "Error writing interval stats: %v", err)
+	}
+}
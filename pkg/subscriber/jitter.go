@@ -0,0 +1,114 @@
+package subscriber
+
+import (
+	"math"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// jitterTracker measures the smoothness of the delivery to a client: the times between consecutive measured
+// messages and the differences between their latencies, as streaming statistics like the latencies
+type jitterTracker struct {
+	previousAt      int64 // unix nanoseconds, 0 before the first message
+	previousLatency float64
+	gaps            *latencyStats
+	deltas          *latencyStats
+}
+
+func newJitterTracker() *jitterTracker {
+	return &jitterTracker{gaps: newLatencyStats(), deltas: newLatencyStats()}
+}
+
+func (t *jitterTracker) received(m *Message, latency float64) {
+	// the wall clock may step back, such pairs are left out
+	if gap := m.ReceivedAt - t.previousAt; t.previousAt > 0 && gap >= 0 {
+		t.gaps.add(float64(gap))
+		t.deltas.add(latency - t.previousLatency)
+	}
+	t.previousAt = m.ReceivedAt
+	t.previousLatency = latency
+}
+
+// results returns nil if fewer than two messages were measured
+func (t *jitterTracker) results() *results.JitterResults {
+	if t.gaps.count == 0 {
+		return nil
+	}
+
+	return &results.JitterResults{
+		Samples:               t.gaps.count,
+		InterArrivalMin:       t.gaps.min,
+		InterArrivalMax:       t.gaps.max,
+		InterArrivalMean:      t.gaps.mean,
+		InterArrivalStd:       t.gaps.std(),
+		InterArrivalP99:       histogramQuantile(t.gaps.histogram, 0.99),
+		LatencyDeltaMean:      t.deltas.mean,
+		Jitter:                t.deltas.std(),
+		InterArrivalHistogram: t.gaps.histogram,
+	}
+}
+
+// moments pools the count, mean and sum of squared deviations of the samples of several clients
+type moments struct {
+	count float64
+	mean  float64
+	m2    float64
+}
+
+// merge adds the samples of a client given their count, mean and sample standard deviation
+func (m *moments) merge(count int64, mean, std float64) {
+	n := float64(count)
+	total := m.count + n
+	delta := mean - m.mean
+	m.m2 += std*std*(n-1) + delta*delta*m.count*n/total
+	m.mean += delta * n / total
+	m.count = total
+}
+
+// std returns the sample standard deviation, 0 for fewer than two samples (convention)
+func (m *moments) std() float64 {
+	if m.count < 2 {
+		return 0
+	}
+
+	return math.Sqrt(m.m2 / (m.count - 1))
+}
+
+// calculateJitterTotals pools the inter-arrival times and latency differences of all clients, the pairs of
+// messages of different clients are not compared
+func calculateJitterTotals(runs []*results.RunResults) *results.JitterResults {
+	var totals *results.JitterResults
+	var gaps, deltas moments
+	histogram := make(map[int64]int64)
+	for _, res := range runs {
+		j := res.Jitter
+		if j == nil {
+			continue
+		}
+		if totals == nil {
+			totals = &results.JitterResults{InterArrivalMin: j.InterArrivalMin}
+		}
+		totals.Samples += j.Samples
+		totals.InterArrivalMin = math.Min(totals.InterArrivalMin, j.InterArrivalMin)
+		totals.InterArrivalMax = math.Max(totals.InterArrivalMax, j.InterArrivalMax)
+		gaps.merge(j.Samples, j.InterArrivalMean, j.InterArrivalStd)
+		deltas.merge(j.Samples, j.LatencyDeltaMean, j.Jitter)
+		for low, count := range j.InterArrivalHistogram {
+			histogram[low] += count
+		}
+	}
+	if totals == nil {
+		return nil
+	}
+	totals.InterArrivalMean = gaps.mean
+	totals.InterArrivalStd = gaps.std()
+	totals.LatencyDeltaMean = deltas.mean
+	totals.Jitter = deltas.std()
+	totals.InterArrivalHistogram = histogram
+	// the histograms are lost when the results are read back, e.g. by the coordinator
+	if len(histogram) > 0 {
+		totals.InterArrivalP99 = histogramQuantile(histogram, 0.99)
+	}
+
+	return totals
+}
@@ -0,0 +1,172 @@
+package subscriber
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// testCase is an outcome of the run for the test reports of CI pipelines: the run of a client or a threshold
+type testCase struct {
+	name    string
+	class   string
+	time    float64 // seconds
+	failure string  // empty if the case passed
+	output  string
+}
+
+// testCases returns a case per client, failed if the client failed or was truncated, and a case per threshold
+// that was checked, failed with the messages of its failures
+func testCases(jr *results.JSONResults) []*testCase {
+	var cases []*testCase
+	for _, res := range jr.Runs {
+		c := &testCase{
+			name:   fmt.Sprintf("client %d", res.ID),
+			class:  "clients",
+			time:   res.RunTime,
+			output: fmt.Sprintf("%d messages, %.3f msg/sec, mean latency %.3f ms, %d lost, %d duplicates", res.Successes, res.MsgsPerSec, res.MsgTimeMean/1_000_000, res.Lost, res.Duplicates),
+		}
+		switch {
+		case res.Failed:
+			c.failure = "client failed: " + res.Error
+		case res.Truncated:
+			c.failure = "client stopped before receiving all messages"
+		}
+		cases = append(cases, c)
+	}
+	if jr.Thresholds != nil {
+		for _, name := range jr.Thresholds.Checked {
+			c := &testCase{name: name, class: "thresholds"}
+			var messages []string
+			for _, failure := range jr.Thresholds.Failures {
+				if failure.Threshold == name {
+					messages = append(messages, failure.Message)
+				}
+			}
+			c.failure = strings.Join(messages, "; ")
+			cases = append(cases, c)
+		}
+	}
+
+	return cases
+}
+
+// suiteName returns the name of the run in the test reports, the run ID if set
+func suiteName(jr *results.JSONResults) string {
+	if jr.RunID != "" {
+		return "mqtt-benchmark-subscriber " + jr.RunID
+	}
+
+	return "mqtt-benchmark-subscriber"
+}
+
+type junitTestSuites struct {
+	XMLName   xml.Name       `xml:"testsuites"`
+	Name      string         `xml:"name,attr"`
+	Tests     int            `xml:"tests,attr"`
+	Failures  int            `xml:"failures,attr"`
+	Time      string         `xml:"time,attr"`
+	TestSuite junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Hostname   string           `xml:"hostname,attr,omitempty"`
+	Properties []junitProperty  `xml:"properties>property,omitempty"`
+	TestCases  []*junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// printJUnit writes the results as a JUnit XML report, a test suite with the cases of testCases. The labels
+// and the seed are properties of the suite.
+func printJUnit(w io.Writer, jr *results.JSONResults) error {
+	suite := junitTestSuite{Name: suiteName(jr), Time: formatFloat(jr.Totals.TotalRunTime)}
+	if jr.Config != nil {
+		suite.Timestamp = jr.Config.StartedAt.UTC().Format("2006-01-02T15:04:05")
+		suite.Hostname = jr.Config.Hostname
+	}
+	suite.Properties = append(suite.Properties, junitProperty{Name: "seed", Value: fmt.Sprint(jr.Seed)})
+	for _, key := range labelFlags(jr.Labels).keys() {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "label." + key, Value: jr.Labels[key]})
+	}
+	for _, c := range testCases(jr) {
+		tc := &junitTestCase{Name: c.name, ClassName: c.class, Time: formatFloat(c.time), SystemOut: c.output}
+		if c.failure != "" {
+			tc.Failure = &junitFailure{Message: c.failure, Type: c.class, Text: c.failure}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	if err := encoder.Encode(junitTestSuites{
+		Name:      suite.Name,
+		Tests:     suite.Tests,
+		Failures:  suite.Failures,
+		Time:      suite.Time,
+		TestSuite: suite,
+	}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+
+	return err
+}
+
+// printTAP writes the results in the Test Anything Protocol version 13, the cases of testCases with the
+// failures as YAML diagnostics
+func printTAP(w io.Writer, jr *results.JSONResults) error {
+	cases := testCases(jr)
+	var b strings.Builder
+	fmt.Fprintln(&b, "TAP version 13")
+	fmt.Fprintf(&b, "1..%d\n", len(cases))
+	for i, c := range cases {
+		status := "ok"
+		if c.failure != "" {
+			status = "not ok"
+		}
+		fmt.Fprintf(&b, "%s %d - %s: %s\n", status, i+1, c.class, c.name)
+		fmt.Fprintln(&b, "  ---")
+		fmt.Fprintf(&b, "  duration_ms: %.3f\n", c.time*1000)
+		if c.output != "" {
+			fmt.Fprintf(&b, "  output: %q\n", c.output)
+		}
+		if c.failure != "" {
+			fmt.Fprintf(&b, "  message: %q\n", c.failure)
+		}
+		fmt.Fprintln(&b, "  ...")
+	}
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
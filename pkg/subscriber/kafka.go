@@ -0,0 +1,391 @@
+package subscriber
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kafka API keys and versions used by the KafkaProducer
+const (
+	kafkaProduceKey      = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadataKey     = 3
+	kafkaMetadataVersion = 1
+)
+
+// kafkaLeaderNotAvailable is returned while a (just auto-created) topic has no leader yet
+const kafkaLeaderNotAvailable = 5
+
+// kafkaProducerTimeout bounds the connect and the requests of the KafkaProducer
+const kafkaProducerTimeout = 30 * time.Second
+
+// kafkaMaxResponseSize bounds the size of a response read from a broker, larger (or negative) sizes are refused
+// rather than allocated
+const kafkaMaxResponseSize = 128 << 20
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// KafkaProducer is a minimal Kafka producer that writes every message to partition 0 of a single topic,
+// which is all that is needed to stream the results and keeps the tool free of a Kafka client dependency
+type KafkaProducer struct {
+	Topic    string
+	ClientID string
+	Key      []byte
+
+	mu   sync.Mutex
+	conn *kafkaConn
+}
+
+// newKafkaProducer looks up the leader of partition 0 of topic using the comma separated bootstrap brokers
+// and connects to it
+func newKafkaProducer(brokers string, topic string, clientID string) (*KafkaProducer, error) {
+	p := &KafkaProducer{
+		Topic:    topic,
+		ClientID: clientID,
+	}
+
+	var err error
+	for _, broker := range strings.Split(brokers, ",") {
+		var leader string
+		leader, err = p.lookupLeader(strings.TrimSpace(broker))
+		if err != nil {
+			continue
+		}
+		if p.conn, err = dialKafka(leader, clientID, kafkaProducerTimeout); err == nil {
+			return p, nil
+		}
+	}
+
+	return nil, err
+}
+
+// lookupLeader returns the address of the leader of partition 0 of the topic
+func (p *KafkaProducer) lookupLeader(broker string) (string, error) {
+	conn, err := dialKafka(broker, p.ClientID, kafkaProducerTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.conn.Close()
+
+	leaders, err := conn.partitionLeaders(p.Topic)
+	if err != nil {
+		return "", err
+	}
+	for address, partitions := range leaders {
+		for _, partition := range partitions {
+			if partition == 0 && address != "" {
+				return address, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no leader for partition 0 of topic %v", p.Topic)
+}
+
+// Produce writes value as a single record to partition 0 of the topic and waits for the leader's acknowledgement
+func (p *KafkaProducer) Produce(value []byte) error {
+	batch := encodeRecordBatch(p.Key, value, time.Now())
+
+	var req bytes.Buffer
+	writeInt16(&req, -1)    // transactional id
+	writeInt16(&req, 1)     // acks
+	writeInt32(&req, 10000) // timeout
+	writeInt32(&req, 1)
+	writeString(&req, p.Topic)
+	writeInt32(&req, 1)
+	writeInt32(&req, 0) // partition
+	writeInt32(&req, int32(len(batch)))
+	req.Write(batch)
+
+	p.mu.Lock()
+	resp, err := p.conn.roundTrip(kafkaProduceKey, kafkaProduceVersion, req.Bytes(), 0)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	r := &kafkaReader{buf: resp}
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		r.string() // topic
+		for m := r.int32(); m > 0 && r.err == nil; m-- {
+			r.int32() // partition
+			if code := r.int16(); code != 0 {
+				return fmt.Errorf("producing to topic %v failed with error code %d", p.Topic, code)
+			}
+			r.int64() // base offset
+			r.int64() // log append time
+		}
+	}
+
+	return r.err
+}
+
+// Write implements io.Writer, producing p (without trailing newline) as a single record
+func (p *KafkaProducer) Write(data []byte) (int, error) {
+	if err := p.Produce(bytes.TrimSuffix(data, []byte("\n"))); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// Close closes the connection to the leader
+func (p *KafkaProducer) Close() error {
+	return p.conn.conn.Close()
+}
+
+// dialKafka connects to a Kafka broker, timeout bounds the connect and every request (0 is unlimited)
+func dialKafka(address, clientID string, timeout time.Duration) (*kafkaConn, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafkaConn{conn: conn, reader: bufio.NewReader(conn), clientID: clientID, timeout: timeout}, nil
+}
+
+// kafkaConn is a connection to a Kafka broker, for one request at a time. The KafkaProducer and the kafkaSource
+// speak the Kafka protocol over it.
+type kafkaConn struct {
+	conn          net.Conn
+	reader        *bufio.Reader
+	clientID      string
+	timeout       time.Duration
+	correlationID int32
+}
+
+// roundTrip sends a request and returns the response body following the correlation id, the broker may
+// hold back the response for wait
+func (kc *kafkaConn) roundTrip(apiKey, apiVersion int16, body []byte, wait time.Duration) ([]byte, error) {
+	kc.correlationID++
+	var req bytes.Buffer
+	writeInt32(&req, 0) // size, filled in below
+	writeInt16(&req, apiKey)
+	writeInt16(&req, apiVersion)
+	writeInt32(&req, kc.correlationID)
+	writeString(&req, kc.clientID)
+	req.Write(body)
+	data := req.Bytes()
+	binary.BigEndian.PutUint32(data, uint32(len(data)-4))
+
+	if kc.timeout > 0 {
+		kc.conn.SetDeadline(time.Now().Add(kc.timeout + wait))
+	}
+	if _, err := kc.conn.Write(data); err != nil {
+		return nil, err
+	}
+
+	return readKafkaResponse(kc.reader, kc.correlationID)
+}
+
+// partitionLeaders returns the partitions of topic by the address of their leader, retrying while the
+// broker is still electing leaders
+func (kc *kafkaConn) partitionLeaders(topic string) (map[string][]int32, error) {
+	for attempt := 0; ; attempt++ {
+		var req bytes.Buffer
+		writeInt32(&req, 1)
+		writeString(&req, topic)
+		resp, err := kc.roundTrip(kafkaMetadataKey, kafkaMetadataVersion, req.Bytes(), 0)
+		if err != nil {
+			return nil, err
+		}
+		leaders, code, err := parsePartitionLeaders(resp, topic)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case code == 0 && len(leaders) > 0:
+			return leaders, nil
+		case code == kafkaLeaderNotAvailable && attempt < 10:
+			time.Sleep(500 * time.Millisecond)
+		default:
+			return nil, fmt.Errorf("no leaders for the partitions of topic %v (error code %d)", topic, code)
+		}
+	}
+}
+
+// parsePartitionLeaders returns the partitions of topic by the address of their leader and the first (topic
+// or partition) error code
+func parsePartitionLeaders(resp []byte, topic string) (map[string][]int32, int16, error) {
+	r := &kafkaReader{buf: resp}
+	hosts := make(map[int32]string)
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		id := r.int32()
+		host := r.string()
+		port := r.int32()
+		r.string() // rack
+		hosts[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.int32() // controller id
+
+	leaders, code := make(map[string][]int32), int16(0)
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		topicCode := r.int16()
+		name := r.string()
+		r.bool() // is internal
+		for m := r.int32(); m > 0 && r.err == nil; m-- {
+			partitionCode := r.int16()
+			partition := r.int32()
+			leaderID := r.int32()
+			r.int32Array() // replicas
+			r.int32Array() // isr
+			if name != topic {
+				continue
+			}
+			if partitionCode != 0 && code == 0 {
+				code = partitionCode
+			}
+			leaders[hosts[leaderID]] = append(leaders[hosts[leaderID]], partition)
+		}
+		if name == topic && topicCode != 0 {
+			code = topicCode
+		}
+	}
+
+	return leaders, code, r.err
+}
+
+// readKafkaResponse reads a size delimited response and returns its body following the correlation id
+func readKafkaResponse(reader io.Reader, correlationID int32) ([]byte, error) {
+	var size int32
+	if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 4 || size > kafkaMaxResponseSize {
+		return nil, fmt.Errorf("invalid kafka response size %d", size)
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(reader, resp); err != nil {
+		return nil, err
+	}
+	if int32(binary.BigEndian.Uint32(resp)) != correlationID {
+		return nil, errors.New("unexpected kafka response")
+	}
+
+	return resp[4:], nil
+}
+
+// encodeRecordBatch encodes a v2 record batch holding a single record
+func encodeRecordBatch(key, value []byte, now time.Time) []byte {
+	var record bytes.Buffer
+	record.WriteByte(0)     // attributes
+	writeVarint(&record, 0) // timestamp delta
+	writeVarint(&record, 0) // offset delta
+	writeVarintBytes(&record, key)
+	writeVarintBytes(&record, value)
+	writeVarint(&record, 0) // headers
+
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	var tail bytes.Buffer
+	writeInt16(&tail, 0) // attributes
+	writeInt32(&tail, 0) // last offset delta
+	writeInt64(&tail, timestamp)
+	writeInt64(&tail, timestamp)
+	writeInt64(&tail, -1) // producer id
+	writeInt16(&tail, -1) // producer epoch
+	writeInt32(&tail, -1) // base sequence
+	writeInt32(&tail, 1)  // records
+	writeVarint(&tail, int64(record.Len()))
+	tail.Write(record.Bytes())
+
+	var batch bytes.Buffer
+	writeInt64(&batch, 0)                       // base offset
+	writeInt32(&batch, int32(4+1+4+tail.Len())) // batch length
+	writeInt32(&batch, -1)                      // partition leader epoch
+	batch.WriteByte(2)                          // magic
+	writeInt32(&batch, int32(crc32.Checksum(tail.Bytes(), crc32c)))
+	batch.Write(tail.Bytes())
+
+	return batch.Bytes()
+}
+
+func writeInt16(w *bytes.Buffer, v int16) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func writeInt32(w *bytes.Buffer, v int32) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func writeInt64(w *bytes.Buffer, v int64) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func writeString(w *bytes.Buffer, s string) {
+	writeInt16(w, int16(len(s)))
+	w.WriteString(s)
+}
+
+func writeVarint(w *bytes.Buffer, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func writeVarintBytes(w *bytes.Buffer, b []byte) {
+	if b == nil {
+		writeVarint(w, -1)
+		return
+	}
+	writeVarint(w, int64(len(b)))
+	w.Write(b)
+}
+
+// kafkaReader decodes a Kafka response, the first error is kept and stops decoding
+type kafkaReader struct {
+	buf []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err == nil && (n < 0 || len(r.buf) < n) {
+		r.err = errors.New("truncated kafka response")
+	}
+	if r.err != nil {
+		return make([]byte, 8)
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+
+	return b
+}
+
+func (r *kafkaReader) bool() bool {
+	return r.next(1)[0] != 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	return int16(binary.BigEndian.Uint16(r.next(2)))
+}
+
+func (r *kafkaReader) int32() int32 {
+	return int32(binary.BigEndian.Uint32(r.next(4)))
+}
+
+func (r *kafkaReader) int64() int64 {
+	return int64(binary.BigEndian.Uint64(r.next(8)))
+}
+
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+
+	return string(r.next(int(n)))
+}
+
+func (r *kafkaReader) int32Array() {
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		r.int32()
+	}
+}
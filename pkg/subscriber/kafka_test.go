@@ -0,0 +1,125 @@
+package subscriber
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeRecordBatch(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	batch := encodeRecordBatch(nil, []byte("value"), now)
+
+	if offset := binary.BigEndian.Uint64(batch); offset != 0 {
+		t.Errorf("base offset %d", offset)
+	}
+	if length := int(binary.BigEndian.Uint32(batch[8:])); length != len(batch)-12 {
+		t.Errorf("batch length %d, want %d", length, len(batch)-12)
+	}
+	if batch[16] != 2 {
+		t.Errorf("magic %d, want 2", batch[16])
+	}
+	// the CRC-32C covers the batch from the attributes on
+	if crc := binary.BigEndian.Uint32(batch[17:]); crc != crc32.Checksum(batch[21:], crc32c) {
+		t.Errorf("crc 0x%08x, want 0x%08x", crc, crc32.Checksum(batch[21:], crc32c))
+	}
+	if timestamp := int64(binary.BigEndian.Uint64(batch[27:])); timestamp != 1700000000123 {
+		t.Errorf("first timestamp %d", timestamp)
+	}
+	if records := binary.BigEndian.Uint32(batch[57:]); records != 1 {
+		t.Errorf("%d records, want 1", records)
+	}
+	// the record: its length, attributes, timestamp and offset deltas, a null key, the value and no headers
+	var record bytes.Buffer
+	record.WriteByte(0)
+	writeVarint(&record, 0)
+	writeVarint(&record, 0)
+	writeVarintBytes(&record, nil)
+	writeVarintBytes(&record, []byte("value"))
+	writeVarint(&record, 0)
+	var want bytes.Buffer
+	writeVarint(&want, int64(record.Len()))
+	want.Write(record.Bytes())
+	if !bytes.Equal(batch[61:], want.Bytes()) {
+		t.Errorf("record %v, want %v", batch[61:], want.Bytes())
+	}
+}
+
+func TestParsePartitionLeaders(t *testing.T) {
+	var resp bytes.Buffer
+	writeInt32(&resp, 2) // brokers
+	for _, broker := range []struct {
+		id   int32
+		host string
+		port int32
+	}{{1, "k1", 9092}, {2, "k2", 9093}} {
+		writeInt32(&resp, broker.id)
+		writeString(&resp, broker.host)
+		writeInt32(&resp, broker.port)
+		writeInt16(&resp, -1) // null rack
+	}
+	writeInt32(&resp, 1) // controller id
+	writeInt32(&resp, 2) // topics
+	for _, topic := range []struct {
+		name    string
+		leaders []int32
+	}{{"other", []int32{1}}, {"results", []int32{1, 2, 1}}} {
+		writeInt16(&resp, 0)
+		writeString(&resp, topic.name)
+		resp.WriteByte(0) // not internal
+		writeInt32(&resp, int32(len(topic.leaders)))
+		for partition, leader := range topic.leaders {
+			code := int16(0)
+			if topic.name == "results" && partition == 2 {
+				code = kafkaLeaderNotAvailable
+			}
+			writeInt16(&resp, code)
+			writeInt32(&resp, int32(partition))
+			writeInt32(&resp, leader)
+			writeInt32(&resp, 1) // replicas
+			writeInt32(&resp, leader)
+			writeInt32(&resp, 0) // isr
+		}
+	}
+
+	leaders, code, err := parsePartitionLeaders(resp.Bytes(), "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]int32{"k1:9092": {0, 2}, "k2:9093": {1}}; !reflect.DeepEqual(leaders, want) {
+		t.Errorf("leaders = %v, want %v", leaders, want)
+	}
+	if code != kafkaLeaderNotAvailable {
+		t.Errorf("error code %d, want %d", code, kafkaLeaderNotAvailable)
+	}
+
+	_, _, err = parsePartitionLeaders(resp.Bytes()[:resp.Len()-3], "results")
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("truncated response: error %v", err)
+	}
+}
+
+func TestReadKafkaResponse(t *testing.T) {
+	var resp bytes.Buffer
+	writeInt32(&resp, 7)
+	writeInt32(&resp, 42) // correlation id
+	resp.WriteString("abc")
+
+	body, err := readKafkaResponse(bytes.NewReader(resp.Bytes()), 42)
+	if err != nil || string(body) != "abc" {
+		t.Errorf("readKafkaResponse() = %q, %v", body, err)
+	}
+	if _, err := readKafkaResponse(bytes.NewReader(resp.Bytes()), 43); err == nil {
+		t.Error("expected an error for another correlation id")
+	}
+	if _, err := readKafkaResponse(bytes.NewReader([]byte{0x7F, 0xFF, 0xFF, 0xFF}), 42); err == nil {
+		t.Error("expected an error for an oversize response")
+	}
+	if _, err := readKafkaResponse(bytes.NewReader(resp.Bytes()[:8]), 42); err == nil {
+		t.Error("expected an error for a truncated response")
+	}
+}
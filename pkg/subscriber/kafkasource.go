@@ -0,0 +1,312 @@
+package subscriber
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kafka API keys and versions used by the kafkaSource, the oldest versions with record batches that Kafka 4
+// still supports
+const (
+	kafkaFetchKey           = 1
+	kafkaFetchVersion       = 4
+	kafkaListOffsetsKey     = 2
+	kafkaListOffsetsVersion = 1
+)
+
+// kafkaFetchWait is how long the broker holds back a fetch without new records
+const kafkaFetchWait = 500 * time.Millisecond
+
+// kafkaSource consumes all partitions of a Kafka topic from the latest offsets on, without a consumer group,
+// so every client receives all messages like an MQTT subscriber. It reads uncompressed and gzip compressed
+// record batches.
+type kafkaSource struct {
+	address  string
+	clientID string
+	timeout  time.Duration
+
+	handleMu sync.Mutex // handle is called for one message at a time
+	mu       sync.Mutex
+	conns    []*kafkaConn
+	closed   chan struct{}
+}
+
+func newKafkaSource(u *url.URL, clientID string, timeout time.Duration) *kafkaSource {
+	return &kafkaSource{address: hostPort(u, "9092"), clientID: clientID, timeout: timeout, closed: make(chan struct{})}
+}
+
+// kafkaTopicName returns the Kafka topic of an MQTT topic, with dots instead of slashes, e.g. /bench/data is
+// bench.data. Kafka topics have no wildcards.
+func kafkaTopicName(topic string) (string, error) {
+	if strings.ContainsAny(topic, "+#") {
+		return "", fmt.Errorf("kafka topics have no wildcards, given: %v", topic)
+	}
+
+	return strings.Replace(strings.TrimPrefix(topic, "/"), "/", ".", -1), nil
+}
+
+// Subscribe looks up the leaders of the partitions of the topic and fetches from each of them in its own
+// goroutine
+func (s *kafkaSource) Subscribe(topic string, handle func(topic string, payload []byte), lost func(err error)) error {
+	name, err := kafkaTopicName(topic)
+	if err != nil {
+		return err
+	}
+	bootstrap, err := s.dial(s.address)
+	if err != nil {
+		return err
+	}
+	leaders, err := bootstrap.partitionLeaders(name)
+	if err != nil {
+		return err
+	}
+
+	for address, partitions := range leaders {
+		conn, err := s.dial(address)
+		if err != nil {
+			return err
+		}
+		offsets, err := conn.latestOffsets(name, partitions)
+		if err != nil {
+			return err
+		}
+		go s.fetch(conn, name, offsets, handle, lost)
+	}
+
+	return nil
+}
+
+func (s *kafkaSource) dial(address string) (*kafkaConn, error) {
+	kc, err := dialKafka(address, s.clientID, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.conns = append(s.conns, kc)
+	s.mu.Unlock()
+
+	return kc, nil
+}
+
+// fetch fetches the records of the partitions from offsets on until the source is closed
+func (s *kafkaSource) fetch(conn *kafkaConn, topic string, offsets map[int32]int64, handle func(topic string, payload []byte), lost func(err error)) {
+	for {
+		values, err := conn.fetch(topic, offsets)
+		if err != nil {
+			select {
+			case <-s.closed:
+			default:
+				lost(fmt.Errorf("fetching from %v: %v", conn.conn.RemoteAddr(), err))
+			}
+			return
+		}
+		s.handleMu.Lock()
+		for _, value := range values {
+			handle(topic, value)
+		}
+		s.handleMu.Unlock()
+	}
+}
+
+func (s *kafkaSource) Close() error {
+	close(s.closed)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.conn.Close()
+	}
+
+	return nil
+}
+
+// latestOffsets returns the offsets the next records of the partitions will get
+func (kc *kafkaConn) latestOffsets(topic string, partitions []int32) (map[int32]int64, error) {
+	var req bytes.Buffer
+	writeInt32(&req, -1) // replica id
+	writeInt32(&req, 1)
+	writeString(&req, topic)
+	writeInt32(&req, int32(len(partitions)))
+	for _, partition := range partitions {
+		writeInt32(&req, partition)
+		writeInt64(&req, -1) // latest
+	}
+	resp, err := kc.roundTrip(kafkaListOffsetsKey, kafkaListOffsetsVersion, req.Bytes(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &kafkaReader{buf: resp}
+	offsets := make(map[int32]int64)
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		r.string() // topic
+		for m := r.int32(); m > 0 && r.err == nil; m-- {
+			partition := r.int32()
+			code := r.int16()
+			r.int64() // timestamp
+			offset := r.int64()
+			if code != 0 && r.err == nil {
+				return nil, fmt.Errorf("listing the offsets of topic %v partition %d failed with error code %d", topic, partition, code)
+			}
+			offsets[partition] = offset
+		}
+	}
+
+	return offsets, r.err
+}
+
+// fetch returns the values of the records of the partitions from offsets on, waiting up to kafkaFetchWait
+// for them, and advances offsets past them
+func (kc *kafkaConn) fetch(topic string, offsets map[int32]int64) ([][]byte, error) {
+	var req bytes.Buffer
+	writeInt32(&req, -1) // replica id
+	writeInt32(&req, int32(kafkaFetchWait/time.Millisecond))
+	writeInt32(&req, 1)      // min bytes
+	writeInt32(&req, 64<<20) // max bytes
+	req.WriteByte(0)         // read uncommitted
+	writeInt32(&req, 1)
+	writeString(&req, topic)
+	writeInt32(&req, int32(len(offsets)))
+	for partition, offset := range offsets {
+		writeInt32(&req, partition)
+		writeInt64(&req, offset)
+		writeInt32(&req, 1<<20) // partition max bytes
+	}
+	resp, err := kc.roundTrip(kafkaFetchKey, kafkaFetchVersion, req.Bytes(), kafkaFetchWait)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &kafkaReader{buf: resp}
+	r.int32() // throttle time
+	var values [][]byte
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		r.string() // topic
+		for m := r.int32(); m > 0 && r.err == nil; m-- {
+			partition := r.int32()
+			code := r.int16()
+			r.int64() // high watermark
+			r.int64() // last stable offset
+			for t := r.int32(); t > 0 && r.err == nil; t-- {
+				r.int64() // aborted transaction producer id
+				r.int64() // aborted transaction first offset
+			}
+			batches := r.bytes()
+			if r.err != nil {
+				break
+			}
+			if code != 0 {
+				return nil, fmt.Errorf("fetching topic %v partition %d failed with error code %d", topic, partition, code)
+			}
+			if offsets[partition], values, err = recordValues(batches, offsets[partition], values); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return values, r.err
+}
+
+// recordValues appends the values of the records of the v2 record batches from offset on to values and
+// returns the offset after them. The last batch may be incomplete, it is fetched again.
+func recordValues(batches []byte, offset int64, values [][]byte) (int64, [][]byte, error) {
+	const headerSize = 61
+	for len(batches) >= 12 {
+		baseOffset := int64(binary.BigEndian.Uint64(batches))
+		size := 12 + int(binary.BigEndian.Uint32(batches[8:]))
+		if len(batches) < size || size < headerSize {
+			break
+		}
+		batch := batches[:size]
+		batches = batches[size:]
+		if magic := batch[16]; magic != 2 {
+			return offset, values, fmt.Errorf("kafka message format %d not supported", magic)
+		}
+		attributes := binary.BigEndian.Uint16(batch[21:])
+		next := baseOffset + int64(binary.BigEndian.Uint32(batch[23:])) + 1
+		if next <= offset {
+			continue
+		}
+		if attributes&0x20 != 0 {
+			// control batch of a transaction
+			offset = next
+			continue
+		}
+		records := batch[headerSize:]
+		switch codec := attributes & 0x07; codec {
+		case 0:
+		case 1:
+			gz, err := gzip.NewReader(bytes.NewReader(records))
+			if err != nil {
+				return offset, values, err
+			}
+			if records, err = ioutil.ReadAll(gz); err != nil {
+				return offset, values, err
+			}
+		default:
+			return offset, values, fmt.Errorf("kafka compression codec %d not supported, only gzip", codec)
+		}
+
+		r := &kafkaReader{buf: records}
+		for n := binary.BigEndian.Uint32(batch[57:]); n > 0 && r.err == nil; n-- {
+			r.varint() // length
+			r.bool()   // attributes
+			r.varint() // timestamp delta
+			offsetDelta := r.varint()
+			r.varbytes() // key
+			value := r.varbytes()
+			for h := r.varint(); h > 0 && r.err == nil; h-- {
+				r.varbytes() // header key
+				r.varbytes() // header value
+			}
+			if r.err == nil && baseOffset+offsetDelta >= offset {
+				values = append(values, value)
+			}
+		}
+		if r.err != nil {
+			return offset, values, fmt.Errorf("invalid kafka record batch at offset %d", baseOffset)
+		}
+		offset = next
+	}
+
+	return offset, values, nil
+}
+
+func (r *kafkaReader) bytes() []byte {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+
+	return r.next(int(n))
+}
+
+func (r *kafkaReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = errors.New("truncated kafka record")
+		return 0
+	}
+	r.buf = r.buf[n:]
+
+	return v
+}
+
+func (r *kafkaReader) varbytes() []byte {
+	n := r.varint()
+	if n < 0 {
+		return nil
+	}
+
+	return r.next(int(n))
+}
@@ -0,0 +1,49 @@
+package subscriber
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// labelFlags collects repeated -label key=value flags
+type labelFlags map[string]string
+
+func (l labelFlags) String() string {
+	keys := l.keys()
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + l[key]
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// Set implements flag.Value, a later label with the same key overrides an earlier one
+func (l labelFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("invalid label %q, expected key=value", value)
+	}
+	l[strings.TrimSpace(parts[0])] = parts[1]
+
+	return nil
+}
+
+// reset drops the labels
+func (l labelFlags) reset() {
+	for key := range l {
+		delete(l, key)
+	}
+}
+
+// keys returns the label keys in sorted order
+func (l labelFlags) keys() []string {
+	keys := make([]string, 0, len(l))
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
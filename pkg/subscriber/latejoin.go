@@ -0,0 +1,100 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// lateJoinTracker measures the first messages of a client that subscribes after a delay; messages generated
+// before the client subscribed are part of the backlog (retained or queued in a persistent session)
+type lateJoinTracker struct {
+	mu            sync.Mutex
+	subscribedAt  int64
+	firstAt       int64
+	retained      int64
+	backlog       int64
+	lastBacklogAt int64
+}
+
+// subscribing records the time the first subscription was sent
+func (t *lateJoinTracker) subscribing(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.subscribedAt == 0 {
+		t.subscribedAt = now.UnixNano()
+	}
+}
+
+func (t *lateJoinTracker) received(m *Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firstAt == 0 {
+		t.firstAt = m.ReceivedAt
+	}
+	if m.Retained {
+		t.retained++
+	}
+	if m.Payload.GeneratedAt < t.subscribedAt {
+		t.backlog++
+		t.lastBacklogAt = m.ReceivedAt
+	}
+}
+
+func (t *lateJoinTracker) results(joinDelay time.Duration) *results.LateJoinResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	res := &results.LateJoinResults{
+		JoinDelay:        float64(joinDelay),
+		RetainedMessages: t.retained,
+		BacklogMessages:  t.backlog,
+	}
+	if t.subscribedAt > 0 && t.firstAt > t.subscribedAt {
+		res.TimeToFirstMessage = float64(t.firstAt - t.subscribedAt)
+		res.TimeToFirstMessageMax = res.TimeToFirstMessage
+	}
+	if t.subscribedAt > 0 && t.lastBacklogAt > t.subscribedAt {
+		res.CatchUpTime = float64(t.lastBacklogAt - t.subscribedAt)
+	}
+
+	return res
+}
+
+// lateJoiner returns whether client id is one of the late joiners, which are the last fraction of the clients
+func lateJoiner(id int, clients int, fraction float64) bool {
+	late := int(fraction*float64(clients) + 0.5)
+
+	return id >= clients-late
+}
+
+func calculateLateJoinTotals(runs []*results.RunResults) *results.LateJoinResults {
+	var totals *results.LateJoinResults
+	var firstMessageTimes, catchUpTimes []float64
+	for _, res := range runs {
+		l := res.LateJoin
+		if l == nil {
+			continue
+		}
+		if totals == nil {
+			totals = &results.LateJoinResults{JoinDelay: l.JoinDelay}
+		}
+		totals.RetainedMessages += l.RetainedMessages
+		totals.BacklogMessages += l.BacklogMessages
+		firstMessageTimes = append(firstMessageTimes, l.TimeToFirstMessage)
+		catchUpTimes = append(catchUpTimes, l.CatchUpTime)
+		if l.TimeToFirstMessageMax > totals.TimeToFirstMessageMax {
+			totals.TimeToFirstMessageMax = l.TimeToFirstMessageMax
+		}
+	}
+	if totals == nil {
+		return nil
+	}
+	totals.TimeToFirstMessage = stats.StatsMean(firstMessageTimes)
+	totals.CatchUpTime = stats.StatsMean(catchUpTimes)
+
+	return totals
+}
@@ -0,0 +1,125 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel is the severity of a log entry, entries below the level of -log-level are discarded
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+// parseLogLevel returns the level of -log-level
+func parseLogLevel(name string) (logLevel, error) {
+	for level, levelName := range logLevelNames {
+		if name == levelName {
+			return logLevel(level), nil
+		}
+	}
+
+	return 0, fmt.Errorf("log-level should be %v, given: %v", strings.Join(logLevelNames, ", "), name)
+}
+
+// logEntry is a log entry of -log-format json, with the client id, broker and topic of the client it is about
+type logEntry struct {
+	Time   string `json:"time"`
+	Level  string `json:"level"`
+	Msg    string `json:"msg"`
+	Client *int   `json:"client,omitempty"`
+	Broker string `json:"broker,omitempty"`
+	Topic  string `json:"topic,omitempty"`
+}
+
+// logger writes the log entries of at least its level to the output of the log package, so redirecting that
+// (see the dashboard) redirects them as well. Text entries are log lines with the level after the timestamp,
+// JSON entries a JSON document per line.
+type logger struct {
+	mu    sync.Mutex // serializes the JSON entries
+	level logLevel
+	json  bool
+}
+
+// logs is the logger of the subscriber, configured by Main
+var logs = &logger{level: levelInfo}
+
+// configure sets the level and format (text or json) of the logger
+func (l *logger) configure(level, format string) error {
+	var err error
+	if l.level, err = parseLogLevel(level); err != nil {
+		return err
+	}
+	switch format {
+	case "text":
+		l.json = false
+	case "json":
+		l.json = true
+	default:
+		return fmt.Errorf("log-format should be text or json, given: %v", format)
+	}
+
+	return nil
+}
+
+func (l *logger) enabled(level logLevel) bool {
+	return level >= l.level
+}
+
+func (l *logger) write(entry *logEntry, text string) {
+	if !l.json {
+		log.Output(3, strings.ToUpper(entry.Level)+" "+text)
+		return
+	}
+	entry.Time = time.Now().Format(time.RFC3339Nano)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	log.Writer().Write(append(data, '\n'))
+}
+
+// logf logs a message that is not about a single client
+func logf(level logLevel, format string, args ...interface{}) {
+	if !logs.enabled(level) {
+		return
+	}
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	logs.write(&logEntry{Level: level.String(), Msg: msg}, msg)
+}
+
+// fatalf logs an error that ends the run and exits with status 1, in the format of -log-format like any
+// other entry
+func fatalf(format string, args ...interface{}) {
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	logs.write(&logEntry{Level: levelError.String(), Msg: msg}, msg)
+	os.Exit(1)
+}
+
+// logf logs a message about the client, prefixed with CLIENT and its id in text
+func (c *Client) logf(level logLevel, format string, args ...interface{}) {
+	if !logs.enabled(level) {
+		return
+	}
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	id := c.ID
+	entry := &logEntry{Level: level.String(), Msg: msg, Client: &id, Broker: c.BrokerURL, Topic: c.MsgTopic}
+	logs.write(entry, fmt.Sprintf("CLIENT %v %v", c.ID, msg))
+}
@@ -0,0 +1,144 @@
+package subscriber
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// PublisherResults is the part of the publisher's JSON results the end-to-end report is based on,
+// publish times in milliseconds
+type PublisherResults struct {
+	RunID  string            `json:"run_id"`
+	Runs   []json.RawMessage `json:"runs"`
+	Totals struct {
+		Successes       int64   `json:"successes"`
+		Failures        int64   `json:"failures"`
+		TotalRunTime    float64 `json:"total_run_time"`
+		MsgTimeMeanAvg  float64 `json:"msg_time_mean_avg"`
+		TotalMsgsPerSec float64 `json:"total_msgs_per_sec"`
+	} `json:"totals"`
+}
+
+// EndToEndResults combines the publisher's and the subscriber's results of a single experiment,
+// durations in nanoseconds
+type EndToEndResults struct {
+	RunID              string  `json:"run_id,omitempty"`
+	Publishers         int     `json:"publishers"`
+	Subscribers        int     `json:"subscribers"`
+	Published          int64   `json:"published"`
+	PublishFailures    int64   `json:"publish_failures"`
+	PublishRate        float64 `json:"publish_rate"`
+	PublishTimeMean    float64 `json:"publish_time_mean"`
+	ExpectedDeliveries int64   `json:"expected_deliveries"`
+	Delivered          int64   `json:"delivered"`
+	DeliveryRate       float64 `json:"delivery_rate"`
+	Loss               float64 `json:"loss"`
+	Duplicates         int64   `json:"duplicates"`
+	LatencyMin         float64 `json:"latency_min"`
+	LatencyMax         float64 `json:"latency_max"`
+	LatencyMean        float64 `json:"latency_mean"`
+}
+
+// runMerge implements the merge subcommand, which combines the publisher's and this tool's JSON results
+// into an end-to-end report
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	var (
+		publisherFile  = fs.String("publisher", "", "Path to the JSON results of mqtt-benchmark-publisher")
+		subscriberFile = fs.String("subscriber", "", "Path to the JSON results of mqtt-benchmark-subscriber")
+		format         = fs.String("format", "text", "Output format: text|json")
+	)
+	fs.Parse(args)
+
+	if *publisherFile == "" || *subscriberFile == "" {
+		fatalf("Invalid arguments: both -publisher and -subscriber are required")
+	}
+
+	var pub PublisherResults
+	if err := readJSONFile(*publisherFile, &pub); err != nil {
+		fatalf("Error reading publisher results: %v", err)
+	}
+	var sub results.JSONResults
+	if err := readJSONFile(*subscriberFile, &sub); err != nil {
+		fatalf("Error reading subscriber results: %v", err)
+	}
+	if sub.Totals == nil {
+		fatalf("Error reading subscriber results: %v has no totals", *subscriberFile)
+	}
+	if pub.RunID != "" && sub.RunID != "" && pub.RunID != sub.RunID {
+		fatalf("Invalid arguments: publisher run id %v does not match subscriber run id %v", pub.RunID, sub.RunID)
+	}
+
+	res := mergeResults(&pub, &sub)
+	switch *format {
+	case "json":
+		data, err := json.Marshal(res)
+		if err != nil {
+			fatalf("Error marshalling results: %v", err)
+		}
+		var out bytes.Buffer
+		_ = json.Indent(&out, data, "", "\t")
+
+		fmt.Println(out.String())
+	default:
+		fmt.Printf("======= END TO END =======\n")
+		if res.RunID != "" {
+			fmt.Printf("Run ID:                      %s\n", res.RunID)
+		}
+		fmt.Printf("Publishers / subscribers:    %d / %d\n", res.Publishers, res.Subscribers)
+		fmt.Printf("Messages published:          %d\n", res.Published)
+		fmt.Printf("Publish failures:            %d\n", res.PublishFailures)
+		fmt.Printf("Publish rate (msg/sec):      %.3f\n", res.PublishRate)
+		fmt.Printf("Publish time mean (ms):      %.3f\n", res.PublishTimeMean/1_000_000)
+		fmt.Printf("Expected deliveries:         %d\n", res.ExpectedDeliveries)
+		fmt.Printf("Messages delivered:          %d\n", res.Delivered)
+		fmt.Printf("Delivery rate (msg/sec):     %.3f\n", res.DeliveryRate)
+		fmt.Printf("Loss (%%):                    %.3f\n", res.Loss*100)
+		fmt.Printf("Duplicates:                  %d\n", res.Duplicates)
+		fmt.Printf("Latency min (ms):            %.3f\n", res.LatencyMin/1_000_000)
+		fmt.Printf("Latency max (ms):            %.3f\n", res.LatencyMax/1_000_000)
+		fmt.Printf("Latency mean (ms):           %.3f\n", res.LatencyMean/1_000_000)
+	}
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// mergeResults computes the end-to-end results, every subscriber is expected to receive every published message
+func mergeResults(pub *PublisherResults, sub *results.JSONResults) *EndToEndResults {
+	res := &EndToEndResults{
+		RunID:           pub.RunID,
+		Publishers:      len(pub.Runs),
+		Subscribers:     len(sub.Runs),
+		Published:       pub.Totals.Successes,
+		PublishFailures: pub.Totals.Failures,
+		PublishRate:     pub.Totals.TotalMsgsPerSec,
+		PublishTimeMean: pub.Totals.MsgTimeMeanAvg * 1_000_000,
+		Delivered:       sub.Totals.Successes,
+		DeliveryRate:    sub.Totals.TotalMsgsPerSec,
+		Duplicates:      sub.Totals.Duplicates,
+		LatencyMin:      sub.Totals.MsgTimeMin,
+		LatencyMax:      sub.Totals.MsgTimeMax,
+		LatencyMean:     sub.Totals.MsgTimeMean,
+	}
+	if res.RunID == "" {
+		res.RunID = sub.RunID
+	}
+	res.ExpectedDeliveries = res.Published * int64(res.Subscribers)
+	if res.ExpectedDeliveries > 0 && res.Delivered < res.ExpectedDeliveries {
+		res.Loss = 1 - float64(res.Delivered)/float64(res.ExpectedDeliveries)
+	}
+
+	return res
+}
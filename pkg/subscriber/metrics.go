@@ -0,0 +1,72 @@
+package subscriber
+
+import (
+	"sort"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// metric is a key number of a run exported to a monitoring service
+type metric struct {
+	Name  string
+	Unit  string
+	Value float64
+}
+
+// Units of the exported metrics, named like CloudWatch's units
+const (
+	unitCount        = "Count"
+	unitCountPerSec  = "Count/Second"
+	unitMilliseconds = "Milliseconds"
+)
+
+// keyMetrics returns the key numbers of the totals exported to monitoring services, latencies in milliseconds
+func keyMetrics(totals *results.TotalResults) []metric {
+	return []metric{
+		{Name: "MessagesReceived", Unit: unitCount, Value: float64(totals.Successes)},
+		{Name: "Throughput", Unit: unitCountPerSec, Value: totals.TotalMsgsPerSec},
+		{Name: "LatencyMin", Unit: unitMilliseconds, Value: totals.MsgTimeMin / 1_000_000},
+		{Name: "LatencyMax", Unit: unitMilliseconds, Value: totals.MsgTimeMax / 1_000_000},
+		{Name: "LatencyMean", Unit: unitMilliseconds, Value: totals.MsgTimeMeanAvg / 1_000_000},
+		{Name: "Duplicates", Unit: unitCount, Value: float64(totals.Duplicates)},
+		{Name: "DuplicateDeliveries", Unit: unitCount, Value: float64(totals.DuplicateDeliveries)},
+		{Name: "Disconnects", Unit: unitCount, Value: float64(totals.Disconnects)},
+	}
+}
+
+// numericFields returns the top-level numbers of the JSON encoding of v by their JSON name, booleans as 0 or 1.
+// Nested sections, strings and the fields named in omit are left out.
+func numericFields(v interface{}, omit ...string) (map[string]float64, error) {
+	doc, err := toDocument(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range omit {
+		delete(doc, field)
+	}
+	fields := make(map[string]float64, len(doc))
+	for name, value := range doc {
+		switch value := value.(type) {
+		case float64:
+			fields[name] = value
+		case bool:
+			fields[name] = 0
+			if value {
+				fields[name] = 1
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// sortedNames returns the names of the fields in sorted order, so exported lines are deterministic
+func sortedNames(fields map[string]float64) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,590 @@
+package subscriber
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// MQTT control packet types besides those of the QoS 2 exchange, see qos2.go
+const (
+	packetConnect     = 1
+	packetConnAck     = 2
+	packetPubAck      = 4
+	packetSubscribe   = 8
+	packetSubAck      = 9
+	packetUnsubscribe = 10
+	packetUnsubAck    = 11
+	packetPingReq     = 12
+	packetPingResp    = 13
+	packetDisconnect  = 14
+	packetAuth        = 15
+)
+
+// MQTT 5.0 property identifiers
+const (
+	propPayloadFormat       = 0x01
+	propMessageExpiry       = 0x02
+	propContentType         = 0x03
+	propResponseTopic       = 0x08
+	propCorrelationData     = 0x09
+	propSubscriptionID      = 0x0B
+	propSessionExpiry       = 0x11
+	propAssignedClientID    = 0x12
+	propServerKeepAlive     = 0x13
+	propAuthMethod          = 0x15
+	propAuthData            = 0x16
+	propRequestProblemInfo  = 0x17
+	propWillDelay           = 0x18
+	propRequestResponseInfo = 0x19
+	propResponseInfo        = 0x1A
+	propServerReference     = 0x1C
+	propReasonString        = 0x1F
+	propReceiveMaximum      = 0x21
+	propTopicAliasMaximum   = 0x22
+	propTopicAlias          = 0x23
+	propMaximumQoS          = 0x24
+	propRetainAvailable     = 0x25
+	propUserProperty        = 0x26
+	propMaximumPacketSize   = 0x27
+	propWildcardAvailable   = 0x28
+	propSubIDAvailable      = 0x29
+	propSharedAvailable     = 0x2A
+)
+
+// UserProperty is an MQTT 5.0 user property, a name-value pair the publisher attached to a message
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// mqttProperties are the MQTT 5.0 properties of a packet the client reads or writes, only those it uses are
+// kept when reading. The has fields tell a property that is absent from one that is zero.
+type mqttProperties struct {
+	messageExpiry      uint32
+	hasMessageExpiry   bool
+	subscriptionIDs    []int
+	sessionExpiry      uint32
+	hasSessionExpiry   bool
+	assignedClientID   string
+	serverKeepAlive    uint16
+	hasServerKeepAlive bool
+	reasonString       string
+	receiveMaximum     uint16
+	topicAliasMaximum  uint16
+	topicAlias         uint16
+	maximumQoS         byte
+	hasMaximumQoS      bool
+	maximumPacketSize  uint32
+	userProperties     []UserProperty
+}
+
+// sessionNeverExpires is the Session Expiry Interval of a session the broker keeps forever, like the sessions of
+// MQTT 3.1.1
+const sessionNeverExpires = 0xFFFFFFFF
+
+// connectPacket is the CONNECT packet of a client, protocol level 3 (MQTT 3.1), 4 (3.1.1) or 5 (5.0)
+type connectPacket struct {
+	level        byte
+	clientID     string
+	username     string
+	password     string
+	cleanSession bool
+	keepAlive    uint16 // seconds
+	properties   mqttProperties
+}
+
+func (p *connectPacket) encode() []byte {
+	var body bytes.Buffer
+	if p.level == 3 {
+		writeString(&body, "MQIsdp")
+	} else {
+		writeString(&body, "MQTT")
+	}
+	body.WriteByte(p.level)
+	flags := byte(0)
+	if p.cleanSession {
+		flags |= 0x02
+	}
+	if p.username != "" {
+		flags |= 0x80
+		if p.password != "" {
+			flags |= 0x40
+		}
+	}
+	body.WriteByte(flags)
+	writeInt16(&body, int16(p.keepAlive))
+	if p.level == 5 {
+		writeProperties(&body, &p.properties)
+	}
+	writeString(&body, p.clientID)
+	if flags&0x80 != 0 {
+		writeString(&body, p.username)
+	}
+	if flags&0x40 != 0 {
+		writeString(&body, p.password)
+	}
+
+	return mqttPacket(packetConnect<<4, body.Bytes())
+}
+
+// subscribePacket subscribes to topic filters with their QoS, and with MQTT 5.0 the subscription options
+type subscribePacket struct {
+	id      uint16
+	filters []Subscription
+	options SubscriptionOptions
+}
+
+func (p *subscribePacket) encode(level byte) []byte {
+	var body bytes.Buffer
+	writeInt16(&body, int16(p.id))
+	if level == 5 {
+		var properties mqttProperties
+		if p.options.SubscriptionID > 0 {
+			properties.subscriptionIDs = []int{p.options.SubscriptionID}
+		}
+		writeProperties(&body, &properties)
+	}
+	for _, filter := range p.filters {
+		writeString(&body, filter.Topic)
+		if level == 5 {
+			body.WriteByte(p.options.flags(filter.QoS))
+		} else {
+			body.WriteByte(filter.QoS)
+		}
+	}
+
+	return mqttPacket(packetSubscribe<<4|0x02, body.Bytes())
+}
+
+// encodeUnsubscribe returns the UNSUBSCRIBE packet of topic filters
+func encodeUnsubscribe(level byte, id uint16, filters []string) []byte {
+	var body bytes.Buffer
+	writeInt16(&body, int16(id))
+	if level == 5 {
+		writeProperties(&body, &mqttProperties{})
+	}
+	for _, filter := range filters {
+		writeString(&body, filter)
+	}
+
+	return mqttPacket(packetUnsubscribe<<4|0x02, body.Bytes())
+}
+
+// encodePublish returns the PUBLISH packet of a message the client publishes, id is 0 with QoS 0
+func encodePublish(level byte, topic string, qos byte, retained bool, id uint16, payload []byte) []byte {
+	var body bytes.Buffer
+	writeString(&body, topic)
+	if qos > 0 {
+		writeInt16(&body, int16(id))
+	}
+	if level == 5 {
+		writeProperties(&body, &mqttProperties{})
+	}
+	body.Write(payload)
+	first := byte(packetPublish<<4) | qos<<1
+	if retained {
+		first |= 0x01
+	}
+
+	return mqttPacket(first, body.Bytes())
+}
+
+// encodeAck returns a PUBACK, PUBREC, PUBREL or PUBCOMP packet, which is the same in MQTT 3.1.1 and 5.0 for
+// the reason code Success
+func encodeAck(kind byte, id uint16) []byte {
+	first := kind << 4
+	if kind == packetPubRel {
+		first |= 0x02
+	}
+
+	return []byte{first, 2, byte(id >> 8), byte(id)}
+}
+
+// mqttPacket returns the packet of the first byte of the fixed header and the body
+func mqttPacket(first byte, body []byte) []byte {
+	packet := make([]byte, 0, 5+len(body))
+	packet = append(packet, first)
+	packet = appendVariableInt(packet, len(body))
+
+	return append(packet, body...)
+}
+
+// appendVariableInt appends the variable byte integer encoding of n to b
+func appendVariableInt(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// writeProperties writes the properties of a packet the client sends, preceded by their length
+func writeProperties(w *bytes.Buffer, p *mqttProperties) {
+	var props bytes.Buffer
+	if p.hasSessionExpiry {
+		props.WriteByte(propSessionExpiry)
+		writeInt32(&props, int32(p.sessionExpiry))
+	}
+	if p.receiveMaximum > 0 {
+		props.WriteByte(propReceiveMaximum)
+		writeInt16(&props, int16(p.receiveMaximum))
+	}
+	if p.maximumPacketSize > 0 {
+		props.WriteByte(propMaximumPacketSize)
+		writeInt32(&props, int32(p.maximumPacketSize))
+	}
+	if p.topicAliasMaximum > 0 {
+		props.WriteByte(propTopicAliasMaximum)
+		writeInt16(&props, int16(p.topicAliasMaximum))
+	}
+	for _, id := range p.subscriptionIDs {
+		props.WriteByte(propSubscriptionID)
+		props.Write(appendVariableInt(nil, id))
+	}
+	w.Write(appendVariableInt(nil, props.Len()))
+	w.Write(props.Bytes())
+}
+
+// readPacket reads the next packet, it returns the first byte of the fixed header and the body
+func readPacket(reader *bufio.Reader) (byte, []byte, error) {
+	first, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&127) * multiplier
+		if b&128 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+
+	return first, body, nil
+}
+
+// mqttReader decodes the body of a packet, the first error is kept and stops decoding
+type mqttReader struct {
+	buf []byte
+	err error
+}
+
+func (r *mqttReader) next(n int) []byte {
+	if r.err == nil && len(r.buf) < n {
+		r.err = errors.New("truncated MQTT packet")
+	}
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+
+	return b
+}
+
+func (r *mqttReader) byte() byte {
+	return r.next(1)[0]
+}
+
+func (r *mqttReader) uint16() uint16 {
+	return binary.BigEndian.Uint16(r.next(2))
+}
+
+func (r *mqttReader) uint32() uint32 {
+	return binary.BigEndian.Uint32(r.next(4))
+}
+
+func (r *mqttReader) string() string {
+	return string(r.binary())
+}
+
+func (r *mqttReader) binary() []byte {
+	return r.next(int(r.uint16()))
+}
+
+func (r *mqttReader) variableInt() int {
+	n, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		b := r.byte()
+		n += int(b&127) * multiplier
+		if b&128 == 0 {
+			return n
+		}
+		multiplier *= 128
+	}
+	if r.err == nil {
+		r.err = errors.New("malformed variable byte integer")
+	}
+
+	return 0
+}
+
+// properties reads the properties of an MQTT 5.0 packet, preceded by their length
+func (r *mqttReader) properties() *mqttProperties {
+	p := new(mqttProperties)
+	length := r.variableInt()
+	props := &mqttReader{buf: r.next(length), err: r.err}
+	for len(props.buf) > 0 && props.err == nil {
+		switch id := props.byte(); id {
+		case propMessageExpiry:
+			p.messageExpiry, p.hasMessageExpiry = props.uint32(), true
+		case propSubscriptionID:
+			p.subscriptionIDs = append(p.subscriptionIDs, props.variableInt())
+		case propSessionExpiry:
+			p.sessionExpiry, p.hasSessionExpiry = props.uint32(), true
+		case propAssignedClientID:
+			p.assignedClientID = props.string()
+		case propServerKeepAlive:
+			p.serverKeepAlive, p.hasServerKeepAlive = props.uint16(), true
+		case propReasonString:
+			p.reasonString = props.string()
+		case propReceiveMaximum:
+			p.receiveMaximum = props.uint16()
+		case propTopicAliasMaximum:
+			p.topicAliasMaximum = props.uint16()
+		case propTopicAlias:
+			p.topicAlias = props.uint16()
+		case propMaximumQoS:
+			p.maximumQoS, p.hasMaximumQoS = props.byte(), true
+		case propMaximumPacketSize:
+			p.maximumPacketSize = props.uint32()
+		case propUserProperty:
+			p.userProperties = append(p.userProperties, UserProperty{Key: props.string(), Value: props.string()})
+		case propPayloadFormat, propRequestProblemInfo, propRequestResponseInfo, propRetainAvailable,
+			propWildcardAvailable, propSubIDAvailable, propSharedAvailable:
+			props.byte()
+		case propWillDelay:
+			props.uint32()
+		case propContentType, propResponseTopic, propAuthMethod, propResponseInfo, propServerReference:
+			props.string()
+		case propCorrelationData, propAuthData:
+			props.binary()
+		default:
+			props.err = fmt.Errorf("unknown MQTT 5.0 property 0x%02x", id)
+		}
+	}
+	if r.err == nil {
+		r.err = props.err
+	}
+
+	return p
+}
+
+// connAckPacket is the CONNACK of the broker, code is the return code (MQTT 3.1.1) or reason code (5.0)
+type connAckPacket struct {
+	sessionPresent bool
+	code           byte
+	properties     *mqttProperties
+}
+
+func decodeConnAck(level byte, body []byte) (*connAckPacket, error) {
+	r := &mqttReader{buf: body}
+	p := &connAckPacket{sessionPresent: r.byte()&0x01 != 0, code: r.byte(), properties: new(mqttProperties)}
+	if level == 5 && len(r.buf) > 0 {
+		p.properties = r.properties()
+	}
+
+	return p, r.err
+}
+
+// err returns the error of a refused connection, nil if the broker accepted it
+func (p *connAckPacket) err(level byte) error {
+	if p.code == 0 {
+		return nil
+	}
+	var reason string
+	if level == 5 {
+		reason = reasonCodeText(p.code)
+	} else {
+		switch p.code {
+		case 1:
+			reason = "unacceptable protocol version"
+		case 2:
+			reason = "identifier rejected"
+		case 3:
+			reason = "server unavailable"
+		case 4:
+			reason = "bad user name or password"
+		case 5:
+			reason = "not authorized"
+		default:
+			reason = "unknown return code"
+		}
+	}
+	if p.properties.reasonString != "" {
+		reason += ": " + p.properties.reasonString
+	}
+
+	return fmt.Errorf("the broker refused the connection with code %d (%v)", p.code, reason)
+}
+
+// publishPacket is a PUBLISH the client received, topic is empty if the broker sent a topic alias instead
+type publishPacket struct {
+	duplicate  bool
+	qos        byte
+	retained   bool
+	topic      string
+	id         uint16
+	properties *mqttProperties
+	payload    []byte
+	size       int64 // of the packet in bytes
+}
+
+func decodePublish(level byte, first byte, body []byte) (*publishPacket, error) {
+	p := &publishPacket{
+		duplicate:  first&0x08 != 0,
+		qos:        (first >> 1) & 0x03,
+		retained:   first&0x01 != 0,
+		properties: new(mqttProperties),
+		size:       int64(len(appendVariableInt([]byte{first}, len(body))) + len(body)),
+	}
+	if p.qos == 3 {
+		return nil, errors.New("PUBLISH with QoS 3")
+	}
+	r := &mqttReader{buf: body}
+	p.topic = r.string()
+	if p.qos > 0 {
+		p.id = r.uint16()
+	}
+	if level == 5 {
+		p.properties = r.properties()
+	}
+	p.payload = r.buf
+
+	return p, r.err
+}
+
+// decodeAck returns the packet identifier of a PUBACK, PUBREC, PUBREL or PUBCOMP and its reason code, 0 if
+// omitted or with MQTT 3.1.1
+func decodeAck(level byte, body []byte) (uint16, byte, error) {
+	r := &mqttReader{buf: body}
+	id := r.uint16()
+	code := byte(0)
+	if level == 5 && len(r.buf) > 0 {
+		code = r.byte()
+	}
+
+	return id, code, r.err
+}
+
+// decodeSubAck returns the packet identifier of a SUBACK and the return or reason code of every topic filter:
+// the granted QoS, or 0x80 or above if the broker refused the subscription. An MQTT 5.0 UNSUBACK has the same
+// layout, with MQTT 3.1.1 it has no codes.
+func decodeSubAck(level byte, body []byte) (uint16, []byte, *mqttProperties, error) {
+	r := &mqttReader{buf: body}
+	id := r.uint16()
+	props := new(mqttProperties)
+	if level == 5 {
+		props = r.properties()
+	}
+	if r.err != nil {
+		return 0, nil, nil, r.err
+	}
+
+	return id, r.buf, props, nil
+}
+
+// decodeDisconnect returns the error of a DISCONNECT the broker sent (MQTT 5.0 only)
+func decodeDisconnect(body []byte) error {
+	r := &mqttReader{buf: body}
+	code := byte(0)
+	props := new(mqttProperties)
+	if len(r.buf) > 0 {
+		code = r.byte()
+	}
+	if len(r.buf) > 0 {
+		props = r.properties()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	reason := reasonCodeText(code)
+	if props.reasonString != "" {
+		reason += ": " + props.reasonString
+	}
+
+	return fmt.Errorf("disconnected by the broker with reason code 0x%02x (%v)", code, reason)
+}
+
+// reasonCodes are the texts of the MQTT 5.0 reason codes the broker sends
+var reasonCodes = map[byte]string{
+	0x00: "success",
+	0x04: "disconnect with will message",
+	0x80: "unspecified error",
+	0x81: "malformed packet",
+	0x82: "protocol error",
+	0x83: "implementation specific error",
+	0x84: "unsupported protocol version",
+	0x85: "client identifier not valid",
+	0x86: "bad user name or password",
+	0x87: "not authorized",
+	0x88: "server unavailable",
+	0x89: "server busy",
+	0x8A: "banned",
+	0x8B: "server shutting down",
+	0x8C: "bad authentication method",
+	0x8D: "keep alive timeout",
+	0x8E: "session taken over",
+	0x8F: "topic filter invalid",
+	0x90: "topic name invalid",
+	0x93: "receive maximum exceeded",
+	0x94: "topic alias invalid",
+	0x95: "packet too large",
+	0x96: "message rate too high",
+	0x97: "quota exceeded",
+	0x98: "administrative action",
+	0x99: "payload format invalid",
+	0x9A: "retain not supported",
+	0x9B: "QoS not supported",
+	0x9C: "use another server",
+	0x9D: "server moved",
+	0x9E: "shared subscriptions not supported",
+	0x9F: "connection rate exceeded",
+	0xA0: "maximum connect time",
+	0xA1: "subscription identifiers not supported",
+	0xA2: "wildcard subscriptions not supported",
+}
+
+func reasonCodeText(code byte) string {
+	if text, ok := reasonCodes[code]; ok {
+		return text
+	}
+
+	return "unknown reason code"
+}
+
+// sortedFilters returns the topic filters of a SubscribeMultiple in a stable order, the SUBACK returns the
+// codes in the order of the SUBSCRIBE
+func sortedFilters(filters map[string]byte) []Subscription {
+	subscriptions := make([]Subscription, 0, len(filters))
+	for topic, qos := range filters {
+		subscriptions = append(subscriptions, Subscription{Topic: topic, QoS: qos})
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Topic < subscriptions[j].Topic
+	})
+
+	return subscriptions
+}
@@ -0,0 +1,182 @@
+package subscriber
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConnectEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet connectPacket
+		want   []byte
+	}{
+		{
+			name:   "3.1.1",
+			packet: connectPacket{level: 4, clientID: "c", cleanSession: true, keepAlive: 30},
+			want:   []byte{0x10, 13, 0, 4, 'M', 'Q', 'T', 'T', 4, 0x02, 0, 30, 0, 1, 'c'},
+		},
+		{
+			name:   "3.1 with credentials",
+			packet: connectPacket{level: 3, clientID: "c", username: "u", password: "p", keepAlive: 1},
+			want: []byte{0x10, 21, 0, 6, 'M', 'Q', 'I', 's', 'd', 'p', 3, 0xC0, 0, 1, 0, 1, 'c', 0, 1, 'u', 0, 1,
+				'p'},
+		},
+		{
+			name: "5.0 with properties",
+			packet: connectPacket{level: 5, clientID: "c", keepAlive: 30, properties: mqttProperties{
+				sessionExpiry: 60, hasSessionExpiry: true, receiveMaximum: 10, maximumPacketSize: 1024,
+			}},
+			want: []byte{0x10, 27, 0, 4, 'M', 'Q', 'T', 'T', 5, 0, 0, 30, 13, propSessionExpiry, 0, 0, 0, 60,
+				propReceiveMaximum, 0, 10, propMaximumPacketSize, 0, 0, 4, 0, 0, 1, 'c'},
+		},
+	}
+	for _, test := range tests {
+		if got := test.packet.encode(); !bytes.Equal(got, test.want) {
+			t.Errorf("%v: encode() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSubscribeEncode(t *testing.T) {
+	filters := sortedFilters(map[string]byte{"b/#": 2, "a": 1})
+	tests := []struct {
+		name   string
+		level  byte
+		packet subscribePacket
+		want   []byte
+	}{
+		{
+			name:   "3.1.1",
+			level:  4,
+			packet: subscribePacket{id: 7, filters: filters},
+			want:   []byte{0x82, 12, 0, 7, 0, 1, 'a', 1, 0, 3, 'b', '/', '#', 2},
+		},
+		{
+			name:   "5.0",
+			level:  5,
+			packet: subscribePacket{id: 7, filters: filters},
+			want:   []byte{0x82, 13, 0, 7, 0, 0, 1, 'a', 1, 0, 3, 'b', '/', '#', 2},
+		},
+		{
+			name:  "5.0 with options",
+			level: 5,
+			packet: subscribePacket{id: 7, filters: filters, options: SubscriptionOptions{
+				NoLocal: true, RetainAsPublished: true, RetainHandling: 2, SubscriptionID: 300,
+			}},
+			want: []byte{0x82, 16, 0, 7, 3, propSubscriptionID, 0xAC, 0x02, 0, 1, 'a', 0x2D, 0, 3, 'b', '/', '#', 0x2E},
+		},
+	}
+	for _, test := range tests {
+		if got := test.packet.encode(test.level); !bytes.Equal(got, test.want) {
+			t.Errorf("%v: encode() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	payload := bytes.Repeat([]byte{'x'}, 200)
+	packet := encodePublish(4, "t", 1, true, 9, payload)
+	// a remaining length of 205 takes two bytes
+	if packet[1] != 0xCD || packet[2] != 0x01 {
+		t.Fatalf("remaining length %v, want [205 1]", packet[1:3])
+	}
+	first, body, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := decodePublish(4, first, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.topic != "t" || p.qos != 1 || !p.retained || p.id != 9 || !bytes.Equal(p.payload, payload) {
+		t.Errorf("decodePublish() = %+v", p)
+	}
+	if p.size != int64(len(packet)) {
+		t.Errorf("size = %d, want %d", p.size, len(packet))
+	}
+
+	_, _, err = readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xFF, 0xFF, 0xFF, 0xFF, 0x01})))
+	if err == nil {
+		t.Error("expected an error for a remaining length of five bytes")
+	}
+	_, _, err = readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 5, 0, 1})))
+	if err == nil {
+		t.Error("expected an error for a truncated packet")
+	}
+}
+
+func TestDecodePublish(t *testing.T) {
+	var props bytes.Buffer
+	props.Write([]byte{propMessageExpiry, 0, 0, 0, 42, propTopicAlias, 0, 3, propContentType, 0, 1, 'j'})
+	props.WriteByte(propUserProperty)
+	writeString(&props, "env")
+	writeString(&props, "ci")
+	var body bytes.Buffer
+	writeString(&body, "a/b")
+	writeInt16(&body, 5)
+	body.Write(appendVariableInt(nil, props.Len()))
+	body.Write(props.Bytes())
+	body.WriteString("{}")
+
+	p, err := decodePublish(5, packetPublish<<4|0x0C, body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.topic != "a/b" || p.qos != 2 || !p.duplicate || p.id != 5 || string(p.payload) != "{}" {
+		t.Errorf("decodePublish() = %+v", p)
+	}
+	if !p.properties.hasMessageExpiry || p.properties.messageExpiry != 42 || p.properties.topicAlias != 3 {
+		t.Errorf("properties = %+v", p.properties)
+	}
+	if want := []UserProperty{{Key: "env", Value: "ci"}}; !reflect.DeepEqual(p.properties.userProperties, want) {
+		t.Errorf("user properties = %v, want %v", p.properties.userProperties, want)
+	}
+
+	if _, err := decodePublish(5, packetPublish<<4, []byte{0, 1, 't', 2, 0x7F, 0}); err == nil {
+		t.Error("expected an error for an unknown property")
+	}
+	if _, err := decodePublish(4, packetPublish<<4|0x06, []byte{0, 1, 't'}); err == nil {
+		t.Error("expected an error for QoS 3")
+	}
+}
+
+func TestDecodeAcks(t *testing.T) {
+	connAck, err := decodeConnAck(5, []byte{1, 0, 6, propServerKeepAlive, 0, 10, propReceiveMaximum, 0, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !connAck.sessionPresent || connAck.properties.serverKeepAlive != 10 || connAck.properties.receiveMaximum != 5 {
+		t.Errorf("decodeConnAck() = %+v %+v", connAck, connAck.properties)
+	}
+	if err := connAck.err(5); err != nil {
+		t.Errorf("err() = %v", err)
+	}
+	refused, _ := decodeConnAck(5, []byte{0, 0x86, 4, propReasonString, 0, 1, 'x'})
+	if err := refused.err(5); err == nil || !strings.Contains(err.Error(), "bad user name or password: x") {
+		t.Errorf("err() = %v", err)
+	}
+	refused, _ = decodeConnAck(4, []byte{0, 5})
+	if err := refused.err(4); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("err() = %v", err)
+	}
+
+	id, codes, _, err := decodeSubAck(5, []byte{0, 7, 0, 1, 0x87})
+	if err != nil || id != 7 || !bytes.Equal(codes, []byte{1, 0x87}) {
+		t.Errorf("decodeSubAck() = %d, %v, %v", id, codes, err)
+	}
+	id, code, err := decodeAck(5, []byte{0, 9, 0x10})
+	if err != nil || id != 9 || code != 0x10 {
+		t.Errorf("decodeAck() = %d, %d, %v", id, code, err)
+	}
+	id, code, err = decodeAck(4, []byte{0, 9})
+	if err != nil || id != 9 || code != 0 {
+		t.Errorf("decodeAck() = %d, %d, %v", id, code, err)
+	}
+	if err := decodeDisconnect([]byte{0x8E}); err == nil || !strings.Contains(err.Error(), "session taken over") {
+		t.Errorf("decodeDisconnect() = %v", err)
+	}
+}
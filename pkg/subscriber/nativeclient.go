@@ -0,0 +1,653 @@
+package subscriber
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"golang.org/x/net/proxy"
+	"golang.org/x/net/websocket"
+)
+
+// errConnectionLost completes the requests still waiting for the broker when the connection is lost
+var errConnectionLost = errors.New("connection lost before the broker acknowledged")
+
+// nativeClient is an MQTT 3.1, 3.1.1 and 5.0 client implementing the paho Client interface from paho's
+// ClientOptions, so the clients use it like a paho client. It keeps a single goroutine per connection, which
+// reads the packets of the broker and calls the message handlers; the packets are written by the goroutine
+// sending them and the keep alive runs on a timer. The MQTT 5.0 properties of its CONNECT are properties, it
+// subscribes with the options subscription.
+type nativeClient struct {
+	opts         *mqtt.ClientOptions
+	level        byte
+	properties   mqttProperties
+	subscription SubscriptionOptions
+	window       *receiveWindow // follows the Receive Maximum of properties, nil if not measured
+
+	writeMu  sync.Mutex // serializes the writes to the connection
+	lastSent int64      // unix nanoseconds of the last packet written, for the keep alive
+
+	mu        sync.Mutex // guards the fields below
+	conn      net.Conn   // nil while not connected
+	connAck   *connAckPacket
+	keepAlive time.Duration
+	pinger    *time.Timer
+	nextID    uint16
+	pending   map[uint16]*nativeToken // by packet identifier, waiting for the acknowledgement of the broker
+	routes    map[string]mqtt.MessageHandler
+	stopped   bool
+	stop      chan struct{} // closed by Disconnect, ends the reconnects
+}
+
+var _ mqtt.Client = (*nativeClient)(nil)
+
+// newNativeClient returns a client connecting with opts, protocol level 0 is MQTT 3.1.1
+func newNativeClient(opts *mqtt.ClientOptions, properties mqttProperties, subscription SubscriptionOptions) *nativeClient {
+	level := byte(opts.ProtocolVersion)
+	if level == 0 {
+		level = 4
+	}
+
+	return &nativeClient{
+		opts:         opts,
+		level:        level,
+		properties:   properties,
+		subscription: subscription,
+		routes:       make(map[string]mqtt.MessageHandler),
+		stop:         make(chan struct{}),
+	}
+}
+
+func (n *nativeClient) IsConnected() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.conn != nil
+}
+
+func (n *nativeClient) IsConnectionOpen() bool {
+	return n.IsConnected()
+}
+
+// connAckProperties returns the MQTT 5.0 properties of the CONNACK of the last connection
+func (n *nativeClient) connAckProperties() *mqttProperties {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.connAck == nil {
+		return new(mqttProperties)
+	}
+
+	return n.connAck.properties
+}
+
+// Connect connects to the first of the brokers that accepts the connection, the returned token is complete
+func (n *nativeClient) Connect() mqtt.Token {
+	t := newNativeToken()
+	t.complete(n.open())
+
+	return t
+}
+
+// Disconnect sends a DISCONNECT and closes the connection, the client does not reconnect. The writes are
+// synchronous, so there is no work in progress to wait quiesce milliseconds for.
+func (n *nativeClient) Disconnect(quiesce uint) {
+	n.mu.Lock()
+	if !n.stopped {
+		n.stopped = true
+		close(n.stop)
+	}
+	conn := n.conn
+	n.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	n.write(conn, []byte{packetDisconnect << 4, 0})
+	n.drop(conn)
+}
+
+func (n *nativeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	t := newNativeToken()
+	var data []byte
+	switch p := payload.(type) {
+	case []byte:
+		data = p
+	case string:
+		data = []byte(p)
+	default:
+		t.complete(fmt.Errorf("unsupported payload type %T", payload))
+		return t
+	}
+	if qos > 0 {
+		return n.request(t, func(id uint16) []byte {
+			return encodePublish(n.level, topic, qos, retained, id, data)
+		})
+	}
+	conn := n.connection()
+	if conn == nil {
+		t.complete(mqtt.ErrNotConnected)
+		return t
+	}
+	t.complete(n.write(conn, encodePublish(n.level, topic, 0, retained, 0, data)))
+
+	return t
+}
+
+func (n *nativeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return n.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+// SubscribeMultiple subscribes to the topic filters, the messages matching them are handled by callback or,
+// if nil, by the default handler
+func (n *nativeClient) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	if callback != nil {
+		for topic := range filters {
+			n.AddRoute(topic, callback)
+		}
+	}
+	t := newNativeToken()
+	t.filters = sortedFilters(filters)
+
+	return n.request(t, func(id uint16) []byte {
+		return (&subscribePacket{id: id, filters: t.filters, options: n.subscription}).encode(n.level)
+	})
+}
+
+func (n *nativeClient) Unsubscribe(topics ...string) mqtt.Token {
+	n.mu.Lock()
+	for _, topic := range topics {
+		delete(n.routes, topic)
+	}
+	n.mu.Unlock()
+
+	return n.request(newNativeToken(), func(id uint16) []byte {
+		return encodeUnsubscribe(n.level, id, topics)
+	})
+}
+
+func (n *nativeClient) AddRoute(topic string, callback mqtt.MessageHandler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.routes[topic] = callback
+}
+
+// OptionsReader is not supported, paho's ClientOptionsReader can't be created outside paho
+func (n *nativeClient) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.ClientOptionsReader{}
+}
+
+// open connects to the first of the brokers that accepts the connection and starts reading from it
+func (n *nativeClient) open() error {
+	err := errors.New("no broker to connect to")
+	for _, broker := range n.opts.Servers {
+		var conn net.Conn
+		if conn, err = dialBroker(broker, n.opts.TLSConfig, n.opts.ConnectTimeout); err != nil {
+			continue
+		}
+		reader := bufio.NewReader(conn)
+		var connAck *connAckPacket
+		if connAck, err = n.handshake(conn, reader); err != nil {
+			conn.Close()
+			continue
+		}
+		keepAlive := time.Duration(n.opts.KeepAlive) * time.Second
+		if connAck.properties.hasServerKeepAlive {
+			keepAlive = time.Duration(connAck.properties.serverKeepAlive) * time.Second
+		}
+
+		n.mu.Lock()
+		if n.stopped {
+			n.mu.Unlock()
+			conn.Close()
+			return errors.New("the client was disconnected while connecting")
+		}
+		n.conn = conn
+		n.connAck = connAck
+		n.pending = make(map[uint16]*nativeToken)
+		n.keepAlive = keepAlive
+		if keepAlive > 0 {
+			n.pinger = time.AfterFunc(keepAlive, func() {
+				n.ping(conn)
+			})
+		}
+		n.mu.Unlock()
+
+		go n.read(conn, reader)
+		if n.opts.OnConnect != nil {
+			// like paho, the handler may wait for the broker, which needs the reader
+			go n.opts.OnConnect(n)
+		}
+		return nil
+	}
+
+	return err
+}
+
+// handshake sends the CONNECT and reads the CONNACK, within the connect timeout
+func (n *nativeClient) handshake(conn net.Conn, reader *bufio.Reader) (*connAckPacket, error) {
+	if n.opts.ConnectTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(n.opts.ConnectTimeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	connect := &connectPacket{
+		level:        n.level,
+		clientID:     n.opts.ClientID,
+		username:     n.opts.Username,
+		password:     n.opts.Password,
+		cleanSession: n.opts.CleanSession,
+		keepAlive:    uint16(n.opts.KeepAlive),
+		properties:   n.properties,
+	}
+	if err := n.write(conn, connect.encode()); err != nil {
+		return nil, err
+	}
+	first, body, err := readPacket(reader)
+	if err != nil {
+		return nil, err
+	}
+	if first>>4 != packetConnAck {
+		return nil, fmt.Errorf("expected a CONNACK, the broker sent packet type %d", first>>4)
+	}
+	connAck, err := decodeConnAck(n.level, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return connAck, connAck.err(n.level)
+}
+
+// read handles the packets of the broker until the connection is lost or closed
+func (n *nativeClient) read(conn net.Conn, reader *bufio.Reader) {
+	aliases := make(map[uint16]string) // topic aliases of the broker, they are valid for the connection
+	for {
+		first, body, err := readPacket(reader)
+		if err == nil {
+			err = n.handle(conn, first, body, aliases)
+		}
+		if err != nil {
+			n.lost(conn, err)
+			return
+		}
+	}
+}
+
+func (n *nativeClient) handle(conn net.Conn, first byte, body []byte, aliases map[uint16]string) error {
+	switch first >> 4 {
+	case packetPublish:
+		p, err := decodePublish(n.level, first, body)
+		if err != nil {
+			return err
+		}
+		if alias := p.properties.topicAlias; alias > 0 {
+			if p.topic != "" {
+				aliases[alias] = p.topic
+			} else if p.topic = aliases[alias]; p.topic == "" {
+				return fmt.Errorf("the broker sent the unknown topic alias %d", alias)
+			}
+		}
+		n.deliver(conn, p)
+	case packetPubAck, packetPubComp:
+		id, code, err := decodeAck(n.level, body)
+		if err != nil {
+			return err
+		}
+		n.complete(id, ackError(code), nil)
+	case packetPubRec:
+		id, code, err := decodeAck(n.level, body)
+		if err != nil {
+			return err
+		}
+		if code >= 0x80 {
+			n.complete(id, ackError(code), nil)
+			return nil
+		}
+		return n.write(conn, encodeAck(packetPubRel, id))
+	case packetPubRel:
+		id, _, err := decodeAck(n.level, body)
+		if err != nil {
+			return err
+		}
+		// the PUBCOMP completes a QoS 2 delivery and frees its slot of the receive window
+		n.window.acknowledged()
+		return n.write(conn, encodeAck(packetPubComp, id))
+	case packetSubAck, packetUnsubAck:
+		// an UNSUBACK has reason codes with MQTT 5.0 only, they are not checked, like the empty one of 3.1.1
+		id, codes, _, err := decodeSubAck(n.level, body)
+		if err != nil {
+			return err
+		}
+		n.complete(id, nil, codes)
+	case packetPingResp:
+		conn.SetReadDeadline(time.Time{})
+	case packetDisconnect:
+		if n.level == 5 {
+			return decodeDisconnect(body)
+		}
+		return errors.New("the broker sent a DISCONNECT")
+	default:
+		return fmt.Errorf("unexpected packet type %d", first>>4)
+	}
+
+	return nil
+}
+
+// deliver hands a received message to the handlers of the routes matching its topic, or else to the default
+// handler, and acknowledges it once they returned, like paho. Without Order every message is handled in a
+// goroutine of its own.
+func (n *nativeClient) deliver(conn net.Conn, p *publishPacket) {
+	if p.qos > 0 {
+		n.window.received()
+	}
+	handle := func() {
+		for _, handler := range n.handlers(p.topic) {
+			handler(n, p)
+		}
+		switch p.qos {
+		case 1:
+			// freed before the write, the broker may use the slot as soon as it reads the PUBACK
+			n.window.acknowledged()
+			n.write(conn, encodeAck(packetPubAck, p.id))
+		case 2:
+			n.write(conn, encodeAck(packetPubRec, p.id))
+		}
+	}
+	if n.opts.Order {
+		handle()
+	} else {
+		go handle()
+	}
+}
+
+func (n *nativeClient) handlers(topic string) []mqtt.MessageHandler {
+	var handlers []mqtt.MessageHandler
+	n.mu.Lock()
+	for filter, handler := range n.routes {
+		if topicMatches(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	n.mu.Unlock()
+	if len(handlers) == 0 && n.opts.DefaultPublishHandler != nil {
+		handlers = append(handlers, n.opts.DefaultPublishHandler)
+	}
+
+	return handlers
+}
+
+// request sends a packet the broker acknowledges, encode returns it for its packet identifier and t completes
+// with the acknowledgement
+func (n *nativeClient) request(t *nativeToken, encode func(id uint16) []byte) mqtt.Token {
+	n.mu.Lock()
+	conn := n.conn
+	if conn == nil {
+		n.mu.Unlock()
+		t.complete(mqtt.ErrNotConnected)
+		return t
+	}
+	for n.nextID++; n.nextID == 0 || n.pending[n.nextID] != nil; n.nextID++ {
+	}
+	id := n.nextID
+	n.pending[id] = t
+	n.mu.Unlock()
+	if err := n.write(conn, encode(id)); err != nil {
+		n.complete(id, err, nil)
+	}
+
+	return t
+}
+
+// complete completes the request of packet identifier id, unless the connection was lost meanwhile
+func (n *nativeClient) complete(id uint16, err error, codes []byte) {
+	n.mu.Lock()
+	t := n.pending[id]
+	delete(n.pending, id)
+	n.mu.Unlock()
+	if t != nil {
+		t.codes = codes
+		t.complete(err)
+	}
+}
+
+// ackError returns the error of an MQTT 5.0 reason code of an acknowledgement, nil for a success
+func ackError(code byte) error {
+	if code < 0x80 {
+		return nil
+	}
+
+	return fmt.Errorf("the broker refused with reason code 0x%02x (%v)", code, reasonCodeText(code))
+}
+
+func (n *nativeClient) connection() net.Conn {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.conn
+}
+
+// write writes a packet to conn, a failed write closes the connection so the reader reports it lost
+func (n *nativeClient) write(conn net.Conn, packet []byte) error {
+	n.writeMu.Lock()
+	defer n.writeMu.Unlock()
+	if n.opts.WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(n.opts.WriteTimeout))
+	}
+	if _, err := conn.Write(packet); err != nil {
+		conn.Close()
+		return err
+	}
+	atomic.StoreInt64(&n.lastSent, time.Now().UnixNano())
+
+	return nil
+}
+
+// ping sends a PINGREQ once nothing was sent for the keep alive interval, the broker has to answer it within
+// the ping timeout or the connection is lost, like with paho
+func (n *nativeClient) ping(conn net.Conn) {
+	n.mu.Lock()
+	if n.conn != conn {
+		n.mu.Unlock()
+		return
+	}
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&n.lastSent)))
+	if idle < n.keepAlive {
+		n.pinger.Reset(n.keepAlive - idle)
+		n.mu.Unlock()
+		return
+	}
+	n.pinger.Reset(n.keepAlive)
+	n.mu.Unlock()
+	if n.opts.PingTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(n.opts.PingTimeout))
+	}
+	n.write(conn, []byte{packetPingReq << 4, 0})
+}
+
+// lost cleans up after the connection was lost and, unless Disconnect closed it, calls OnConnectionLost and
+// reconnects if AutoReconnect is set, like paho
+func (n *nativeClient) lost(conn net.Conn, err error) {
+	if !n.drop(conn) {
+		return
+	}
+	if n.opts.OnConnectionLost != nil {
+		n.opts.OnConnectionLost(n, err)
+	}
+	if n.opts.AutoReconnect {
+		n.reconnect()
+	}
+}
+
+// drop closes conn and fails the requests waiting for the broker, it returns whether conn was the connection
+// of a client that was not disconnected
+func (n *nativeClient) drop(conn net.Conn) bool {
+	n.mu.Lock()
+	current := n.conn == conn
+	var pending map[uint16]*nativeToken
+	if current {
+		n.conn = nil
+		if n.pinger != nil {
+			n.pinger.Stop()
+		}
+		pending, n.pending = n.pending, nil
+		n.window.reset()
+	}
+	stopped := n.stopped
+	n.mu.Unlock()
+	conn.Close()
+	for _, t := range pending {
+		t.complete(errConnectionLost)
+	}
+
+	return current && !stopped
+}
+
+// reconnect connects again until connected or disconnected, with a backoff from a second doubling up to the
+// maximum reconnect interval like paho
+func (n *nativeClient) reconnect() {
+	backoff := time.Second
+	for {
+		select {
+		case <-n.stop:
+			return
+		default:
+		}
+		if n.open() == nil {
+			return
+		}
+		select {
+		case <-n.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > n.opts.MaxReconnectInterval {
+			backoff = n.opts.MaxReconnectInterval
+		}
+	}
+}
+
+// dialBroker opens the connection to a broker like paho: tcp and ssl connections go through the proxy of the
+// environment if there is one, which is how the Dialer establishes them
+func dialBroker(broker *url.URL, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
+	switch broker.Scheme {
+	case "ws", "wss":
+		origin := "http://" + broker.Host
+		if broker.Scheme == "wss" {
+			origin = "https://" + broker.Host
+		}
+		config, err := websocket.NewConfig(broker.String(), origin)
+		if err != nil {
+			return nil, err
+		}
+		config.Protocol = []string{"mqtt"}
+		config.TlsConfig = tlsConfig
+		config.Dialer = &net.Dialer{Timeout: timeout}
+		conn, err := websocket.DialConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		conn.PayloadType = websocket.BinaryFrame
+		return conn, nil
+	case "unix":
+		return net.DialTimeout("unix", broker.Host, timeout)
+	case "tcp", "ssl", "tls", "tcps":
+		var conn net.Conn
+		var err error
+		if os.Getenv("all_proxy") == "" {
+			conn, err = net.DialTimeout("tcp", broker.Host, timeout)
+		} else {
+			conn, err = proxy.FromEnvironment().Dial("tcp", broker.Host)
+		}
+		if err != nil || broker.Scheme == "tcp" {
+			return conn, err
+		}
+		if tlsConfig == nil {
+			tlsConfig = new(tls.Config)
+		}
+		if tlsConfig.ServerName == "" && !tlsConfig.InsecureSkipVerify {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = broker.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %v", broker.Scheme)
+	}
+}
+
+// nativeToken is the token of a request of a nativeClient, for a SUBSCRIBE it holds the codes of the SUBACK
+type nativeToken struct {
+	done    chan struct{}
+	err     error
+	filters []Subscription
+	codes   []byte
+}
+
+func newNativeToken() *nativeToken {
+	return &nativeToken{done: make(chan struct{})}
+}
+
+func (t *nativeToken) complete(err error) {
+	t.err = err
+	close(t.done)
+}
+
+func (t *nativeToken) Wait() bool {
+	<-t.done
+
+	return true
+}
+
+func (t *nativeToken) WaitTimeout(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-t.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (t *nativeToken) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// Result returns the code of the SUBACK by topic filter like paho's SubscribeToken: the granted QoS, or 0x80
+// or above if the broker refused the subscription
+func (t *nativeToken) Result() map[string]byte {
+	result := make(map[string]byte, len(t.filters))
+	for i, filter := range t.filters {
+		if i < len(t.codes) {
+			result[filter.Topic] = t.codes[i]
+		}
+	}
+
+	return result
+}
+
+var _ mqtt.Message = (*publishPacket)(nil)
+
+func (p *publishPacket) Duplicate() bool   { return p.duplicate }
+func (p *publishPacket) Qos() byte         { return p.qos }
+func (p *publishPacket) Retained() bool    { return p.retained }
+func (p *publishPacket) Topic() string     { return p.topic }
+func (p *publishPacket) MessageID() uint16 { return p.id }
+func (p *publishPacket) Payload() []byte   { return p.payload }
+
+// Ack does nothing, the client acknowledges the message once its handlers returned
+func (p *publishPacket) Ack() {}
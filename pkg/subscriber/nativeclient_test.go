@@ -0,0 +1,105 @@
+package subscriber
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestNativeClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	acked := make(chan uint16, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			first, body, err := readPacket(reader)
+			if err != nil {
+				return
+			}
+			switch first >> 4 {
+			case packetConnect:
+				conn.Write([]byte{packetConnAck << 4, 3, 0, 0, 0})
+			case packetSubscribe:
+				conn.Write([]byte{packetSubAck << 4, 4, body[0], body[1], 0, 1})
+				// the second message only has the topic alias of the first
+				var props bytes.Buffer
+				props.Write([]byte{propTopicAlias, 0, 1, propUserProperty})
+				writeString(&props, "k")
+				writeString(&props, "v")
+				for i, topic := range []string{"a/b", ""} {
+					var publish bytes.Buffer
+					writeString(&publish, topic)
+					writeInt16(&publish, int16(i+1))
+					publish.Write(appendVariableInt(nil, props.Len()))
+					publish.Write(props.Bytes())
+					publish.WriteString("{}")
+					conn.Write(mqttPacket(packetPublish<<4|0x02, publish.Bytes()))
+				}
+			case packetPubAck:
+				acked <- uint16(body[0])<<8 | uint16(body[1])
+			case packetDisconnect:
+				return
+			}
+		}
+	}()
+
+	opts := mqtt.NewClientOptions().AddBroker("tcp://" + listener.Addr().String()).SetClientID("test")
+	opts.ProtocolVersion = 5
+	client := newNativeClient(opts, mqttProperties{}, SubscriptionOptions{})
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	defer client.Disconnect(0)
+	received := make(chan mqtt.Message)
+	handled := make(chan struct{})
+	token := client.Subscribe("a/#", 1, func(_ mqtt.Client, msg mqtt.Message) {
+		received <- msg
+		<-handled
+	})
+	if !token.WaitTimeout(time.Second) || token.Error() != nil {
+		t.Fatalf("subscribe: %v", token.Error())
+	}
+	if result := token.(*nativeToken).Result(); result["a/#"] != 1 {
+		t.Errorf("Result() = %v, want QoS 1 for a/#", result)
+	}
+	for i := uint16(1); i <= 2; i++ {
+		select {
+		case msg := <-received:
+			p := msg.(*publishPacket)
+			if p.Topic() != "a/b" || p.MessageID() != i || len(p.properties.userProperties) != 1 {
+				t.Errorf("message %d: topic %q, id %d, user properties %v", i, p.Topic(), p.MessageID(),
+					p.properties.userProperties)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("message %d not received", i)
+		}
+		// acknowledged once the handler returned
+		select {
+		case id := <-acked:
+			t.Errorf("message %d acknowledged before it was handled", id)
+		case <-time.After(10 * time.Millisecond):
+		}
+		handled <- struct{}{}
+		select {
+		case id := <-acked:
+			if id != i {
+				t.Errorf("acknowledged %d, want %d", id, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("message %d not acknowledged", i)
+		}
+	}
+}
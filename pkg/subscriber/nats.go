@@ -0,0 +1,194 @@
+package subscriber
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsMaxPayload bounds the size of a message read from the server, the largest max_payload a NATS server
+// accepts. Larger (or negative) sizes are refused rather than allocated.
+const natsMaxPayload = 64 << 20
+
+// natsSource subscribes to a NATS server with the NATS client protocol, a line based text protocol
+type natsSource struct {
+	address  string
+	name     string
+	user     string
+	password string
+	token    string
+	timeout  time.Duration
+
+	mu     sync.Mutex // serializes the writes
+	conn   net.Conn
+	closed chan struct{}
+}
+
+func newNATSSource(u *url.URL, name string, timeout time.Duration) *natsSource {
+	s := &natsSource{address: hostPort(u, "4222"), name: name, timeout: timeout, closed: make(chan struct{})}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			s.user, s.password = u.User.Username(), password
+		} else {
+			s.token = u.User.Username()
+		}
+	}
+
+	return s
+}
+
+// natsSubject returns the NATS subject of an MQTT topic filter: levels are separated by dots instead of
+// slashes and the wildcards are * and > instead of + and #, e.g. /bench/+/data is bench.*.data
+func natsSubject(topic string) string {
+	levels := strings.Split(strings.TrimPrefix(topic, "/"), "/")
+	for i, level := range levels {
+		switch level {
+		case "+":
+			levels[i] = "*"
+		case "#":
+			levels[i] = ">"
+		}
+	}
+
+	return strings.Join(levels, ".")
+}
+
+// Subscribe connects, subscribes to the subject of topic and then reads the messages in its own goroutine
+func (s *natsSource) Subscribe(topic string, handle func(topic string, payload []byte), lost func(err error)) error {
+	conn, err := net.DialTimeout("tcp", s.address, s.timeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	reader := bufio.NewReader(conn)
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+	// the server starts with an INFO line
+	line, err := readLine(reader)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("%v is no NATS server, it sent %q", s.address, line)
+	}
+	connect, _ := json.Marshal(map[string]interface{}{
+		"verbose":    false,
+		"pedantic":   false,
+		"name":       s.name,
+		"lang":       "go",
+		"version":    toolVersion(),
+		"protocol":   1,
+		"user":       s.user,
+		"pass":       s.password,
+		"auth_token": s.token,
+	})
+	// the PONG confirms the server accepted the CONNECT and the SUB
+	subject := natsSubject(topic)
+	if err := s.write("CONNECT " + string(connect) + "\r\nSUB " + subject + " 1\r\nPING\r\n"); err != nil {
+		conn.Close()
+		return err
+	}
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return fmt.Errorf("NATS server: %v", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		if line == "PONG" {
+			break
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	go s.read(reader, handle, lost)
+
+	return nil
+}
+
+// read handles the messages and answers the PINGs of the server until the connection is closed
+func (s *natsSource) read(reader *bufio.Reader, handle func(topic string, payload []byte), lost func(err error)) {
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			s.lost(lost, err)
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				s.lost(lost, fmt.Errorf("invalid message %q", line))
+				return
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 || size > natsMaxPayload {
+				s.lost(lost, fmt.Errorf("invalid message %q", line))
+				return
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				s.lost(lost, err)
+				return
+			}
+			handle(fields[1], payload[:size])
+		case line == "PING":
+			if err := s.write("PONG\r\n"); err != nil {
+				s.lost(lost, err)
+				return
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			logf(levelWarn, "NATS server %v: %v", s.address, strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// lost reports why the connection was lost, unless it was closed
+func (s *natsSource) lost(lost func(err error), err error) {
+	select {
+	case <-s.closed:
+	default:
+		lost(err)
+	}
+}
+
+func (s *natsSource) write(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.conn, data)
+
+	return err
+}
+
+func (s *natsSource) Close() error {
+	close(s.closed)
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
+
+// readLine reads a line terminated by CRLF, without it
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
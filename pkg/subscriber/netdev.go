@@ -0,0 +1,69 @@
+package subscriber
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// InterfaceCounters holds the receive counters of a single network interface
+type InterfaceCounters struct {
+	RxBytes   uint64
+	RxPackets uint64
+}
+
+// readInterfaceCounters reads the RX counters of the given interface from /proc/net/dev (Linux only)
+func readInterfaceCounters(iface string) (*InterfaceCounters, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		sep := strings.Index(line, ":")
+		if sep < 0 || strings.TrimSpace(line[:sep]) != iface {
+			continue
+		}
+		// receive columns: bytes packets errs drop fifo frame compressed multicast
+		fields := strings.Fields(line[sep+1:])
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("unexpected /proc/net/dev format for interface %v", iface)
+		}
+		rxBytes, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		rxPackets, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &InterfaceCounters{RxBytes: rxBytes, RxPackets: rxPackets}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("interface %v not found", iface)
+}
+
+// calculateInterfaceResults computes the counter deltas over the run
+func calculateInterfaceResults(iface string, before, after *InterfaceCounters, runTime float64) *results.InterfaceResults {
+	res := &results.InterfaceResults{
+		Name:      iface,
+		RxBytes:   after.RxBytes - before.RxBytes,
+		RxPackets: after.RxPackets - before.RxPackets,
+	}
+	if runTime > 0 {
+		res.RxBytesPerSec = float64(res.RxBytes) / runTime
+		res.RxPacketsPerSec = float64(res.RxPackets) / runTime
+	}
+
+	return res
+}
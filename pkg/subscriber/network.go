@@ -0,0 +1,132 @@
+package subscriber
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// dialNetwork returns the network clients dial for the -network flag, "" lets paho choose (tcp)
+func dialNetwork(network string) (string, error) {
+	switch network {
+	case "auto":
+		return "", nil
+	case "tcp4", "tcp6":
+		return network, nil
+	default:
+		return "", fmt.Errorf("invalid network %v, expected tcp4, tcp6 or auto", network)
+	}
+}
+
+// addressFamily returns ipv4 or ipv6 for a TCP address, empty for other addresses
+func addressFamily(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	if tcp.IP.To4() != nil {
+		return "ipv4"
+	}
+
+	return "ipv6"
+}
+
+// filterAddresses returns the addresses (ip:port) of the family of network, all addresses for tcp
+func filterAddresses(network string, addresses []string) []string {
+	if network != "tcp4" && network != "tcp6" {
+		return addresses
+	}
+	var filtered []string
+	for _, address := range addresses {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(host)
+		// host names are left to the dial to resolve for the network
+		if ip == nil || (ip.To4() != nil) == (network == "tcp4") {
+			filtered = append(filtered, address)
+		}
+	}
+
+	return filtered
+}
+
+// parseSourceAddresses parses a comma separated list of local IP addresses and interface names, an interface
+// contributes all its unicast addresses
+func parseSourceAddresses(list string) ([]*net.TCPAddr, error) {
+	var sources []*net.TCPAddr
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if ip := net.ParseIP(item); ip != nil {
+			sources = append(sources, &net.TCPAddr{IP: ip})
+			continue
+		}
+		iface, err := net.InterfaceByName(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source address %v, expected an IP address or interface name", item)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		n := len(sources)
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				sources = append(sources, &net.TCPAddr{IP: ipNet.IP})
+			}
+		}
+		if len(sources) == n {
+			return nil, fmt.Errorf("interface %v has no usable address", item)
+		}
+	}
+
+	return sources, nil
+}
+
+// SourceAddress returns the local IP address of the client's last connection, empty if it did not connect
+func (cc *ClientConn) SourceAddress() string {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.tcp == nil {
+		return ""
+	}
+	if local, ok := cc.tcp.LocalAddr().(*net.TCPAddr); ok {
+		return local.IP.String()
+	}
+
+	return ""
+}
+
+// AddressFamily returns the address family (ipv4 or ipv6) of the client's last connection, empty if it did
+// not connect
+func (cc *ClientConn) AddressFamily() string {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.tcp == nil {
+		return ""
+	}
+
+	return addressFamily(cc.tcp.RemoteAddr())
+}
+
+// calculateAddressFamilies counts the clients per address family
+func calculateAddressFamilies(runs []*results.RunResults) map[string]int {
+	var families map[string]int
+	for _, res := range runs {
+		if res.AddressFamily == "" {
+			continue
+		}
+		if families == nil {
+			families = make(map[string]int)
+		}
+		families[res.AddressFamily]++
+	}
+
+	return families
+}
@@ -0,0 +1,158 @@
+package subscriber
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// brokerRange pins the clients with IDs in [From, To] to a broker node
+type brokerRange struct {
+	From   int
+	To     int
+	Broker string
+}
+
+// parseBrokerMap parses a comma separated list of <from>-<to>=<broker url> entries, the ranges must not overlap
+func parseBrokerMap(s string) ([]brokerRange, error) {
+	var ranges []brokerRange
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		from, to, broker, err := parseRangeEntry(entry, "broker map")
+		if err != nil {
+			return nil, err
+		}
+		// a client is pinned to a single broker
+		for _, r := range ranges {
+			if from <= r.To && to >= r.From {
+				return nil, fmt.Errorf("broker map entry %q overlaps the clients %d-%d of an earlier entry", entry, r.From, r.To)
+			}
+		}
+		ranges = append(ranges, brokerRange{From: from, To: to, Broker: broker})
+	}
+
+	return ranges, nil
+}
+
+// parseRangeEntry parses a <from>-<to>=<value> (or <index>=<value>) entry of a client range list
+func parseRangeEntry(entry string, list string) (int, int, string, error) {
+	sep := strings.Index(entry, "=")
+	if sep < 0 {
+		return 0, 0, "", fmt.Errorf("missing '=' in %s entry %q", list, entry)
+	}
+	bounds := strings.SplitN(entry[:sep], "-", 2)
+	from, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid client index in %s entry %q", list, entry)
+	}
+	to := from
+	if len(bounds) == 2 {
+		to, err = strconv.Atoi(bounds[1])
+		if err != nil {
+			return 0, 0, "", fmt.Errorf("invalid client index in %s entry %q", list, entry)
+		}
+	}
+	if from < 0 || to < from {
+		return 0, 0, "", fmt.Errorf("invalid client range in %s entry %q", list, entry)
+	}
+
+	return from, to, entry[sep+1:], nil
+}
+
+// brokerFor returns the broker client id is pinned to, or one of the default brokers round-robin
+func brokerFor(ranges []brokerRange, id int, defaultBrokers []string) string {
+	for _, r := range ranges {
+		if id >= r.From && id <= r.To {
+			return r.Broker
+		}
+	}
+
+	return defaultBrokers[id%len(defaultBrokers)]
+}
+
+// parseBrokers parses the comma separated broker URLs of -broker
+func parseBrokers(s string) ([]string, error) {
+	var brokers []string
+	for _, broker := range strings.Split(s, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("broker should be at least one broker URL, given: %q", s)
+	}
+
+	return brokers, nil
+}
+
+// resolveBrokers replaces the brokers with a host name by a broker per address of the host, so the clients are
+// distributed over all nodes behind a DNS round-robin name. It returns the server name to verify the
+// certificates of the nodes against: tlsServer if set, else the host name of the TLS brokers it resolved, which
+// should then all have the same host name.
+func resolveBrokers(brokers []string, tlsServer string) ([]string, string, error) {
+	var resolved []string
+	tlsHost := tlsServer
+	for _, broker := range brokers {
+		u, err := url.Parse(broker)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid broker %v: %v", broker, err)
+		}
+		if net.ParseIP(u.Hostname()) != nil {
+			resolved = append(resolved, broker)
+			continue
+		}
+		addresses, err := lookupAddresses(u.Host)
+		if err != nil {
+			return nil, "", fmt.Errorf("resolving broker %v: %v", broker, err)
+		}
+		if u.Scheme == "ssl" || u.Scheme == "tls" || u.Scheme == "tcps" || u.Scheme == "wss" {
+			if tlsServer == "" && tlsHost != "" && tlsHost != u.Hostname() {
+				return nil, "", fmt.Errorf("resolved TLS brokers %v and %v need a tls-server-name", tlsHost, u.Hostname())
+			}
+			if tlsServer == "" {
+				tlsHost = u.Hostname()
+			}
+		}
+		for _, address := range addresses {
+			node := *u
+			node.Host = address
+			resolved = append(resolved, node.String())
+		}
+	}
+
+	return resolved, tlsHost, nil
+}
+
+// calculateNodeResults aggregates the results per broker node, or returns nil if all clients used the same broker
+func calculateNodeResults(runs []*results.RunResults, totalTime time.Duration) []*results.NodeResults {
+	perNode := make(map[string][]*results.RunResults)
+	for _, res := range runs {
+		perNode[res.Broker] = append(perNode[res.Broker], res)
+	}
+	if len(perNode) < 2 {
+		return nil
+	}
+
+	nodes := make([]*results.NodeResults, 0, len(perNode))
+	for broker, nodeResults := range perNode {
+		nodes = append(nodes, &results.NodeResults{
+			Broker:       broker,
+			Clients:      len(nodeResults),
+			TotalResults: calculateTotalResults(nodeResults, totalTime, len(nodeResults)),
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Broker < nodes[j].Broker
+	})
+
+	return nodes
+}
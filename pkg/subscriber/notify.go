@@ -0,0 +1,73 @@
+package subscriber
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// runSummary returns a concise summary of the run for notifications: throughput, p99 latency, loss
+// (only known with -publisher-count) and the verdict against the thresholds
+func runSummary(jr *results.JSONResults, p99 float64, thresholds Thresholds) string {
+	totals := jr.Totals
+	var b strings.Builder
+
+	title := "MQTT benchmark"
+	if jr.RunID != "" {
+		title += " " + jr.RunID
+	}
+	failures := thresholds.check(totals, p99)
+	switch {
+	case !thresholds.enabled():
+		title += " finished"
+	case len(failures) == 0:
+		title += " PASSED"
+	default:
+		title += " FAILED"
+	}
+	fmt.Fprintf(&b, "*%s*\n", title)
+	fmt.Fprintf(&b, "Clients: %d, messages received: %d\n", len(jr.Runs), totals.Successes)
+	fmt.Fprintf(&b, "Throughput: %.1f msg/sec\n", totals.TotalMsgsPerSec)
+	fmt.Fprintf(&b, "Latency p99: %.3f ms\n", p99/1_000_000)
+
+	var missing, expected int64
+	for _, count := range totals.Publishers {
+		missing += count.Missing
+		expected += count.Expected
+	}
+	if expected > 0 {
+		fmt.Fprintf(&b, "Loss: %.3f%%\n", float64(missing)/float64(expected)*100)
+	}
+	for _, failure := range failures {
+		fmt.Fprintf(&b, "- %s\n", failure.Message)
+	}
+
+	return b.String()
+}
+
+// notify posts text to a Slack or Microsoft Teams incoming webhook, both accept a JSON object with a text field
+func notify(webhookURL string, text string) error {
+	data, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned %v: %s", resp.Status, body)
+	}
+
+	return nil
+}
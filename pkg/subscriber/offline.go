@@ -0,0 +1,153 @@
+package subscriber
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// offlineTracker takes a client offline for a while and measures the drain of the queued messages after
+// it reconnects; messages generated before the reconnect are considered queued
+type offlineTracker struct {
+	mu              sync.Mutex
+	offlineAt       int64
+	reconnectedAt   int64
+	lastQueuedAt    int64
+	queuedLatencies []float64
+}
+
+// goOffline disconnects the client, waits for the given duration and connects again with the same session.
+// A paho client can't be connected again after Disconnect, so a new one is created from the same options
+// and replaces the client of c.
+func (t *offlineTracker) goOffline(c *Client, duration time.Duration) {
+	if !c.Quiet {
+		c.logf(levelInfo, "going offline for %v", duration)
+	}
+	c.mqttMu.Lock()
+	client, opts := c.mqttClient, c.mqttOpts
+	c.mqttMu.Unlock()
+	t.mu.Lock()
+	t.offlineAt = time.Now().UnixNano()
+	t.mu.Unlock()
+	c.events.log(c.ID, eventDisconnect, nil)
+	client.Disconnect(250)
+
+	// Run stops the accumulator when it is done or cancelled, the client then stays offline
+	select {
+	case <-c.acc.done:
+		return
+	case <-time.After(duration):
+	}
+
+	client = c.newMQTTClient(opts)
+	c.mqttMu.Lock()
+	if c.stopped {
+		// Run is done
+		c.mqttMu.Unlock()
+		return
+	}
+	c.mqttClient = client
+	c.mqttMu.Unlock()
+	// with the limit, retries and backoff of the first connect; a client that can't reconnect would wait for
+	// its messages forever
+	if err := c.connect(client); err != nil {
+		c.fail(fmt.Errorf("reconnecting after going offline (%d attempts): %v", c.ConnectRetries+1, err))
+		return
+	}
+	if c.connectedAfterStop(client) {
+		return
+	}
+	t.mu.Lock()
+	t.reconnectedAt = time.Now().UnixNano()
+	t.mu.Unlock()
+}
+
+func (t *offlineTracker) received(m *Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.offlineAt == 0 || m.Payload.GeneratedAt < t.offlineAt {
+		return
+	}
+	// messages may arrive before goOffline saw the CONNACK, those are queued as well
+	if t.reconnectedAt == 0 || m.Payload.GeneratedAt < t.reconnectedAt {
+		t.queuedLatencies = append(t.queuedLatencies, float64(m.ReceivedAt-m.Payload.GeneratedAt))
+		t.lastQueuedAt = m.ReceivedAt
+	}
+}
+
+// results returns the offline queue results, or nil if the client did not go offline
+func (t *offlineTracker) results() *results.OfflineQueueResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.offlineAt == 0 {
+		return nil
+	}
+
+	res := &results.OfflineQueueResults{
+		QueuedMessages: int64(len(t.queuedLatencies)),
+	}
+	if t.reconnectedAt > 0 {
+		res.OfflineTime = float64(t.reconnectedAt - t.offlineAt)
+	}
+	if len(t.queuedLatencies) > 0 {
+		res.QueuedLatencyMin = stats.StatsMin(t.queuedLatencies)
+		res.QueuedLatencyMax = stats.StatsMax(t.queuedLatencies)
+		res.QueuedLatencyMean = stats.StatsMean(t.queuedLatencies)
+		// calculate std if sample is > 1, otherwise leave as 0 (convention)
+		if len(t.queuedLatencies) > 1 {
+			res.QueuedLatencyStd = stats.StatsSampleStandardDeviation(t.queuedLatencies)
+		}
+	}
+	if t.reconnectedAt > 0 && t.lastQueuedAt > t.reconnectedAt {
+		res.DrainTime = float64(t.lastQueuedAt - t.reconnectedAt)
+		res.DrainRate = float64(res.QueuedMessages) / time.Duration(res.DrainTime).Seconds()
+	}
+
+	return res
+}
+
+func calculateOfflineQueueTotals(runs []*results.RunResults) *results.OfflineQueueResults {
+	var totals *results.OfflineQueueResults
+	var offlineTimes, drainTimes, drainRates, latencyMeans []float64
+	for _, res := range runs {
+		q := res.OfflineQueue
+		if q == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.OfflineQueueResults)
+		}
+		totals.QueuedMessages += q.QueuedMessages
+		offlineTimes = append(offlineTimes, q.OfflineTime)
+		if q.QueuedMessages == 0 {
+			continue
+		}
+		drainTimes = append(drainTimes, q.DrainTime)
+		drainRates = append(drainRates, q.DrainRate)
+		latencyMeans = append(latencyMeans, q.QueuedLatencyMean)
+		if q.QueuedLatencyMin < totals.QueuedLatencyMin || totals.QueuedLatencyMin == 0 {
+			totals.QueuedLatencyMin = q.QueuedLatencyMin
+		}
+		if q.QueuedLatencyMax > totals.QueuedLatencyMax {
+			totals.QueuedLatencyMax = q.QueuedLatencyMax
+		}
+	}
+	if totals == nil {
+		return nil
+	}
+	totals.OfflineTime = stats.StatsMean(offlineTimes)
+	if len(drainTimes) > 0 {
+		totals.DrainTime = stats.StatsMean(drainTimes)
+		totals.DrainRate = stats.StatsMean(drainRates)
+		totals.QueuedLatencyMean = stats.StatsMean(latencyMeans)
+	}
+	if len(latencyMeans) > 1 {
+		totals.QueuedLatencyStd = stats.StatsSampleStandardDeviation(latencyMeans)
+	}
+
+	return totals
+}
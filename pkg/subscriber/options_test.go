@@ -0,0 +1,86 @@
+package subscriber
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestOptions(args ...string) (*options, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	return parseOptions(fs, args)
+}
+
+func TestParseOptions(t *testing.T) {
+	o, err := parseTestOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.clients != 10 || o.count != 100 || o.qos != 1 || o.protocolLevel != 4 {
+		t.Errorf("defaults: clients %d, count %d, qos %d, protocol level %d", o.clients, o.count, o.qos, o.protocolLevel)
+	}
+	if len(o.subscriptions) != 1 || o.topics.Topic(3) != "/test" {
+		t.Errorf("default topic: %+v", o.subscriptions)
+	}
+	if o.tuning.KeepAlive != 30*time.Second || o.tuning.Unordered {
+		t.Errorf("tuning = %+v", o.tuning)
+	}
+
+	// without an explicit -count the clients receive until -duration elapsed
+	if o, err := parseTestOptions("-duration", "10s"); err != nil || o.count != 0 {
+		t.Errorf("-duration: count %v, %v", o.count, err)
+	}
+	if o, err := parseTestOptions("-duration", "10s", "-count", "5"); err != nil || o.count != 5 {
+		t.Errorf("-duration -count: count %v, %v", o.count, err)
+	}
+
+	o, err = parseTestOptions("-protocol-version", "5.0", "-order=false", "-receive-maximum", "5", "-max-packet-size",
+		"1024", "-topic", "a/%d:2,b", "-qos-mix", "0=50,2=50", "-clients", "4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.protocolLevel != 5 || o.tuning.ReceiveMaximum != 5 || !o.tuning.Unordered || o.maxPacket != 1024 {
+		t.Errorf("protocol level %d, tuning %+v, max packet size %d", o.protocolLevel, o.tuning, o.maxPacket)
+	}
+	if len(o.subscriptions) != 2 || o.topics.Topic(3) != "a/3" || o.subscriptions[0].qos != 2 || o.subscriptions[1].qos != -1 {
+		t.Errorf("subscriptions = %+v", o.subscriptions)
+	}
+	if string(o.qosLevels) != "\x00\x00\x02\x02" {
+		t.Errorf("qos levels = %v", o.qosLevels)
+	}
+}
+
+func TestParseOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-no-such-flag"}, "not defined"},
+		{[]string{"-clients", "0"}, "number of clients"},
+		{[]string{"-count", "0"}, "messages count"},
+		{[]string{"-chaos-fraction", "2"}, "chaos-fraction"},
+		{[]string{"-max-inflight", "5"}, "requires -order=false"},
+		{[]string{"-decode-workers", "2", "-pipeline-buffer", "10"}, "use one of them"},
+		{[]string{"-payload-format", "xml"}, "payload-format"},
+		{[]string{"-exactly-once", "0-9"}, "requires -qos 2"},
+		{[]string{"-mode", "cluster"}, "mode should be"},
+		{[]string{"-client-cert", "c.pem"}, "clientKey path missing"},
+		{[]string{"-topic", "a:3"}, "invalid QoS of topic"},
+		{[]string{"-qos-mix", "0=0"}, "does not assign any clients"},
+		{[]string{"-protocol-version", "4"}, "invalid protocol version"},
+		{[]string{"-session-expiry", "1m"}, "requires -protocol-version 5.0"},
+		{[]string{"-receive-maximum", "5", "-order=false"}, "requires -protocol-version 5.0"},
+		{[]string{"-protocol-version", "5.0", "-order=false", "-receive-maximum", "5", "-max-inflight", "5"}, "use one of them"},
+		{[]string{"-protocol-version", "5.0", "-receive-maximum", "70000", "-order=false"}, "receive-maximum should be"},
+	}
+	for _, test := range tests {
+		_, err := parseTestOptions(test.args...)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: error %v, want %q", test.args, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package subscriber
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// OTLPExporter sends a trace of a run, with a span for the run and a child span per client, and the key numbers
+// of the run as gauges to an OpenTelemetry collector over OTLP/HTTP with JSON encoding. Headers, e.g. for
+// authentication, are taken from the OTEL_EXPORTER_OTLP_HEADERS environment variable (key=value,...).
+type OTLPExporter struct {
+	Endpoint    string // base URL, e.g. http://localhost:4318
+	ServiceName string
+
+	client http.Client
+}
+
+// otlpAttribute is a key-value pair of the OTLP JSON encoding, value holds one of stringValue, intValue,
+// doubleValue or boolValue
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpMetric struct {
+	Name  string `json:"name"`
+	Unit  string `json:"unit"`
+	Gauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+type otlpDataPoint struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+// Span kinds and status codes of the OTLP protocol
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+// otlpMetricPrefix is prepended to the names of the exported metrics
+const otlpMetricPrefix = "mqtt_benchmark."
+
+// Export sends the trace and the metrics of the run that started at start and ended at end
+func (e *OTLPExporter) Export(jr *results.JSONResults, start, end time.Time) error {
+	e.client.Timeout = 30 * time.Second
+	resource := e.resource(jr)
+
+	traceID := randomHex(16)
+	runSpanID := randomHex(8)
+	totals := jr.Totals
+	runSpan := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            runSpanID,
+		Name:              "mqtt-benchmark-subscriber run",
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(start),
+		EndTimeUnixNano:   otlpTime(end),
+		Attributes: []otlpAttribute{
+			otlpInt("benchmark.clients", int64(len(jr.Runs))),
+			otlpInt("benchmark.messages", totals.Successes),
+			otlpDouble("benchmark.msgs_per_sec", totals.TotalMsgsPerSec),
+			otlpDouble("benchmark.latency_mean_ms", totals.MsgTimeMeanAvg/1_000_000),
+			otlpInt("benchmark.failed_clients", int64(len(totals.FailedClients))),
+		},
+		Status: otlpStatus{Code: otlpStatusOK},
+	}
+	if len(totals.FailedClients) > 0 {
+		runSpan.Status = otlpStatus{Code: otlpStatusError, Message: fmt.Sprintf("%d clients failed", len(totals.FailedClients))}
+	}
+	spans := []otlpSpan{runSpan}
+	for _, res := range jr.Runs {
+		spans = append(spans, clientSpan(res, traceID, runSpanID, start, end))
+	}
+	traces := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource":   resource,
+			"scopeSpans": []interface{}{map[string]interface{}{"scope": otlpScope{Name: e.ServiceName}, "spans": spans}},
+		}},
+	}
+	if err := e.post("/v1/traces", traces); err != nil {
+		return err
+	}
+	logf(levelInfo, "Exported the run as trace %v to %v", traceID, e.Endpoint)
+
+	metrics := map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource":     resource,
+			"scopeMetrics": []interface{}{map[string]interface{}{"scope": otlpScope{Name: e.ServiceName}, "metrics": otlpMetrics(jr, end)}},
+		}},
+	}
+
+	return e.post("/v1/metrics", metrics)
+}
+
+// resource describes the run, by the service name, the run id and the labels
+func (e *OTLPExporter) resource(jr *results.JSONResults) otlpResource {
+	attributes := []otlpAttribute{otlpString("service.name", e.ServiceName)}
+	if jr.RunID != "" {
+		attributes = append(attributes, otlpString("benchmark.run_id", jr.RunID))
+	}
+	keys := make([]string, 0, len(jr.Labels))
+	for key := range jr.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attributes = append(attributes, otlpString("benchmark.label."+key, jr.Labels[key]))
+	}
+
+	return otlpResource{Attributes: attributes}
+}
+
+// clientSpan returns the span of a client, from the start of the run to its last measured message, or to the end
+// of the run if it measured none
+func clientSpan(res *results.RunResults, traceID, parentSpanID string, start, end time.Time) otlpSpan {
+	spanEnd := end
+	if res.MeasuredTo > 0 {
+		spanEnd = time.Unix(0, res.MeasuredTo)
+	}
+	span := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            randomHex(8),
+		ParentSpanID:      parentSpanID,
+		Name:              fmt.Sprintf("client %d", res.ID),
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(start),
+		EndTimeUnixNano:   otlpTime(spanEnd),
+		Attributes: []otlpAttribute{
+			otlpInt("benchmark.client.id", int64(res.ID)),
+			otlpInt("messaging.mqtt.qos", int64(res.QoS)),
+			otlpInt("benchmark.messages", res.Successes),
+			otlpDouble("benchmark.msgs_per_sec", res.MsgsPerSec),
+			otlpDouble("benchmark.latency_mean_ms", res.MsgTimeMean/1_000_000),
+			otlpDouble("benchmark.connect_time_ms", res.ConnectTime/1_000_000),
+			otlpInt("benchmark.disconnects", res.Disconnects),
+		},
+		Status: otlpStatus{Code: otlpStatusOK},
+	}
+	if res.Broker != "" {
+		span.Attributes = append(span.Attributes, otlpString("server.address", res.Broker))
+	}
+	if res.Topic != "" {
+		span.Attributes = append(span.Attributes, otlpString("messaging.destination.name", res.Topic))
+	}
+	if res.Failed {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: res.Error}
+	}
+
+	return span
+}
+
+// otlpMetrics returns the key numbers of the totals and the throughput and mean latency of every client
+func otlpMetrics(jr *results.JSONResults, timestamp time.Time) []otlpMetric {
+	var metrics []otlpMetric
+	for _, m := range keyMetrics(jr.Totals) {
+		metrics = append(metrics, otlpGauge(m.Name, m.Unit, otlpDataPoint{TimeUnixNano: otlpTime(timestamp), AsDouble: m.Value}))
+	}
+	throughput := otlpGauge("ClientThroughput", unitCountPerSec)
+	latency := otlpGauge("ClientLatencyMean", unitMilliseconds)
+	for _, res := range jr.Runs {
+		client := []otlpAttribute{otlpInt("benchmark.client.id", int64(res.ID))}
+		throughput.Gauge.DataPoints = append(throughput.Gauge.DataPoints,
+			otlpDataPoint{TimeUnixNano: otlpTime(timestamp), AsDouble: res.MsgsPerSec, Attributes: client})
+		latency.Gauge.DataPoints = append(latency.Gauge.DataPoints,
+			otlpDataPoint{TimeUnixNano: otlpTime(timestamp), AsDouble: res.MsgTimeMean / 1_000_000, Attributes: client})
+	}
+
+	return append(metrics, throughput, latency)
+}
+
+func otlpGauge(name, unit string, points ...otlpDataPoint) otlpMetric {
+	m := otlpMetric{Name: otlpMetricPrefix + name, Unit: otlpUnits[unit]}
+	m.Gauge.DataPoints = points
+
+	return m
+}
+
+// otlpUnits maps the units of the metrics to UCUM, which OpenTelemetry uses
+var otlpUnits = map[string]string{
+	unitCount:        "1",
+	unitCountPerSec:  "1/s",
+	unitMilliseconds: "ms",
+}
+
+func (e *OTLPExporter) post(path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(e.Endpoint, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if parts := strings.SplitN(header, "=", 2); len(parts) == 2 {
+			req.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		}
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("posting %v failed with %v: %s", path, resp.Status, respBody)
+	}
+
+	return nil
+}
+
+// randomHex returns n random bytes hex encoded, for trace and span ids
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// otlpTime encodes t as a string like the 64-bit integers of the OTLP JSON encoding
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"stringValue": value}}
+}
+
+func otlpInt(key string, value int64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+func otlpDouble(key string, value float64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"doubleValue": value}}
+}
@@ -0,0 +1,83 @@
+package subscriber
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// resultsExporter pushes the results of a run to an external system
+type resultsExporter interface {
+	Export(jr *results.JSONResults, start time.Time) error
+}
+
+// outputFlags collects repeated -output URLs of the sinks the results are pushed to
+type outputFlags []string
+
+func (o *outputFlags) String() string {
+	return strings.Join(*o, ",")
+}
+
+// Set implements flag.Value, the URL is validated when the flag is parsed
+func (o *outputFlags) Set(value string) error {
+	if _, err := newOutput(value, false); err != nil {
+		return err
+	}
+	*o = append(*o, value)
+
+	return nil
+}
+
+// newOutput returns the exporter of an -output URL: influxdb://[user:pass@]host:port/database or
+// graphite://host:port[/prefix]. With series the latency series are exported as well.
+func newOutput(outputURL string, series bool) (resultsExporter, error) {
+	u, err := url.Parse(outputURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output %v: %v", outputURL, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid output %v, missing host:port", outputURL)
+	}
+	path := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "influxdb":
+		if path == "" {
+			return nil, fmt.Errorf("invalid output %v, expected influxdb://host:port/database", outputURL)
+		}
+		exporter := &InfluxDBExporter{
+			URL:      "http://" + u.Host,
+			Database: path,
+			Series:   series,
+		}
+		if u.User != nil {
+			exporter.Username = u.User.Username()
+			exporter.Password, _ = u.User.Password()
+		}
+		return exporter, nil
+	case "graphite":
+		prefix := strings.Replace(path, "/", ".", -1)
+		if prefix == "" {
+			prefix = defaultGraphitePrefix
+		}
+		return &GraphiteExporter{
+			Address: u.Host,
+			Prefix:  prefix,
+			Series:  series,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid output %v, expected influxdb:// or graphite://", outputURL)
+	}
+}
+
+// outputEndpoint returns scheme://host:port of an -output URL for messages, leaving out its credentials
+func outputEndpoint(outputURL string) string {
+	u, err := url.Parse(outputURL)
+	if err != nil {
+		return "output"
+	}
+
+	return u.Scheme + "://" + u.Host
+}
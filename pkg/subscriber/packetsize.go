@@ -0,0 +1,57 @@
+package subscriber
+
+import (
+	"sync/atomic"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// packetSizes tracks the sizes of the PUBLISH packets a client receives. With MQTT 5.0 the limit is the
+// Maximum Packet Size of the CONNECT, the broker discards larger packets, which count as lost; MQTT 3.1.1
+// cannot announce it, so the client drops larger packets the way an MQTT 5 broker would. Either way the
+// larger packets received are counted as oversize. Payloads that cannot be decoded, e.g. because the broker
+// truncated them, are counted as malformed.
+type packetSizes struct {
+	limit     int64
+	largest   int64
+	oversize  int64
+	malformed int64
+}
+
+// publishPacketSize returns the size in bytes of the PUBLISH packet msg was received in, computed for paho
+// messages, which lack the MQTT 5.0 properties
+func publishPacketSize(msg mqtt.Message) int64 {
+	if p, ok := msg.(*publishPacket); ok {
+		return p.size
+	}
+	remaining := int64(2 + len(msg.Topic()) + len(msg.Payload()))
+	if msg.Qos() > 0 {
+		remaining += 2 // packet identifier
+	}
+	// fixed header: packet type and flags plus the variable length encoding of the remaining length
+	size := 1 + remaining
+	for n := remaining; ; n /= 128 {
+		size++
+		if n < 128 {
+			break
+		}
+	}
+
+	return size
+}
+
+// accept records the size of a received packet, it returns false if the packet exceeds the limit
+func (p *packetSizes) accept(size int64) bool {
+	// the handlers of a client may run concurrently
+	for largest := atomic.LoadInt64(&p.largest); size > largest; largest = atomic.LoadInt64(&p.largest) {
+		if atomic.CompareAndSwapInt64(&p.largest, largest, size) {
+			break
+		}
+	}
+	if p.limit > 0 && size > p.limit {
+		atomic.AddInt64(&p.oversize, 1)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,79 @@
+package subscriber
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// payloadKeeper keeps the first and last count raw payloads a client received, so unexpected publisher
+// traffic can be diagnosed from the results. The last payloads are kept in a ring buffer.
+type payloadKeeper struct {
+	count int
+
+	mu    sync.Mutex
+	first []*results.PayloadSample
+	last  []*results.PayloadSample
+	next  int
+	seen  int64
+}
+
+func newPayloadKeeper(count int) *payloadKeeper {
+	return &payloadKeeper{count: count}
+}
+
+// keep records a received payload, a nil payloadKeeper ignores it
+func (k *payloadKeeper) keep(topic string, payload []byte, receivedAt int64) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.seen++
+	if len(k.first) < k.count {
+		k.first = append(k.first, newPayloadSample(topic, payload, receivedAt))
+		return
+	}
+	sample := newPayloadSample(topic, payload, receivedAt)
+	if len(k.last) < k.count {
+		k.last = append(k.last, sample)
+		return
+	}
+	k.last[k.next] = sample
+	k.next = (k.next + 1) % k.count
+}
+
+// results returns the kept payloads in the order they were received
+func (k *payloadKeeper) results() *results.PayloadResults {
+	if k == nil {
+		return nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return &results.PayloadResults{
+		Received: k.seen,
+		First:    append([]*results.PayloadSample(nil), k.first...),
+		Last:     append(append([]*results.PayloadSample(nil), k.last[k.next:]...), k.last[:k.next]...),
+	}
+}
+
+// newPayloadSample copies a payload, JSON payloads are kept as is, others hex encoded
+func newPayloadSample(topic string, payload []byte, receivedAt int64) *results.PayloadSample {
+	sample := &results.PayloadSample{
+		ReceivedAt: receivedAt,
+		Topic:      topic,
+		Size:       len(payload),
+	}
+	if json.Valid(payload) {
+		sample.Encoding = "json"
+		sample.Payload = string(payload)
+	} else {
+		sample.Encoding = "hex"
+		sample.Payload = hex.EncodeToString(payload)
+	}
+
+	return sample
+}
@@ -0,0 +1,105 @@
+package subscriber
+
+import (
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// connectPhases holds the timestamps of the phases of a single connection established by the Dialer
+type connectPhases struct {
+	started    time.Time // MQTT client started connecting
+	dialed     time.Time // Dialer was asked for the connection
+	resolved   time.Time // broker host resolved
+	connected  time.Time // TCP connection established
+	handshaken time.Time // TLS handshake done (equal to connected without TLS)
+	connacked  time.Time // CONNACK received
+}
+
+// dialedConn records the phases of the first connection of a client, later (re)connections are not timed
+func (cc *ClientConn) dialedConn(phases *connectPhases) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.phases == nil {
+		cc.phases = phases
+	}
+}
+
+// connacked records when the MQTT client that started connecting at started received the CONNACK
+// of its first connection
+func (cc *ClientConn) connacked(started, connacked time.Time) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.phases != nil && cc.phases.connacked.IsZero() {
+		cc.phases.started = started
+		cc.phases.connacked = connacked
+	}
+}
+
+// ConnectResults returns the phases of the client's first connection, nil if it was not established
+func (cc *ClientConn) ConnectResults() *results.ConnectResults {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	p := cc.phases
+	if p == nil || p.connacked.IsZero() {
+		return nil
+	}
+
+	return &results.ConnectResults{
+		DNS:   float64(p.resolved.Sub(p.dialed)),
+		TCP:   float64(p.connected.Sub(p.resolved)),
+		TLS:   float64(p.handshaken.Sub(p.connected)),
+		MQTT:  float64(p.connacked.Sub(p.handshaken)),
+		Total: float64(p.connacked.Sub(p.started)),
+	}
+}
+
+func calculateConnectTotals(runs []*results.RunResults) *results.ConnectTotalResults {
+	var dns, tcp, tls, mqtt, total []float64
+	for _, res := range runs {
+		if res.Connect == nil {
+			continue
+		}
+		dns = append(dns, res.Connect.DNS)
+		tcp = append(tcp, res.Connect.TCP)
+		tls = append(tls, res.Connect.TLS)
+		mqtt = append(mqtt, res.Connect.MQTT)
+		total = append(total, res.Connect.Total)
+	}
+	if len(total) == 0 {
+		return nil
+	}
+
+	return &results.ConnectTotalResults{
+		Clients: len(total),
+		DNS:     phaseDistribution(dns),
+		TCP:     phaseDistribution(tcp),
+		TLS:     phaseDistribution(tls),
+		MQTT:    phaseDistribution(mqtt),
+		Total:   phaseDistribution(total),
+	}
+}
+
+func phaseDistribution(durations []float64) *results.PhaseDistribution {
+	sorted := sortedCopy(durations)
+
+	return &results.PhaseDistribution{
+		Min:  sorted[0],
+		Mean: stats.StatsMean(sorted),
+		P50:  quantile(sorted, 0.50),
+		P95:  quantile(sorted, 0.95),
+		P99:  quantile(sorted, 0.99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// minMeanMax returns the minimum, mean and maximum of durations, all 0 if there are none
+func minMeanMax(durations []float64) (min, mean, max float64) {
+	if len(durations) == 0 {
+		return 0, 0, 0
+	}
+
+	return stats.StatsMin(durations), stats.StatsMean(durations), stats.StatsMax(durations)
+}
@@ -0,0 +1,57 @@
+package subscriber
+
+import (
+	"sync/atomic"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// pipelineMessage is a message waiting in the pipeline with the time it was received by the handler
+type pipelineMessage struct {
+	msg        mqtt.Message
+	receivedAt int64
+}
+
+// messagePipeline decouples the measurement of the messages from paho's message handler with a bounded
+// buffer, so decoding and recording them never blocks paho's network loop. Messages arriving while the
+// buffer is full are dropped and counted instead.
+type messagePipeline struct {
+	messages chan pipelineMessage
+	dropped  int64
+}
+
+func newMessagePipeline(size int) *messagePipeline {
+	return &messagePipeline{messages: make(chan pipelineMessage, size)}
+}
+
+// push queues a message without blocking, it returns false if the buffer was full and it was dropped
+func (p *messagePipeline) push(msg mqtt.Message, receivedAt int64) bool {
+	select {
+	case p.messages <- pipelineMessage{msg: msg, receivedAt: receivedAt}:
+		return true
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+		return false
+	}
+}
+
+// run handles the queued messages until done is closed
+func (p *messagePipeline) run(handle func(msg mqtt.Message, receivedAt int64), done <-chan struct{}) {
+	for {
+		select {
+		case m := <-p.messages:
+			handle(m.msg, m.receivedAt)
+		case <-done:
+			return
+		}
+	}
+}
+
+// droppedCount returns the number of dropped messages, 0 without a pipeline
+func (p *messagePipeline) droppedCount() int64 {
+	if p == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&p.dropped)
+}
@@ -0,0 +1,143 @@
+package subscriber
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	// registers the postgres driver
+	_ "github.com/lib/pq"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// postgresSchema creates the result tables if they do not exist yet
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS mqtt_benchmark_runs (
+	id                 BIGSERIAL PRIMARY KEY,
+	run_id             TEXT,
+	started_at         TIMESTAMPTZ NOT NULL,
+	clients            INTEGER NOT NULL,
+	successes          BIGINT NOT NULL,
+	total_run_time     DOUBLE PRECISION NOT NULL,
+	msg_time_min       DOUBLE PRECISION NOT NULL,
+	msg_time_max       DOUBLE PRECISION NOT NULL,
+	msg_time_mean_avg  DOUBLE PRECISION NOT NULL,
+	msg_time_mean_std  DOUBLE PRECISION NOT NULL,
+	total_msgs_per_sec DOUBLE PRECISION NOT NULL,
+	duplicates         BIGINT NOT NULL,
+	totals             JSONB NOT NULL
+);
+ALTER TABLE mqtt_benchmark_runs ADD COLUMN IF NOT EXISTS labels JSONB;
+CREATE TABLE IF NOT EXISTS mqtt_benchmark_clients (
+	run           BIGINT NOT NULL REFERENCES mqtt_benchmark_runs (id) ON DELETE CASCADE,
+	client        INTEGER NOT NULL,
+	successes     BIGINT NOT NULL,
+	run_time      DOUBLE PRECISION NOT NULL,
+	msg_time_min  DOUBLE PRECISION NOT NULL,
+	msg_time_max  DOUBLE PRECISION NOT NULL,
+	msg_time_mean DOUBLE PRECISION NOT NULL,
+	msg_time_std  DOUBLE PRECISION NOT NULL,
+	msgs_per_sec  DOUBLE PRECISION NOT NULL,
+	duplicates    BIGINT NOT NULL,
+	results       JSONB NOT NULL,
+	PRIMARY KEY (run, client)
+);
+CREATE TABLE IF NOT EXISTS mqtt_benchmark_intervals (
+	run      BIGINT NOT NULL REFERENCES mqtt_benchmark_runs (id) ON DELETE CASCADE,
+	time     TIMESTAMPTZ NOT NULL,
+	elapsed  DOUBLE PRECISION NOT NULL,
+	received BIGINT NOT NULL,
+	p50      DOUBLE PRECISION NOT NULL,
+	p95      DOUBLE PRECISION NOT NULL,
+	p99      DOUBLE PRECISION NOT NULL
+);
+`
+
+// timescaleSchema turns the interval table into a TimescaleDB hypertable
+const timescaleSchema = `SELECT create_hypertable('mqtt_benchmark_intervals', 'time', if_not_exists => TRUE)`
+
+// PostgresSink writes the results into PostgreSQL / TimescaleDB, creating the schema automatically.
+// Latencies are stored in nanoseconds, like in the JSON results.
+type PostgresSink struct {
+	DSN       string
+	Timescale bool
+}
+
+// Write stores the totals, the per-client results and the latency series of the run in a single transaction
+func (p *PostgresSink) Write(jr *results.JSONResults, start time.Time) error {
+	db, err := sql.Open("postgres", p.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(postgresSchema); err != nil {
+		return err
+	}
+	if p.Timescale {
+		if _, err := db.Exec(timescaleSchema); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	t := jr.Totals
+	totals, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	var runID sql.NullString
+	if jr.RunID != "" {
+		runID = sql.NullString{String: jr.RunID, Valid: true}
+	}
+	var labels sql.NullString
+	if len(jr.Labels) > 0 {
+		data, err := json.Marshal(jr.Labels)
+		if err != nil {
+			return err
+		}
+		labels = sql.NullString{String: string(data), Valid: true}
+	}
+	var run int64
+	err = tx.QueryRow(`INSERT INTO mqtt_benchmark_runs (run_id, started_at, clients, successes, total_run_time,
+			msg_time_min, msg_time_max, msg_time_mean_avg, msg_time_mean_std, total_msgs_per_sec, duplicates, totals, labels)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+		runID, start, len(jr.Runs), t.Successes, t.TotalRunTime, t.MsgTimeMin, t.MsgTimeMax, t.MsgTimeMeanAvg,
+		t.MsgTimeMeanStd, t.TotalMsgsPerSec, t.Duplicates, string(totals), labels).Scan(&run)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range jr.Runs {
+		doc, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO mqtt_benchmark_clients (run, client, successes, run_time, msg_time_min,
+				msg_time_max, msg_time_mean, msg_time_std, msgs_per_sec, duplicates, results)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			run, res.ID, res.Successes, res.RunTime, res.MsgTimeMin, res.MsgTimeMax, res.MsgTimeMean,
+			res.MsgTimeStd, res.MsgsPerSec, res.Duplicates, string(doc))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sample := range t.LatencySeries {
+		_, err = tx.Exec(`INSERT INTO mqtt_benchmark_intervals (run, time, elapsed, received, p50, p95, p99)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			run, start.Add(time.Duration(sample.Elapsed*float64(time.Second))), sample.Elapsed, sample.Received,
+			sample.P50, sample.P95, sample.P99)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
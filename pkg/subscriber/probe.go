@@ -0,0 +1,194 @@
+package subscriber
+
+import (
+	"crypto/tls"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// SubscribeProbe periodically subscribes and unsubscribes a dedicated client on a probe topic (which can be
+// the benchmark topic itself), measuring how responsive the broker's control plane stays while the benchmark
+// loads it and the number of connected clients climbs
+type SubscribeProbe struct {
+	BrokerURLs []string
+	BrokerUser string
+	BrokerPass string
+	ClientID   string
+	Topic      string
+	QoS        byte
+	Interval   time.Duration
+	TLSConfig  *tls.Config
+	Quiet      bool
+
+	connections *connectionCount
+
+	mu      sync.Mutex
+	samples []results.ProbeSample
+	errors  int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Start connects the probe client and starts probing at the configured interval
+func (p *SubscribeProbe) Start(start time.Time) {
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	opts := mqtt.NewClientOptions()
+	for _, brokerURL := range p.BrokerURLs {
+		opts.AddBroker(brokerURL)
+	}
+	opts.SetClientID(p.ClientID).
+		SetCleanSession(true).
+		SetAutoReconnect(true)
+	if p.BrokerUser != "" && p.BrokerPass != "" {
+		opts.SetUsername(p.BrokerUser)
+		opts.SetPassword(p.BrokerPass)
+	}
+	if p.TLSConfig != nil {
+		opts.SetTLSConfig(p.TLSConfig)
+	}
+
+	go func() {
+		defer close(p.done)
+		client := mqtt.NewClient(opts)
+		token := client.Connect()
+		token.Wait()
+		if token.Error() != nil {
+			logf(levelError, "PROBE had error connecting to the broker: %v", token.Error())
+			return
+		}
+		defer client.Disconnect(250)
+
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.probe(client, start)
+			}
+		}
+	}()
+}
+
+func (p *SubscribeProbe) probe(client mqtt.Client, start time.Time) {
+	sample := results.ProbeSample{
+		Time:        time.Since(start).Seconds(),
+		Connections: p.connections.count(),
+	}
+
+	t := time.Now()
+	token := client.Subscribe(p.Topic, p.QoS, nil)
+	token.Wait()
+	if token.Error() != nil {
+		p.failed(token.Error())
+		return
+	}
+	sample.SubackLatency = float64(time.Since(t).Nanoseconds())
+
+	t = time.Now()
+	token = client.Unsubscribe(p.Topic)
+	token.Wait()
+	if token.Error() != nil {
+		p.failed(token.Error())
+		return
+	}
+	sample.UnsubackLatency = float64(time.Since(t).Nanoseconds())
+
+	if !p.Quiet {
+		logf(levelInfo, "PROBE SUBACK after %.3f ms", sample.SubackLatency/1_000_000)
+	}
+	p.mu.Lock()
+	p.samples = append(p.samples, sample)
+	p.mu.Unlock()
+}
+
+func (p *SubscribeProbe) failed(err error) {
+	logf(levelWarn, "PROBE had error (un)subscribing: %v", err)
+	p.mu.Lock()
+	p.errors++
+	p.mu.Unlock()
+}
+
+// Stop stops probing and returns the results
+func (p *SubscribeProbe) Stop() *results.ProbeResults {
+	close(p.stop)
+	<-p.done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := &results.ProbeResults{
+		Samples: p.samples,
+		Errors:  p.errors,
+	}
+	if len(p.samples) == 0 {
+		return res
+	}
+	times := make([]float64, len(p.samples))
+	subacks := make([]float64, len(p.samples))
+	unsubacks := make([]float64, len(p.samples))
+	for i, sample := range p.samples {
+		times[i] = sample.Time
+		subacks[i] = sample.SubackLatency
+		unsubacks[i] = sample.UnsubackLatency
+	}
+	res.SubackMin = stats.StatsMin(subacks)
+	res.SubackMax = stats.StatsMax(subacks)
+	res.SubackMean = stats.StatsMean(subacks)
+	res.UnsubackMean = stats.StatsMean(unsubacks)
+	res.SubackTrend = slope(times, subacks)
+	// calculate std if sample is > 1, otherwise leave as 0 (convention)
+	if len(subacks) > 1 {
+		res.SubackStd = stats.StatsSampleStandardDeviation(subacks)
+	}
+
+	return res
+}
+
+// connectionCount counts the benchmark clients currently connected to the broker
+type connectionCount struct {
+	n int64
+}
+
+func (c *connectionCount) up() {
+	if c != nil {
+		atomic.AddInt64(&c.n, 1)
+	}
+}
+
+func (c *connectionCount) down() {
+	if c != nil {
+		atomic.AddInt64(&c.n, -1)
+	}
+}
+
+func (c *connectionCount) count() int64 {
+	if c == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&c.n)
+}
+
+// slope returns the least squares slope of y over x, 0 if x does not vary
+func slope(x, y []float64) float64 {
+	meanX, meanY := stats.StatsMean(x), stats.StatsMean(y)
+	var cov, varX float64
+	for i := range x {
+		cov += (x[i] - meanX) * (y[i] - meanY)
+		varX += (x[i] - meanX) * (x[i] - meanX)
+	}
+	if varX == 0 {
+		return 0
+	}
+
+	return cov / varX
+}
@@ -0,0 +1,91 @@
+package subscriber
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// parseProgressInterval parses -progress-interval, a number of messages or a duration, 0 disables the
+// progress logs
+func parseProgressInterval(value string) (int64, time.Duration, error) {
+	if messages, err := strconv.ParseInt(value, 10, 64); err == nil && messages >= 0 {
+		return messages, 0, nil
+	}
+	if period, err := time.ParseDuration(value); err == nil && period >= 0 {
+		return 0, period, nil
+	}
+
+	return 0, 0, fmt.Errorf("progress-interval should be a number of messages or a duration >= 0, given: %v", value)
+}
+
+// progressDue returns whether the client logs its progress after receiving its received-th message, every
+// ProgressEvery messages or every ProgressPeriod. The caller must hold the lock of the accumulator.
+func (c *Client) progressDue(received int64, now time.Time) bool {
+	switch {
+	case c.ProgressEvery > 0:
+		return received%c.ProgressEvery == 0
+	case c.ProgressPeriod > 0:
+		// the first period starts with the first message
+		if c.progressLogged.IsZero() {
+			c.progressLogged = now
+		}
+		if now.Sub(c.progressLogged) < c.ProgressPeriod {
+			return false
+		}
+		c.progressLogged = now
+		return true
+	}
+
+	return false
+}
+
+// aggregateProgress logs a single progress line over all clients instead of a line per client, every
+// messages received by any client or every period
+type aggregateProgress struct {
+	every    int64
+	expected int64 // by all clients, 0 if they receive until stopped
+	clients  int
+	received int64
+	start    time.Time
+}
+
+func newAggregateProgress(every int64, clients int, count int64) *aggregateProgress {
+	return &aggregateProgress{every: every, expected: count * int64(clients), clients: clients, start: time.Now()}
+}
+
+// add counts a measured message
+func (p *aggregateProgress) add() {
+	if p == nil {
+		return
+	}
+	received := atomic.AddInt64(&p.received, 1)
+	if p.every > 0 && received%p.every == 0 {
+		p.log(received)
+	}
+}
+
+func (p *aggregateProgress) log(received int64) {
+	rate := float64(received) / time.Since(p.start).Seconds()
+	if p.expected > 0 {
+		logf(levelInfo, "PROGRESS received %d of %d messages (%.1f%%) on %d clients, %.1f msg/sec",
+			received, p.expected, 100*float64(received)/float64(p.expected), p.clients, rate)
+	} else {
+		logf(levelInfo, "PROGRESS received %d messages on %d clients, %.1f msg/sec", received, p.clients, rate)
+	}
+}
+
+// run logs the progress every period until stop is closed
+func (p *aggregateProgress) run(period time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.log(atomic.LoadInt64(&p.received))
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package subscriber
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// promBuckets are the upper bounds in seconds of the buckets of the latency histograms
+var promBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// clientMetrics holds the live metrics of a single client exposed to Prometheus. It is updated by the
+// message handler and read by the scrapes.
+type clientMetrics struct {
+	mu       sync.Mutex
+	received int64
+	buckets  []int64 // non-cumulative counts per bucket, the last one is +Inf
+	sum      float64 // seconds
+	second   int64   // unix second of the last message
+	current  int64   // messages received in second
+	previous int64   // messages received in the second before second
+}
+
+func newClientMetrics() *clientMetrics {
+	return &clientMetrics{buckets: make([]int64, len(promBuckets)+1)}
+}
+
+// observe records a message with latency (nanoseconds) received at receivedAt (unix nanoseconds)
+func (m *clientMetrics) observe(latency float64, receivedAt int64) {
+	if m == nil {
+		return
+	}
+	seconds := latency / float64(time.Second)
+	bucket := len(promBuckets)
+	for i, bound := range promBuckets {
+		if seconds <= bound {
+			bucket = i
+			break
+		}
+	}
+	second := receivedAt / int64(time.Second)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received++
+	m.buckets[bucket]++
+	m.sum += seconds
+	switch {
+	case second == m.second:
+		m.current++
+	case second == m.second+1:
+		m.second, m.previous, m.current = second, m.current, 1
+	case second > m.second:
+		m.second, m.previous, m.current = second, 0, 1
+	}
+}
+
+// clientSnapshot is a consistent copy of the metrics of a client
+type clientSnapshot struct {
+	received int64
+	buckets  []int64
+	sum      float64
+	rate     float64 // messages received in the last complete second
+}
+
+func (m *clientMetrics) snapshot(now time.Time) clientSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := clientSnapshot{
+		received: m.received,
+		buckets:  append([]int64(nil), m.buckets...),
+		sum:      m.sum,
+	}
+	switch m.second {
+	case now.Unix():
+		s.rate = float64(m.previous)
+	case now.Unix() - 1:
+		s.rate = float64(m.current)
+	}
+
+	return s
+}
+
+// PrometheusExporter serves the live metrics of all clients in the Prometheus text format on /metrics
+type PrometheusExporter struct {
+	Clients []*Client
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// newPrometheusExporter listens on addr (e.g. :9090) for the metrics of the given number of clients
+func newPrometheusExporter(addr string, clients int) (*PrometheusExporter, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	e := &PrometheusExporter{
+		Clients:  make([]*Client, clients),
+		listener: listener,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.serveMetrics)
+	e.server = &http.Server{Handler: mux}
+
+	return e, nil
+}
+
+// Start starts serving the metrics, the Clients must not be changed anymore
+func (e *PrometheusExporter) Start() {
+	go func() {
+		if err := e.server.Serve(e.listener); err != http.ErrServerClosed {
+			logf(levelError, "Error serving Prometheus metrics: %v", err)
+		}
+	}()
+}
+
+// Close stops serving the metrics
+func (e *PrometheusExporter) Close() error {
+	return e.server.Close()
+}
+
+func (e *PrometheusExporter) serveMetrics(rw http.ResponseWriter, _ *http.Request) {
+	now := time.Now()
+	snapshots := make([]clientSnapshot, len(e.Clients))
+	disconnects := make([]int64, len(e.Clients))
+	total := clientSnapshot{buckets: make([]int64, len(promBuckets)+1)}
+	var totalDisconnects int64
+	for i, c := range e.Clients {
+		snapshots[i] = c.metrics.snapshot(now)
+		disconnects[i] = atomic.LoadInt64(&c.disconnects)
+		total.received += snapshots[i].received
+		total.sum += snapshots[i].sum
+		total.rate += snapshots[i].rate
+		for b, n := range snapshots[i].buckets {
+			total.buckets[b] += n
+		}
+		totalDisconnects += disconnects[i]
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w := bufio.NewWriter(rw)
+	defer w.Flush()
+
+	promFamily(w, "mqtt_subscriber_client_messages_received_total", "counter", "Messages received and measured per client")
+	for i, c := range e.Clients {
+		fmt.Fprintf(w, "mqtt_subscriber_client_messages_received_total{client=\"%d\"} %d\n", c.ID, snapshots[i].received)
+	}
+	promFamily(w, "mqtt_subscriber_client_receive_rate", "gauge", "Messages received per client in the last complete second")
+	for i, c := range e.Clients {
+		fmt.Fprintf(w, "mqtt_subscriber_client_receive_rate{client=\"%d\"} %g\n", c.ID, snapshots[i].rate)
+	}
+	promFamily(w, "mqtt_subscriber_client_disconnects_total", "counter", "Lost broker connections per client, each followed by a reconnect")
+	for i, c := range e.Clients {
+		fmt.Fprintf(w, "mqtt_subscriber_client_disconnects_total{client=\"%d\"} %d\n", c.ID, disconnects[i])
+	}
+	promFamily(w, "mqtt_subscriber_client_latency_seconds", "histogram", "Latency of the measured messages per client")
+	for i, c := range e.Clients {
+		promHistogram(w, "mqtt_subscriber_client_latency_seconds", fmt.Sprintf("client=\"%d\",", c.ID), snapshots[i])
+	}
+
+	promFamily(w, "mqtt_subscriber_messages_received_total", "counter", "Messages received and measured by all clients")
+	fmt.Fprintf(w, "mqtt_subscriber_messages_received_total %d\n", total.received)
+	promFamily(w, "mqtt_subscriber_receive_rate", "gauge", "Messages received by all clients in the last complete second")
+	fmt.Fprintf(w, "mqtt_subscriber_receive_rate %g\n", total.rate)
+	promFamily(w, "mqtt_subscriber_disconnects_total", "counter", "Lost broker connections of all clients")
+	fmt.Fprintf(w, "mqtt_subscriber_disconnects_total %d\n", totalDisconnects)
+	promFamily(w, "mqtt_subscriber_latency_seconds", "histogram", "Latency of the messages measured by all clients")
+	promHistogram(w, "mqtt_subscriber_latency_seconds", "", total)
+}
+
+func promFamily(w *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// promHistogram writes the cumulative buckets, sum and count of s, labels is empty or ends with a comma
+func promHistogram(w *bufio.Writer, name, labels string, s clientSnapshot) {
+	var cumulative int64
+	for i, n := range s.buckets {
+		cumulative += n
+		le := "+Inf"
+		if i < len(promBuckets) {
+			le = strconv.FormatFloat(promBuckets[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, le, cumulative)
+	}
+	if labels != "" {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, s.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, cumulative)
+}
@@ -0,0 +1,368 @@
+package subscriber
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+)
+
+// protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protobuf field types of a FieldDescriptorProto
+const (
+	protoTypeDouble   = 1
+	protoTypeInt64    = 3
+	protoTypeUint64   = 4
+	protoTypeInt32    = 5
+	protoTypeFixed64  = 6
+	protoTypeFixed32  = 7
+	protoTypeMessage  = 11
+	protoTypeUint32   = 13
+	protoTypeSfixed32 = 15
+	protoTypeSfixed64 = 16
+	protoTypeSint32   = 17
+	protoTypeSint64   = 18
+)
+
+// protoTimestamp is the well-known type of protobuf timestamps, seconds (field 1) and nanos (field 2)
+const protoTimestamp = ".google.protobuf.Timestamp"
+
+// protoScan calls fn for every field of a protobuf message with the value of varint fields as varint,
+// the value of the other fields as their raw bytes
+func protoScan(message []byte, fn func(field, wireType int, varint uint64, value []byte) error) error {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return errors.New("invalid protobuf field key")
+		}
+		message = message[n:]
+		var varint uint64
+		var value []byte
+		switch key & 7 {
+		case protoVarint:
+			if varint, n = binary.Uvarint(message); n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			message = message[n:]
+		case protoFixed64:
+			if len(message) < 8 {
+				return errors.New("truncated protobuf message")
+			}
+			value, message = message[:8], message[8:]
+		case protoFixed32:
+			if len(message) < 4 {
+				return errors.New("truncated protobuf message")
+			}
+			value, message = message[:4], message[4:]
+		case protoBytes:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return errors.New("truncated protobuf message")
+			}
+			value = message[n : n+int(length)]
+			message = message[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %v", key&7)
+		}
+		if err := fn(int(key>>3), int(key&7), varint, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// protoFields calls fn for every length-delimited field of a protobuf message, other fields are skipped
+func protoFields(message []byte, fn func(field int, value []byte) error) error {
+	return protoScan(message, func(field, wireType int, _ uint64, value []byte) error {
+		if wireType != protoBytes {
+			return nil
+		}
+		return fn(field, value)
+	})
+}
+
+// protoField is a field of a message type in a descriptor set
+type protoField struct {
+	number   int
+	kind     int    // protoType*
+	typeName string // fully qualified with a leading dot, for messages
+}
+
+// protoMessages maps the fully qualified names (with a leading dot) of the message types in a descriptor
+// set to their fields by name
+type protoMessages map[string]map[string]protoField
+
+// readProtoDescriptors reads a FileDescriptorSet as written by 'protoc --descriptor_set_out'
+func readProtoDescriptors(path string) (protoMessages, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	messages := make(protoMessages)
+	err = protoFields(data, func(field int, file []byte) error {
+		if field != 1 {
+			return nil
+		}
+		var pkg string
+		var types [][]byte
+		err := protoFields(file, func(field int, value []byte) error {
+			switch field {
+			case 2:
+				pkg = string(value)
+			case 4:
+				types = append(types, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		scope := ""
+		if pkg != "" {
+			scope = "." + pkg
+		}
+		for _, message := range types {
+			if err := messages.add(scope, message); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %v: %v", path, err)
+	}
+
+	return messages, nil
+}
+
+// add adds a DescriptorProto declared in scope and its nested types
+func (m protoMessages) add(scope string, descriptor []byte) error {
+	var name string
+	var fields, nested [][]byte
+	err := protoFields(descriptor, func(field int, value []byte) error {
+		switch field {
+		case 1:
+			name = string(value)
+		case 2:
+			fields = append(fields, value)
+		case 3:
+			nested = append(nested, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fullName := scope + "." + name
+	m[fullName] = make(map[string]protoField)
+	for _, descriptor := range fields {
+		var name string
+		var f protoField
+		err := protoScan(descriptor, func(field, _ int, varint uint64, value []byte) error {
+			switch field {
+			case 1:
+				name = string(value)
+			case 3:
+				f.number = int(varint)
+			case 5:
+				f.kind = int(varint)
+			case 6:
+				f.typeName = string(value)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		m[fullName][name] = f
+	}
+	for _, descriptor := range nested {
+		if err := m.add(fullName, descriptor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// path resolves a dotted path of field names (e.g. meta.sent_at) in message to the fields along it
+func (m protoMessages) path(message, path string) ([]protoField, error) {
+	var fields []protoField
+	for _, name := range strings.Split(path, ".") {
+		f, ok := m[message][name]
+		if !ok {
+			return nil, fmt.Errorf("field %v not found in protobuf message %v", name, strings.TrimPrefix(message, "."))
+		}
+		fields = append(fields, f)
+		message = f.typeName
+	}
+
+	return fields, nil
+}
+
+// protobufDecoder takes the fields of the Payload from protobuf messages. The timestamp is an integer
+// number of units since the Unix epoch or a google.protobuf.Timestamp; the publisher and message id are
+// optional integer fields.
+type protobufDecoder struct {
+	timestamp []protoField
+	unit      time.Duration
+	clientID  []protoField
+	messageID []protoField
+}
+
+// newProtobufDecoder creates a decoder for messages of the named type in the descriptor set at descriptorFile,
+// the fields are dotted paths of field names, clientIDField and messageIDField may be empty
+func newProtobufDecoder(descriptorFile, message, timestampField, unit, clientIDField, messageIDField string) (*protobufDecoder, error) {
+	messages, err := readProtoDescriptors(descriptorFile)
+	if err != nil {
+		return nil, err
+	}
+	message = "." + strings.TrimPrefix(message, ".")
+	if _, ok := messages[message]; !ok {
+		return nil, fmt.Errorf("protobuf message %v not found in %v", strings.TrimPrefix(message, "."), descriptorFile)
+	}
+	d := &protobufDecoder{unit: timestampUnits[unit]}
+	if d.unit == 0 {
+		return nil, fmt.Errorf("invalid timestamp unit %v, expected ns, us, ms or s", unit)
+	}
+	if d.timestamp, err = messages.path(message, timestampField); err != nil {
+		return nil, err
+	}
+	last := d.timestamp[len(d.timestamp)-1]
+	if last.typeName != protoTimestamp && !protoInteger(last.kind) && last.kind != protoTypeDouble {
+		return nil, fmt.Errorf("timestamp field %v should be a number or %v", timestampField, protoTimestamp[1:])
+	}
+	if clientIDField != "" {
+		if d.clientID, err = messages.path(message, clientIDField); err != nil {
+			return nil, err
+		}
+		if !protoInteger(d.clientID[len(d.clientID)-1].kind) {
+			return nil, fmt.Errorf("publisher id field %v should be an integer", clientIDField)
+		}
+	}
+	if messageIDField != "" {
+		if d.messageID, err = messages.path(message, messageIDField); err != nil {
+			return nil, err
+		}
+		if !protoInteger(d.messageID[len(d.messageID)-1].kind) {
+			return nil, fmt.Errorf("message id field %v should be an integer", messageIDField)
+		}
+	}
+
+	return d, nil
+}
+
+// protoInteger reports whether the field type is an integer
+func protoInteger(kind int) bool {
+	switch kind {
+	case protoTypeInt64, protoTypeUint64, protoTypeInt32, protoTypeFixed64, protoTypeFixed32, protoTypeUint32,
+		protoTypeSfixed32, protoTypeSfixed64, protoTypeSint32, protoTypeSint64:
+		return true
+	}
+
+	return false
+}
+
+func (d *protobufDecoder) decode(data []byte) (Payload, error) {
+	var payload Payload
+	message, f, err := protoLookup(data, d.timestamp)
+	if err != nil {
+		return payload, err
+	}
+	if f.typeName == protoTimestamp {
+		seconds, _, err := protoLookup(message, []protoField{{number: 1, kind: protoTypeInt64}})
+		if err != nil {
+			return payload, err
+		}
+		nanos, _, err := protoLookup(message, []protoField{{number: 2, kind: protoTypeInt32}})
+		if err != nil {
+			return payload, err
+		}
+		payload.GeneratedAt = time.Unix(protoInt(seconds, protoTypeInt64), protoInt(nanos, protoTypeInt32)).UnixNano()
+	} else if f.kind == protoTypeDouble {
+		payload.GeneratedAt = int64(math.Float64frombits(binary.LittleEndian.Uint64(message)) * float64(d.unit))
+	} else {
+		payload.GeneratedAt = protoInt(message, f.kind) * int64(d.unit)
+	}
+
+	if d.clientID != nil {
+		value, f, err := protoLookup(data, d.clientID)
+		if err != nil {
+			return payload, err
+		}
+		payload.ClientId = int(protoInt(value, f.kind))
+	}
+	if d.messageID != nil {
+		value, f, err := protoLookup(data, d.messageID)
+		if err != nil {
+			return payload, err
+		}
+		payload.MessageId = int(protoInt(value, f.kind))
+	}
+
+	return payload, nil
+}
+
+func (d *protobufDecoder) messageIDs() bool {
+	return d.messageID != nil
+}
+
+// protoLookup returns the encoded value of the field at the end of path in message, varints encoded as
+// 8 bytes little-endian. A missing field has the default value, i.e. 0 for numbers and an empty message.
+func protoLookup(message []byte, path []protoField) ([]byte, protoField, error) {
+	f := path[0]
+	var found []byte
+	err := protoScan(message, func(field, wireType int, varint uint64, value []byte) error {
+		if field != f.number {
+			return nil
+		}
+		// the last occurrence of a field wins
+		if wireType == protoVarint {
+			value = make([]byte, 8)
+			binary.LittleEndian.PutUint64(value, varint)
+		}
+		found = value
+		return nil
+	})
+	if err != nil {
+		return nil, f, err
+	}
+	if len(path) > 1 {
+		return protoLookup(found, path[1:])
+	}
+	if found == nil && f.typeName != protoTimestamp {
+		found = make([]byte, 8)
+	}
+
+	return found, f, nil
+}
+
+// protoInt decodes the integer value returned by protoLookup for a field of the given type
+func protoInt(value []byte, kind int) int64 {
+	if len(value) == 4 {
+		value = append(value[:4:4], 0, 0, 0, 0)
+	}
+	if len(value) < 8 {
+		return 0
+	}
+	n := binary.LittleEndian.Uint64(value)
+	switch kind {
+	case protoTypeSint32, protoTypeSint64:
+		return int64(n>>1) ^ -int64(n&1)
+	case protoTypeInt32, protoTypeSfixed32:
+		return int64(int32(n))
+	default:
+		return int64(n)
+	}
+}
@@ -0,0 +1,81 @@
+package subscriber
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// protocolVersion returns the protocol level sent in the CONNECT packet for the -protocol-version flag.
+// paho.mqtt.golang speaks MQTT 3.1 and 3.1.1 only, the clients connect with the native client for MQTT 5.0.
+func protocolVersion(version string) (uint, error) {
+	switch version {
+	case "3.1":
+		return 3, nil
+	case "3.1.1":
+		return 4, nil
+	case "5", "5.0":
+		return 5, nil
+	default:
+		return 0, fmt.Errorf("invalid protocol version %v, expected 3.1, 3.1.1 or 5.0", version)
+	}
+}
+
+// maxSessionExpiry is the longest Session Expiry Interval that expires, the next one never does
+const maxSessionExpiry = (sessionNeverExpires - 1) * time.Second
+
+// maxSubscriptionID is the largest Subscription Identifier, a variable byte integer of at most four bytes
+const maxSubscriptionID = 268435455
+
+// maxMaximumPacketSize is the largest Maximum Packet Size, a four byte integer
+const maxMaximumPacketSize = 1<<32 - 1
+
+// maxReceiveMaximum is the largest Receive Maximum, a two byte integer and the default of the brokers
+const maxReceiveMaximum = 65535
+
+// SubscriptionOptions are the MQTT 5.0 subscription options, the native client subscribes with them. The zero
+// value is the behaviour of MQTT 3.1.1, whose SUBSCRIBE carries the requested QoS only.
+type SubscriptionOptions struct {
+	NoLocal           bool
+	RetainAsPublished bool
+	RetainHandling    int // 0 sends the retained messages on every subscribe, 1 on a new subscription only, 2 never
+	SubscriptionID    int // 0 is none
+}
+
+// check validates the options, those other than the zero value need MQTT 5.0 (protocol level 5)
+func (o SubscriptionOptions) check(level uint) error {
+	if o.RetainHandling < 0 || o.RetainHandling > 2 {
+		return fmt.Errorf("retain-handling should be 0, 1 or 2, given: %v", o.RetainHandling)
+	}
+	if o.SubscriptionID < 0 || o.SubscriptionID > maxSubscriptionID {
+		return fmt.Errorf("subscription-id should be between 1 and %d, given: %v", maxSubscriptionID, o.SubscriptionID)
+	}
+	if o != (SubscriptionOptions{}) && level != 5 {
+		return fmt.Errorf("-no-local, -retain-as-published, -retain-handling and -subscription-id require -protocol-version 5.0")
+	}
+
+	return nil
+}
+
+// flags returns the subscription options byte of a topic filter subscribed with qos
+func (o SubscriptionOptions) flags(qos byte) byte {
+	flags := qos | byte(o.RetainHandling)<<4
+	if o.NoLocal {
+		flags |= 0x04
+	}
+	if o.RetainAsPublished {
+		flags |= 0x08
+	}
+
+	return flags
+}
+
+func (o SubscriptionOptions) results() *results.SubscriptionOptions {
+	return &results.SubscriptionOptions{
+		NoLocal:           o.NoLocal,
+		RetainAsPublished: o.RetainAsPublished,
+		RetainHandling:    o.RetainHandling,
+		SubscriptionID:    o.SubscriptionID,
+	}
+}
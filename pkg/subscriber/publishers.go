@@ -0,0 +1,70 @@
+package subscriber
+
+import (
+	"sort"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// publisherCounter counts the distinct MessageIds received per publisher ClientId
+type publisherCounter map[int]map[int]bool
+
+func (p publisherCounter) received(m *Message) {
+	ids, ok := p[m.Payload.ClientId]
+	if !ok {
+		ids = make(map[int]bool)
+		p[m.Payload.ClientId] = ids
+	}
+	ids[m.Payload.MessageId] = true
+}
+
+// results returns the counts per publisher sorted by ClientId, publishers that were expected but not
+// observed at all can't be known and are left out
+func (p publisherCounter) results(expected int64) []*results.PublisherCount {
+	counts := make([]*results.PublisherCount, 0, len(p))
+	for clientID, ids := range p {
+		counts = append(counts, newPublisherCount(clientID, int64(len(ids)), expected))
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].ClientID < counts[j].ClientID
+	})
+
+	return counts
+}
+
+func newPublisherCount(clientID int, received, expected int64) *results.PublisherCount {
+	res := &results.PublisherCount{
+		ClientID: clientID,
+		Received: received,
+		Expected: expected,
+	}
+	if received < expected {
+		res.Missing = expected - received
+	}
+
+	return res
+}
+
+func calculatePublisherTotals(runs []*results.RunResults) []*results.PublisherCount {
+	received := make(map[int]int64)
+	expected := make(map[int]int64)
+	for _, res := range runs {
+		for _, count := range res.Publishers {
+			received[count.ClientID] += count.Received
+			expected[count.ClientID] += count.Expected
+		}
+	}
+	if len(received) == 0 {
+		return nil
+	}
+
+	totals := make([]*results.PublisherCount, 0, len(received))
+	for clientID := range received {
+		totals = append(totals, newPublisherCount(clientID, received[clientID], expected[clientID]))
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].ClientID < totals[j].ClientID
+	})
+
+	return totals
+}
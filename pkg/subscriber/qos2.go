@@ -0,0 +1,241 @@
+package subscriber
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// MQTT control packet types of the QoS 2 exchange
+const (
+	packetPublish = 3
+	packetPubRec  = 5
+	packetPubRel  = 6
+	packetPubComp = 7
+)
+
+// packetScanner follows the MQTT packets in one direction of a connection. paho does not expose the
+// acknowledgement packets, so the exchange is timed by watching the bytes it reads and writes.
+type packetScanner struct {
+	first     byte // first byte of the fixed header, 0 while waiting for the next packet
+	length    int  // remaining length decoded so far
+	shift     uint
+	inBody    bool
+	remaining int    // bytes of the packet body not scanned yet
+	need      int    // bytes of the body needed to find the packet identifier
+	body      []byte // the first need bytes of the body
+}
+
+// scan scans the next bytes of the stream, emit is called with the type and identifier of every
+// complete PUBLISH (QoS 2 only), PUBREC, PUBREL and PUBCOMP packet
+func (s *packetScanner) scan(p []byte, emit func(kind byte, id uint16)) {
+	for len(p) > 0 {
+		if !s.inBody {
+			b := p[0]
+			p = p[1:]
+			if s.first == 0 {
+				s.first, s.length, s.shift = b, 0, 0
+				continue
+			}
+			s.length |= int(b&127) << s.shift
+			s.shift += 7
+			if b&128 != 0 {
+				continue
+			}
+			s.inBody = true
+			s.remaining = s.length
+			s.body = s.body[:0]
+			switch s.first >> 4 {
+			case packetPublish:
+				if (s.first>>1)&3 == 2 {
+					s.need = 2 // topic length, extended once known
+				} else {
+					s.need = 0
+				}
+			case packetPubRec, packetPubRel, packetPubComp:
+				s.need = 2
+			default:
+				s.need = 0
+			}
+		} else {
+			n := s.remaining
+			if want := s.need - len(s.body); want > 0 && want < n {
+				n = want
+			}
+			if n > len(p) {
+				n = len(p)
+			}
+			if len(s.body) < s.need {
+				s.body = append(s.body, p[:n]...)
+				if s.first>>4 == packetPublish && s.need == 2 && len(s.body) == 2 {
+					s.need = 2 + int(binary.BigEndian.Uint16(s.body)) + 2
+				}
+			}
+			p = p[n:]
+			s.remaining -= n
+		}
+		if s.inBody && s.remaining == 0 {
+			if s.need > 0 && len(s.body) == s.need {
+				emit(s.first>>4, binary.BigEndian.Uint16(s.body[s.need-2:]))
+			}
+			s.first, s.inBody = 0, false
+		}
+	}
+}
+
+// qos2Exchange holds the timestamps of the QoS 2 exchange of a single message
+type qos2Exchange struct {
+	published time.Time // PUBLISH received
+	pubrec    time.Time // PUBREC sent
+	pubrel    time.Time // PUBREL received
+}
+
+// qos2Timing times the QoS 2 exchanges of all connections of a client, by packet identifier
+type qos2Timing struct {
+	mu      sync.Mutex
+	pending map[uint16]*qos2Exchange
+	pubrec  []float64
+	pubrel  []float64
+	pubcomp []float64
+	total   []float64
+}
+
+func newQoS2Timing() *qos2Timing {
+	return &qos2Timing{pending: make(map[uint16]*qos2Exchange)}
+}
+
+// received records a packet received from the broker
+func (t *qos2Timing) received(kind byte, id uint16, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch kind {
+	case packetPublish:
+		// a redelivered PUBLISH restarts the exchange
+		t.pending[id] = &qos2Exchange{published: at}
+	case packetPubRel:
+		if ex := t.pending[id]; ex != nil && !ex.pubrec.IsZero() && ex.pubrel.IsZero() {
+			ex.pubrel = at
+		}
+	}
+}
+
+// sent records a packet sent to the broker, the exchange is complete once the PUBCOMP is sent
+func (t *qos2Timing) sent(kind byte, id uint16, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ex := t.pending[id]
+	if ex == nil {
+		return
+	}
+	switch kind {
+	case packetPubRec:
+		if ex.pubrec.IsZero() {
+			ex.pubrec = at
+		}
+	case packetPubComp:
+		if ex.pubrel.IsZero() {
+			return
+		}
+		t.pubrec = append(t.pubrec, float64(ex.pubrec.Sub(ex.published)))
+		t.pubrel = append(t.pubrel, float64(ex.pubrel.Sub(ex.pubrec)))
+		t.pubcomp = append(t.pubcomp, float64(at.Sub(ex.pubrel)))
+		t.total = append(t.total, float64(at.Sub(ex.published)))
+		delete(t.pending, id)
+	}
+}
+
+// qos2Conn is a broker connection whose QoS 2 exchanges are timed
+type qos2Conn struct {
+	net.Conn
+	timing  *qos2Timing
+	in, out packetScanner
+	inMu    sync.Mutex
+	outMu   sync.Mutex
+}
+
+// wrap returns conn with its QoS 2 exchanges timed
+func (t *qos2Timing) wrap(conn net.Conn) net.Conn {
+	return &qos2Conn{Conn: conn, timing: t}
+}
+
+func (c *qos2Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		at := time.Now()
+		c.inMu.Lock()
+		c.in.scan(p[:n], func(kind byte, id uint16) {
+			c.timing.received(kind, id, at)
+		})
+		c.inMu.Unlock()
+	}
+
+	return n, err
+}
+
+func (c *qos2Conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		at := time.Now()
+		c.outMu.Lock()
+		c.out.scan(p[:n], func(kind byte, id uint16) {
+			c.timing.sent(kind, id, at)
+		})
+		c.outMu.Unlock()
+	}
+
+	return n, err
+}
+
+// QoS2Results returns the timing of the client's QoS 2 exchanges, nil if none completed
+func (cc *ClientConn) QoS2Results() *results.QoS2Results {
+	t := cc.qos2
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.total) == 0 {
+		return nil
+	}
+
+	return qos2Results(t.pubrec, t.pubrel, t.pubcomp, t.total, int64(len(t.pending)))
+}
+
+func qos2Results(pubrec, pubrel, pubcomp, total []float64, incomplete int64) *results.QoS2Results {
+	return &results.QoS2Results{
+		Exchanges:    int64(len(total)),
+		Incomplete:   incomplete,
+		PubRec:       phaseDistribution(pubrec),
+		PubRel:       phaseDistribution(pubrel),
+		PubComp:      phaseDistribution(pubcomp),
+		Total:        phaseDistribution(total),
+		PubRecTimes:  pubrec,
+		PubRelTimes:  pubrel,
+		PubCompTimes: pubcomp,
+		TotalTimes:   total,
+	}
+}
+
+// calculateQoS2Totals pools the QoS 2 exchanges of all clients
+func calculateQoS2Totals(runs []*results.RunResults) *results.QoS2Results {
+	var pubrec, pubrel, pubcomp, total []float64
+	var incomplete int64
+	for _, res := range runs {
+		if res.QoS2 == nil {
+			continue
+		}
+		pubrec = append(pubrec, res.QoS2.PubRecTimes...)
+		pubrel = append(pubrel, res.QoS2.PubRelTimes...)
+		pubcomp = append(pubcomp, res.QoS2.PubCompTimes...)
+		total = append(total, res.QoS2.TotalTimes...)
+		incomplete += res.QoS2.Incomplete
+	}
+	if len(total) == 0 {
+		return nil
+	}
+
+	return qos2Results(pubrec, pubrel, pubcomp, total, incomplete)
+}
@@ -0,0 +1,42 @@
+package subscriber
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPacketScanner(t *testing.T) {
+	type packet struct {
+		kind byte
+		id   uint16
+	}
+	var stream bytes.Buffer
+	stream.Write(encodePublish(4, "a/b", 2, false, 7, bytes.Repeat([]byte{'x'}, 300)))
+	stream.Write(encodeAck(packetPubRel, 7))
+	stream.Write(encodePublish(4, "a/b", 1, false, 8, []byte("qos 1")))
+	stream.Write(encodePublish(4, "a/b", 0, false, 0, []byte("qos 0")))
+	stream.Write([]byte{packetPingResp << 4, 0})
+	stream.Write(encodeAck(packetPubRec, 9))
+	stream.Write(encodeAck(packetPubComp, 9))
+	// a QoS 2 PUBLISH with an empty topic and payload
+	stream.Write(encodePublish(4, "", 2, false, 10, nil))
+	want := []packet{{packetPublish, 7}, {packetPubRel, 7}, {packetPubRec, 9}, {packetPubComp, 9}, {packetPublish, 10}}
+
+	// the packets are found however the stream is split into reads
+	for _, size := range []int{1, 2, 3, 7, 64, stream.Len()} {
+		var s packetScanner
+		var got []packet
+		data := stream.Bytes()
+		for len(data) > 0 {
+			n := min(size, len(data))
+			s.scan(data[:n], func(kind byte, id uint16) {
+				got = append(got, packet{kind, id})
+			})
+			data = data[n:]
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("reads of %d bytes: %v, want %v", size, got, want)
+		}
+	}
+}
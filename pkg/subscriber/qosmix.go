@@ -0,0 +1,95 @@
+package subscriber
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// parseQoSMix parses a comma separated list of <qos>=<percentage> entries and distributes the QoS levels
+// over the given number of clients, using the largest remainder method so the distribution sums up to clients
+func parseQoSMix(s string, clients int) ([]byte, error) {
+	var levels []byte
+	var shares []float64
+	var total float64
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		sep := strings.Index(entry, "=")
+		if sep < 0 {
+			return nil, fmt.Errorf("missing '=' in QoS mix entry %q", entry)
+		}
+		qos, err := strconv.Atoi(strings.TrimSpace(entry[:sep]))
+		if err != nil || qos < 0 || qos > 2 {
+			return nil, fmt.Errorf("invalid QoS level in QoS mix entry %q", entry)
+		}
+		share, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(entry[sep+1:]), "%"), 64)
+		if err != nil || share < 0 {
+			return nil, fmt.Errorf("invalid percentage in QoS mix entry %q", entry)
+		}
+		levels = append(levels, byte(qos))
+		shares = append(shares, share)
+		total += share
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("QoS mix %q does not assign any clients", s)
+	}
+
+	counts := make([]int, len(levels))
+	remainders := make([]float64, len(levels))
+	assigned := 0
+	for i, share := range shares {
+		exact := share / total * float64(clients)
+		counts[i] = int(exact)
+		remainders[i] = exact - float64(counts[i])
+		assigned += counts[i]
+	}
+	order := make([]int, len(levels))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+	for i := 0; assigned < clients; i++ {
+		counts[order[i]]++
+		assigned++
+	}
+
+	qosLevels := make([]byte, 0, clients)
+	for i, level := range levels {
+		for j := 0; j < counts[i]; j++ {
+			qosLevels = append(qosLevels, level)
+		}
+	}
+
+	return qosLevels, nil
+}
+
+// calculateQoSResults aggregates the results per QoS level
+func calculateQoSResults(runs []*results.RunResults, totalTime time.Duration) []*results.QoSResults {
+	perQoS := make(map[byte][]*results.RunResults)
+	for _, res := range runs {
+		perQoS[res.QoS] = append(perQoS[res.QoS], res)
+	}
+
+	levels := make([]*results.QoSResults, 0, len(perQoS))
+	for qos, qosResults := range perQoS {
+		levels = append(levels, &results.QoSResults{
+			QoS:          qos,
+			Clients:      len(qosResults),
+			TotalResults: calculateTotalResults(qosResults, totalTime, len(qosResults)),
+		})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].QoS < levels[j].QoS
+	})
+
+	return levels
+}
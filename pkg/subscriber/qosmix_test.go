@@ -0,0 +1,44 @@
+package subscriber
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseQoSMix(t *testing.T) {
+	tests := []struct {
+		mix     string
+		clients int
+		want    []byte
+	}{
+		{"0=50,1=40,2=10", 10, []byte{0, 0, 0, 0, 0, 1, 1, 1, 1, 2}},
+		{"1=100%", 3, []byte{1, 1, 1}},
+		// the largest remainders get the clients left, the first one on a tie
+		{"0=1, 1=1, 2=1", 4, []byte{0, 0, 1, 2}},
+		{"2=3,0=1", 4, []byte{2, 2, 2, 0}},
+	}
+	for _, test := range tests {
+		got, err := parseQoSMix(test.mix, test.clients)
+		if err != nil {
+			t.Errorf("parseQoSMix(%q): %v", test.mix, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("parseQoSMix(%q, %d) = %v, want %v", test.mix, test.clients, got, test.want)
+		}
+	}
+
+	for mix, want := range map[string]string{
+		"0":     "missing '='",
+		"3=10":  "invalid QoS level",
+		"1=x":   "invalid percentage",
+		"1=-5":  "invalid percentage",
+		"0=0,":  "does not assign any clients",
+		" , , ": "does not assign any clients",
+	} {
+		if _, err := parseQoSMix(mix, 10); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseQoSMix(%q): error %v, want %q", mix, err, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package subscriber
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// quantile returns the q-th quantile (0 <= q <= 1) of sorted data using the nearest-rank method
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+// sortedCopy returns a sorted copy of data
+func sortedCopy(data []float64) []float64 {
+	sorted := append([]float64(nil), data...)
+	sort.Float64s(sorted)
+
+	return sorted
+}
+
+// pooledLatencies returns the latencies of all clients
+func pooledLatencies(runs []*results.RunResults) []float64 {
+	var latencies []float64
+	for _, res := range runs {
+		latencies = append(latencies, res.Latencies...)
+	}
+
+	return latencies
+}
+
+// parsePercentiles parses a comma separated list of percentiles, e.g. "50,99,99.9"
+func parsePercentiles(s string) ([]float64, error) {
+	var percentiles []float64
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(strings.TrimPrefix(entry, "p"), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q, expected a number between 0 and 100", entry)
+		}
+		percentiles = append(percentiles, p)
+	}
+
+	return percentiles, nil
+}
+
+// latencyPercentiles returns the given percentiles of the latencies. All latencies are kept anyway, so the
+// percentiles are exact rather than estimated from a histogram. It returns nil without latencies.
+func latencyPercentiles(latencies []float64, percentiles []float64) []*results.Percentile {
+	if len(latencies) == 0 || len(percentiles) == 0 {
+		return nil
+	}
+	sorted := sortedCopy(latencies)
+	res := make([]*results.Percentile, len(percentiles))
+	for i, p := range percentiles {
+		res[i] = &results.Percentile{Percentile: p, Latency: quantile(sorted, p/100)}
+	}
+
+	return res
+}
@@ -0,0 +1,84 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// rampUp spreads the connections of the clients over the ramp-up period and records when each client
+// received its first SUBACK, separating the connect phase from the phase in which all clients receive
+type rampUp struct {
+	start      time.Time
+	planned    time.Duration
+	clients    int
+	mu         sync.Mutex
+	subscribed map[int]time.Time
+}
+
+// newRampUp creates the ramp-up of clients starting at start, connecting at rate clients per second or
+// spread evenly over period; a zero rate and period connect all clients at once
+func newRampUp(start time.Time, clients int, rate float64, period time.Duration) *rampUp {
+	r := &rampUp{
+		start:      start,
+		planned:    period,
+		clients:    clients,
+		subscribed: make(map[int]time.Time),
+	}
+	if rate > 0 && clients > 0 {
+		r.planned = time.Duration(float64(clients-1) / rate * float64(time.Second))
+	}
+
+	return r
+}
+
+// delay returns how long client id waits before connecting
+func (r *rampUp) delay(id int) time.Duration {
+	if r.clients <= 1 {
+		return 0
+	}
+
+	return time.Duration(int64(r.planned) * int64(id) / int64(r.clients-1))
+}
+
+// suback records the first SUBACK of client id, it is safe to call on a nil rampUp
+func (r *rampUp) suback(id int, now time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.subscribed[id]; !ok {
+		r.subscribed[id] = now
+	}
+}
+
+// results reports the connect phase, from the start until the last client subscribed, and the receive
+// phase after it in totals; totalTime is the duration of the whole run
+func (r *rampUp) results(totals *results.TotalResults, totalTime time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := &results.RampUpResults{
+		Planned:    float64(r.planned),
+		Clients:    r.clients,
+		Subscribed: len(r.subscribed),
+	}
+	var first, last time.Duration
+	for _, at := range r.subscribed {
+		since := at.Sub(r.start)
+		if first == 0 || since < first {
+			first = since
+		}
+		if since > last {
+			last = since
+		}
+	}
+	res.FirstSubscribed = float64(first)
+	res.LastSubscribed = float64(last)
+	if totalTime > last {
+		res.ReceivePhase = float64(totalTime - last)
+	}
+	totals.RampUp = res
+}
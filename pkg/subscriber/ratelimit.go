@@ -0,0 +1,34 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter paces the consumers of a client to a maximum rate, without allowing bursts. With -order=false
+// the handlers wait concurrently, each for the next free slot.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newRateLimiter creates a rateLimiter for the given rate in messages per second
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next message may be consumed
+func (l *rateLimiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	slot := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(slot.Sub(now))
+}
@@ -0,0 +1,138 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// missedCounter counts the messages missed during connection losses from the jump in the MessageIds of
+// each publisher between its last message before a loss and its first message after it
+type missedCounter struct {
+	lastIDs   map[int]int
+	idsAtLoss map[int]int
+	missed    int64
+}
+
+// lost remembers the last MessageId of every publisher at a connection loss
+func (m *missedCounter) lost() {
+	m.idsAtLoss = make(map[int]int, len(m.lastIDs))
+	for publisher, id := range m.lastIDs {
+		m.idsAtLoss[publisher] = id
+	}
+}
+
+func (m *missedCounter) received(msg *Message) {
+	if m.lastIDs == nil {
+		m.lastIDs = make(map[int]int)
+	}
+	publisher, id := msg.Payload.ClientId, msg.Payload.MessageId
+	if last, ok := m.idsAtLoss[publisher]; ok {
+		if id > last+1 {
+			m.missed += int64(id - last - 1)
+		}
+		delete(m.idsAtLoss, publisher)
+	}
+	if last, ok := m.lastIDs[publisher]; !ok || id > last {
+		m.lastIDs[publisher] = id
+	}
+}
+
+// reconnectTracker accounts for the connection losses of a client and paho's automatic reconnects. Reconnect
+// attempts are counted from the dials of the client's ClientConn, so only when the connections go through
+// the Dialer.
+type reconnectTracker struct {
+	mu             sync.Mutex
+	losses         int64
+	lostAt         time.Time
+	dialsAtLoss    int64
+	attempts       int64
+	reconnectTimes []float64
+	missed         missedCounter
+}
+
+func (t *reconnectTracker) connectionLost(at time.Time, dials int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.losses++
+	t.lostAt = at
+	t.dialsAtLoss = dials
+	t.missed.lost()
+}
+
+func (t *reconnectTracker) connected(at time.Time, dials int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lostAt.IsZero() {
+		return
+	}
+	t.reconnectTimes = append(t.reconnectTimes, float64(at.Sub(t.lostAt)))
+	t.attempts += dials - t.dialsAtLoss
+	t.lostAt = time.Time{}
+}
+
+func (t *reconnectTracker) received(m *Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.missed.received(m)
+}
+
+// results returns the reconnect results, nil if the client never lost its connection. A client that is
+// still disconnected at end is down until then.
+func (t *reconnectTracker) results(end time.Time, countAttempts bool) *results.ReconnectResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.losses == 0 {
+		return nil
+	}
+
+	res := &results.ReconnectResults{
+		ConnectionLosses: t.losses,
+		Reconnects:       int64(len(t.reconnectTimes)),
+		MissedMessages:   t.missed.missed,
+	}
+	if countAttempts {
+		res.Attempts = t.attempts
+	}
+	if len(t.reconnectTimes) > 0 {
+		res.ReconnectTime = stats.StatsMean(t.reconnectTimes)
+		res.ReconnectTimeMax = stats.StatsMax(t.reconnectTimes)
+		res.Downtime = stats.StatsSum(t.reconnectTimes)
+	}
+	if !t.lostAt.IsZero() && end.After(t.lostAt) {
+		res.Downtime += float64(end.Sub(t.lostAt))
+	}
+
+	return res
+}
+
+func calculateReconnectTotals(runs []*results.RunResults) *results.ReconnectResults {
+	var totals *results.ReconnectResults
+	var reconnectTime float64
+	for _, res := range runs {
+		if res.Reconnect == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.ReconnectResults)
+		}
+		totals.ConnectionLosses += res.Reconnect.ConnectionLosses
+		totals.Reconnects += res.Reconnect.Reconnects
+		totals.Attempts += res.Reconnect.Attempts
+		totals.Downtime += res.Reconnect.Downtime
+		totals.MissedMessages += res.Reconnect.MissedMessages
+		if res.Reconnect.ReconnectTimeMax > totals.ReconnectTimeMax {
+			totals.ReconnectTimeMax = res.Reconnect.ReconnectTimeMax
+		}
+		reconnectTime += res.Reconnect.ReconnectTime * float64(res.Reconnect.Reconnects)
+	}
+	if totals != nil && totals.Reconnects > 0 {
+		// every reconnect weighs the same
+		totals.ReconnectTime = reconnectTime / float64(totals.Reconnects)
+	}
+
+	return totals
+}
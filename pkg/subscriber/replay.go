@@ -0,0 +1,167 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// writeRawSamples writes the samples of all clients of the run started at start to path
+func writeRawSamples(path string, jr *results.JSONResults, start time.Time) error {
+	raw := &results.RawSamples{
+		SchemaVersion: results.SchemaVersion,
+		RunID:         jr.RunID,
+		Seed:          jr.Seed,
+		Labels:        jr.Labels,
+		Start:         start.UnixNano(),
+	}
+	for _, res := range jr.Runs {
+		raw.Clients = append(raw.Clients, &results.ClientSamples{
+			ID:         res.ID,
+			Broker:     res.Broker,
+			Tenant:     res.Tenant,
+			QoS:        res.QoS,
+			ReceivedAt: res.ReceivedAt,
+			Latencies:  res.Latencies,
+		})
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// runReplay implements the replay subcommand, which calculates and reports the results of a run again
+// from its raw samples, e.g. with another warm-up or output format
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var (
+		samplesFile = fs.String("samples", "", "Path to the raw samples written by -samples-file")
+		format      = fs.String("format", "text", "Output format: text|json|csv")
+		warmup      = fs.Duration("warmup", 0, "Ignore the messages received within this time after the start of the run")
+		percentList = fs.String("percentiles", "50,90,95,99,99.9", "Comma separated latency percentiles to report per client and over all clients (disabled if empty)")
+		bootstrap   = fs.Int("bootstrap", 0, "Number of bootstrap resamples for confidence intervals of mean and p99 latency (0 disables)")
+		confidence  = fs.Float64("confidence", 0.95, "Confidence level of the bootstrap confidence intervals")
+		apdexT      = fs.Duration("apdex-satisfied", 0, "Latency threshold up to which messages count as satisfied for the Apdex score (0 disables)")
+		apdexF      = fs.Duration("apdex-tolerating", 0, "Latency threshold up to which messages count as tolerating for the Apdex score (default 4x -apdex-satisfied)")
+		seed        = fs.Int64("seed", 0, "Seed for the bootstrap resamples (the seed of the run if 0)")
+	)
+	fs.Parse(args)
+
+	if *samplesFile == "" {
+		fatalf("Invalid arguments: -samples is required")
+	}
+	if *warmup < 0 {
+		fatalf("Invalid arguments: warmup should be >= 0, given: %v", *warmup)
+	}
+	if *bootstrap < 0 {
+		fatalf("Invalid arguments: bootstrap should be >= 0, given: %v", *bootstrap)
+	}
+	percentiles, err := parsePercentiles(*percentList)
+	if err != nil {
+		fatalf("Invalid arguments: %v", err)
+	}
+	if *confidence <= 0 || *confidence >= 1 {
+		fatalf("Invalid arguments: confidence should be between 0 and 1, given: %v", *confidence)
+	}
+	if *apdexF == 0 {
+		*apdexF = 4 * *apdexT
+	}
+	if *apdexT < 0 || *apdexF < *apdexT {
+		fatalf("Invalid arguments: Apdex thresholds should satisfy 0 <= satisfied <= tolerating, given: %v, %v", *apdexT, *apdexF)
+	}
+
+	var raw results.RawSamples
+	if err := readJSONFile(*samplesFile, &raw); err != nil {
+		fatalf("Error reading raw samples: %v", err)
+	}
+	if raw.SchemaVersion != results.SchemaVersion {
+		fatalf("Error reading raw samples: schema version %v is not supported", raw.SchemaVersion)
+	}
+	if *seed == 0 {
+		*seed = raw.Seed
+	}
+
+	measureFrom := raw.Start + int64(*warmup)
+	var runs []*results.RunResults
+	var first, last int64
+	for _, samples := range raw.Clients {
+		if len(samples.ReceivedAt) != len(samples.Latencies) {
+			fatalf("Error reading raw samples: client %v has %v receive times for %v latencies",
+				samples.ID, len(samples.ReceivedAt), len(samples.Latencies))
+		}
+		res := replayClient(samples, measureFrom)
+		if res.Successes == 0 {
+			logf(levelWarn, "CLIENT %v has less than two samples after the warm-up, it is left out", samples.ID)
+			continue
+		}
+		res.Percentiles = latencyPercentiles(res.Latencies, percentiles)
+		if *apdexT > 0 {
+			res.Apdex = calculateApdex(res.Latencies, *apdexT, *apdexF)
+		}
+		if *bootstrap > 0 {
+			res.Confidence = bootstrapConfidence(res.Latencies, *bootstrap, *confidence, *seed+int64(res.ID))
+		}
+		if first == 0 || res.ReceivedAt[0] < first {
+			first = res.ReceivedAt[0]
+		}
+		if end := res.ReceivedAt[len(res.ReceivedAt)-1]; end > last {
+			last = end
+		}
+		runs = append(runs, res)
+	}
+	if len(runs) == 0 {
+		fatalf("Error replaying %v: no samples left after the warm-up", *samplesFile)
+	}
+
+	totals := calculateTotalResults(runs, time.Duration(last-first), len(runs))
+	totals.Percentiles = latencyPercentiles(pooledLatencies(runs), percentiles)
+	if *bootstrap > 0 {
+		totals.Confidence = bootstrapConfidence(pooledLatencies(runs), *bootstrap, *confidence, *seed)
+	}
+	printResults(os.Stdout, &results.JSONResults{
+		SchemaVersion: results.SchemaVersion,
+		RunID:         raw.RunID,
+		Seed:          raw.Seed,
+		Labels:        raw.Labels,
+		Runs:          runs,
+		Totals:        totals,
+	}, *format)
+}
+
+// replayClient calculates the results of a single client from the samples received from measureFrom
+// (unix nanoseconds) on, the run time spans the first to the last of these samples. Without at least
+// two samples no results are calculated.
+func replayClient(samples *results.ClientSamples, measureFrom int64) *results.RunResults {
+	res := &results.RunResults{
+		ID:     samples.ID,
+		Broker: samples.Broker,
+		Tenant: samples.Tenant,
+		QoS:    samples.QoS,
+	}
+	perSecond := make(map[int64]int64)
+	latencies := newLatencyStats()
+	for i, receivedAt := range samples.ReceivedAt {
+		if receivedAt < measureFrom {
+			res.WarmupMessages++
+			continue
+		}
+		res.ReceivedAt = append(res.ReceivedAt, receivedAt)
+		res.Latencies = append(res.Latencies, samples.Latencies[i])
+		latencies.add(samples.Latencies[i])
+		perSecond[receivedAt/int64(time.Second)]++
+	}
+	if len(res.Latencies) < 2 {
+		return res
+	}
+	res.MeasuredFrom, res.MeasuredTo = res.ReceivedAt[0], res.ReceivedAt[len(res.ReceivedAt)-1]
+	summarize(res, latencies, perSecond, time.Duration(res.MeasuredTo-res.MeasuredFrom))
+
+	return res
+}
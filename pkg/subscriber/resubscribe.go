@@ -0,0 +1,155 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// resubscribeTracker periodically unsubscribes and resubscribes a client, measuring the UNSUBACK/SUBACK
+// latencies and the messages missed during the gap based on the publishers' MessageIds
+type resubscribeTracker struct {
+	mu               sync.Mutex
+	lastIDs          map[int]int
+	idsAtResubscribe map[int]int
+	unsubscribeTimes []float64
+	resubscribeTimes []float64
+	missed           int64
+	stop             chan struct{}
+	stopOnce         sync.Once
+}
+
+func newResubscribeTracker() *resubscribeTracker {
+	return &resubscribeTracker{
+		lastIDs: make(map[int]int),
+		stop:    make(chan struct{}),
+	}
+}
+
+// cycle unsubscribes the client every interval and resubscribes it after gap, until the tracker is stopped
+func (t *resubscribeTracker) cycle(c *Client, every, gap time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// the client of c changes when it goes offline
+		client := c.currentMQTTClient()
+		unsubscribeStart := time.Now()
+		c.events.log(c.ID, eventUnsubscribe, nil)
+		token := c.unsubscribe(client)
+		token.Wait()
+		if token.Error() != nil {
+			c.events.log(c.ID, eventUnsubscribeError, token.Error())
+			c.logf(levelWarn, "had error unsubscribing from the broker: %v", token.Error())
+			continue
+		}
+		unsubscribeTime := time.Since(unsubscribeStart)
+		c.events.log(c.ID, eventUnsuback, nil)
+
+		select {
+		case <-t.stop:
+			return
+		case <-time.After(gap):
+		}
+
+		// messages still in flight when unsubscribing have been received by now
+		t.mu.Lock()
+		t.idsAtResubscribe = make(map[int]int, len(t.lastIDs))
+		for publisher, id := range t.lastIDs {
+			t.idsAtResubscribe[publisher] = id
+		}
+		t.mu.Unlock()
+
+		subscribeStart := time.Now()
+		c.events.log(c.ID, eventSubscribe, nil)
+		token = c.subscribe(client)
+		token.Wait()
+		if token.Error() != nil {
+			c.events.log(c.ID, eventSubscribeError, token.Error())
+			c.logf(levelWarn, "had error resubscribing to the broker: %v", token.Error())
+			continue
+		}
+		resubscribeTime := time.Since(subscribeStart)
+		c.events.log(c.ID, eventSuback, nil)
+		c.qos.suback(c, token)
+
+		t.mu.Lock()
+		t.unsubscribeTimes = append(t.unsubscribeTimes, float64(unsubscribeTime))
+		t.resubscribeTimes = append(t.resubscribeTimes, float64(resubscribeTime))
+		t.mu.Unlock()
+	}
+}
+
+func (t *resubscribeTracker) received(m *Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	publisher, id := m.Payload.ClientId, m.Payload.MessageId
+	if last, ok := t.idsAtResubscribe[publisher]; ok && id > last {
+		if id > last+1 {
+			t.missed += int64(id - last - 1)
+		}
+		delete(t.idsAtResubscribe, publisher)
+	}
+	if last, ok := t.lastIDs[publisher]; !ok || id > last {
+		t.lastIDs[publisher] = id
+	}
+}
+
+// results stops cycling and returns the results, it may be called more than once
+func (t *resubscribeTracker) results() *results.ResubscribeResults {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return resubscribeResults(t.unsubscribeTimes, t.resubscribeTimes, t.missed)
+}
+
+func resubscribeResults(unsubscribeTimes, resubscribeTimes []float64, missed int64) *results.ResubscribeResults {
+	res := &results.ResubscribeResults{
+		Cycles:           len(resubscribeTimes),
+		MissedMessages:   missed,
+		UnsubscribeTimes: unsubscribeTimes,
+		ResubscribeTimes: resubscribeTimes,
+	}
+	if len(resubscribeTimes) > 0 {
+		res.UnsubscribeTime = stats.StatsMean(unsubscribeTimes)
+		res.ResubscribeTime = stats.StatsMean(resubscribeTimes)
+		res.ResubscribeTimeMax = stats.StatsMax(resubscribeTimes)
+		res.Unsuback = phaseDistribution(unsubscribeTimes)
+		res.Suback = phaseDistribution(resubscribeTimes)
+	}
+
+	return res
+}
+
+// calculateResubscribeTotals pools the cycles of all clients
+func calculateResubscribeTotals(runs []*results.RunResults) *results.ResubscribeResults {
+	var unsubscribeTimes, resubscribeTimes []float64
+	var missed int64
+	resubscribed := false
+	for _, res := range runs {
+		r := res.Resubscribe
+		if r == nil {
+			continue
+		}
+		resubscribed = true
+		unsubscribeTimes = append(unsubscribeTimes, r.UnsubscribeTimes...)
+		resubscribeTimes = append(resubscribeTimes, r.ResubscribeTimes...)
+		missed += r.MissedMessages
+	}
+	if !resubscribed {
+		return nil
+	}
+
+	return resubscribeResults(unsubscribeTimes, resubscribeTimes, missed)
+}
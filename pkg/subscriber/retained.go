@@ -0,0 +1,100 @@
+package subscriber
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// retainedTracker measures how fast the broker delivers its retained messages after a client subscribes,
+// and counts the retained and live deliveries by the retain flag of the PUBLISH packets
+type retainedTracker struct {
+	mu              sync.Mutex
+	subscribedAt    int64
+	firstRetainedAt int64
+	lastRetainedAt  int64
+	retained        int64
+	live            int64
+}
+
+// subscribing records the time the first subscription was sent
+func (t *retainedTracker) subscribing(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.subscribedAt == 0 {
+		t.subscribedAt = now.UnixNano()
+	}
+}
+
+func (t *retainedTracker) received(m *Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !m.Retained {
+		t.live++
+		return
+	}
+	t.retained++
+	if t.firstRetainedAt == 0 {
+		t.firstRetainedAt = m.ReceivedAt
+	}
+	t.lastRetainedAt = m.ReceivedAt
+}
+
+func (t *retainedTracker) results() *results.RetainedResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	res := &results.RetainedResults{
+		RetainedMessages: t.retained,
+		LiveMessages:     t.live,
+	}
+	if t.subscribedAt > 0 && t.firstRetainedAt > t.subscribedAt {
+		res.TimeToFirstRetained = float64(t.firstRetainedAt - t.subscribedAt)
+		res.TimeToFirstRetainedMax = res.TimeToFirstRetained
+	}
+	if t.subscribedAt > 0 && t.lastRetainedAt > t.subscribedAt {
+		res.RetainedDeliveryTime = float64(t.lastRetainedAt - t.subscribedAt)
+		res.RetainedDeliveryTimeMax = res.RetainedDeliveryTime
+	}
+
+	return res
+}
+
+func calculateRetainedTotals(runs []*results.RunResults) *results.RetainedResults {
+	var totals *results.RetainedResults
+	var firstRetainedTimes, deliveryTimes []float64
+	for _, res := range runs {
+		r := res.Retained
+		if r == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.RetainedResults)
+		}
+		totals.RetainedMessages += r.RetainedMessages
+		totals.LiveMessages += r.LiveMessages
+		if r.RetainedMessages == 0 {
+			continue
+		}
+		firstRetainedTimes = append(firstRetainedTimes, r.TimeToFirstRetained)
+		deliveryTimes = append(deliveryTimes, r.RetainedDeliveryTime)
+		if r.TimeToFirstRetainedMax > totals.TimeToFirstRetainedMax {
+			totals.TimeToFirstRetainedMax = r.TimeToFirstRetainedMax
+		}
+		if r.RetainedDeliveryTimeMax > totals.RetainedDeliveryTimeMax {
+			totals.RetainedDeliveryTimeMax = r.RetainedDeliveryTimeMax
+		}
+	}
+	if totals == nil {
+		return nil
+	}
+	if len(firstRetainedTimes) > 0 {
+		totals.TimeToFirstRetained = stats.StatsMean(firstRetainedTimes)
+		totals.RetainedDeliveryTime = stats.StatsMean(deliveryTimes)
+	}
+
+	return totals
+}
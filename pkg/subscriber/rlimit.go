@@ -0,0 +1,29 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package subscriber
+
+import "syscall"
+
+// ensureFDLimit raises the soft RLIMIT_NOFILE towards required (capped by the hard limit)
+// and returns the resulting soft limit
+func ensureFDLimit(required uint64) (uint64, error) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, err
+	}
+	if rlim.Cur >= required {
+		return rlim.Cur, nil
+	}
+
+	current := rlim.Cur
+	rlim.Cur = required
+	if rlim.Cur > rlim.Max {
+		rlim.Cur = rlim.Max
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return current, err
+	}
+
+	return rlim.Cur, nil
+}
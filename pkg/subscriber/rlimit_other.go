@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package subscriber
+
+import "math"
+
+// ensureFDLimit does not check or raise the file descriptor limit on other platforms
+func ensureFDLimit(required uint64) (uint64, error) {
+	return math.MaxUint64, nil
+}
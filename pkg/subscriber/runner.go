@@ -0,0 +1,79 @@
+// Package subscriber implements the MQTT subscriber benchmark: Clients that measure the latency of the
+// messages sent by mqtt-benchmark-publisher and a Runner that runs a set of them and aggregates their
+// results, so other programs and test harnesses can embed the benchmark. The command line tool in
+// cmd/mqtt-benchmark-subscriber is a thin wrapper around Main.
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// Runner runs a set of clients concurrently and aggregates their results like the command line tool
+type Runner struct {
+	Clients []*Client
+	// Percentiles of the latency to report over all clients, e.g. 50, 99, 99.9
+	Percentiles []float64
+	RunID       string
+	Labels      map[string]string
+}
+
+// Run runs the clients until all received their messages or ctx is done, in which case the results are
+// those of the messages received so far and marked as truncated. The runs are ordered by client ID.
+func (r *Runner) Run(ctx context.Context) (*results.JSONResults, error) {
+	if len(r.Clients) == 0 {
+		return nil, errors.New("no clients to run")
+	}
+
+	resCh := make(chan *results.RunResults)
+	start := time.Now()
+	for _, c := range r.Clients {
+		go c.Run(ctx, resCh)
+	}
+	runs := make([]*results.RunResults, len(r.Clients))
+	for i := range runs {
+		runs[i] = <-resCh
+	}
+	totalTime := time.Since(start)
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ID < runs[j].ID
+	})
+
+	totals := calculateTotalResults(runs, totalTime, len(runs))
+	totals.Percentiles = pooledPercentiles(runs, r.Percentiles)
+
+	return &results.JSONResults{
+		SchemaVersion: results.SchemaVersion,
+		RunID:         r.RunID,
+		Labels:        r.Labels,
+		Runs:          runs,
+		Totals:        totals,
+	}, nil
+}
+
+// WriteResults writes the results to w in the given format: text, json or csv
+func WriteResults(w io.Writer, jr *results.JSONResults, format string) error {
+	switch format {
+	case "text":
+		printResults(w, jr, format)
+		return nil
+	case "json":
+		data, err := json.MarshalIndent(jr, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		return printCSV(w, jr)
+	default:
+		return fmt.Errorf("invalid output format %v, expected text, json or csv", format)
+	}
+}
@@ -0,0 +1,125 @@
+package subscriber
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// SelfMonitor measures the resources the subscriber itself uses during the run: its CPU time, the peak heap
+// and goroutines sampled at an interval, and the allocations and GC pauses from the runtime
+type SelfMonitor struct {
+	mu             sync.Mutex
+	started        time.Time
+	user, system   time.Duration
+	before         runtime.MemStats
+	heapPeak       uint64
+	goroutinesPeak int
+	stop           chan struct{}
+	done           chan struct{}
+}
+
+// startSelfMonitor starts sampling the heap and goroutines every interval
+func startSelfMonitor(interval time.Duration) *SelfMonitor {
+	m := &SelfMonitor{
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	m.user, m.system, _ = processCPUTime()
+	runtime.ReadMemStats(&m.before)
+	m.heapPeak = m.before.HeapAlloc
+	m.goroutinesPeak = runtime.NumGoroutine()
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				var stats runtime.MemStats
+				runtime.ReadMemStats(&stats)
+				m.sample(&stats)
+			}
+		}
+	}()
+
+	return m
+}
+
+func (m *SelfMonitor) sample(stats *runtime.MemStats) {
+	goroutines := runtime.NumGoroutine()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stats.HeapAlloc > m.heapPeak {
+		m.heapPeak = stats.HeapAlloc
+	}
+	if goroutines > m.goroutinesPeak {
+		m.goroutinesPeak = goroutines
+	}
+}
+
+// Stop stops sampling and returns the resources used since the start
+func (m *SelfMonitor) Stop() *results.SelfResults {
+	close(m.stop)
+	<-m.done
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	m.sample(&after)
+	elapsed := time.Since(m.started)
+
+	res := &results.SelfResults{
+		HeapPeak:       m.heapPeak,
+		SysMemory:      after.Sys,
+		Allocated:      after.TotalAlloc - m.before.TotalAlloc,
+		GoroutinesPeak: m.goroutinesPeak,
+		GCCycles:       after.NumGC - m.before.NumGC,
+		GCPauseTotal:   float64(after.PauseTotalNs - m.before.PauseTotalNs),
+	}
+	if user, system, ok := processCPUTime(); ok {
+		res.CPUUser = float64(user - m.user)
+		res.CPUSystem = float64(system - m.system)
+		res.CPUCores = (res.CPUUser + res.CPUSystem) / float64(elapsed)
+	}
+	// the runtime keeps the pauses of the last 256 cycles
+	cycles := res.GCCycles
+	if cycles > uint32(len(after.PauseNs)) {
+		cycles = uint32(len(after.PauseNs))
+	}
+	for i := uint32(0); i < cycles; i++ {
+		pause := float64(after.PauseNs[(after.NumGC-i+255)%256])
+		if pause > res.GCPauseMax {
+			res.GCPauseMax = pause
+		}
+	}
+
+	return res
+}
+
+// startPprof serves the pprof profiles on /debug/pprof/ at addr
+func startPprof(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logf(levelError, "Error serving pprof: %v", err)
+		}
+	}()
+
+	return nil
+}
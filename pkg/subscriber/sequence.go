@@ -0,0 +1,133 @@
+package subscriber
+
+import (
+	"sort"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// maxMissingRanges bounds the ranges of missing MessageIds listed per client, all missing messages are counted
+const maxMissingRanges = 1000
+
+// sequenceTracker follows the MessageIds received per publisher ClientId to detect lost, out-of-order and
+// duplicate messages. The displacement of an out-of-order message is the number of later MessageIds of its
+// publisher received before it. Every publisher numbers its messages consecutively, the sequence starts at the first
+// message received from it, so messages published before the client subscribed do not count as lost. The
+// (ClientId, MessageId) pairs seen are the ids up to the last one except the missing ranges, so its memory
+// grows with the gaps rather than with the messages.
+type sequenceTracker map[int]*publisherSequence
+
+// publisherSequence is the state of the sequence of a single publisher
+type publisherSequence struct {
+	first      int      // MessageId the sequence started at
+	last       int      // highest MessageId received
+	missing    [][2]int // sorted, disjoint ranges [first, last] of MessageIds not received (yet)
+	gaps       int64
+	outOfOrder int64
+	duplicates int64
+
+	maxDisplacement int64
+	outOfOrderQoS   [3]int64 // out-of-order messages by the QoS they were delivered with
+}
+
+func (s sequenceTracker) received(m *Message) {
+	id := m.Payload.MessageId
+	seq, ok := s[m.Payload.ClientId]
+	if !ok {
+		s[m.Payload.ClientId] = &publisherSequence{first: id, last: id}
+		return
+	}
+	switch {
+	case id == seq.last+1:
+		seq.last = id
+	case id > seq.last+1:
+		seq.gaps++
+		seq.missing = append(seq.missing, [2]int{seq.last + 1, id - 1})
+		seq.last = id
+	case id < seq.first:
+		// published before the sequence started, it can't be told apart from a duplicate
+	case seq.fill(id):
+		seq.outOfOrder++
+		if displacement := int64(seq.last - id); displacement > seq.maxDisplacement {
+			seq.maxDisplacement = displacement
+		}
+		if m.QoS < 3 {
+			seq.outOfOrderQoS[m.QoS]++
+		}
+	default:
+		seq.duplicates++
+	}
+}
+
+// fill removes id from the missing ranges, it returns false if id was not missing
+func (seq *publisherSequence) fill(id int) bool {
+	i := sort.Search(len(seq.missing), func(i int) bool {
+		return seq.missing[i][1] >= id
+	})
+	if i == len(seq.missing) || seq.missing[i][0] > id {
+		return false
+	}
+	r := &seq.missing[i]
+	switch {
+	case r[0] == r[1]:
+		seq.missing = append(seq.missing[:i], seq.missing[i+1:]...)
+	case id == r[0]:
+		r[0]++
+	case id == r[1]:
+		r[1]--
+	default:
+		// split the range around id
+		upper := [2]int{id + 1, r[1]}
+		r[1] = id - 1
+		seq.missing = append(seq.missing, [2]int{})
+		copy(seq.missing[i+2:], seq.missing[i+1:])
+		seq.missing[i+1] = upper
+	}
+
+	return true
+}
+
+// results sets the lost, out-of-order, gap and duplicate counts and the largest displacement of res and lists
+// the missing MessageIds per publisher
+func (s sequenceTracker) results(res *results.RunResults) {
+	publishers := make([]int, 0, len(s))
+	for clientID := range s {
+		publishers = append(publishers, clientID)
+	}
+	sort.Ints(publishers)
+
+	ranges := 0
+	for _, clientID := range publishers {
+		seq := s[clientID]
+		res.Gaps += seq.gaps
+		res.OutOfOrder += seq.outOfOrder
+		res.DuplicateDeliveries += seq.duplicates
+		if seq.maxDisplacement > res.MaxDisplacement {
+			res.MaxDisplacement = seq.maxDisplacement
+		}
+		for qos, count := range seq.outOfOrderQoS {
+			if count == 0 {
+				continue
+			}
+			if res.OutOfOrderQoS == nil {
+				res.OutOfOrderQoS = make(map[int]int64)
+			}
+			res.OutOfOrderQoS[qos] += count
+		}
+		for _, r := range seq.missing {
+			res.Lost += int64(r[1] - r[0] + 1)
+		}
+		if len(seq.missing) == 0 || ranges == maxMissingRanges {
+			continue
+		}
+		missing := seq.missing
+		if len(missing) > maxMissingRanges-ranges {
+			missing = missing[:maxMissingRanges-ranges]
+		}
+		ranges += len(missing)
+		res.MissingIDs = append(res.MissingIDs, &results.MissingIDs{
+			ClientID: clientID,
+			Ranges:   missing,
+		})
+	}
+}
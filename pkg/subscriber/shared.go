@@ -0,0 +1,109 @@
+package subscriber
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/GaryBoone/GoStats/stats"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// sharedTopic returns the shared subscription of topic for group, i.e. '$share/<group>/<topic>'
+func sharedTopic(group, topic string) string {
+	return "$share/" + group + "/" + topic
+}
+
+// sharedGroup coordinates the clients that consume a shared subscription. The broker delivers every
+// message to one client of the group, so the count applies to the group and the MessageId sequences of
+// the publishers are followed over the group instead of per client.
+type sharedGroup struct {
+	name    string
+	limit   int64 // messages to receive by the group, 0 to receive until stopped
+	claimed int64 // atomic
+	done    chan struct{}
+
+	mu        sync.Mutex
+	sequences sequenceTracker
+}
+
+func newSharedGroup(name string, count int64) *sharedGroup {
+	return &sharedGroup{
+		name:      name,
+		limit:     count,
+		done:      make(chan struct{}),
+		sequences: make(sequenceTracker),
+	}
+}
+
+// claim counts a message towards the group, it returns false once the group received all messages
+func (g *sharedGroup) claim() bool {
+	n := atomic.AddInt64(&g.claimed, 1)
+	if g.limit > 0 && n > g.limit {
+		return false
+	}
+	if n == g.limit {
+		close(g.done)
+	}
+
+	return true
+}
+
+// completed returns a channel that is closed once the group received all messages, it is nil (never
+// ready) for a nil sharedGroup
+func (g *sharedGroup) completed() <-chan struct{} {
+	if g == nil {
+		return nil
+	}
+
+	return g.done
+}
+
+// received follows the MessageId of a message received by any client of the group
+func (g *sharedGroup) received(m *Message) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sequences.received(m)
+}
+
+// results sets the lost, out-of-order and gap counts and the largest displacement of totals over the group and describes how the
+// messages were distributed over the clients
+func (g *sharedGroup) results(runs []*results.RunResults, totals *results.TotalResults) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var sequences results.RunResults
+	g.sequences.results(&sequences)
+	totals.Lost = sequences.Lost
+	totals.OutOfOrder = sequences.OutOfOrder
+	totals.Gaps = sequences.Gaps
+	totals.MaxDisplacement = sequences.MaxDisplacement
+	totals.OutOfOrderQoS = sequences.OutOfOrderQoS
+
+	perClient := make([]float64, len(runs))
+	var sum, sumSquares float64
+	shared := &results.SharedGroupResults{
+		Group:   g.name,
+		Clients: len(runs),
+	}
+	for i, res := range runs {
+		perClient[i] = float64(res.Successes)
+		sum += perClient[i]
+		sumSquares += perClient[i] * perClient[i]
+		shared.Messages += res.Successes
+		if i == 0 || res.Successes < shared.MinPerClient {
+			shared.MinPerClient = res.Successes
+		}
+		if res.Successes > shared.MaxPerClient {
+			shared.MaxPerClient = res.Successes
+		}
+	}
+	shared.MeanPerClient = stats.StatsMean(perClient)
+	if len(perClient) > 1 {
+		shared.StdPerClient = stats.StatsSampleStandardDeviation(perClient)
+	}
+	// without any messages the fairness is undefined and left 0
+	if sumSquares > 0 {
+		shared.Fairness = sum * sum / (float64(len(perClient)) * sumSquares)
+	}
+	totals.SharedGroup = shared
+}
@@ -0,0 +1,36 @@
+package subscriber
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runContext returns the context the clients run in. It is cancelled after timeout (if > 0) or on SIGINT or
+// SIGTERM, so the clients stop and report what they received so far. A second signal terminates the process.
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-signals:
+			logf(levelInfo, "Received %v, stopping the clients. Interrupt again to exit immediately", s)
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+			if ctx.Err() == context.DeadlineExceeded {
+				logf(levelInfo, "Timeout of %v expired, stopping the clients", timeout)
+			}
+		}
+	}()
+
+	return ctx, cancel
+}
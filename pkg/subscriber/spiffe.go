@@ -0,0 +1,262 @@
+package subscriber
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// spiffeFetchX509SVID is the gRPC method of the SPIFFE Workload API streaming the X.509 SVIDs of the workload
+const spiffeFetchX509SVID = "/SpiffeWorkloadAPI/FetchX509SVID"
+
+// SPIFFESource keeps the X.509 SVID and trust bundle of the workload up to date by watching the
+// SPIFFE Workload API, so clients authenticate with the current identity after every rotation.
+// The Workload API is a gRPC service; the single streaming call is spoken directly over HTTP/2.
+type SPIFFESource struct {
+	network string
+	address string
+	quiet   bool
+
+	mu    sync.RWMutex
+	id    string
+	cert  *tls.Certificate
+	roots *x509.CertPool
+	ready chan struct{}
+}
+
+// spiffeSVID is the part of an X509SVID message of the Workload API the client uses
+type spiffeSVID struct {
+	id     string
+	certs  []byte
+	key    []byte
+	bundle []byte
+}
+
+// NewSPIFFESource connects to the Workload API at socket (unix:///path or tcp://ip:port) and waits
+// until the first SVID is received
+func NewSPIFFESource(socket string, timeout time.Duration, quiet bool) (*SPIFFESource, error) {
+	s := &SPIFFESource{quiet: quiet, ready: make(chan struct{})}
+	switch {
+	case strings.HasPrefix(socket, "unix://"):
+		s.network, s.address = "unix", strings.TrimPrefix(socket, "unix://")
+	case strings.HasPrefix(socket, "unix:"):
+		s.network, s.address = "unix", strings.TrimPrefix(socket, "unix:")
+	case strings.HasPrefix(socket, "tcp://"):
+		s.network, s.address = "tcp", strings.TrimPrefix(socket, "tcp://")
+	default:
+		return nil, fmt.Errorf("invalid SPIFFE Workload API socket %v, expected unix:///path or tcp://ip:port", socket)
+	}
+
+	go s.watch()
+	select {
+	case <-s.ready:
+		return s, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no SVID received from the SPIFFE Workload API at %v within %v", socket, timeout)
+	}
+}
+
+// ID returns the SPIFFE ID of the current SVID
+func (s *SPIFFESource) ID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.id
+}
+
+// Configure makes cfg present the current SVID and verify the broker against the current trust bundle,
+// the broker's certificate must carry serverID as URI SAN if serverID is set
+func (s *SPIFFESource) Configure(cfg *tls.Config, serverID string) {
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		return s.cert, nil
+	}
+	// the broker is authenticated by its SVID instead of its host name
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		return s.verify(rawCerts, serverID)
+	}
+}
+
+func (s *SPIFFESource) verify(rawCerts [][]byte, serverID string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("broker presented no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	s.mu.RLock()
+	roots := s.roots
+	s.mu.RUnlock()
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return err
+	}
+	if serverID == "" {
+		return nil
+	}
+	for _, uri := range certs[0].URIs {
+		if uri.String() == serverID {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("broker certificate does not have SPIFFE ID %v", serverID)
+}
+
+// watch keeps the stream of SVID updates open, reconnecting when it breaks. Like the SVID updates, the
+// reconnects are not logged when quiet.
+func (s *SPIFFESource) watch() {
+	backoff := time.Second
+	for {
+		err := s.fetch()
+		if !s.quiet {
+			logf(levelWarn, "SPIFFE Workload API stream ended: %v, reconnecting in %v", err, backoff)
+		}
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (s *SPIFFESource) fetch() error {
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(string, string, *tls.Config) (net.Conn, error) {
+			return net.Dial(s.network, s.address)
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	// an empty X509SVIDRequest in a gRPC frame
+	req, err := http.NewRequest(http.MethodPost, "http://localhost"+spiffeFetchX509SVID, bytes.NewReader(make([]byte, 5)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("workload.spiffe.io", "true")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response %v", resp.Status)
+	}
+	if status := resp.Header.Get("Grpc-Status"); status != "" && status != "0" {
+		return fmt.Errorf("gRPC status %v: %v", status, resp.Header.Get("Grpc-Message"))
+	}
+
+	for {
+		var prefix [5]byte
+		if _, err := io.ReadFull(resp.Body, prefix[:]); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("gRPC status %v: %v", resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message"))
+			}
+			return err
+		}
+		if prefix[0] != 0 {
+			return errors.New("compressed gRPC messages are not supported")
+		}
+		message := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		if _, err := io.ReadFull(resp.Body, message); err != nil {
+			return err
+		}
+		if err := s.update(message); err != nil {
+			return err
+		}
+	}
+}
+
+// update installs the first SVID of an X509SVIDResponse
+func (s *SPIFFESource) update(message []byte) error {
+	var svid *spiffeSVID
+	err := protoFields(message, func(field int, value []byte) error {
+		if field != 1 || svid != nil {
+			return nil
+		}
+		svid = new(spiffeSVID)
+		return protoFields(value, func(field int, value []byte) error {
+			switch field {
+			case 1:
+				svid.id = string(value)
+			case 2:
+				svid.certs = value
+			case 3:
+				svid.key = value
+			case 4:
+				svid.bundle = value
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if svid == nil {
+		return errors.New("response holds no SVID")
+	}
+
+	certs, err := x509.ParseCertificates(svid.certs)
+	if err != nil || len(certs) == 0 {
+		return fmt.Errorf("invalid SVID certificates: %v", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(svid.key)
+	if err != nil {
+		return fmt.Errorf("invalid SVID key: %v", err)
+	}
+	bundle, err := x509.ParseCertificates(svid.bundle)
+	if err != nil {
+		return fmt.Errorf("invalid trust bundle: %v", err)
+	}
+	cert := &tls.Certificate{PrivateKey: key, Leaf: certs[0]}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	roots := x509.NewCertPool()
+	for _, c := range bundle {
+		roots.AddCert(c)
+	}
+
+	s.mu.Lock()
+	first := s.cert == nil
+	s.id, s.cert, s.roots = svid.id, cert, roots
+	s.mu.Unlock()
+	if first {
+		close(s.ready)
+	}
+	if !s.quiet {
+		logf(levelInfo, "Received SVID %v valid until %v", svid.id, certs[0].NotAfter)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package subscriber
+
+import (
+	"sort"
+
+	"github.com/GaryBoone/GoStats/stats"
+)
+
+// rateCV returns the coefficient of variation (std / mean) of the per-second receive rates, skipping the
+// partial first and last second; 0 if there are less than 2 full seconds
+func rateCV(counts map[int64]int64) float64 {
+	if len(counts) < 2 {
+		return 0
+	}
+	seconds := make([]int64, 0, len(counts))
+	for second := range counts {
+		seconds = append(seconds, second)
+	}
+	sort.Slice(seconds, func(i, j int) bool { return seconds[i] < seconds[j] })
+
+	// seconds without any message count as a rate of 0
+	first, last := seconds[0]+1, seconds[len(seconds)-1]-1
+	if last-first+1 < 2 {
+		return 0
+	}
+	rates := make([]float64, 0, last-first+1)
+	for second := first; second <= last; second++ {
+		rates = append(rates, float64(counts[second]))
+	}
+	mean := stats.StatsMean(rates)
+	if mean == 0 {
+		return 0
+	}
+
+	return stats.StatsSampleStandardDeviation(rates) / mean
+}
@@ -0,0 +1,141 @@
+package subscriber
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// maxStalls bounds the number of stalls listed per client and in the totals, all are counted
+const maxStalls = 1000
+
+// stallWatchdog detects the periods in which a client receives no measured messages for longer than the
+// threshold, e.g. broker pauses or GC stalls, which the mean rate and latency would average away. A stall
+// is logged while it lasts and recorded once the next message arrives or the client stops.
+type stallWatchdog struct {
+	threshold time.Duration
+
+	mu      sync.Mutex
+	last    int64 // unix nanoseconds of the last measured message, 0 before the first
+	alerted bool  // the current stall was logged
+	count   int64
+	stalled float64
+	longest float64
+	stalls  []*results.Stall
+}
+
+func newStallWatchdog(threshold time.Duration) *stallWatchdog {
+	return &stallWatchdog{threshold: threshold}
+}
+
+// watch logs the stalls of client c while they last, until done is closed
+func (w *stallWatchdog) watch(c *Client, done <-chan struct{}) {
+	interval := w.threshold / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			w.mu.Lock()
+			since := time.Duration(now.UnixNano() - w.last)
+			stalled := w.last > 0 && !w.alerted && since > w.threshold
+			if stalled {
+				w.alerted = true
+			}
+			w.mu.Unlock()
+			if stalled {
+				c.logf(levelWarn, "received no messages for %v", since.Round(time.Millisecond))
+				c.events.log(c.ID, eventStalled, nil)
+			}
+		}
+	}
+}
+
+// received records the stall before a message received at receivedAt (unix nanoseconds), if any
+func (w *stallWatchdog) received(c *Client, receivedAt int64) {
+	w.mu.Lock()
+	gap := receivedAt - w.last
+	stalled := w.last > 0 && time.Duration(gap) > w.threshold
+	if stalled {
+		w.add(c.ID, w.last, float64(gap), false)
+	}
+	alerted := w.alerted
+	w.alerted = false
+	w.last = receivedAt
+	w.mu.Unlock()
+	if stalled && alerted {
+		c.logf(levelInfo, "received messages again after %v", time.Duration(gap).Round(time.Millisecond))
+		c.events.log(c.ID, eventStallEnded, nil)
+	}
+}
+
+func (w *stallWatchdog) add(client int, start int64, duration float64, ongoing bool) {
+	w.count++
+	w.stalled += duration
+	if duration > w.longest {
+		w.longest = duration
+	}
+	if len(w.stalls) < maxStalls {
+		w.stalls = append(w.stalls, &results.Stall{Client: client, Start: start, Duration: duration, Ongoing: ongoing})
+	}
+}
+
+// results returns the stalls of client until it stopped at end, nil if it didn't stall
+func (w *stallWatchdog) results(client int, end time.Time) *results.StallResults {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if gap := end.UnixNano() - w.last; w.last > 0 && time.Duration(gap) > w.threshold {
+		w.add(client, w.last, float64(gap), true)
+	}
+	if w.count == 0 {
+		return nil
+	}
+
+	return &results.StallResults{
+		Count:   w.count,
+		Stalled: w.stalled,
+		Longest: w.longest,
+		Stalls:  w.stalls,
+	}
+}
+
+// calculateStallTotals sums the stalls of all clients and lists them in the order they started
+func calculateStallTotals(runs []*results.RunResults) *results.StallResults {
+	var totals *results.StallResults
+	for _, res := range runs {
+		if res.Stalls == nil {
+			continue
+		}
+		if totals == nil {
+			totals = new(results.StallResults)
+		}
+		totals.Count += res.Stalls.Count
+		totals.Stalled += res.Stalls.Stalled
+		if res.Stalls.Longest > totals.Longest {
+			totals.Longest = res.Stalls.Longest
+		}
+		totals.Clients++
+		totals.Stalls = append(totals.Stalls, res.Stalls.Stalls...)
+	}
+	if totals == nil {
+		return nil
+	}
+	sort.SliceStable(totals.Stalls, func(i, j int) bool {
+		return totals.Stalls[i].Start < totals.Stalls[j].Start
+	})
+	if len(totals.Stalls) > maxStalls {
+		totals.Stalls = totals.Stalls[:maxStalls]
+	}
+
+	return totals
+}
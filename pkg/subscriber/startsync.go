@@ -0,0 +1,86 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// startSync is shared by all clients and coordinates the start of the measurements with the publisher over
+// a control topic: every client announces on <topic>/ready that it subscribed, and the measurements start
+// once the publisher sends a message on <topic>/start. Messages received before are not measured.
+type startSync struct {
+	topic string
+	start time.Time
+	quiet bool
+
+	mu        sync.Mutex
+	startedAt time.Time
+}
+
+// readyMessage is the payload of the ready announcements
+type readyMessage struct {
+	ClientId string
+	RunId    string `json:",omitempty"`
+}
+
+func newStartSync(topic string, start time.Time, quiet bool) *startSync {
+	return &startSync{topic: topic, start: start, quiet: quiet}
+}
+
+// ready subscribes client to the start topic and announces that it subscribed to the benchmark topic, it
+// is called after every SUBACK until the start message was received
+func (s *startSync) ready(c *Client, client mqtt.Client) {
+	if s.started() {
+		return
+	}
+	token := client.Subscribe(s.topic+"/start", 1, func(mqtt.Client, mqtt.Message) {
+		s.open()
+	})
+	if token.Wait(); token.Error() != nil {
+		c.logf(levelError, "had error subscribing to the start topic: %v", token.Error())
+		return
+	}
+	payload, err := json.Marshal(&readyMessage{ClientId: c.mqttClientID(), RunId: c.RunID})
+	if err != nil {
+		c.logf(levelError, "could not marshal its ready message: %v", err)
+		return
+	}
+	token = client.Publish(s.topic+"/ready", 1, false, payload)
+	if token.Wait(); token.Error() != nil {
+		c.logf(levelError, "had error announcing it is ready: %v", token.Error())
+	}
+}
+
+func (s *startSync) open() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.startedAt.IsZero() {
+		return
+	}
+	s.startedAt = time.Now()
+	if !s.quiet {
+		logf(levelInfo, "Received the start message after %v, starting measurements", s.startedAt.Sub(s.start))
+	}
+}
+
+// started returns whether the start message was received
+func (s *startSync) started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.startedAt.IsZero()
+}
+
+// startedAfter returns how long it took until the start message was received, in nanoseconds
+func (s *startSync) startedAfter() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.startedAt.IsZero() {
+		return 0
+	}
+
+	return float64(s.startedAt.Sub(s.start))
+}
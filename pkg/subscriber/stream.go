@@ -0,0 +1,69 @@
+package subscriber
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// StreamEvent is a single update of a running benchmark, either the results of a client that completed
+// or an interval report
+type StreamEvent struct {
+	Run      *results.RunResults
+	Interval *IntervalReport
+}
+
+// ResultStream delivers per-client results and interval reports to an embedder while the benchmark runs.
+// Use OnComplete as the OnComplete hook of the clients and set the stream on the IntervalReporter.
+// Events never block the benchmark: when the consumer falls behind and the buffer is full they are dropped.
+type ResultStream struct {
+	events  chan *StreamEvent
+	dropped int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewResultStream creates a ResultStream buffering up to buffer events
+func NewResultStream(buffer int) *ResultStream {
+	return &ResultStream{events: make(chan *StreamEvent, buffer)}
+}
+
+// Events returns the channel the events are delivered on, it is closed by Close
+func (s *ResultStream) Events() <-chan *StreamEvent {
+	return s.events
+}
+
+// OnComplete streams the results of a client, it can be used as Client.OnComplete
+func (s *ResultStream) OnComplete(c *Client, res *results.RunResults) {
+	s.publish(&StreamEvent{Run: res})
+}
+
+// Dropped returns the number of events dropped because the buffer was full
+func (s *ResultStream) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Close closes the events channel, events published afterwards are discarded
+func (s *ResultStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
+
+func (s *ResultStream) publish(e *StreamEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- e:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
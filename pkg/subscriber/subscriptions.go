@@ -0,0 +1,122 @@
+package subscriber
+
+import (
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// Subscription is a further topic filter a client subscribes to besides MsgTopic, with its own QoS
+type Subscription struct {
+	Topic string
+	QoS   byte
+}
+
+// subscriptions returns the topic filters of the client with their QoS, MsgTopic first
+func (c *Client) subscriptions() []Subscription {
+	return append([]Subscription{{Topic: c.MsgTopic, QoS: c.MsgQoS}}, c.MoreTopics...)
+}
+
+// subscribe subscribes client to all topic filters of the client in a single SUBSCRIBE
+func (c *Client) subscribe(client mqtt.Client) mqtt.Token {
+	if len(c.MoreTopics) == 0 {
+		return client.Subscribe(c.MsgTopic, c.MsgQoS, nil)
+	}
+	filters := make(map[string]byte, 1+len(c.MoreTopics))
+	for _, s := range c.subscriptions() {
+		filters[s.Topic] = s.QoS
+	}
+
+	return client.SubscribeMultiple(filters, nil)
+}
+
+// unsubscribe unsubscribes client from all topic filters of the client in a single UNSUBSCRIBE
+func (c *Client) unsubscribe(client mqtt.Client) mqtt.Token {
+	topics := make([]string, 0, 1+len(c.MoreTopics))
+	for _, s := range c.subscriptions() {
+		topics = append(topics, s.Topic)
+	}
+
+	return client.Unsubscribe(topics...)
+}
+
+// subscriptionCounter counts the measured messages per subscription of a client with several, a message
+// matching several (overlapping) topic filters is counted for the first
+type subscriptionCounter struct {
+	subscriptions []Subscription
+	messages      []int64
+}
+
+func newSubscriptionCounter(subscriptions []Subscription) *subscriptionCounter {
+	return &subscriptionCounter{subscriptions: subscriptions, messages: make([]int64, len(subscriptions))}
+}
+
+func (s *subscriptionCounter) received(m *Message) {
+	for i, subscription := range s.subscriptions {
+		if topicMatches(subscription.Topic, m.Topic) {
+			s.messages[i]++
+			return
+		}
+	}
+}
+
+func (s *subscriptionCounter) results() []*results.SubscriptionResults {
+	res := make([]*results.SubscriptionResults, len(s.subscriptions))
+	for i, subscription := range s.subscriptions {
+		res[i] = &results.SubscriptionResults{
+			Topic:    subscription.Topic,
+			QoS:      subscription.QoS,
+			Messages: s.messages[i],
+		}
+	}
+
+	return res
+}
+
+// topicMatches reports whether topic matches the topic filter, a shared subscription matches like its
+// topic filter
+func topicMatches(filter, topic string) bool {
+	if strings.HasPrefix(filter, "$share/") {
+		if parts := strings.SplitN(filter, "/", 3); len(parts) == 3 {
+			filter = parts[2]
+		}
+	}
+	// wildcards at the first level don't match topics starting with $, e.g. $SYS
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
+
+// calculateSubscriptionTotals sums the messages per topic filter over all clients, in the order the topic
+// filters first appear
+func calculateSubscriptionTotals(runs []*results.RunResults) []*results.SubscriptionResults {
+	var totals []*results.SubscriptionResults
+	byTopic := make(map[string]*results.SubscriptionResults)
+	for _, res := range runs {
+		for _, subscription := range res.Subscriptions {
+			total, ok := byTopic[subscription.Topic]
+			if !ok {
+				total = &results.SubscriptionResults{Topic: subscription.Topic, QoS: subscription.QoS}
+				byTopic[subscription.Topic] = total
+				totals = append(totals, total)
+			}
+			total.Messages += subscription.Messages
+		}
+	}
+
+	return totals
+}
@@ -0,0 +1,48 @@
+package subscriber
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// takeoverReconnectWindow is how soon after losing the connection a reconnect must succeed to count as a takeover
+const takeoverReconnectWindow = 5 * time.Second
+
+// takeoverTracker detects connection losses that look like a session takeover by another client using the
+// same client id. MQTT 3.1.1 has no disconnect reason codes, so a takeover is assumed when the broker closed
+// the connection (EOF) but accepted the reconnect right away, unlike a broker that went down.
+type takeoverTracker struct {
+	mu        sync.Mutex
+	suspectAt time.Time
+	takeovers int64
+}
+
+func (t *takeoverTracker) connectionLost(reason error, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if reason == io.EOF {
+		t.suspectAt = at
+	}
+}
+
+// connected returns true if the connection loss before this (re)connect was most likely a takeover
+func (t *takeoverTracker) connected(at time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	suspectAt := t.suspectAt
+	t.suspectAt = time.Time{}
+	if suspectAt.IsZero() || at.Sub(suspectAt) > takeoverReconnectWindow {
+		return false
+	}
+	t.takeovers++
+
+	return true
+}
+
+func (t *takeoverTracker) count() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.takeovers
+}
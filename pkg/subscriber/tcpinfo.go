@@ -0,0 +1,124 @@
+package subscriber
+
+import (
+	"math"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// tcpInfo holds the TCP_INFO values we are interested in, durations in nanoseconds
+type tcpInfo struct {
+	RTT          float64
+	RTTVar       float64
+	TotalRetrans uint64
+}
+
+// tcpInfoStats accumulates TCP_INFO samples over all connections of a client
+type tcpInfoStats struct {
+	samples     int
+	rttMin      float64
+	rttMax      float64
+	rttSum      float64
+	rttVarMax   float64
+	retransDone uint64 // retransmits of previous connections
+	retransConn uint64 // retransmits of the current connection
+}
+
+func (s *tcpInfoStats) newConn() {
+	s.retransDone += s.retransConn
+	s.retransConn = 0
+}
+
+func (s *tcpInfoStats) add(info *tcpInfo) {
+	if s.samples == 0 || info.RTT < s.rttMin {
+		s.rttMin = info.RTT
+	}
+	if info.RTT > s.rttMax {
+		s.rttMax = info.RTT
+	}
+	if info.RTTVar > s.rttVarMax {
+		s.rttVarMax = info.RTTVar
+	}
+	s.rttSum += info.RTT
+	s.retransConn = info.TotalRetrans
+	s.samples++
+}
+
+// sampleTCPInfo adds a TCP_INFO sample of the current connection
+func (cc *ClientConn) sampleTCPInfo() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.tcp == nil {
+		return
+	}
+	info, err := readTCPInfo(cc.tcp)
+	if err != nil {
+		// connection is gone, keep what was sampled before
+		return
+	}
+	cc.tcpStats.add(info)
+}
+
+// TCPInfoResults returns the summary of all TCP_INFO samples of the client, nil if there are none
+func (cc *ClientConn) TCPInfoResults() *results.TCPInfoResults {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	s := cc.tcpStats
+	if s.samples == 0 {
+		return nil
+	}
+
+	return &results.TCPInfoResults{
+		Samples:     s.samples,
+		RTTMin:      s.rttMin,
+		RTTMax:      s.rttMax,
+		RTTMean:     s.rttSum / float64(s.samples),
+		RTTVarMax:   s.rttVarMax,
+		Retransmits: s.retransDone + s.retransConn,
+	}
+}
+
+// sampleTCPInfo samples TCP_INFO of all client connections at the given interval until stop is closed
+func (d *Dialer) sampleTCPInfo(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			for _, cc := range d.ClientConns() {
+				cc.sampleTCPInfo()
+			}
+			return
+		case <-ticker.C:
+			for _, cc := range d.ClientConns() {
+				cc.sampleTCPInfo()
+			}
+		}
+	}
+}
+
+func calculateTCPInfoTotals(runs []*results.RunResults) *results.TCPInfoResults {
+	var totals *results.TCPInfoResults
+	var clients int
+	for _, res := range runs {
+		if res.TCPInfo == nil {
+			continue
+		}
+		if totals == nil {
+			totals = &results.TCPInfoResults{RTTMin: math.MaxFloat64}
+		}
+		clients++
+		totals.Samples += res.TCPInfo.Samples
+		totals.RTTMin = math.Min(totals.RTTMin, res.TCPInfo.RTTMin)
+		totals.RTTMax = math.Max(totals.RTTMax, res.TCPInfo.RTTMax)
+		totals.RTTMean += res.TCPInfo.RTTMean
+		totals.RTTVarMax = math.Max(totals.RTTVarMax, res.TCPInfo.RTTVarMax)
+		totals.Retransmits += res.TCPInfo.Retransmits
+	}
+	if totals != nil {
+		totals.RTTMean /= float64(clients)
+	}
+
+	return totals
+}
@@ -0,0 +1,42 @@
+//go:build linux && !386
+// +build linux,!386
+
+package subscriber
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// tcpInfoSupported reports whether readTCPInfo is implemented on this platform
+const tcpInfoSupported = true
+
+// readTCPInfo reads TCP_INFO of the given connection
+func readTCPInfo(conn *net.TCPConn) (*tcpInfo, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var info syscall.TCPInfo
+	var errno syscall.Errno
+	err = raw.Control(func(fd uintptr) {
+		size := uint32(syscall.SizeofTCPInfo)
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if errno != 0 {
+		return nil, errno
+	}
+
+	// the kernel reports RTT in microseconds
+	return &tcpInfo{
+		RTT:          float64(info.Rtt) * 1000,
+		RTTVar:       float64(info.Rttvar) * 1000,
+		TotalRetrans: uint64(info.Total_retrans),
+	}, nil
+}
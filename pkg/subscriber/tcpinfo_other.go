@@ -0,0 +1,17 @@
+//go:build !linux || (linux && 386)
+// +build !linux linux,386
+
+package subscriber
+
+import (
+	"errors"
+	"net"
+)
+
+// tcpInfoSupported reports whether readTCPInfo is implemented on this platform
+const tcpInfoSupported = false
+
+// readTCPInfo is only implemented on Linux
+func readTCPInfo(conn *net.TCPConn) (*tcpInfo, error) {
+	return nil, errors.New("TCP_INFO is not supported on this platform")
+}
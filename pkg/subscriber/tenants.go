@@ -0,0 +1,91 @@
+package subscriber
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// tenant assigns the clients with IDs in [From, To] to a named tenant with its own credentials and topic namespace
+type tenant struct {
+	From     int
+	To       int
+	Name     string
+	Username string
+	Password string
+}
+
+// parseTenants parses a comma separated list of <from>-<to>=<name>[:<username>:<password>] entries
+func parseTenants(s string) ([]tenant, error) {
+	var tenants []tenant
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		from, to, value, err := parseRangeEntry(entry, "tenant")
+		if err != nil {
+			return nil, err
+		}
+		t := tenant{From: from, To: to}
+		parts := strings.SplitN(value, ":", 3)
+		t.Name = parts[0]
+		switch len(parts) {
+		case 1:
+		case 3:
+			t.Username = parts[1]
+			t.Password = parts[2]
+		default:
+			return nil, fmt.Errorf("tenant entry %q should have both a username and a password", entry)
+		}
+		if t.Name == "" || strings.ContainsAny(t.Name, "/+#") {
+			return nil, fmt.Errorf("invalid tenant name in tenant entry %q", entry)
+		}
+		tenants = append(tenants, t)
+	}
+
+	return tenants, nil
+}
+
+// tenantFor returns the tenant client id belongs to, or nil if it does not belong to a tenant
+func tenantFor(tenants []tenant, id int) *tenant {
+	for i := range tenants {
+		if id >= tenants[i].From && id <= tenants[i].To {
+			return &tenants[i]
+		}
+	}
+
+	return nil
+}
+
+// Topic returns topic within the namespace of the tenant, i.e. prefixed with '<name>/'
+func (t *tenant) Topic(topic string) string {
+	return t.Name + "/" + strings.TrimPrefix(topic, "/")
+}
+
+// calculateTenantResults aggregates the results per tenant, clients without tenant are left out
+func calculateTenantResults(runs []*results.RunResults, totalTime time.Duration) []*results.TenantResults {
+	perTenant := make(map[string][]*results.RunResults)
+	for _, res := range runs {
+		if res.Tenant != "" {
+			perTenant[res.Tenant] = append(perTenant[res.Tenant], res)
+		}
+	}
+
+	tenants := make([]*results.TenantResults, 0, len(perTenant))
+	for name, tenantResults := range perTenant {
+		tenants = append(tenants, &results.TenantResults{
+			Tenant:       name,
+			Clients:      len(tenantResults),
+			TotalResults: calculateTotalResults(tenantResults, totalTime, len(tenantResults)),
+		})
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].Tenant < tenants[j].Tenant
+	})
+
+	return tenants
+}
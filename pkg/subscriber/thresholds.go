@@ -0,0 +1,134 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// exitThresholdsFailed is the exit code of a run that did not meet its thresholds
+const exitThresholdsFailed = 3
+
+// Thresholds are the objectives a run is checked against. MaxP99Ms and MinMsgsPerSec are not checked when
+// zero, MaxLossRatio and MaxDuplicates when negative, as no loss or duplicates at all is a valid objective.
+// ExactlyOnce requires the exactly-once verdict of the run to pass.
+type Thresholds struct {
+	MaxP99Ms      float64
+	MinMsgsPerSec float64
+	MaxLossRatio  float64
+	MaxDuplicates int64
+	ExactlyOnce   bool
+}
+
+// enabled returns whether any threshold is set
+func (t Thresholds) enabled() bool {
+	return t.MaxP99Ms > 0 || t.MinMsgsPerSec > 0 || t.MaxLossRatio >= 0 || t.MaxDuplicates >= 0 || t.ExactlyOnce
+}
+
+// lossRatio returns the fraction of the messages lost according to the MessageId sequences of the publishers
+func lossRatio(totals *results.TotalResults) float64 {
+	if totals.Successes+totals.Lost == 0 {
+		return 0
+	}
+
+	return float64(totals.Lost) / float64(totals.Successes+totals.Lost)
+}
+
+// checked returns the names of the thresholds that are set, in the order they are checked
+func (t Thresholds) checked() []string {
+	var names []string
+	if t.MaxP99Ms > 0 {
+		names = append(names, "max_p99_ms")
+	}
+	if t.MinMsgsPerSec > 0 {
+		names = append(names, "min_msgs_per_sec")
+	}
+	if t.MaxLossRatio >= 0 {
+		names = append(names, "max_loss_ratio")
+	}
+	if t.MaxDuplicates >= 0 {
+		names = append(names, "max_duplicates")
+	}
+	if t.ExactlyOnce {
+		names = append(names, "exactly_once")
+	}
+
+	return names
+}
+
+// check returns every objective the run did not meet
+func (t Thresholds) check(totals *results.TotalResults, p99 float64) []*results.ThresholdFailure {
+	var failures []*results.ThresholdFailure
+	if t.MaxP99Ms > 0 && p99/1_000_000 > t.MaxP99Ms {
+		failures = append(failures, &results.ThresholdFailure{
+			Threshold: "max_p99_ms",
+			Limit:     t.MaxP99Ms,
+			Value:     p99 / 1_000_000,
+			Message:   fmt.Sprintf("p99 latency %.3f ms exceeds %.3f ms", p99/1_000_000, t.MaxP99Ms),
+		})
+	}
+	if t.MinMsgsPerSec > 0 && totals.TotalMsgsPerSec < t.MinMsgsPerSec {
+		failures = append(failures, &results.ThresholdFailure{
+			Threshold: "min_msgs_per_sec",
+			Limit:     t.MinMsgsPerSec,
+			Value:     totals.TotalMsgsPerSec,
+			Message:   fmt.Sprintf("throughput %.3f msg/sec is below %.3f msg/sec", totals.TotalMsgsPerSec, t.MinMsgsPerSec),
+		})
+	}
+	if loss := lossRatio(totals); t.MaxLossRatio >= 0 && loss > t.MaxLossRatio {
+		failures = append(failures, &results.ThresholdFailure{
+			Threshold: "max_loss_ratio",
+			Limit:     t.MaxLossRatio,
+			Value:     loss,
+			Message:   fmt.Sprintf("loss ratio %.6f exceeds %.6f (%d messages lost)", loss, t.MaxLossRatio, totals.Lost),
+		})
+	}
+	if t.MaxDuplicates >= 0 && totals.DuplicateDeliveries > t.MaxDuplicates {
+		failures = append(failures, &results.ThresholdFailure{
+			Threshold: "max_duplicates",
+			Limit:     float64(t.MaxDuplicates),
+			Value:     float64(totals.DuplicateDeliveries),
+			Message:   fmt.Sprintf("%d duplicate deliveries exceed %d", totals.DuplicateDeliveries, t.MaxDuplicates),
+		})
+	}
+	if eo := totals.ExactlyOnce; t.ExactlyOnce && (eo == nil || !eo.Passed) {
+		failure := &results.ThresholdFailure{Threshold: "exactly_once", Message: "no client reported an exactly-once verdict"}
+		if eo != nil {
+			failure.Value = float64(eo.Missing + eo.Duplicated)
+			failure.Message = fmt.Sprintf("%d MessageIds missing and %d duplicated on %d clients", eo.Missing, eo.Duplicated, eo.FailedClients)
+		}
+		failures = append(failures, failure)
+	}
+
+	return failures
+}
+
+// results returns the verdict of the run against the thresholds, nil if no threshold is set
+func (t Thresholds) results(totals *results.TotalResults, p99 float64) *results.ThresholdResults {
+	if !t.enabled() {
+		return nil
+	}
+	failures := t.check(totals, p99)
+
+	return &results.ThresholdResults{
+		Passed:   len(failures) == 0,
+		Checked:  t.checked(),
+		Failures: failures,
+	}
+}
+
+// exitOnFailedThresholds exits with exitThresholdsFailed if the results did not meet their thresholds,
+// after writing the failures as a single JSON line on stderr for CI pipelines (stdout holds the results)
+func exitOnFailedThresholds(jr *results.JSONResults) {
+	if jr.Thresholds == nil || jr.Thresholds.Passed {
+		return
+	}
+	data, err := json.Marshal(jr.Thresholds)
+	if err != nil {
+		fatalf("Error marshalling threshold results: %v", err)
+	}
+	fmt.Fprintln(os.Stderr, string(data))
+	os.Exit(exitThresholdsFailed)
+}
@@ -0,0 +1,48 @@
+package subscriber
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// sessionCache is a ClientSessionCache shared by all clients, so clients (re)connecting to the same broker
+// resume a TLS session instead of doing a full handshake. It counts how often a session could be offered.
+type sessionCache struct {
+	cache   tls.ClientSessionCache
+	lookups int64
+	hits    int64
+}
+
+func newSessionCache() *sessionCache {
+	return &sessionCache{cache: tls.NewLRUClientSessionCache(0)}
+}
+
+// Get implements tls.ClientSessionCache, it is called once for every handshake
+func (s *sessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	atomic.AddInt64(&s.lookups, 1)
+	session, ok := s.cache.Get(sessionKey)
+	if ok {
+		atomic.AddInt64(&s.hits, 1)
+	}
+
+	return session, ok
+}
+
+// Put implements tls.ClientSessionCache
+func (s *sessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	s.cache.Put(sessionKey, cs)
+}
+
+func (s *sessionCache) results() *results.TLSSessionResults {
+	res := &results.TLSSessionResults{
+		Handshakes: atomic.LoadInt64(&s.lookups),
+		Resumed:    atomic.LoadInt64(&s.hits),
+	}
+	if res.Handshakes > 0 {
+		res.ResumptionRate = float64(res.Resumed) / float64(res.Handshakes)
+	}
+
+	return res
+}
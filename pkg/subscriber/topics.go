@@ -0,0 +1,143 @@
+package subscriber
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// topicTemplate derives the topic of every client from -topic: a printf format with a single %d for the
+// client index (e.g. bench/client-%d), a Go template with the client index as .ID (e.g. bench/{{.ID}}),
+// or a literal topic all clients subscribe to
+type topicTemplate struct {
+	literal string
+	format  string
+	tmpl    *template.Template
+}
+
+// parseTopicTemplate parses s and checks that it yields a topic for a client
+func parseTopicTemplate(s string) (*topicTemplate, error) {
+	if s == "" {
+		return nil, fmt.Errorf("topic should not be empty")
+	}
+	t := new(topicTemplate)
+	switch {
+	case strings.Contains(s, "{{"):
+		tmpl, err := template.New("topic").Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic template %q: %v", s, err)
+		}
+		t.tmpl = tmpl
+	case strings.Contains(s, "%"):
+		t.format = s
+	default:
+		t.literal = s
+	}
+	if _, err := t.execute(0); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// PerClient reports whether the clients subscribe to different topics
+func (t *topicTemplate) PerClient() bool {
+	return t.literal == ""
+}
+
+// Topic returns the topic of the client with index id
+func (t *topicTemplate) Topic(id int) string {
+	// the template was checked by parseTopicTemplate, it cannot fail for another index
+	topic, _ := t.execute(id)
+
+	return topic
+}
+
+func (t *topicTemplate) execute(id int) (string, error) {
+	switch {
+	case t.tmpl != nil:
+		var b strings.Builder
+		if err := t.tmpl.Execute(&b, struct{ ID int }{id}); err != nil {
+			return "", fmt.Errorf("invalid topic template: %v", err)
+		}
+		return b.String(), nil
+	case t.format != "":
+		topic := fmt.Sprintf(t.format, id)
+		if strings.Contains(topic, "%!") {
+			return "", fmt.Errorf("invalid topic format %q: it should contain a single %%d for the client index", t.format)
+		}
+		return topic, nil
+	default:
+		return t.literal, nil
+	}
+}
+
+// perClientTopics reports whether the clients subscribe to different topics
+func perClientTopics(subscriptions []topicSubscription) bool {
+	for _, s := range subscriptions {
+		if s.topic.PerClient() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// topicFlags collects repeated or comma separated -topic flags, the first one replaces the default topic
+type topicFlags struct {
+	values []string
+	set    bool
+}
+
+func (t *topicFlags) String() string {
+	return strings.Join(t.values, ",")
+}
+
+// Set implements flag.Value, the topics are validated by parseTopicSubscriptions
+func (t *topicFlags) Set(value string) error {
+	if !t.set {
+		t.values, t.set = nil, true
+	}
+	for _, topic := range strings.Split(value, ",") {
+		t.values = append(t.values, strings.TrimSpace(topic))
+	}
+
+	return nil
+}
+
+// topicSubscription is a topic of -topic with its own QoS, -1 for -qos
+type topicSubscription struct {
+	topic *topicTemplate
+	qos   int
+}
+
+// parseTopicSubscriptions parses the topics of -topic, each optionally followed by :<qos>. A colon followed
+// by anything but a number is part of the topic.
+func parseTopicSubscriptions(values []string) ([]topicSubscription, error) {
+	subscriptions := make([]topicSubscription, 0, len(values))
+	for _, value := range values {
+		s := topicSubscription{qos: -1}
+		if i := strings.LastIndex(value, ":"); i >= 0 {
+			if qos, err := strconv.Atoi(value[i+1:]); err == nil {
+				if qos < 0 || qos > 2 {
+					return nil, fmt.Errorf("invalid QoS of topic %q, it should be 0, 1 or 2", value)
+				}
+				value, s.qos = value[:i], qos
+			}
+		}
+		topic, err := parseTopicTemplate(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range subscriptions {
+			if other.topic.Topic(0) == topic.Topic(0) {
+				return nil, fmt.Errorf("topic %q is given twice", value)
+			}
+		}
+		s.topic = topic
+		subscriptions = append(subscriptions, s)
+	}
+
+	return subscriptions, nil
+}
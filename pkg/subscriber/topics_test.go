@@ -0,0 +1,66 @@
+package subscriber
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTopicSubscriptions(t *testing.T) {
+	subscriptions, err := parseTopicSubscriptions([]string{"a/%d:2", "b/{{.ID}}", "c:d", "e:0", "f/+/#"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		topic     string
+		qos       int
+		perClient bool
+	}{
+		{"a/7", 2, true},
+		{"b/7", -1, true},
+		// a colon followed by anything but a number is part of the topic
+		{"c:d", -1, false},
+		{"e", 0, false},
+		{"f/+/#", -1, false},
+	}
+	if len(subscriptions) != len(want) {
+		t.Fatalf("%d subscriptions, want %d", len(subscriptions), len(want))
+	}
+	for i, w := range want {
+		s := subscriptions[i]
+		if s.topic.Topic(7) != w.topic || s.qos != w.qos || s.topic.PerClient() != w.perClient {
+			t.Errorf("subscription %d: topic %q, QoS %d, per client %v, want %+v", i, s.topic.Topic(7), s.qos,
+				s.topic.PerClient(), w)
+		}
+	}
+	if !perClientTopics(subscriptions) || perClientTopics(subscriptions[2:]) {
+		t.Error("perClientTopics() should only report the templates")
+	}
+
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"a:3"}, "invalid QoS"},
+		{[]string{"a", "b", "a:1"}, "given twice"},
+		{[]string{""}, "should not be empty"},
+		{[]string{":1"}, "should not be empty"},
+		{[]string{"a/%d/%d"}, "single %d"},
+		{[]string{"a/{{.Name}}"}, "invalid topic template"},
+		{[]string{"a/{{"}, "invalid topic template"},
+	}
+	for _, test := range tests {
+		_, err := parseTopicSubscriptions(test.values)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: error %v, want %q", test.values, err, test.want)
+		}
+	}
+}
+
+func TestTopicFlags(t *testing.T) {
+	topics := topicFlags{values: []string{"/test"}}
+	topics.Set("a, b")
+	topics.Set("c")
+	if topics.String() != "a,b,c" || !topics.set {
+		t.Errorf("topics = %q, set %v", topics.String(), topics.set)
+	}
+}
@@ -0,0 +1,129 @@
+package subscriber
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// maxTopicStats bounds the number of topics counted separately per client, the messages of further topics
+// are counted under otherTopics so subscribing to # on a busy broker can't exhaust the memory
+const maxTopicStats = 10000
+
+const otherTopics = "(other)"
+
+// topicStats keeps the count and latency sums of the messages received per concrete topic, for
+// subscriptions with wildcards
+type topicStats map[string]*topicStat
+
+type topicStat struct {
+	messages   int64
+	first      int64 // unix nanoseconds
+	last       int64 // unix nanoseconds
+	sum        float64
+	sumSquares float64
+	min        float64
+	max        float64
+}
+
+func (t topicStats) received(m *Message, latency float64) {
+	topic := m.Topic
+	if _, ok := t[topic]; !ok && len(t) >= maxTopicStats {
+		topic = otherTopics
+	}
+	s, ok := t[topic]
+	if !ok {
+		s = &topicStat{first: m.ReceivedAt, min: latency, max: latency}
+		t[topic] = s
+	}
+	s.add(latency, m.ReceivedAt)
+}
+
+func (s *topicStat) add(latency float64, receivedAt int64) {
+	s.messages++
+	s.sum += latency
+	s.sumSquares += latency * latency
+	s.min = math.Min(s.min, latency)
+	s.max = math.Max(s.max, latency)
+	if receivedAt < s.first {
+		s.first = receivedAt
+	}
+	if receivedAt > s.last {
+		s.last = receivedAt
+	}
+}
+
+// merge adds the counts of the results of a single client for the topic
+func (s *topicStat) merge(res *results.TopicResults) {
+	n := float64(res.Messages)
+	if s.messages == 0 {
+		s.first, s.last, s.min, s.max = res.FirstReceived, res.LastReceived, res.MsgTimeMin, res.MsgTimeMax
+	}
+	s.messages += res.Messages
+	s.sum += res.MsgTimeMean * n
+	s.sumSquares += res.MsgTimeStd*res.MsgTimeStd*(n-1) + n*res.MsgTimeMean*res.MsgTimeMean
+	s.min = math.Min(s.min, res.MsgTimeMin)
+	s.max = math.Max(s.max, res.MsgTimeMax)
+	if res.FirstReceived < s.first {
+		s.first = res.FirstReceived
+	}
+	if res.LastReceived > s.last {
+		s.last = res.LastReceived
+	}
+}
+
+func (s *topicStat) results(topic string) *results.TopicResults {
+	n := float64(s.messages)
+	res := &results.TopicResults{
+		Topic:         topic,
+		Messages:      s.messages,
+		MsgTimeMin:    s.min,
+		MsgTimeMax:    s.max,
+		MsgTimeMean:   s.sum / n,
+		FirstReceived: s.first,
+		LastReceived:  s.last,
+	}
+	// calculate std if sample is > 1, otherwise leave as 0 (convention)
+	if s.messages > 1 {
+		res.MsgTimeStd = math.Sqrt(math.Max(0, (s.sumSquares-s.sum*s.sum/n)/(n-1)))
+	}
+	if s.last > s.first {
+		res.MsgsPerSec = n / time.Duration(s.last-s.first).Seconds()
+	}
+
+	return res
+}
+
+// results returns the statistics per topic sorted by topic
+func (t topicStats) results() []*results.TopicResults {
+	topics := make([]*results.TopicResults, 0, len(t))
+	for topic, s := range t {
+		topics = append(topics, s.results(topic))
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].Topic < topics[j].Topic
+	})
+
+	return topics
+}
+
+func calculateTopicTotals(runs []*results.RunResults) []*results.TopicResults {
+	totals := make(topicStats)
+	for _, res := range runs {
+		for _, topic := range res.Topics {
+			s, ok := totals[topic.Topic]
+			if !ok {
+				s = new(topicStat)
+				totals[topic.Topic] = s
+			}
+			s.merge(topic)
+		}
+	}
+	if len(totals) == 0 {
+		return nil
+	}
+
+	return totals.results()
+}
@@ -0,0 +1,88 @@
+package subscriber
+
+import (
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/TNO-SlaFleur/mqtt-benchmark-subscriber/results"
+)
+
+// MQTTTuning holds the client-side settings of the MQTT client library, zero values keep its defaults
+type MQTTTuning struct {
+	KeepAlive           time.Duration
+	WriteTimeout        time.Duration
+	MessageChannelDepth uint // messages queued for the handler while reconnecting
+	MaxInflight         int  // messages handled and not yet acknowledged at once with Unordered, 0 is unlimited
+	ReceiveMaximum      int  // MQTT 5.0 Receive Maximum announced to the broker, 0 keeps its default of 65535
+	Unordered           bool // handle messages concurrently instead of one after the other
+}
+
+func (t MQTTTuning) apply(opts *mqtt.ClientOptions) {
+	if t.KeepAlive > 0 {
+		opts.SetKeepAlive(t.KeepAlive)
+	}
+	if t.WriteTimeout > 0 {
+		opts.SetWriteTimeout(t.WriteTimeout)
+	}
+	if t.MessageChannelDepth > 0 {
+		opts.SetMessageChannelDepth(t.MessageChannelDepth)
+	}
+	if t.Unordered {
+		opts.SetOrderMatters(false)
+	}
+}
+
+// settings returns the effective settings, including the defaults of the MQTT client library
+func (t MQTTTuning) settings() *results.MQTTSettings {
+	opts := mqtt.NewClientOptions()
+	t.apply(opts)
+
+	return &results.MQTTSettings{
+		KeepAlive:           float64(time.Duration(opts.KeepAlive) * time.Second),
+		PingTimeout:         float64(opts.PingTimeout),
+		WriteTimeout:        float64(opts.WriteTimeout),
+		MessageChannelDepth: opts.MessageChannelDepth,
+		MaxInflight:         t.MaxInflight,
+		ReceiveMaximum:      t.ReceiveMaximum,
+		Order:               opts.Order,
+	}
+}
+
+// inflightWindow bounds the number of messages handled at once, paho acknowledges a message once its
+// handler returns. A nil window is unbounded.
+type inflightWindow chan struct{}
+
+func newInflightWindow(size int) inflightWindow {
+	if size <= 0 {
+		return nil
+	}
+
+	return make(inflightWindow, size)
+}
+
+// acquire takes a slot of the window, it returns whether it had to wait for one
+func (w inflightWindow) acquire() bool {
+	if w == nil {
+		return false
+	}
+	select {
+	case w <- struct{}{}:
+		return false
+	default:
+	}
+	w <- struct{}{}
+
+	return true
+}
+
+// full returns whether all slots of the window are taken
+func (w inflightWindow) full() bool {
+	return w != nil && len(w) == cap(w)
+}
+
+func (w inflightWindow) release() {
+	if w != nil {
+		<-w
+	}
+}
@@ -0,0 +1,25 @@
+package subscriber
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// webSocketURL returns brokerURL with path as the HTTP path if it is a ws:// or wss:// URL without
+// a path of its own, other broker URLs are returned unchanged. paho connects to ws:// and wss://
+// brokers itself, wss:// with the TLS settings of the other TLS brokers.
+func webSocketURL(brokerURL, path string) (string, error) {
+	if brokerURL == "" || path == "" {
+		return brokerURL, nil
+	}
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid broker %v: %v", brokerURL, err)
+	}
+	if (u.Scheme != "ws" && u.Scheme != "wss") || (u.Path != "" && u.Path != "/") {
+		return brokerURL, nil
+	}
+	u.Path = path
+
+	return u.String(), nil
+}
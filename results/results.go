@@ -0,0 +1,343 @@
+// Package results defines the JSON results written by mqtt-benchmark-subscriber.
+//
+// Units: latencies and durations are in nanoseconds unless the field name says otherwise
+// (RunTime, TotalRunTime and AvgRunTime are in seconds), rates are per second and ratios are in [0, 1].
+//
+// Compatibility: the schema version is written to every document as schema_version. Within a schema
+// version fields are only ever added, optional sections are omitted when they were not measured and
+// existing fields keep their name, type and unit. Renaming or removing a field, or changing its type
+// or unit, increments SchemaVersion.
+package results
+
+import "time"
+
+// SchemaVersion is the version of the JSON results schema described by this package
+const SchemaVersion = 1
+
+// RunResults describes results of a single client / run
+type RunResults struct {
+	ID              int     `json:"id"`
+	Broker          string  `json:"broker,omitempty"`
+	Tenant          string  `json:"tenant,omitempty"`
+	Group           string  `json:"group,omitempty"`
+	Topic           string  `json:"topic,omitempty"` // only with a topic per client
+	QoS             byte    `json:"qos"`
+	Successes       int64   `json:"successes"`
+	RunTime         float64 `json:"run_time"`      // seconds
+	MsgTimeMin      float64 `json:"msg_time_min"`  // nanoseconds
+	MsgTimeMax      float64 `json:"msg_time_max"`  // nanoseconds
+	MsgTimeMean     float64 `json:"msg_time_mean"` // nanoseconds
+	MsgTimeStd      float64 `json:"msg_time_std"`  // nanoseconds
+	MsgsPerSec      float64 `json:"msgs_per_sec"`
+	RateCV          float64 `json:"rate_cv"`
+	Duplicates      int64   `json:"duplicates"` // messages received beyond the count, see DuplicateDeliveries
+	Takeovers       int64   `json:"takeovers"`
+	Lost            int64   `json:"lost"`         // messages missing from the MessageId sequences of the publishers
+	OutOfOrder      int64   `json:"out_of_order"` // messages received after a later message of the same publisher
+	Gaps            int64   `json:"gaps"`         // jumps in the MessageId sequences of the publishers
+	Disconnects     int64   `json:"disconnects"`
+	ConnectTime     float64 `json:"connect_time"`        // nanoseconds from CONNECT to the CONNACK of the first connection
+	SubscribeTime   float64 `json:"subscribe_time"`      // nanoseconds from SUBSCRIBE to the first SUBACK
+	Truncated       bool    `json:"truncated,omitempty"` // stopped by -timeout or a signal before all messages were received
+	Failed          bool    `json:"failed,omitempty"`    // stopped by a connect or subscribe failure it could not recover from
+	Error           string  `json:"error,omitempty"`     // why the client failed
+	RunIDMismatches int64   `json:"run_id_mismatches,omitempty"`
+	Oversize        int64   `json:"oversize,omitempty"`
+	Malformed       int64   `json:"malformed,omitempty"`
+	Corrupted       int64   `json:"corrupted,omitempty"` // payloads failing the size or checksum verification
+	DroppedInternal int64   `json:"dropped_internal,omitempty"`
+	LargestPacket   int64   `json:"largest_packet,omitempty"` // bytes
+	WarmupMessages  int64   `json:"warmup_messages,omitempty"`
+	QueueDepth      float64 `json:"queue_depth"`   // messages
+	MeasuredFrom    int64   `json:"measured_from"` // unix nanoseconds of the first measured message
+	MeasuredTo      int64   `json:"measured_to"`   // unix nanoseconds of the last measured message
+
+	// messages received within -cooldown after the client completed, not measured
+	LateArrivals *int64 `json:"late_arrivals,omitempty"`
+	// seconds the subscription was kept open for -cooldown, not part of the run time
+	CooldownTime float64 `json:"cooldown_time,omitempty"`
+
+	PersistentSession   bool  `json:"persistent_session,omitempty"` // connected with clean session false
+	SessionExpiry       int64 `json:"session_expiry,omitempty"`     // seconds the broker keeps the MQTT 5.0 session, 4294967295 is forever
+	DuplicateDeliveries int64 `json:"duplicate_deliveries"`         // messages received again with the same publisher and MessageId
+	MaxDisplacement     int64 `json:"max_displacement"`             // most later messages of the publisher received before an out-of-order message
+
+	// payload sizes of the measured messages
+	BytesReceived  int64   `json:"bytes_received"`
+	AvgPayloadSize float64 `json:"avg_payload_size"` // bytes
+	MBPerSec       float64 `json:"mb_per_sec"`       // megabytes (10^6 bytes) per second
+
+	// with -batch-mode the messages are batches of records, which are measured and counted individually
+	Batches         int64   `json:"batches,omitempty"`
+	RecordsPerBatch float64 `json:"records_per_batch,omitempty"`
+
+	// QoS granted in the (last) SUBACK for the topic, 128 if the broker refused the subscription, and the QoS
+	// the measured messages were delivered with
+	GrantedQoS    *int          `json:"granted_qos,omitempty"`
+	DeliveredQoS  map[int]int64 `json:"delivered_qos,omitempty"`
+	QoSMismatches int64         `json:"qos_mismatches,omitempty"` // delivered with another QoS than subscribed with
+	OutOfOrderQoS map[int]int64 `json:"out_of_order_qos,omitempty"`
+
+	// PerSecond counts the received messages per (unix) second, Histogram counts the measured latencies
+	// by the lowest latency in nanoseconds of their histogram bucket, Latencies holds all measured
+	// latencies in nanoseconds (only kept for -store-raw and the features needing them) and ReceivedAt
+	// their receive times in unix nanoseconds (only kept for -samples-file). None of them is part of the
+	// JSON results.
+	PerSecond  map[int64]int64 `json:"-"`
+	Histogram  map[int64]int64 `json:"-"`
+	Latencies  []float64       `json:"-"`
+	ReceivedAt []int64         `json:"-"`
+
+	Percentiles      []*Percentile      `json:"percentiles,omitempty"`
+	LatencyHistogram *LatencyHistogram  `json:"latency_histogram,omitempty"`
+	Confidence       *ConfidenceResults `json:"confidence,omitempty"`
+	Apdex            *ApdexResults      `json:"apdex,omitempty"`
+
+	TCPInfo      *TCPInfoResults      `json:"tcp_info,omitempty"`
+	Failover     *FailoverResults     `json:"failover,omitempty"`
+	Reconnect    *ReconnectResults    `json:"reconnect,omitempty"`
+	OfflineQueue *OfflineQueueResults `json:"offline_queue,omitempty"`
+	LateJoin     *LateJoinResults     `json:"late_join,omitempty"`
+	Retained     *RetainedResults     `json:"retained,omitempty"`
+	Resubscribe  *ResubscribeResults  `json:"resubscribe,omitempty"`
+	Expiry       *ExpiryResults       `json:"expiry,omitempty"`
+	Jitter       *JitterResults       `json:"jitter,omitempty"`
+	Stalls       *StallResults        `json:"stalls,omitempty"`
+	Chaos        *ChaosResults        `json:"chaos,omitempty"`
+	Compression  *CompressionResults  `json:"compression,omitempty"`
+	ExactlyOnce  *ExactlyOnceResults  `json:"exactly_once,omitempty"`
+
+	BrokerLatency *BrokerLatencyResults `json:"broker_latency,omitempty"`
+	FlowControl   *FlowControlResults   `json:"flow_control,omitempty"`
+	DecodeWorkers *DecodeWorkerResults  `json:"decode_workers,omitempty"`
+
+	Publishers    []*PublisherCount `json:"publishers,omitempty"`
+	MissingIDs    []*MissingIDs     `json:"missing_ids,omitempty"`
+	Topics        []*TopicResults   `json:"topics,omitempty"`
+	LatencySeries []*LatencySample  `json:"latency_series,omitempty"`
+
+	Subscriptions []*SubscriptionResults `json:"subscriptions,omitempty"` // only with several topics
+
+	Connect       *ConnectResults `json:"connect,omitempty"`
+	QoS2          *QoS2Results    `json:"qos2,omitempty"`
+	AddressFamily string          `json:"address_family,omitempty"` // ipv4 or ipv6
+	SourceAddress string          `json:"source_address,omitempty"` // local IP with -source-addresses
+
+	Payloads  *PayloadResults `json:"payloads,omitempty"`
+	Anomalies *AnomalyResults `json:"anomalies,omitempty"`
+}
+
+// TotalResults describes results of all clients / runs
+type TotalResults struct {
+	Ratio           float64 `json:"ratio"`
+	Successes       int64   `json:"successes"`
+	TotalRunTime    float64 `json:"total_run_time"`    // seconds
+	AvgRunTime      float64 `json:"avg_run_time"`      // seconds
+	MsgTimeMin      float64 `json:"msg_time_min"`      // nanoseconds
+	MsgTimeMax      float64 `json:"msg_time_max"`      // nanoseconds
+	MsgTimeMeanAvg  float64 `json:"msg_time_mean_avg"` // nanoseconds
+	MsgTimeMeanStd  float64 `json:"msg_time_mean_std"` // nanoseconds
+	MsgTimeMean     float64 `json:"msg_time_mean"`     // nanoseconds, every message weighs the same
+	MsgTimeStd      float64 `json:"msg_time_std"`      // nanoseconds, every message weighs the same
+	TotalMsgsPerSec float64 `json:"total_msgs_per_sec"`
+	AvgMsgsPerSec   float64 `json:"avg_msgs_per_sec"`
+	MsgsPerSec      float64 `json:"msgs_per_sec"` // over the window from the first to the last measured message of any client
+	WindowTime      float64 `json:"window_time"`  // seconds
+	RateCV          float64 `json:"rate_cv"`
+	Duplicates      int64   `json:"duplicates"` // messages received beyond the count, see DuplicateDeliveries
+	Takeovers       int64   `json:"takeovers"`
+	Lost            int64   `json:"lost"`         // messages missing from the MessageId sequences of the publishers
+	OutOfOrder      int64   `json:"out_of_order"` // messages received after a later message of the same publisher
+	Gaps            int64   `json:"gaps"`         // jumps in the MessageId sequences of the publishers
+	Disconnects     int64   `json:"disconnects"`
+	Truncated       bool    `json:"truncated,omitempty"` // any client was truncated
+	FailedClients   []int   `json:"failed_clients,omitempty"`
+	RunIDMismatches int64   `json:"run_id_mismatches,omitempty"`
+	Oversize        int64   `json:"oversize,omitempty"`
+	Malformed       int64   `json:"malformed,omitempty"`
+	Corrupted       int64   `json:"corrupted,omitempty"`
+	DroppedInternal int64   `json:"dropped_internal,omitempty"`
+	LargestPacket   int64   `json:"largest_packet,omitempty"` // bytes
+	WarmupMessages  int64   `json:"warmup_messages,omitempty"`
+	LateArrivals    *int64  `json:"late_arrivals,omitempty"`    // messages received within -cooldown after the client completed
+	PublishersReady float64 `json:"publishers_ready,omitempty"` // nanoseconds since the start of the run
+	StartedAfter    float64 `json:"started_after,omitempty"`    // nanoseconds since the start of the run until the start message
+	QueueDepth      float64 `json:"queue_depth"`                // messages
+
+	DuplicateDeliveries int64 `json:"duplicate_deliveries"` // messages received again with the same publisher and MessageId
+	MaxDisplacement     int64 `json:"max_displacement"`     // of the out-of-order messages of any client
+
+	// payload sizes of the measured messages, the rates in megabytes (10^6 bytes) per second like the message rates
+	BytesReceived  int64   `json:"bytes_received"`
+	AvgPayloadSize float64 `json:"avg_payload_size"` // bytes
+	TotalMBPerSec  float64 `json:"total_mb_per_sec"`
+	MBPerSec       float64 `json:"mb_per_sec"` // over the window from the first to the last measured message of any client
+
+	// with -batch-mode the messages are batches of records, which are measured and counted individually
+	Batches         int64   `json:"batches,omitempty"`
+	RecordsPerBatch float64 `json:"records_per_batch,omitempty"`
+
+	QoSDowngrades int           `json:"qos_downgrades,omitempty"` // clients granted a lower QoS than subscribed with, or refused
+	DeliveredQoS  map[int]int64 `json:"delivered_qos,omitempty"`
+	QoSMismatches int64         `json:"qos_mismatches,omitempty"`
+	OutOfOrderQoS map[int]int64 `json:"out_of_order_qos,omitempty"`
+
+	// connect and subscribe times in nanoseconds over the clients that connected and subscribed
+	ConnectTimeMin    float64 `json:"connect_time_min"`
+	ConnectTimeMean   float64 `json:"connect_time_mean"`
+	ConnectTimeMax    float64 `json:"connect_time_max"`
+	SubscribeTimeMin  float64 `json:"subscribe_time_min"`
+	SubscribeTimeMean float64 `json:"subscribe_time_mean"`
+	SubscribeTimeMax  float64 `json:"subscribe_time_max"`
+
+	Interface    *InterfaceResults    `json:"interface,omitempty"`
+	FDs          *FDResults           `json:"fds,omitempty"`
+	Self         *SelfResults         `json:"self,omitempty"`
+	TLSSessions  *TLSSessionResults   `json:"tls_sessions,omitempty"`
+	Clock        *ClockResults        `json:"clock,omitempty"`
+	Container    *ContainerResults    `json:"container,omitempty"`
+	TCPInfo      *TCPInfoResults      `json:"tcp_info,omitempty"`
+	Failover     *FailoverResults     `json:"failover,omitempty"`
+	Reconnect    *ReconnectResults    `json:"reconnect,omitempty"`
+	OfflineQueue *OfflineQueueResults `json:"offline_queue,omitempty"`
+	LateJoin     *LateJoinResults     `json:"late_join,omitempty"`
+	Retained     *RetainedResults     `json:"retained,omitempty"`
+	Resubscribe  *ResubscribeResults  `json:"resubscribe,omitempty"`
+	Expiry       *ExpiryResults       `json:"expiry,omitempty"`
+	Chaos        *ChaosResults        `json:"chaos,omitempty"`
+	Compression  *CompressionResults  `json:"compression,omitempty"`
+	ExactlyOnce  *ExactlyOnceResults  `json:"exactly_once,omitempty"`
+	Probe        *ProbeResults        `json:"probe,omitempty"`
+	Connect      *ConnectTotalResults `json:"connect,omitempty"`
+	QoS2         *QoS2Results         `json:"qos2,omitempty"`
+	SharedGroup  *SharedGroupResults  `json:"shared_group,omitempty"`
+	RampUp       *RampUpResults       `json:"ramp_up,omitempty"`
+
+	InterArrival *InterArrivalResults `json:"inter_arrival,omitempty"`
+	Jitter       *JitterResults       `json:"jitter,omitempty"`
+	Anomalies    *AnomalyResults      `json:"anomalies,omitempty"`
+	Stalls       *StallResults        `json:"stalls,omitempty"`
+
+	BrokerLatency *BrokerLatencyResults `json:"broker_latency,omitempty"`
+	FlowControl   *FlowControlResults   `json:"flow_control,omitempty"`
+	DecodeWorkers *DecodeWorkerResults  `json:"decode_workers,omitempty"`
+
+	// AddressFamilies counts the clients per address family (ipv4, ipv6)
+	AddressFamilies map[string]int `json:"address_families,omitempty"`
+
+	LatencySeries []*LatencySample  `json:"latency_series,omitempty"`
+	Publishers    []*PublisherCount `json:"publishers,omitempty"`
+	Topics        []*TopicResults   `json:"topics,omitempty"`
+
+	Subscriptions []*SubscriptionResults `json:"subscriptions,omitempty"` // only with several topics
+
+	Percentiles      []*Percentile      `json:"percentiles,omitempty"`
+	LatencyHistogram *LatencyHistogram  `json:"latency_histogram,omitempty"`
+	Confidence       *ConfidenceResults `json:"confidence,omitempty"`
+	Apdex            *ApdexResults      `json:"apdex,omitempty"`
+}
+
+// JSONResults are used to export results as a JSON document
+type JSONResults struct {
+	SchemaVersion int               `json:"schema_version"`
+	RunID         string            `json:"run_id,omitempty"`
+	Seed          int64             `json:"seed"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Runs          []*RunResults     `json:"runs"`
+	Totals        *TotalResults     `json:"totals"`
+	Nodes         []*NodeResults    `json:"nodes,omitempty"`
+	Workers       []*WorkerResults  `json:"workers,omitempty"`
+	Tenants       []*TenantResults  `json:"tenants,omitempty"`
+	Groups        []*GroupResults   `json:"groups,omitempty"`
+	QoS           []*QoSResults     `json:"qos,omitempty"`
+	Config        *ConfigResults    `json:"config,omitempty"`
+	Thresholds    *ThresholdResults `json:"thresholds,omitempty"`
+	Baseline      *BaselineResults  `json:"baseline,omitempty"`
+}
+
+// ConfigResults records how and where the results were produced: the tool version, the host, the
+// command line and the effective value of every flag (secrets redacted), the broker, and when the run
+// started and ended
+type ConfigResults struct {
+	Version    string            `json:"version"`
+	GoVersion  string            `json:"go_version"`
+	Hostname   string            `json:"hostname"`
+	Host       *HostResults      `json:"host,omitempty"`
+	Broker     string            `json:"broker"` // password redacted
+	Args       []string          `json:"args"`
+	Flags      map[string]string `json:"flags"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	MQTT       *MQTTSettings     `json:"mqtt,omitempty"`
+}
+
+// HostResults describes the host the subscriber ran on, Kernel is the kernel release on Linux
+type HostResults struct {
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	CPUs       int    `json:"cpus"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	Kernel     string `json:"kernel,omitempty"`
+}
+
+// MQTTSettings are the effective client-side settings of the MQTT client library, its defaults included,
+// durations in nanoseconds (0 write timeout and max inflight are unlimited)
+type MQTTSettings struct {
+	KeepAlive           float64 `json:"keep_alive"`
+	PingTimeout         float64 `json:"ping_timeout"`
+	WriteTimeout        float64 `json:"write_timeout"`
+	MessageChannelDepth uint    `json:"message_channel_depth"`
+	MaxInflight         int     `json:"max_inflight"`
+	ReceiveMaximum      int     `json:"receive_maximum,omitempty"`
+	Order               bool    `json:"order"`
+	NativeClient        bool    `json:"native_client"` // the built-in MQTT client instead of paho
+
+	Subscription *SubscriptionOptions `json:"subscription,omitempty"`
+}
+
+// SubscriptionOptions are the MQTT 5.0 options the clients subscribed with, with MQTT 3.1.1 those of its
+// SUBSCRIBE: RetainHandling 0 and no Subscription Identifier
+type SubscriptionOptions struct {
+	NoLocal           bool `json:"no_local"`
+	RetainAsPublished bool `json:"retain_as_published"`
+	RetainHandling    int  `json:"retain_handling"`
+	SubscriptionID    int  `json:"subscription_id,omitempty"`
+}
+
+// NodeResults describes results of all clients connected to a single broker node
+type NodeResults struct {
+	Broker  string `json:"broker"`
+	Clients int    `json:"clients"`
+	*TotalResults
+}
+
+// WorkerResults describes results of all clients of a single worker of a distributed run, the IDs of
+// its clients in the merged runs start at IDOffset
+type WorkerResults struct {
+	Worker   string `json:"worker"`
+	Index    int    `json:"index"`
+	Clients  int    `json:"clients"`
+	IDOffset int    `json:"id_offset"`
+	*TotalResults
+}
+
+// GroupResults describes results of all clients of a single client group
+type GroupResults struct {
+	Group   string `json:"group"`
+	Clients int    `json:"clients"`
+	*TotalResults
+}
+
+// TenantResults describes results of all clients of a single tenant
+type TenantResults struct {
+	Tenant  string `json:"tenant"`
+	Clients int    `json:"clients"`
+	*TotalResults
+}
+
+// QoSResults describes results of all clients subscribed with a single QoS level
+type QoSResults struct {
+	QoS     byte `json:"qos"`
+	Clients int  `json:"clients"`
+	*TotalResults
+}
@@ -0,0 +1,26 @@
+package results
+
+// RawSamples is the document written by -samples-file: the receive time and latency of every measured
+// message, from which the replay subcommand calculates the results again with other reporting options
+type RawSamples struct {
+	SchemaVersion int               `json:"schema_version"`
+	RunID         string            `json:"run_id,omitempty"`
+	Seed          int64             `json:"seed"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Start         int64             `json:"start"` // unix nanoseconds
+	// of a checkpoint: when it was written (unix nanoseconds) and how long the run was interrupted before
+	// it was resumed (nanoseconds)
+	CheckpointedAt int64            `json:"checkpointed_at,omitempty"`
+	Interrupted    int64            `json:"interrupted,omitempty"`
+	Clients        []*ClientSamples `json:"clients"`
+}
+
+// ClientSamples holds the samples of a single client in the order they were received
+type ClientSamples struct {
+	ID         int       `json:"id"`
+	Broker     string    `json:"broker,omitempty"`
+	Tenant     string    `json:"tenant,omitempty"`
+	QoS        byte      `json:"qos"`
+	ReceivedAt []int64   `json:"received_at"` // unix nanoseconds
+	Latencies  []float64 `json:"latencies"`   // nanoseconds
+}
@@ -0,0 +1,592 @@
+package results
+
+// Percentile is a latency percentile (0 < Percentile <= 100), the latency in nanoseconds
+type Percentile struct {
+	Percentile float64 `json:"percentile"`
+	Latency    float64 `json:"latency"`
+}
+
+// LatencyHistogram counts the measured latencies in the buckets of -hist-buckets: a latency is counted in
+// the first bucket whose upper bound it does not exceed (to the 0.2% resolution of the histogram the
+// percentiles are estimated from), Overflow counts the latencies above the highest bound
+type LatencyHistogram struct {
+	Buckets  []*HistogramBucket `json:"buckets"`
+	Overflow int64              `json:"overflow"`
+}
+
+// HistogramBucket counts the latencies above the bound of the previous bucket up to Le, in nanoseconds
+type HistogramBucket struct {
+	Le    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// ConfidenceResults holds bootstrap confidence intervals for the mean and p99 latency, in nanoseconds
+type ConfidenceResults struct {
+	Level     float64 `json:"level"`
+	Resamples int     `json:"resamples"`
+	MeanLow   float64 `json:"mean_low"`
+	MeanHigh  float64 `json:"mean_high"`
+	P99Low    float64 `json:"p99_low"`
+	P99High   float64 `json:"p99_high"`
+}
+
+// ApdexResults holds the Apdex score of the message latencies and the counts it is based on
+type ApdexResults struct {
+	Score      float64 `json:"score"`
+	Satisfied  int64   `json:"satisfied"`
+	Tolerating int64   `json:"tolerating"`
+	Frustrated int64   `json:"frustrated"`
+}
+
+// TCPInfoResults summarizes the TCP_INFO samples of a client, durations in nanoseconds
+type TCPInfoResults struct {
+	Samples     int     `json:"samples"`
+	RTTMin      float64 `json:"rtt_min"`
+	RTTMax      float64 `json:"rtt_max"`
+	RTTMean     float64 `json:"rtt_mean"`
+	RTTVarMax   float64 `json:"rtt_var_max"`
+	Retransmits uint64  `json:"retransmits"`
+}
+
+// FailoverResults describes how clients failed over to the standby broker, durations in nanoseconds
+type FailoverResults struct {
+	Failovers        int     `json:"failovers"`
+	ReconnectTime    float64 `json:"reconnect_time"`
+	ReconnectTimeMax float64 `json:"reconnect_time_max"`
+	ResumeTime       float64 `json:"resume_time"`
+	ResumeTimeMax    float64 `json:"resume_time_max"`
+	MissedMessages   int64   `json:"missed_messages"`
+}
+
+// ReconnectResults describes the connection losses of a client and the automatic reconnects after them,
+// durations in nanoseconds. Downtime is the total time disconnected; Attempts counts the connection attempts
+// of the reconnects and is only measured when the connections go through the dialer (e.g. -connect-timing).
+type ReconnectResults struct {
+	ConnectionLosses int64   `json:"connection_losses"`
+	Reconnects       int64   `json:"reconnects"`
+	Attempts         int64   `json:"attempts,omitempty"`
+	ReconnectTime    float64 `json:"reconnect_time"`
+	ReconnectTimeMax float64 `json:"reconnect_time_max"`
+	Downtime         float64 `json:"downtime"`
+	MissedMessages   int64   `json:"missed_messages"`
+}
+
+// ChaosResults describes the recovery of the clients whose connection was dropped on purpose without a
+// DISCONNECT (-chaos-fraction), durations in nanoseconds since the drop. Over all clients the durations are
+// the mean and max over the clients that reconnected or recovered.
+type ChaosResults struct {
+	Clients          int     `json:"clients"`
+	Recovered        int     `json:"recovered"`            // received messages again
+	DroppedAt        int64   `json:"dropped_at,omitempty"` // unix nanoseconds, per client only
+	ReconnectTime    float64 `json:"reconnect_time"`       // until the CONNACK
+	ReconnectTimeMax float64 `json:"reconnect_time_max"`
+	RecoveryTime     float64 `json:"recovery_time"` // until the first message after the reconnect
+	RecoveryTimeMax  float64 `json:"recovery_time_max"`
+	Redelivered      int64   `json:"redelivered"` // messages received with the DUP flag after the drop
+}
+
+// CompressionResults compares the payload bytes received, compressed with Codec, with the bytes after
+// decompressing them. Ratio is decompressed by compressed bytes and MBPerSec the decompressed throughput.
+type CompressionResults struct {
+	Codec             string  `json:"codec"`
+	BytesDecompressed int64   `json:"bytes_decompressed"`
+	Ratio             float64 `json:"ratio"`
+	MBPerSec          float64 `json:"mb_per_sec"`
+	Failed            int64   `json:"failed"` // payloads that could not be decompressed, counted as malformed too
+}
+
+// OfflineQueueResults describes how the broker delivered the messages queued while a client was offline,
+// durations in nanoseconds
+type OfflineQueueResults struct {
+	OfflineTime       float64 `json:"offline_time"`
+	QueuedMessages    int64   `json:"queued_messages"`
+	DrainTime         float64 `json:"drain_time"`
+	DrainRate         float64 `json:"drain_rate"`
+	QueuedLatencyMin  float64 `json:"queued_latency_min"`
+	QueuedLatencyMax  float64 `json:"queued_latency_max"`
+	QueuedLatencyMean float64 `json:"queued_latency_mean"`
+	QueuedLatencyStd  float64 `json:"queued_latency_std"`
+}
+
+// LateJoinResults describes how a client that subscribed mid-run caught up, durations in nanoseconds
+type LateJoinResults struct {
+	JoinDelay             float64 `json:"join_delay"`
+	TimeToFirstMessage    float64 `json:"time_to_first_message"`
+	TimeToFirstMessageMax float64 `json:"time_to_first_message_max"`
+	RetainedMessages      int64   `json:"retained_messages"`
+	BacklogMessages       int64   `json:"backlog_messages"`
+	CatchUpTime           float64 `json:"catch_up_time"`
+}
+
+// RetainedResults describes the delivery of retained messages after subscribing, durations in nanoseconds
+// from the first SUBSCRIBE
+type RetainedResults struct {
+	RetainedMessages        int64   `json:"retained_messages"`
+	LiveMessages            int64   `json:"live_messages"`
+	TimeToFirstRetained     float64 `json:"time_to_first_retained"`
+	TimeToFirstRetainedMax  float64 `json:"time_to_first_retained_max"`
+	RetainedDeliveryTime    float64 `json:"retained_delivery_time"` // until the last retained message
+	RetainedDeliveryTimeMax float64 `json:"retained_delivery_time_max"`
+}
+
+// ResubscribeResults describes the unsubscribe/resubscribe cycles of a client, durations in nanoseconds. Unsuback
+// and Suback are the distributions of the UNSUBACK and SUBACK latencies of the cycles.
+type ResubscribeResults struct {
+	Cycles             int                `json:"cycles"`
+	UnsubscribeTime    float64            `json:"unsubscribe_time"`
+	ResubscribeTime    float64            `json:"resubscribe_time"`
+	ResubscribeTimeMax float64            `json:"resubscribe_time_max"`
+	Unsuback           *PhaseDistribution `json:"unsuback,omitempty"`
+	Suback             *PhaseDistribution `json:"suback,omitempty"`
+	MissedMessages     int64              `json:"missed_messages"`
+
+	// the latencies of all cycles, not part of the JSON results
+	UnsubscribeTimes []float64 `json:"-"`
+	ResubscribeTimes []float64 `json:"-"`
+}
+
+// ExpiryResults describes the delivery of messages published with an expiry interval, remaining expiry in nanoseconds.
+// With MQTT 5.0 the expiry is the message expiry interval property the broker delivered, MQTT 3.1.1 has no
+// such property, so publishers have to mirror the expiry interval they set in the payload (ExpiryInterval, in
+// seconds like MQTT 5), which is preferred as it is not rounded to seconds. Dropped estimates the lost
+// messages the broker dropped because they expired, it is 0 for shared subscriptions.
+type ExpiryResults struct {
+	Messages      int64   `json:"messages"`
+	Expired       int64   `json:"expired"`
+	Dropped       int64   `json:"dropped"`
+	RemainingMin  float64 `json:"remaining_min"`
+	RemainingMax  float64 `json:"remaining_max"`
+	RemainingMean float64 `json:"remaining_mean"`
+}
+
+// SharedGroupResults describes how evenly the broker balanced the messages of a shared subscription
+// over the clients of the group. Fairness is Jain's index of the messages per client, 1 if all clients
+// received the same number of messages and 1/clients if a single client received all of them.
+type SharedGroupResults struct {
+	Group         string  `json:"group"`
+	Clients       int     `json:"clients"`
+	Messages      int64   `json:"messages"`
+	MinPerClient  int64   `json:"min_per_client"`
+	MaxPerClient  int64   `json:"max_per_client"`
+	MeanPerClient float64 `json:"mean_per_client"`
+	StdPerClient  float64 `json:"std_per_client"`
+	Fairness      float64 `json:"fairness"`
+}
+
+// RampUpResults describes the connect phase of clients connecting staggered over the ramp-up, from the
+// start of the run until the last client received its SUBACK, and the receive phase after it. Durations
+// are in nanoseconds, FirstSubscribed and LastSubscribed since the start of the run.
+type RampUpResults struct {
+	Planned         float64 `json:"planned"`
+	Clients         int     `json:"clients"`
+	Subscribed      int     `json:"subscribed"`
+	FirstSubscribed float64 `json:"first_subscribed"`
+	LastSubscribed  float64 `json:"last_subscribed"`
+	ReceivePhase    float64 `json:"receive_phase"`
+}
+
+// ThresholdResults is the verdict of a run against the thresholds (-max-p99-ms, -min-msgs-per-sec,
+// -max-loss-ratio, -max-duplicates, -max-regression-pct), a run that did not pass exits with a non-zero code.
+// Checked lists the thresholds that were set, by the names of their failures.
+type ThresholdResults struct {
+	Passed   bool                `json:"passed"`
+	Checked  []string            `json:"checked,omitempty"`
+	Failures []*ThresholdFailure `json:"failures,omitempty"`
+}
+
+// ThresholdFailure describes an objective that was not met: the threshold by its flag name in snake_case,
+// its limit and the measured value in the unit of the flag
+type ThresholdFailure struct {
+	Threshold string  `json:"threshold"`
+	Limit     float64 `json:"limit"`
+	Value     float64 `json:"value"`
+	Message   string  `json:"message"`
+}
+
+// BaselineResults compares the run with the results of a previous run (-baseline), e.g. of another broker
+// version. Regressions lists the metrics that got worse by more than -max-regression-pct, a run with
+// regressions fails like a run that did not meet its thresholds.
+type BaselineResults struct {
+	File        string              `json:"file"`
+	RunID       string              `json:"run_id,omitempty"`
+	Metrics     []*BaselineMetric   `json:"metrics"`
+	Regressions []*ThresholdFailure `json:"regressions,omitempty"`
+}
+
+// BaselineMetric is a metric of the baseline and of the run, latencies in milliseconds. Change is the delta
+// in percent of the baseline value, nil if that is 0.
+type BaselineMetric struct {
+	Metric   string   `json:"metric"`
+	Baseline float64  `json:"baseline"`
+	Current  float64  `json:"current"`
+	Delta    float64  `json:"delta"`
+	Change   *float64 `json:"change_pct,omitempty"`
+}
+
+// PublisherCount describes how many distinct messages of a single publisher were received vs expected
+type PublisherCount struct {
+	ClientID int   `json:"client_id"`
+	Received int64 `json:"received"`
+	Expected int64 `json:"expected"`
+	Missing  int64 `json:"missing"`
+}
+
+// TopicResults describes the messages received on a single concrete topic, latencies in nanoseconds
+type TopicResults struct {
+	Topic         string  `json:"topic"`
+	Messages      int64   `json:"messages"`
+	MsgsPerSec    float64 `json:"msgs_per_sec"`
+	MsgTimeMin    float64 `json:"msg_time_min"`
+	MsgTimeMax    float64 `json:"msg_time_max"`
+	MsgTimeMean   float64 `json:"msg_time_mean"`
+	MsgTimeStd    float64 `json:"msg_time_std"`
+	FirstReceived int64   `json:"first_received"` // unix nanoseconds
+	LastReceived  int64   `json:"last_received"`  // unix nanoseconds
+}
+
+// SubscriptionResults counts the measured messages received through a topic filter of a client subscribed to
+// several topics
+type SubscriptionResults struct {
+	Topic      string `json:"topic"`
+	QoS        byte   `json:"qos"`
+	GrantedQoS *int   `json:"granted_qos,omitempty"` // in the (last) SUBACK, 128 if refused
+	Messages   int64  `json:"messages"`
+}
+
+// MissingIDs lists the MessageIds of a single publisher that were not received, as ranges [first, last]
+// of consecutive ids
+type MissingIDs struct {
+	ClientID int      `json:"client_id"`
+	Ranges   [][2]int `json:"ranges"`
+}
+
+// DuplicateIDs lists the MessageIds of a single publisher that were received more than once, as ranges
+// [first, last] of consecutive ids
+type DuplicateIDs struct {
+	ClientID int      `json:"client_id"`
+	Ranges   [][2]int `json:"ranges"`
+}
+
+// ExactlyOnceResults is the exactly-once verdict of a QoS 2 run (-exactly-once): whether every MessageId in
+// [FirstID, LastID] of every publisher ClientId was received exactly once. Expected is the number of messages
+// of the publishers that were observed, Duplicated the MessageIds received more than once and Unexpected the
+// messages with a MessageId outside the range, which do not fail the verdict. The totals leave out the ids.
+type ExactlyOnceResults struct {
+	Passed        bool            `json:"passed"`
+	FirstID       int             `json:"first_id"`
+	LastID        int             `json:"last_id"`
+	Publishers    int             `json:"publishers"`
+	Expected      int64           `json:"expected"`
+	Missing       int64           `json:"missing"`
+	Duplicated    int64           `json:"duplicated"`
+	Unexpected    int64           `json:"unexpected"`
+	FailedClients int             `json:"failed_clients,omitempty"` // totals only
+	MissingIDs    []*MissingIDs   `json:"missing_ids,omitempty"`
+	DuplicateIDs  []*DuplicateIDs `json:"duplicate_ids,omitempty"`
+}
+
+// InterfaceResults describes interface-level traffic received during the run
+type InterfaceResults struct {
+	Name            string  `json:"name"`
+	RxBytes         uint64  `json:"rx_bytes"`
+	RxPackets       uint64  `json:"rx_packets"`
+	RxBytesPerSec   float64 `json:"rx_bytes_per_sec"`
+	RxPacketsPerSec float64 `json:"rx_packets_per_sec"`
+}
+
+// ContainerResults describes the resource limits of the container (cgroup) the subscriber ran in and the CPU
+// throttling during the run, limits are 0 if unlimited, memory in bytes and the throttled time in nanoseconds.
+// MemoryPeak is the peak memory usage of the cgroup, 0 if the kernel does not report it.
+type ContainerResults struct {
+	CgroupVersion    int     `json:"cgroup_version"`
+	CPULimit         float64 `json:"cpu_limit"` // cores
+	MemoryLimit      int64   `json:"memory_limit"`
+	MemoryPeak       int64   `json:"memory_peak,omitempty"`
+	Periods          int64   `json:"periods"`
+	ThrottledPeriods int64   `json:"throttled_periods"`
+	ThrottledTime    float64 `json:"throttled_time"`
+	ThrottledRatio   float64 `json:"throttled_ratio"`
+}
+
+// SelfResults describes the resources the subscriber itself used during the run, to tell whether it was the
+// bottleneck: its user and system CPU time and the mean number of cores busy, the peak heap, the memory
+// obtained from the OS and the bytes allocated (in bytes), and the GC cycles and their pauses (the longest
+// of the last 256 cycles), durations in nanoseconds
+type SelfResults struct {
+	CPUUser        float64 `json:"cpu_user"`
+	CPUSystem      float64 `json:"cpu_system"`
+	CPUCores       float64 `json:"cpu_cores"`
+	HeapPeak       uint64  `json:"heap_peak"`
+	SysMemory      uint64  `json:"sys_memory"`
+	Allocated      uint64  `json:"allocated"`
+	GoroutinesPeak int     `json:"goroutines_peak"`
+	GCCycles       uint32  `json:"gc_cycles"`
+	GCPauseTotal   float64 `json:"gc_pause_total"`
+	GCPauseMax     float64 `json:"gc_pause_max"`
+}
+
+// FDResults describes file descriptor usage during the run
+type FDResults struct {
+	Limit uint64 `json:"limit"`
+	Peak  int    `json:"peak"`
+}
+
+// ConnectResults describes the phases of a client's first connection to the broker, durations in nanoseconds.
+// DNS is the broker host lookup, TCP the TCP connect, TLS the TLS handshake (0 without TLS) and MQTT the
+// CONNECT/CONNACK exchange. Total runs from the start of the connection attempt up to the CONNACK.
+type ConnectResults struct {
+	DNS   float64 `json:"dns"`
+	TCP   float64 `json:"tcp"`
+	TLS   float64 `json:"tls"`
+	MQTT  float64 `json:"mqtt"`
+	Total float64 `json:"total"`
+}
+
+// PhaseDistribution describes the distribution of a connection phase over all clients, durations in nanoseconds
+type PhaseDistribution struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// ConnectTotalResults describes the connection phases of all clients
+type ConnectTotalResults struct {
+	Clients int                `json:"clients"`
+	DNS     *PhaseDistribution `json:"dns"`
+	TCP     *PhaseDistribution `json:"tcp"`
+	TLS     *PhaseDistribution `json:"tls"`
+	MQTT    *PhaseDistribution `json:"mqtt"`
+	Total   *PhaseDistribution `json:"total"`
+}
+
+// QoS2Results describes the QoS 2 exchanges of the received messages, durations in nanoseconds. PubRec runs
+// from receiving the PUBLISH up to sending the PUBREC, PubRel from the PUBREC up to receiving the PUBREL (the
+// broker's part of the exchange) and PubComp from the PUBREL up to sending the PUBCOMP. Total spans the exchange.
+type QoS2Results struct {
+	Exchanges  int64              `json:"exchanges"`
+	Incomplete int64              `json:"incomplete"` // exchanges without PUBCOMP at the end of the run
+	PubRec     *PhaseDistribution `json:"pubrec"`
+	PubRel     *PhaseDistribution `json:"pubrel"`
+	PubComp    *PhaseDistribution `json:"pubcomp"`
+	Total      *PhaseDistribution `json:"total"`
+
+	// the durations of all exchanges, not part of the JSON results
+	PubRecTimes  []float64 `json:"-"`
+	PubRelTimes  []float64 `json:"-"`
+	PubCompTimes []float64 `json:"-"`
+	TotalTimes   []float64 `json:"-"`
+}
+
+// ClockResults describes the clock the receive timestamps were taken with and how the local clock drifted
+// over the run, durations in nanoseconds. Divergence is how far the wall clock moved apart from the
+// monotonic clock (steps and slewing of the system clock), Drift the change of the offset to the NTP server.
+// Offset is the clock skew compensation added to the receive timestamps.
+type ClockResults struct {
+	Source         string  `json:"source"`
+	Divergence     float64 `json:"divergence"`
+	Offset         float64 `json:"offset,omitempty"`
+	NTPServer      string  `json:"ntp_server,omitempty"`
+	NTPOffsetStart float64 `json:"ntp_offset_start,omitempty"`
+	NTPOffsetEnd   float64 `json:"ntp_offset_end,omitempty"`
+	Drift          float64 `json:"drift,omitempty"`
+	DriftPPM       float64 `json:"drift_ppm,omitempty"`
+}
+
+// TLSSessionResults describes the use of the TLS session cache shared by the clients. A resumed session
+// is a handshake the cached session was offered in, the broker may still decide to do a full handshake.
+type TLSSessionResults struct {
+	Handshakes     int64   `json:"handshakes"`
+	Resumed        int64   `json:"resumed"`
+	ResumptionRate float64 `json:"resumption_rate"`
+}
+
+// ProbeSample is a single subscribe/unsubscribe round trip of the probe, time in seconds since the start
+// of the run, latencies in nanoseconds, connections is the number of benchmark clients connected at the time
+type ProbeSample struct {
+	Time            float64 `json:"time"`
+	Connections     int64   `json:"connections"`
+	SubackLatency   float64 `json:"suback_latency"`
+	UnsubackLatency float64 `json:"unsuback_latency"`
+}
+
+// ProbeResults describes the SUBACK/UNSUBACK latencies measured by the probe over the run,
+// latencies in nanoseconds, the trend is the change of the SUBACK latency in nanoseconds per second of the run
+type ProbeResults struct {
+	Samples      []ProbeSample `json:"samples"`
+	Errors       int           `json:"errors"`
+	SubackMin    float64       `json:"suback_min"`
+	SubackMax    float64       `json:"suback_max"`
+	SubackMean   float64       `json:"suback_mean"`
+	SubackStd    float64       `json:"suback_std"`
+	SubackTrend  float64       `json:"suback_trend"`
+	UnsubackMean float64       `json:"unsuback_mean"`
+}
+
+// InterArrivalResults characterizes the times between consecutive messages of the clients, in nanoseconds,
+// by fitting them to candidate distributions. The goodness of fit is the Kolmogorov-Smirnov statistic
+// (the largest distance between the observed and fitted distribution, lower is better); BestFit names
+// the distribution with the lowest statistic.
+type InterArrivalResults struct {
+	Samples     int             `json:"samples"`
+	Mean        float64         `json:"mean"`
+	Std         float64         `json:"std"`
+	CV          float64         `json:"cv"`
+	Exponential *ExponentialFit `json:"exponential,omitempty"`
+	Lognormal   *LognormalFit   `json:"lognormal,omitempty"`
+	BestFit     string          `json:"best_fit,omitempty"`
+}
+
+// JitterResults describes the smoothness of the delivery, in nanoseconds: the times between consecutive
+// measured messages and the jitter, the standard deviation of the differences between the latencies of
+// consecutive messages. Samples is the number of consecutive pairs.
+type JitterResults struct {
+	Samples          int64   `json:"samples"`
+	InterArrivalMin  float64 `json:"inter_arrival_min"`
+	InterArrivalMax  float64 `json:"inter_arrival_max"`
+	InterArrivalMean float64 `json:"inter_arrival_mean"`
+	InterArrivalStd  float64 `json:"inter_arrival_std"`
+	InterArrivalP99  float64 `json:"inter_arrival_p99"`
+	LatencyDeltaMean float64 `json:"latency_delta_mean"`
+	Jitter           float64 `json:"jitter"`
+
+	// InterArrivalHistogram counts the inter-arrival times like the latency histogram, to pool the
+	// percentile of the clients in the totals
+	InterArrivalHistogram map[int64]int64 `json:"-"`
+}
+
+// FlowControlResults describes how the receive window of the clients throttled the delivery, durations in
+// nanoseconds. With -max-inflight a message is throttled when it had to wait for a slot because the window was
+// full, holding back its acknowledgement and so the broker's next deliveries. With -receive-maximum the broker
+// holds back its deliveries while the window is full, the first message after a slot was freed is throttled,
+// its wait being the time since the window filled up. The mean latencies compare the messages measured while
+// the window was full with the others.
+type FlowControlResults struct {
+	Window           int     `json:"window"`
+	Messages         int64   `json:"messages"`
+	Throttled        int64   `json:"throttled"`
+	ThrottledRatio   float64 `json:"throttled_ratio"`
+	WaitMean         float64 `json:"wait_mean"`
+	WaitMax          float64 `json:"wait_max"`
+	MeasuredFull     int64   `json:"measured_full"`
+	LatencyFullMean  float64 `json:"latency_full_mean"`
+	MeasuredOther    int64   `json:"measured_other"`
+	LatencyOtherMean float64 `json:"latency_other_mean"`
+}
+
+// DecodeWorkerResults describes the decode workers of the clients (-decode-workers): the messages they
+// decoded, PerWorker by worker, and how often the message handler waited because their queue was full
+type DecodeWorkerResults struct {
+	Workers   int     `json:"workers"`
+	Messages  int64   `json:"messages"`
+	PerWorker []int64 `json:"per_worker,omitempty"`
+	QueueFull int64   `json:"queue_full"`
+}
+
+// LatencyComponent describes a part of the end-to-end latency of the messages, in nanoseconds
+type LatencyComponent struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	Std  float64 `json:"std"`
+	P50  float64 `json:"p50"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+
+	// Histogram counts the latencies like the latency histogram, to pool the percentiles of the clients in
+	// the totals
+	Histogram map[int64]int64 `json:"-"`
+}
+
+// BrokerLatencyResults splits the end-to-end latency at the time the broker or a bridge stamped the messages
+// with (-broker-timestamp-field): from the publisher to the broker and from the broker to the subscriber. The
+// components include the clock offsets between the hosts. Unstamped counts the measured messages without a
+// broker timestamp, which are left out.
+type BrokerLatencyResults struct {
+	Samples            int64             `json:"samples"`
+	Unstamped          int64             `json:"unstamped"`
+	PublisherToBroker  *LatencyComponent `json:"publisher_to_broker"`
+	BrokerToSubscriber *LatencyComponent `json:"broker_to_subscriber"`
+}
+
+// ExponentialFit is the exponential distribution (Poisson arrivals) fitted to the inter-arrival times,
+// the rate in messages per second
+type ExponentialFit struct {
+	Rate float64 `json:"rate"`
+	KS   float64 `json:"ks"`
+}
+
+// LognormalFit is the lognormal distribution fitted to the positive inter-arrival times, Mu and Sigma
+// are the mean and standard deviation of their natural logarithm (of nanoseconds)
+type LognormalFit struct {
+	Mu    float64 `json:"mu"`
+	Sigma float64 `json:"sigma"`
+	KS    float64 `json:"ks"`
+}
+
+// PayloadResults holds the first and last raw payloads a client received (including messages that were not
+// measured), for debugging unexpected publisher traffic
+type PayloadResults struct {
+	Received int64            `json:"received"`
+	First    []*PayloadSample `json:"first"`
+	Last     []*PayloadSample `json:"last,omitempty"`
+}
+
+// PayloadSample is a single raw payload, JSON payloads are kept as text and other payloads hex encoded
+type PayloadSample struct {
+	ReceivedAt int64  `json:"received_at"` // unix nanoseconds
+	Topic      string `json:"topic"`
+	Size       int    `json:"size"` // bytes
+	Encoding   string `json:"encoding"`
+	Payload    string `json:"payload"`
+}
+
+// AnomalyResults lists the latency spikes: messages whose latency exceeded a factor times the rolling median
+// latency of their client. Count is the number of spikes, at most 1000 are listed.
+type AnomalyResults struct {
+	Count     int64             `json:"count"`
+	Anomalies []*LatencyAnomaly `json:"anomalies"`
+}
+
+// LatencyAnomaly is a single latency spike, latencies in nanoseconds. Client is the subscribing client,
+// Publisher and MessageID identify the message.
+type LatencyAnomaly struct {
+	ReceivedAt int64   `json:"received_at"` // unix nanoseconds
+	Client     int     `json:"client"`
+	Publisher  int     `json:"publisher"`
+	MessageID  int     `json:"message_id"`
+	Latency    float64 `json:"latency"`
+	Median     float64 `json:"median"`
+}
+
+// StallResults describes the periods in which a client received no messages for longer than the stall
+// threshold, durations in nanoseconds. Count is the number of stalls, at most 1000 are listed; Clients is the
+// number of clients that stalled (totals only).
+type StallResults struct {
+	Count   int64    `json:"count"`
+	Stalled float64  `json:"stalled"` // total duration of the stalls
+	Longest float64  `json:"longest"`
+	Clients int      `json:"clients,omitempty"`
+	Stalls  []*Stall `json:"stalls"`
+}
+
+// Stall is a single period without messages of a client, from the last message before it, Ongoing if the
+// client stopped before receiving another message
+type Stall struct {
+	Client   int     `json:"client"`
+	Start    int64   `json:"start"` // unix nanoseconds
+	Duration float64 `json:"duration"`
+	Ongoing  bool    `json:"ongoing,omitempty"`
+}
+
+// LatencySample holds the throughput and latency quantiles of a single client or over all clients for a
+// single interval, elapsed in seconds since the start of the run, latencies in nanoseconds
+type LatencySample struct {
+	Elapsed    float64 `json:"elapsed"`
+	Received   int64   `json:"received"`
+	MsgsPerSec float64 `json:"msgs_per_sec"`
+	P50        float64 `json:"p50"`
+	P95        float64 `json:"p95"`
+	P99        float64 `json:"p99"`
+}